@@ -25,8 +25,10 @@ import (
 	"github.com/gcla/termshark/v2/pkg/cli"
 	"github.com/gcla/termshark/v2/pkg/confwatcher"
 	"github.com/gcla/termshark/v2/pkg/convs"
+	"github.com/gcla/termshark/v2/pkg/extcap"
 	"github.com/gcla/termshark/v2/pkg/fields"
 	"github.com/gcla/termshark/v2/pkg/pcap"
+	"github.com/gcla/termshark/v2/pkg/remote"
 	"github.com/gcla/termshark/v2/pkg/shark"
 	"github.com/gcla/termshark/v2/pkg/streams"
 	"github.com/gcla/termshark/v2/pkg/summary"
@@ -66,6 +68,7 @@ func main() {
 	wormhole.Goroutinewg = &ensureGoroutinesStopWG
 	summary.Goroutinewg = &ensureGoroutinesStopWG
 	confwatcher.Goroutinewg = &ensureGoroutinesStopWG
+	remote.Goroutinewg = &ensureGoroutinesStopWG
 
 	res := cmain()
 	ensureGoroutinesStopWG.Wait()
@@ -207,7 +210,20 @@ func cmain() int {
 	// not being run. The reason to do it after the CLI parsing logic is so that I have the correct
 	// config profile loaded, needed for the tshark command.
 	if os.Getenv("TERMSHARK_CAPTURE_MODE") == "1" {
-		err = system.DumpcapExt(termshark.DumpcapBin(), termshark.TSharkBin(), os.Args[1:]...)
+		args := os.Args[1:]
+		if os.Getenv(extcap.AnswersEnv) != "" {
+			var extcapCmd *exec.Cmd
+			args, extcapCmd, err = startExtcap(args)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				return 1
+			}
+			defer func() {
+				extcapCmd.Process.Kill()
+				extcapCmd.Wait()
+			}()
+		}
+		err = system.DumpcapExt(termshark.DumpcapBin(), termshark.TSharkBin(), args...)
 		if err != nil {
 			return 1
 		} else {
@@ -519,6 +535,10 @@ func cmain() int {
 			fmt.Fprintf(os.Stderr, "Cannot use a capture filter when reading from a pcap file - '%s' and '%s'.\n", captureFilter, pcapf)
 			return 1
 		}
+		if captureOptionsProvided(opts) {
+			fmt.Fprintf(os.Stderr, "Cannot use capture options (-s, -p, -B, -I, -y, --time-stamp-type) when reading from a pcap file.\n")
+			return 1
+		}
 		if argsFilter != "" {
 			if opts.DisplayFilter != "" {
 				fmt.Fprintf(os.Stderr, "Two display filters provided - '%s' and '%s' - please supply one only.\n", opts.DisplayFilter, argsFilter)
@@ -697,6 +717,35 @@ func cmain() int {
 		}
 	}
 
+	// Capture options provided on the command-line apply to this run only. They're added to
+	// any saved for the interface, but not saved themselves.
+	if captureOptionsProvided(opts) {
+		for _, psrc := range psrcs {
+			if psrc.IsInterface() {
+				copts := shark.GetCaptureOptions(psrc.Name())
+				if opts.Snaplen > 0 {
+					copts.Snaplen = opts.Snaplen
+				}
+				if opts.NoPromiscuous {
+					copts.NoPromiscuous = true
+				}
+				if opts.BufferSize > 0 {
+					copts.BufferSize = opts.BufferSize
+				}
+				if opts.MonitorMode {
+					copts.MonitorMode = true
+				}
+				if opts.LinkType != "" {
+					copts.LinkType = opts.LinkType
+				}
+				if opts.TimestampType != "" {
+					copts.TimestampType = opts.TimestampType
+				}
+				shark.SetSessionCaptureOptions(copts)
+			}
+		}
+	}
+
 	watcher, err := confwatcher.New()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Problem constructing config file watcher: %v", err)
@@ -773,8 +822,7 @@ func cmain() int {
 	}
 	tsharkArgs := profiles.ConfStringSlice("main.tshark-args", []string{})
 	if ui.PacketColors && !ui.PacketColorsSupported {
-		log.Warnf("Packet coloring is enabled, but %s does not support --color", tsharkBin)
-		ui.PacketColors = false
+		log.Warnf("Packet coloring is enabled, but %s does not support --color - termshark will apply coloring rules itself", tsharkBin)
 	}
 	cacheSize := profiles.ConfInt("main.pcap-cache-size", 64)
 	bundleSize := profiles.ConfInt("main.pcap-bundle-size", 1000)
@@ -877,7 +925,32 @@ func cmain() int {
 
 	appRunner := app.Runner()
 
-	pcap.PcapCmds = pcap.MakeCommands(opts.DecodeAs, tsharkArgs, pdmlArgs, psmlArgs, ui.PacketColors)
+	if opts.Script != "" {
+		script, err := filepath.Abs(string(opts.Script))
+		if err == nil {
+			_, err = os.Stat(script)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Could not read script %s: %v\n", opts.Script, err)
+			return 1
+		}
+		ui.SetStartupScript(script)
+	}
+
+	remoteSocket := opts.RemoteSocket
+	if remoteSocket == "" {
+		remoteSocket = profiles.ConfString("main.remote-socket", "")
+	}
+	if remoteSocket != "" {
+		srv, err := ui.StartRemoteControl(remoteSocket, app)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Could not listen for remote control on %s: %v\n", remoteSocket, err)
+			return 1
+		}
+		defer srv.Close()
+	}
+
+	pcap.PcapCmds = pcap.MakeCommands(opts.DecodeAs, tsharkArgs, pdmlArgs, psmlArgs, ui.PacketColors && ui.PacketColorsSupported)
 	pcap.PcapOpts = pcap.Options{
 		CacheSize:      cacheSize,
 		PacketsPerLoad: bundleSize,
@@ -886,6 +959,7 @@ func cmain() int {
 	// This is a global. The type supports swapping out the real loader by embedding it via
 	// pointer, but I assume this only happens in the main goroutine.
 	ui.Loader = &pcap.PacketLoader{ParentLoader: pcap.NewPcapLoader(pcap.PcapCmds, &pcap.Runner{app}, pcap.PcapOpts)}
+	ui.Loader.SetWatcher(ui.MakeWatchRulesMatcher(app))
 
 	// Populate the filter widget initially - runs asynchronously
 	go ui.FilterWidget.UpdateCompletions(app)
@@ -947,14 +1021,19 @@ func cmain() int {
 		validator.Validate(displayFilter)
 	} else {
 
-		// Verifies whether or not we will be able to read from the interface (hopefully)
+		// Verifies whether or not we will be able to read from the interface (hopefully). The
+		// capture filter is included so that a filter that doesn't compile is reported now.
 		ifaceExitCode = 0
 		for _, psrc := range psrcs {
 			if psrc.IsInterface() {
+				checkArgs := append([]string{"-i", psrc.Name()}, shark.GetCaptureOptions(psrc.Name()).Args()...)
+				if captureFilter != "" {
+					checkArgs = append(checkArgs, "-f", captureFilter)
+				}
 				if ifaceExitCode, ifaceErr = termshark.RunForStderr(
 					termshark.CaptureBin(),
-					[]string{"-i", psrc.Name(), "-a", "duration:1"},
-					append(os.Environ(), "TERMSHARK_CAPTURE_MODE=1"),
+					append(checkArgs, "-a", "duration:1"),
+					append(extcap.Environ([]string{psrc.Name()}), "TERMSHARK_CAPTURE_MODE=1"),
 					stderr,
 				); ifaceExitCode != 0 {
 					return 1
@@ -1205,6 +1284,10 @@ Loop:
 
 			ui.StartUIChan = nil // make sure it's not triggered again
 
+			app.Run(gowid.RunFunction(func(app gowid.IApp) {
+				ui.RunStartupScripts(app)
+			}))
+
 			if runtime.GOOS != "windows" {
 				if app.GetColorMode() == gowid.Mode8Colors {
 					// If exists is true, it means we already tried and then reverted back, so
@@ -1367,6 +1450,38 @@ Loop:
 	return 0
 }
 
+// captureOptionsProvided returns true if any of the per-interface capture options
+// were set on the command-line.
+func captureOptionsProvided(opts cli.Termshark) bool {
+	return opts.Snaplen > 0 || opts.NoPromiscuous || opts.BufferSize > 0 || opts.MonitorMode ||
+		opts.LinkType != "" || opts.TimestampType != ""
+}
+
+// startExtcap starts the configured extcap interface being captured, so that
+// its packets can be read on stdin, and returns the capture command's
+// arguments rewritten to read from there.
+func startExtcap(args []string) ([]string, *exec.Cmd, error) {
+	ifaces := make([]string, 0)
+	for i := 0; i < len(args)-1; i++ {
+		if args[i] == "-i" {
+			ifaces = append(ifaces, args[i+1])
+		}
+	}
+	if len(ifaces) != 1 {
+		return nil, nil, fmt.Errorf("A configured extcap interface must be captured on its own.")
+	}
+	intf, ok := extcap.Lookup(ifaces[0])
+	if !ok {
+		return nil, nil, fmt.Errorf("Could not find extcap interface %s.", ifaces[0])
+	}
+	newArgs, filter := extcap.RewriteCaptureArgs(args, ifaces[0])
+	cmd, err := extcap.Start(intf, extcap.EnvAnswers(ifaces[0]), filter)
+	if err != nil {
+		return nil, nil, err
+	}
+	return newArgs, cmd, nil
+}
+
 //======================================================================
 // Local Variables:
 // mode: Go
@@ -164,6 +164,10 @@ func ConfBool(name string, def ...bool) bool {
 	return confBool(vProfile, vDefault, name, def...)
 }
 
+func ConfBoolFrom(v *viper.Viper, vd *viper.Viper, name string, def ...bool) bool {
+	return confBool(v, vd, name, def...)
+}
+
 func confBool(v *viper.Viper, vd *viper.Viper, name string, def ...bool) bool {
 	confMutex.Lock()
 	defer confMutex.Unlock()
@@ -218,6 +222,21 @@ func profilesDir() (string, error) {
 	return filepath.Join(dirs[0].Path, "profiles"), nil
 }
 
+// Dir returns the directory holding the current profile's files. For the
+// default profile, this is termshark's config directory.
+func Dir() (string, error) {
+	if currentName == "" || currentName == "default" {
+		stdConf := configdir.New("", "termshark")
+		dirs := stdConf.QueryFolders(configdir.Global)
+		return dirs[0].Path, nil
+	}
+	dir, err := profilesDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, currentName), nil
+}
+
 func CopyToAndUse(name string) error {
 	if Default() == Current() {
 		vProfile = viper.New()
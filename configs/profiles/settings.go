@@ -0,0 +1,342 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+package profiles
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//======================================================================
+
+type SettingType int
+
+const (
+	BoolSetting SettingType = iota
+	IntSetting
+	StringSetting
+	StringListSetting
+)
+
+func (t SettingType) String() string {
+	switch t {
+	case BoolSetting:
+		return "bool"
+	case IntSetting:
+		return "int"
+	case StringSetting:
+		return "string"
+	default:
+		return "string list"
+	}
+}
+
+// Setting describes a key in the main section of termshark.toml that the user
+// can change with :set.
+type Setting struct {
+	Name        string // without the "main." prefix
+	Type        SettingType
+	Default     interface{} // bool, int, string or []string, depending on Type
+	Description string
+	Choices     []string // if not empty, the only values allowed (for each element of a list)
+	Min         *int     // for ints, the smallest value allowed
+	Restart     bool     // true if termshark only reads the value at startup
+	EditWith    string   // if not empty, where the value is changed; :set only shows it
+}
+
+func atLeast(i int) *int {
+	return &i
+}
+
+// Settings holds every user-configurable key, sorted by name. Keys with their
+// own editors, like main.color-rules, can be shown but not changed with :set.
+// Bookkeeping keys that termshark manages itself, like main.recent-files and
+// main.cmdline-history, are not included.
+//
+// A value changed with :set is used the next time termshark reads it, e.g.
+// when the next capture is loaded, unless the UI has a hook to apply it
+// straight away. Keys only read at startup are marked Restart.
+var Settings = []Setting{
+	{Name: "always-keep-pcap", Type: BoolSetting, Default: false,
+		Description: "Keep the pcap of a live capture without asking"},
+	{Name: "auto-scroll", Type: BoolSetting, Default: true,
+		Description: "Follow new packets during a live capture"},
+	{Name: "browse-command", Type: StringListSetting, Default: []string{},
+		Description: "Command run to open a URL in a browser"},
+	{Name: "capinfos", Type: StringSetting, Default: "capinfos",
+		Description: "Path to the capinfos binary"},
+	{Name: "capture-command", Type: StringSetting, Default: "",
+		Description: "Command run to capture packets (default is dumpcap, or termshark itself)"},
+	{Name: "capture-options", Type: StringListSetting, Default: []string{}, EditWith: "the capture-opts command",
+		Description: "Capture options saved for each interface e.g. snapshot length"},
+	{Name: "color-rules", Type: StringListSetting, Default: []string{}, EditWith: "the color-rules command",
+		Description: "Coloring rules, used instead of those of the linked Wireshark profile"},
+	{Name: "column-format", Type: StringListSetting, Default: []string{}, EditWith: "the columns command",
+		Description: "Columns of the packet list"},
+	{Name: "conv-absolute-time", Type: BoolSetting, Default: false,
+		Description: "Show absolute start times in the conversations view"},
+	{Name: "conv-resolve-names", Type: BoolSetting, Default: false,
+		Description: "Resolve names in the conversations view"},
+	{Name: "conv-types", Type: StringListSetting, Default: []string{"eth", "ip", "ipv6", "tcp", "udp"},
+		Choices:     []string{"eth", "ip", "ipv6", "tcp", "udp"},
+		Description: "Conversation types shown in the conversations view"},
+	{Name: "conv-use-filter", Type: BoolSetting, Default: false,
+		Description: "Limit the conversations view to packets matching the display filter"},
+	{Name: "copy-command", Type: StringListSetting, Default: []string{},
+		Description: "Command run to copy to the clipboard"},
+	{Name: "copy-command-timeout", Type: IntSetting, Default: 5, Min: atLeast(1),
+		Description: "Seconds to wait for the copy command to finish"},
+	{Name: "dark-mode", Type: BoolSetting, Default: true,
+		Description: "Use the dark version of the theme"},
+	{Name: "debug", Type: BoolSetting, Default: false, Restart: true,
+		Description: "Write debug output to the log and serve pprof"},
+	{Name: "decode-as", Type: StringListSetting, Default: []string{}, EditWith: "the decode-as command",
+		Description: "Decode As rules passed to tshark with -d"},
+	{Name: "disable-shark-fin", Type: BoolSetting, Default: false, Restart: true,
+		Description: "Turn off the shark-fin screensaver"},
+	{Name: "disable-term-helper", Type: BoolSetting, Default: false, Restart: true,
+		Description: "Don't switch TERM to a 256-color variant"},
+	{Name: "disk-cache-size-mb", Type: IntSetting, Default: -1, Min: atLeast(-1),
+		Description: "Size limit in MB of the pcap cache directory (-1 for no limit)"},
+	{Name: "dumpcap", Type: StringSetting, Default: "dumpcap",
+		Description: "Path to the dumpcap binary"},
+	{Name: "extcap-args", Type: StringListSetting, Default: []string{}, EditWith: "the extcap command",
+		Description: "Answers to the configuration questions of extcap interfaces"},
+	{Name: "filter-buttons", Type: StringListSetting, Default: []string{}, EditWith: "the filter-button command",
+		Description: "Display filter buttons, added to those of the linked Wireshark profile"},
+	{Name: "ignore-base16-colors", Type: BoolSetting, Default: false, Restart: true,
+		Description: "Use themes unchanged in 16-color terminals"},
+	{Name: "key-mappings", Type: StringListSetting, Default: []string{}, EditWith: "the map and unmap commands",
+		Description: "Key mappings"},
+	{Name: "layout", Type: StringSetting, Default: "mainview", Restart: true,
+		Choices:     []string{"altview1", "altview2", "mainview"},
+		Description: "Arrangement of the packet list, structure and hex views"},
+	{Name: "macros", Type: StringListSetting, Default: []string{}, EditWith: "q followed by a register",
+		Description: "Recorded macros"},
+	{Name: "packet-colors", Type: BoolSetting, Default: true,
+		Description: "Color packets in the packet list using the color rules"},
+	{Name: "pager", Type: StringSetting, Default: "",
+		Description: "Pager used to show logs and configuration"},
+	{Name: "pcap-bundle-size", Type: IntSetting, Default: 1000, Min: atLeast(1), Restart: true,
+		Description: "Number of packets loaded at a time for the structure and hex views"},
+	{Name: "pcap-cache-dir", Type: StringSetting, Default: "", Restart: true,
+		Description: "Directory for pcaps of live captures"},
+	{Name: "pcap-cache-size", Type: IntSetting, Default: 64, Min: atLeast(1), Restart: true,
+		Description: "Number of packet bundles cached"},
+	{Name: "pdml-args", Type: StringListSetting, Default: []string{}, Restart: true,
+		Description: "Extra arguments for tshark when generating PDML"},
+	{Name: "pref-overrides", Type: StringListSetting, Default: []string{}, EditWith: "the prefs command",
+		Description: "Wireshark preference values passed to tshark with -o"},
+	{Name: "psml-args", Type: StringListSetting, Default: []string{}, Restart: true,
+		Description: "Extra arguments for tshark when generating PSML"},
+	{Name: "record-macros", Type: BoolSetting, Default: false,
+		Description: "Make q followed by a register record a macro, instead of q opening the quit dialog"},
+	{Name: "remote-socket", Type: StringSetting, Default: "", Restart: true,
+		Description: "Unix socket to listen on for remote control"},
+	{Name: "respect-colorterm", Type: BoolSetting, Default: false, Restart: true,
+		Description: "Use truecolor if COLORTERM says the terminal supports it"},
+	{Name: "search-case-sensitive", Type: BoolSetting, Default: false,
+		Description: "Match case when searching for strings"},
+	{Name: "search-target", Type: StringSetting, Default: "list",
+		Choices:     []string{"bytes", "details", "list"},
+		Description: "Where to search for strings"},
+	{Name: "search-type", Type: StringSetting, Default: "filter",
+		Choices:     []string{"filter", "hex", "regex", "string"},
+		Description: "Type of search"},
+	{Name: "stream-cache-size", Type: IntSetting, Default: 100, Min: atLeast(1),
+		Description: "Number of stream chunks cached for display"},
+	{Name: "stream-view", Type: StringSetting, Default: "hex",
+		Choices:     []string{"ascii", "hex", "raw"},
+		Description: "How streams are displayed"},
+	{Name: "suppress-tshark-errors", Type: BoolSetting, Default: true,
+		Description: "Don't show tshark errors"},
+	{Name: "tail-command", Type: StringListSetting, Default: []string{},
+		Description: "Command run to tail a live capture's pcap"},
+	{Name: "term", Type: StringSetting, Default: "", Restart: true,
+		Description: "Terminal type to use instead of TERM"},
+	{Name: "tls-keylog-file", Type: StringSetting, Default: "",
+		Description: "TLS key log file used to decrypt TLS"},
+	{Name: "tls-keylog-from-env", Type: BoolSetting, Default: false,
+		Description: "Read the TLS key log file from SSLKEYLOGFILE"},
+	{Name: "tshark", Type: StringSetting, Default: "", Restart: true,
+		Description: "Path to the tshark binary"},
+	{Name: "tshark-args", Type: StringListSetting, Default: []string{}, Restart: true,
+		Description: "Extra arguments for every tshark invocation"},
+	{Name: "ui-cache-size", Type: IntSetting, Default: 1000, Min: atLeast(1), Restart: true,
+		Description: "Number of packet list rows cached for display"},
+	{Name: "use-tshark-temp-for-pcap-cache", Type: BoolSetting, Default: false, Restart: true,
+		Description: "Save live captures in tshark's temporary directory"},
+	{Name: "watch-rules", Type: StringListSetting, Default: []string{}, EditWith: "the watch command",
+		Description: "Display filters checked against each packet of a live capture"},
+	{Name: "wireshark-profile", Type: StringSetting, Default: "",
+		Description: "Wireshark profile whose configuration tshark uses"},
+	{Name: "wormhole-length", Type: IntSetting, Default: 2, Min: atLeast(1),
+		Description: "Number of words in a magic-wormhole code"},
+	{Name: "wormhole-rendezvous-url", Type: StringSetting, Default: "",
+		Description: "Rendezvous server for magic-wormhole"},
+	{Name: "wormhole-transit-relay", Type: StringSetting, Default: "",
+		Description: "Transit relay for magic-wormhole"},
+}
+
+// LookupSetting returns the setting with the given name, with or without the
+// "main." prefix.
+func LookupSetting(name string) (Setting, bool) {
+	name = strings.TrimPrefix(name, "main.")
+	i := sort.Search(len(Settings), func(i int) bool {
+		return Settings[i].Name >= name
+	})
+	if i < len(Settings) && Settings[i].Name == name {
+		return Settings[i], true
+	}
+	return Setting{}, false
+}
+
+// SettingNames returns the name of every setting, in sorted order.
+func SettingNames() []string {
+	res := make([]string, 0, len(Settings))
+	for _, s := range Settings {
+		res = append(res, s.Name)
+	}
+	return res
+}
+
+// Key returns the name to use with ConfString, SetConf and friends.
+func (s Setting) Key() string {
+	return "main." + s.Name
+}
+
+// ParseBool accepts the forms of true and false understood by strconv, plus
+// on/off and yes/no.
+func ParseBool(val string) (bool, error) {
+	switch strings.ToLower(val) {
+	case "on", "yes":
+		return true, nil
+	case "off", "no":
+		return false, nil
+	}
+	return strconv.ParseBool(val)
+}
+
+// Parse converts the words given to :set into a value of the setting's type,
+// returning an error if it is not allowed. A string value made of several
+// words is joined with spaces.
+func (s Setting) Parse(vals []string) (interface{}, error) {
+	if s.EditWith != "" {
+		return nil, fmt.Errorf("%s is changed with %s", s.Name, s.EditWith)
+	}
+	if len(vals) == 0 {
+		return nil, fmt.Errorf("No value provided for %s", s.Name)
+	}
+
+	switch s.Type {
+	case BoolSetting:
+		if len(vals) != 1 {
+			return nil, fmt.Errorf("%s takes a single value", s.Name)
+		}
+		b, err := ParseBool(vals[0])
+		if err != nil {
+			return nil, fmt.Errorf("%s is not a valid bool", vals[0])
+		}
+		return b, nil
+	case IntSetting:
+		if len(vals) != 1 {
+			return nil, fmt.Errorf("%s takes a single value", s.Name)
+		}
+		i, err := strconv.Atoi(vals[0])
+		if err != nil {
+			return nil, fmt.Errorf("%s is not a valid integer", vals[0])
+		}
+		if s.Min != nil && i < *s.Min {
+			return nil, fmt.Errorf("%s must be at least %d", s.Name, *s.Min)
+		}
+		return i, nil
+	case StringSetting:
+		str := strings.Join(vals, " ")
+		if err := s.checkChoice(str); err != nil {
+			return nil, err
+		}
+		return str, nil
+	default:
+		for _, v := range vals {
+			if err := s.checkChoice(v); err != nil {
+				return nil, err
+			}
+		}
+		return append([]string{}, vals...), nil
+	}
+}
+
+func (s Setting) checkChoice(val string) error {
+	if len(s.Choices) == 0 {
+		return nil
+	}
+	for _, c := range s.Choices {
+		if c == val {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s must be one of %s", s.Name, strings.Join(s.Choices, ", "))
+}
+
+// Format renders a value of the setting's type for display.
+func (s Setting) Format(val interface{}) string {
+	switch v := val.(type) {
+	case []string:
+		quoted := make([]string, 0, len(v))
+		for _, w := range v {
+			if w == "" || strings.ContainsAny(w, " \t\"") {
+				w = strconv.Quote(w)
+			}
+			quoted = append(quoted, w)
+		}
+		return "[" + strings.Join(quoted, " ") + "]"
+	case string:
+		if v == "" {
+			return "(unset)"
+		}
+		return v
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// IsDefault returns true if val is the setting's default value.
+func (s Setting) IsDefault(val interface{}) bool {
+	return s.Format(val) == s.Format(s.Default)
+}
+
+// Current returns the setting's value in the current profile, or its
+// default.
+func (s Setting) Current() interface{} {
+	switch s.Type {
+	case BoolSetting:
+		return ConfBool(s.Key(), s.Default.(bool))
+	case IntSetting:
+		return ConfInt(s.Key(), s.Default.(int))
+	case StringSetting:
+		return ConfString(s.Key(), s.Default.(string))
+	default:
+		return ConfStringSlice(s.Key(), s.Default.([]string))
+	}
+}
+
+// Reset returns the setting to its default value in the current profile.
+func (s Setting) Reset() {
+	// Deleted keys are stored as "", which reads back as the default for
+	// strings, but as 0 or false for other types.
+	if s.Type == StringSetting {
+		DeleteConf(s.Key())
+	} else {
+		SetConf(s.Key(), s.Default)
+	}
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 78
+// End:
@@ -0,0 +1,103 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+package profiles
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+//======================================================================
+
+func TestSettingsSorted1(t *testing.T) {
+	names := SettingNames()
+	assert.True(t, sort.StringsAreSorted(names))
+
+	for _, s := range Settings {
+		assert.NotNil(t, s.Default, s.Name)
+		assert.NotEqual(t, "", s.Description, s.Name)
+	}
+
+	s, ok := LookupSetting("main.pcap-bundle-size")
+	assert.True(t, ok)
+	assert.Equal(t, IntSetting, s.Type)
+	_, ok = LookupSetting("pcap-bundle-size")
+	assert.True(t, ok)
+	_, ok = LookupSetting("nosuchkey")
+	assert.False(t, ok)
+}
+
+func TestSettingsParse1(t *testing.T) {
+	s, _ := LookupSetting("auto-scroll")
+	v, err := s.Parse([]string{"off"})
+	assert.NoError(t, err)
+	assert.Equal(t, false, v)
+	v, err = s.Parse([]string{"true"})
+	assert.NoError(t, err)
+	assert.Equal(t, true, v)
+	_, err = s.Parse([]string{"maybe"})
+	assert.Error(t, err)
+
+	s, _ = LookupSetting("pcap-bundle-size")
+	v, err = s.Parse([]string{"500"})
+	assert.NoError(t, err)
+	assert.Equal(t, 500, v)
+	_, err = s.Parse([]string{"0"})
+	assert.Error(t, err)
+	_, err = s.Parse([]string{"lots"})
+	assert.Error(t, err)
+
+	s, _ = LookupSetting("stream-view")
+	v, err = s.Parse([]string{"ascii"})
+	assert.NoError(t, err)
+	assert.Equal(t, "ascii", v)
+	_, err = s.Parse([]string{"ebcdic"})
+	assert.Error(t, err)
+
+	s, _ = LookupSetting("pager")
+	v, err = s.Parse([]string{"less", "-R"})
+	assert.NoError(t, err)
+	assert.Equal(t, "less -R", v)
+
+	s, _ = LookupSetting("conv-types")
+	v, err = s.Parse([]string{"ip", "tcp"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ip", "tcp"}, v)
+	_, err = s.Parse([]string{"ip", "sctp"})
+	assert.Error(t, err)
+	_, err = s.Parse([]string{})
+	assert.Error(t, err)
+
+	// Changed with its own editor
+	s, ok := LookupSetting("watch-rules")
+	assert.True(t, ok)
+	_, err = s.Parse([]string{`"TRUE","bell","dns",""`})
+	assert.Error(t, err)
+
+	s, ok = LookupSetting("wireshark-profile")
+	assert.True(t, ok)
+	v, err = s.Parse([]string{"Classic"})
+	assert.NoError(t, err)
+	assert.Equal(t, "Classic", v)
+}
+
+func TestSettingsFormat1(t *testing.T) {
+	s, _ := LookupSetting("tail-command")
+	assert.Equal(t, `[tail -f "my file"]`, s.Format([]string{"tail", "-f", "my file"}))
+	assert.True(t, s.IsDefault([]string{}))
+
+	s, _ = LookupSetting("term")
+	assert.Equal(t, "(unset)", s.Format(""))
+	assert.True(t, s.IsDefault(""))
+	assert.False(t, s.IsDefault("xterm-256color"))
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 78
+// End:
@@ -26,7 +26,15 @@ type Termshark struct {
 	PrintIfaces     bool           `short:"D" optional:"true" optional-value:"true" description:"Print a list of the interfaces on which termshark can capture."`
 	DisplayFilter   string         `short:"Y" description:"Apply display filter." value-name:"<displaY filter>"`
 	CaptureFilter   string         `short:"f" description:"Apply capture filter." value-name:"<capture filter>"`
+	Snaplen         int            `short:"s" description:"Set the snapshot length for live captures." value-name:"<snaplen>"`
+	NoPromiscuous   bool           `short:"p" optional:"true" optional-value:"true" description:"Don't capture in promiscuous mode."`
+	BufferSize      int            `short:"B" description:"Set the kernel buffer size in MiB." value-name:"<buffer size>"`
+	MonitorMode     bool           `short:"I" optional:"true" optional-value:"true" description:"Capture in monitor mode, if available."`
+	LinkType        string         `short:"y" description:"Set the link-layer type for live captures." value-name:"<link type>"`
+	TimestampType   string         `long:"time-stamp-type" description:"Set the timestamp type for live captures." value-name:"<type>"`
 	TimestampFormat string         `short:"t" description:"Set the format of the packet timestamp printed in summary lines." choice:"a" choice:"ad" choice:"adoy" choice:"d" choice:"dd" choice:"e" choice:"r" choice:"u" choice:"ud" choice:"udoy" value-name:"<timestamp format>"`
+	Script          flags.Filename `long:"script" description:"Run this file of command-line commands once packets are loaded." value-name:"<file>"`
+	RemoteSocket    string         `long:"remote-socket" description:"Accept remote control commands on this UNIX socket." value-name:"<path>"`
 	PlatformSwitches
 	Profile  string   `long:"profile" short:"C" description:"Start with this configuration profile." value-name:"<profile>"`
 	PassThru string   `long:"pass-thru" default:"auto" optional:"true" optional-value:"true" choice:"auto" choice:"true" choice:"false" description:"Run tshark instead (auto => if stdout is not a tty)."`
@@ -42,7 +50,7 @@ type Termshark struct {
 
 // If args are passed through to tshark (e.g. stdout not a tty), then
 // strip these out so tshark doesn't fail.
-var TermsharkOnly = []string{"--pass-thru", "--profile", "--log-tty", "--debug", "--tail"}
+var TermsharkOnly = []string{"--pass-thru", "--profile", "--log-tty", "--debug", "--tail", "--remote-socket", "--script"}
 
 func FlagIsTrue(val string) bool {
 	return val == "true" || val == "yes"
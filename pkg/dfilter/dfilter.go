@@ -0,0 +1,944 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+// Package dfilter checks Wireshark display filters without running tshark.
+// It understands enough of the display filter language to catch typos -
+// unknown fields, bad operators, malformed addresses and numbers - as the
+// user types, and reports where in the filter the problem is. Constructs it
+// can't fully check, such as values given by name, are left to tshark.
+package dfilter
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gcla/termshark/v2/pkg/fields"
+)
+
+//======================================================================
+
+// IFields provides the protocols and fields known to tshark. It is satisfied
+// by *fields.TSharkFields.
+type IFields interface {
+	Loaded() bool
+	LookupField(name string) (bool, fields.Field)
+	IsProtocol(name string) bool
+}
+
+// ParseError is returned for an invalid filter. Pos is the byte offset in the
+// filter at which the problem was found.
+type ParseError struct {
+	Pos int
+	Msg string
+}
+
+var _ error = (*ParseError)(nil)
+
+func (e *ParseError) Error() string {
+	return e.Msg
+}
+
+// Check parses filter, looking up fields and protocols in flds. If the filter
+// is invalid, a *ParseError is returned. Otherwise verified is true if the
+// filter is known to be valid, or false if it uses something only tshark can
+// check, such as a value string (e.g. ip.proto == tcp) or a function call.
+// Nothing can be checked until the fields have been loaded from tshark.
+func Check(filter string, flds IFields) (verified bool, err error) {
+	if !flds.Loaded() {
+		return false, nil
+	}
+
+	p := &parser{
+		lex:      newLexer(filter),
+		flds:     flds,
+		verified: true,
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			if perr, ok := r.(*ParseError); ok {
+				verified = false
+				err = perr
+				return
+			}
+			panic(r)
+		}
+	}()
+
+	p.next()
+	if p.tok.typ == tokEOF {
+		p.fail(p.tok.pos, "The filter is empty")
+	}
+	p.parseExpr()
+	if p.tok.typ != tokEOF {
+		p.unexpected()
+	}
+
+	return p.verified, nil
+}
+
+//======================================================================
+
+type tokenType int
+
+const (
+	tokEOF tokenType = iota
+	tokWord
+	tokString
+	tokChar
+	tokFieldRef
+	tokSlice
+	tokLParen
+	tokRParen
+	tokLBrace
+	tokRBrace
+	tokComma
+	tokCompare
+	tokArith
+	tokAnd
+	tokOr
+	tokNot
+	tokIn
+	tokAt
+)
+
+type token struct {
+	typ tokenType
+	pos int
+	val string
+}
+
+// Relational operators, symbolic and word forms
+var compareOps = map[string]string{
+	"==":       "==",
+	"eq":       "==",
+	"any_eq":   "==",
+	"===":      "===",
+	"all_eq":   "===",
+	"!=":       "!=",
+	"ne":       "!=",
+	"all_ne":   "!=",
+	"!==":      "!==",
+	"any_ne":   "!==",
+	"~=":       "!==",
+	">":        ">",
+	"gt":       ">",
+	"<":        "<",
+	"lt":       "<",
+	">=":       ">=",
+	"ge":       ">=",
+	"<=":       "<=",
+	"le":       "<=",
+	"contains": "contains",
+	"matches":  "matches",
+	"~":        "matches",
+}
+
+// Functions that can be applied to fields
+var functions = map[string]struct{}{
+	"len":    {},
+	"count":  {},
+	"upper":  {},
+	"lower":  {},
+	"string": {},
+	"max":    {},
+	"min":    {},
+	"abs":    {},
+}
+
+type lexer struct {
+	input string
+	pos   int
+}
+
+func newLexer(input string) *lexer {
+	return &lexer{input: input}
+}
+
+func isWordByte(c byte) bool {
+	switch {
+	case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		return true
+	case c == '_', c == '.', c == ':', c == '-', c == '/', c == '#':
+		return true
+	case c >= 0x80:
+		return true
+	}
+	return false
+}
+
+// next returns the next token, or panics with a *ParseError if the input
+// can't be tokenized.
+func (l *lexer) next() token {
+	for l.pos < len(l.input) && (l.input[l.pos] == ' ' || l.input[l.pos] == '\t' || l.input[l.pos] == '\n' || l.input[l.pos] == '\r') {
+		l.pos++
+	}
+
+	start := l.pos
+	if l.pos >= len(l.input) {
+		return token{typ: tokEOF, pos: start}
+	}
+
+	rest := l.input[l.pos:]
+	c := rest[0]
+
+	single := func(typ tokenType) token {
+		l.pos++
+		return token{typ: typ, pos: start, val: rest[0:1]}
+	}
+
+	switch c {
+	case '(':
+		return single(tokLParen)
+	case ')':
+		return single(tokRParen)
+	case '{':
+		return single(tokLBrace)
+	case '}':
+		return single(tokRBrace)
+	case ',':
+		return single(tokComma)
+	case '@':
+		return single(tokAt)
+	case '+', '*', '%':
+		return single(tokArith)
+	case '"':
+		return l.quoted(tokString, '"', start, start+1)
+	case '\'':
+		return l.quoted(tokChar, '\'', start, start+1)
+	case '[':
+		end := strings.IndexByte(rest, ']')
+		if end == -1 {
+			panic(&ParseError{Pos: start, Msg: "Missing ] to close the slice"})
+		}
+		l.pos += end + 1
+		return token{typ: tokSlice, pos: start, val: rest[1:end]}
+	case '$':
+		if strings.HasPrefix(rest, "${") {
+			end := strings.IndexByte(rest, '}')
+			if end == -1 {
+				panic(&ParseError{Pos: start, Msg: "Missing } to close the field reference"})
+			}
+			l.pos += end + 1
+			return token{typ: tokFieldRef, pos: start, val: rest[2:end]}
+		}
+		l.pos++
+		tok := l.word(l.pos)
+		if tok.val == "" {
+			panic(&ParseError{Pos: start, Msg: "Expected a field name after $"})
+		}
+		return token{typ: tokFieldRef, pos: start, val: tok.val}
+	}
+
+	for _, op := range []string{"===", "!==", "==", "!=", "~=", ">=", "<=", "&&", "||", "^^"} {
+		if strings.HasPrefix(rest, op) {
+			l.pos += len(op)
+			switch op {
+			case "&&":
+				return token{typ: tokAnd, pos: start, val: op}
+			case "||", "^^":
+				return token{typ: tokOr, pos: start, val: op}
+			default:
+				return token{typ: tokCompare, pos: start, val: op}
+			}
+		}
+	}
+
+	switch c {
+	case '>', '<', '~':
+		return single(tokCompare)
+	case '&':
+		return single(tokArith)
+	case '!':
+		return single(tokNot)
+	}
+
+	if (c == 'r' || c == 'R') && len(rest) > 1 && rest[1] == '"' {
+		return l.quoted(tokString, '"', start, start+2)
+	}
+
+	if isWordByte(c) {
+		tok := l.word(start)
+		switch strings.ToLower(tok.val) {
+		case "and":
+			tok.typ = tokAnd
+		case "or", "xor":
+			tok.typ = tokOr
+		case "not":
+			tok.typ = tokNot
+		case "in":
+			tok.typ = tokIn
+		default:
+			if _, ok := compareOps[tok.val]; ok {
+				tok.typ = tokCompare
+			} else if tok.val == "-" || tok.val == "bitwise_and" {
+				tok.typ = tokArith
+			}
+		}
+		return tok
+	}
+
+	panic(&ParseError{Pos: start, Msg: fmt.Sprintf("Unexpected character '%c'", c)})
+}
+
+func (l *lexer) word(start int) token {
+	for l.pos < len(l.input) && isWordByte(l.input[l.pos]) {
+		l.pos++
+	}
+	return token{typ: tokWord, pos: start, val: l.input[start:l.pos]}
+}
+
+// quoted scans a string or character literal whose contents start at from. A
+// backslash escapes the next character.
+func (l *lexer) quoted(typ tokenType, delim byte, start int, from int) token {
+	i := from
+	for i < len(l.input) {
+		switch l.input[i] {
+		case '\\':
+			i += 2
+			continue
+		case delim:
+			l.pos = i + 1
+			return token{typ: typ, pos: start, val: l.input[from:i]}
+		}
+		i++
+	}
+	if delim == '"' {
+		panic(&ParseError{Pos: start, Msg: "Missing \" to close the string"})
+	}
+	panic(&ParseError{Pos: start, Msg: "Missing ' to close the character"})
+}
+
+//======================================================================
+
+type operandKind int
+
+const (
+	opField    operandKind = iota // a field or protocol
+	opWord                        // an unquoted value e.g. 80, 10.0.0.1, tcp-syn
+	opString                      // a quoted string
+	opChar                        // a character literal e.g. 'a'
+	opComputed                    // a function call, field reference or arithmetic
+)
+
+type operand struct {
+	kind   operandKind
+	pos    int
+	val    string
+	field  fields.Field
+	proto  bool
+	sliced bool
+}
+
+func (o operand) isValue() bool {
+	return o.kind == opWord || o.kind == opString || o.kind == opChar
+}
+
+type parser struct {
+	lex      *lexer
+	tok      token
+	flds     IFields
+	verified bool
+}
+
+func (p *parser) next() {
+	p.tok = p.lex.next()
+}
+
+func (p *parser) fail(pos int, format string, args ...interface{}) {
+	panic(&ParseError{Pos: pos, Msg: fmt.Sprintf(format, args...)})
+}
+
+func (p *parser) unexpected() {
+	if p.tok.typ == tokEOF {
+		p.fail(p.tok.pos, "Unexpected end of filter")
+	}
+	p.fail(p.tok.pos, "\"%s\" was unexpected in this context", p.tok.val)
+}
+
+func (p *parser) parseExpr() {
+	p.parseUnary()
+	for p.tok.typ == tokAnd || p.tok.typ == tokOr {
+		p.next()
+		p.parseUnary()
+	}
+}
+
+func (p *parser) parseUnary() {
+	if p.tok.typ == tokNot {
+		p.next()
+		p.parseUnary()
+		return
+	}
+	p.parseRelation()
+}
+
+func (p *parser) parseRelation() {
+	if p.tok.typ == tokLParen {
+		open := p.tok.pos
+		p.next()
+		p.parseExpr()
+		if p.tok.typ != tokRParen {
+			if p.tok.typ == tokEOF {
+				p.fail(open, "Missing ) to close the (")
+			}
+			p.unexpected()
+		}
+		p.next()
+		return
+	}
+
+	lhs := p.parseOperand()
+
+	switch {
+	case p.tok.typ == tokCompare:
+		op := p.tok
+		p.next()
+		rhs := p.parseOperand()
+		p.checkComparison(lhs, op, rhs)
+	case p.tok.typ == tokIn:
+		p.next()
+		p.parseSet(lhs)
+	case p.tok.typ == tokNot && p.tok.val != "!":
+		// not in
+		p.next()
+		if p.tok.typ != tokIn {
+			p.unexpected()
+		}
+		p.next()
+		p.parseSet(lhs)
+	default:
+		p.checkExists(lhs)
+	}
+}
+
+// checkExists checks a bare operand, which must be a field or protocol whose
+// presence is tested.
+func (p *parser) checkExists(o operand) {
+	switch o.kind {
+	case opField:
+	case opComputed:
+		p.verified = false
+	default:
+		p.fail(o.pos, "\"%s\" is neither a field nor a protocol name", o.val)
+	}
+}
+
+func (p *parser) parseOperand() operand {
+	res := p.parseValue()
+	for p.tok.typ == tokArith {
+		optok := p.tok
+		p.next()
+		rhs := p.parseValue()
+		// Masking a field leaves a value of the field's type, which can be tested for
+		// being non-zero or compared e.g. tcp.flags & 0x02 == 0x02
+		if (optok.val == "&" || optok.val == "bitwise_and") && res.kind == opField && rhs.isValue() {
+			p.checkValue(res, optok, "&", rhs)
+			continue
+		}
+		res.kind = opComputed
+		p.verified = false
+	}
+	return res
+}
+
+func (p *parser) parseValue() operand {
+	tok := p.tok
+	var res operand
+
+	switch tok.typ {
+	case tokString:
+		p.next()
+		return operand{kind: opString, pos: tok.pos, val: tok.val}
+	case tokChar:
+		p.next()
+		return operand{kind: opChar, pos: tok.pos, val: tok.val}
+	case tokFieldRef:
+		// Could be a field reference or a display filter macro
+		p.next()
+		p.verified = false
+		res = operand{kind: opComputed, pos: tok.pos, val: tok.val}
+	case tokAt:
+		p.next()
+		if p.tok.typ != tokWord {
+			p.unexpected()
+		}
+		res = p.lookup(p.tok)
+		if res.kind != opField {
+			p.fail(p.tok.pos, "\"%s\" is not a valid protocol or protocol field", p.tok.val)
+		}
+		p.next()
+		res.pos = tok.pos
+	case tokWord:
+		p.next()
+		if p.tok.typ == tokLParen {
+			res = p.parseFunction(tok)
+		} else {
+			res = p.lookup(tok)
+		}
+	default:
+		p.unexpected()
+	}
+
+	if p.tok.typ == tokSlice {
+		if res.kind == opWord {
+			p.fail(p.tok.pos, "Only fields can be sliced, not \"%s\"", res.val)
+		}
+		p.checkSlice(p.tok)
+		res.sliced = true
+		p.next()
+	}
+
+	return res
+}
+
+// lookup turns a word into a field or protocol if possible, otherwise it is a
+// value. A field may be followed by a layer e.g. ip.src#2.
+func (p *parser) lookup(tok token) operand {
+	name := tok.val
+	if i := strings.IndexByte(name, '#'); i != -1 {
+		layer := name[i+1:]
+		name = name[0:i]
+		if _, err := strconv.Atoi(layer); err != nil || name == "" {
+			p.fail(tok.pos, "\"%s\" is not a valid field layer", tok.val)
+		}
+		if ok, field := p.flds.LookupField(name); ok {
+			return operand{kind: opField, pos: tok.pos, val: tok.val, field: field}
+		}
+		if p.flds.IsProtocol(name) {
+			return operand{kind: opField, pos: tok.pos, val: tok.val, field: fields.Field{Name: name, Type: fields.FT_PROTOCOL}, proto: true}
+		}
+		p.fail(tok.pos, "\"%s\" is not a valid protocol or protocol field", name)
+	}
+
+	if ok, field := p.flds.LookupField(name); ok {
+		return operand{kind: opField, pos: tok.pos, val: name, field: field}
+	}
+	if p.flds.IsProtocol(name) {
+		return operand{kind: opField, pos: tok.pos, val: name, field: fields.Field{Name: name, Type: fields.FT_PROTOCOL}, proto: true}
+	}
+	return operand{kind: opWord, pos: tok.pos, val: name}
+}
+
+func (p *parser) parseFunction(name token) operand {
+	if _, ok := functions[strings.ToLower(name.val)]; !ok {
+		p.fail(name.pos, "The function \"%s\" does not exist", name.val)
+	}
+	open := p.tok.pos
+	p.next()
+	if p.tok.typ != tokRParen {
+		for {
+			arg := p.parseOperand()
+			if p.unknownField(arg) {
+				p.fail(arg.pos, "\"%s\" is not a valid protocol or protocol field", arg.val)
+			}
+			if p.tok.typ != tokComma {
+				break
+			}
+			p.next()
+		}
+	}
+	if p.tok.typ != tokRParen {
+		if p.tok.typ == tokEOF {
+			p.fail(open, "Missing ) to close the function call")
+		}
+		p.unexpected()
+	}
+	p.next()
+	p.verified = false
+	return operand{kind: opComputed, pos: name.pos, val: name.val}
+}
+
+// Each range in a slice looks like [i], [i:j], [i-j], [i:] or [:j], and
+// several can be separated by commas.
+var sliceRE = regexp.MustCompile(`^(-?[0-9]+)?(:(-?[0-9]+)?|-(-?[0-9]+))?$`)
+
+func (p *parser) checkSlice(tok token) {
+	for _, r := range strings.Split(tok.val, ",") {
+		r = strings.Join(strings.Fields(r), "")
+		if r == "" || r == ":" || !sliceRE.MatchString(r) {
+			p.fail(tok.pos, "\"[%s]\" is not a valid slice", tok.val)
+		}
+	}
+}
+
+func (p *parser) parseSet(lhs operand) {
+	if p.tok.typ != tokLBrace {
+		if p.tok.typ == tokEOF {
+			p.fail(p.tok.pos, "Expected { to start a set of values")
+		}
+		p.unexpected()
+	}
+	open := p.tok.pos
+	p.next()
+
+	n := 0
+	for p.tok.typ != tokRBrace {
+		if p.tok.typ == tokEOF {
+			p.fail(open, "Missing } to close the set")
+		}
+		if p.tok.typ == tokComma {
+			p.next()
+			continue
+		}
+		if p.tok.typ == tokWord && p.tok.val == ".." {
+			p.next()
+			continue
+		}
+		elt := p.parseOperand()
+		if elt.kind == opWord && strings.Contains(elt.val, "..") {
+			// A range e.g. 1..10
+			parts := strings.SplitN(elt.val, "..", 2)
+			p.checkComparison(lhs, token{typ: tokCompare, pos: elt.pos, val: "=="}, operand{kind: opWord, pos: elt.pos, val: parts[0]})
+			elt = operand{kind: opWord, pos: elt.pos + len(parts[0]) + 2, val: parts[1]}
+		}
+		p.checkComparison(lhs, token{typ: tokCompare, pos: elt.pos, val: "=="}, elt)
+		n++
+	}
+	if n == 0 {
+		p.fail(open, "The set of values is empty")
+	}
+	p.next()
+}
+
+//======================================================================
+
+// unknownField returns true if a value is probably a mistyped field name,
+// rather than e.g. a hostname or value string - i.e. it has a dot, and
+// starts with a protocol tshark knows about.
+func (p *parser) unknownField(o operand) bool {
+	if o.kind != opWord {
+		return false
+	}
+	i := strings.IndexByte(o.val, '.')
+	if i <= 0 {
+		return false
+	}
+	return p.flds.IsProtocol(o.val[0:i])
+}
+
+func (p *parser) checkComparison(lhs operand, optok token, rhs operand) {
+	op := compareOps[optok.val]
+
+	// A mistyped field is seen as a value, e.g. tcp.prot == 80
+	for _, o := range []operand{lhs, rhs} {
+		if p.unknownField(o) {
+			p.fail(o.pos, "\"%s\" is not a valid protocol or protocol field", o.val)
+		}
+	}
+
+	switch {
+	case lhs.isValue() && rhs.isValue():
+		if lhs.kind == opWord {
+			p.fail(lhs.pos, "\"%s\" is neither a field nor a protocol name", lhs.val)
+		}
+		if rhs.kind == opWord {
+			p.fail(rhs.pos, "\"%s\" is neither a field nor a protocol name", rhs.val)
+		}
+		p.fail(lhs.pos, "Constant expression is invalid")
+	case lhs.kind == opField && rhs.isValue():
+		p.checkValue(lhs, optok, op, rhs)
+	case rhs.kind == opField && lhs.isValue():
+		p.checkValue(rhs, optok, op, lhs)
+	case lhs.kind == opField && rhs.kind == opField:
+		p.checkOperator(lhs, optok, op)
+		if lhs.sliced != rhs.sliced || (!lhs.sliced && lhs.field.Type != rhs.field.Type) {
+			p.verified = false
+		}
+	default:
+		p.verified = false
+	}
+}
+
+func isInteger(t fields.FieldType) bool {
+	return (t >= fields.FT_CHAR && t <= fields.FT_INT64) || t == fields.FT_FRAMENUM
+}
+
+func isBytes(t fields.FieldType) bool {
+	switch t {
+	case fields.FT_PROTOCOL, fields.FT_BYTES, fields.FT_UINT_BYTES, fields.FT_ETHER,
+		fields.FT_GUID, fields.FT_OID, fields.FT_EUI64, fields.FT_AX25, fields.FT_VINES,
+		fields.FT_REL_OID, fields.FT_SYSTEM_ID, fields.FT_FCWWN:
+		return true
+	}
+	return false
+}
+
+func isString(t fields.FieldType) bool {
+	switch t {
+	case fields.FT_STRING, fields.FT_STRINGZ, fields.FT_UINT_STRING, fields.FT_STRINGZPAD:
+		return true
+	}
+	return false
+}
+
+// Operators returns the relational operators that can be used to compare a
+// field of type t with a value, most useful first. A field of type FT_NONE
+// can only be tested for presence.
+func Operators(t fields.FieldType) []string {
+	switch {
+	case t == fields.FT_NONE:
+		return []string{}
+	case t == fields.FT_BOOLEAN:
+		return []string{"==", "!="}
+	case isInteger(t):
+		return []string{"==", "!=", ">", "<", ">=", "<=", "&"}
+	case isString(t), isBytes(t):
+		return []string{"==", "!=", "contains", "matches", ">", "<", ">=", "<="}
+	default:
+		return []string{"==", "!=", ">", "<", ">=", "<="}
+	}
+}
+
+// checkOperator checks that the field's type supports the operator.
+func (p *parser) checkOperator(f operand, optok token, op string) {
+	t := f.field.Type
+	if f.sliced {
+		t = fields.FT_BYTES
+	}
+
+	bad := false
+	switch {
+	case t == fields.FT_NONE:
+		// Either a text label, which can only be tested for presence, or a
+		// type added to tshark since termshark was built.
+		p.verified = false
+	case op == "contains" || op == "matches":
+		bad = !isBytes(t) && !isString(t)
+	case op == "&":
+		bad = !isInteger(t) && !isBytes(t)
+	}
+
+	if bad {
+		p.fail(optok.pos, "%s (type=%s) cannot participate in \"%s\" comparison", f.val, t, optok.val)
+	}
+}
+
+// The maximum values for integer fields, by number of bits
+var integerBits = map[fields.FieldType]int{
+	fields.FT_CHAR:     8,
+	fields.FT_UINT8:    8,
+	fields.FT_UINT16:   16,
+	fields.FT_UINT24:   24,
+	fields.FT_UINT32:   32,
+	fields.FT_UINT40:   40,
+	fields.FT_UINT48:   48,
+	fields.FT_UINT56:   56,
+	fields.FT_UINT64:   64,
+	fields.FT_INT8:     8,
+	fields.FT_INT16:    16,
+	fields.FT_INT24:    24,
+	fields.FT_INT32:    32,
+	fields.FT_INT40:    40,
+	fields.FT_INT48:    48,
+	fields.FT_INT56:    56,
+	fields.FT_INT64:    64,
+	fields.FT_FRAMENUM: 32,
+}
+
+func isSigned(t fields.FieldType) bool {
+	return t >= fields.FT_INT8 && t <= fields.FT_INT64
+}
+
+// A byte string e.g. 00:11:22, 0:1:2, 00-11-22, 0011.2233 or ab
+var bytesRE = regexp.MustCompile(`^[0-9A-Fa-f]+([:.\-][0-9A-Fa-f]+)*$`)
+var byteSepRE = regexp.MustCompile(`[:.\-]`)
+
+// parseBytes returns the number of bytes in a byte string, and false if the
+// value isn't a byte string. Each group between separators is one byte, or
+// an even number of hex digits.
+func parseBytes(val string) (int, bool) {
+	if !bytesRE.MatchString(val) {
+		return 0, false
+	}
+	parts := byteSepRE.Split(val, -1)
+	res := 0
+	for _, part := range parts {
+		switch {
+		case len(part) <= 2:
+			res++
+		case len(part)%2 == 0:
+			res += len(part) / 2
+		default:
+			return 0, false
+		}
+	}
+	return res, true
+}
+
+// startsNumeric returns true if the value must be a number rather than a
+// name, such as a value string.
+func startsNumeric(val string) bool {
+	if val == "" {
+		return false
+	}
+	c := val[0]
+	if c == '-' && len(val) > 1 {
+		c = val[1]
+	}
+	return (c >= '0' && c <= '9') || c == '.'
+}
+
+// checkValue checks that a value is written in a form that suits the field's
+// type.
+func (p *parser) checkValue(f operand, optok token, op string, v operand) {
+	p.checkOperator(f, optok, op)
+
+	t := f.field.Type
+	if f.sliced {
+		t = fields.FT_BYTES
+	}
+
+	switch {
+	case op == "matches":
+		// tshark uses PCRE, which Go's regexp doesn't fully match
+		p.verified = false
+		if v.kind != opString {
+			p.fail(v.pos, "The regular expression must be a quoted string")
+		}
+		return
+	case v.kind == opChar:
+		if !isInteger(t) && !isBytes(t) {
+			p.verified = false
+		}
+		return
+	case v.kind == opString:
+		if !isString(t) && !isBytes(t) {
+			p.verified = false
+		}
+		return
+	}
+
+	val := v.val
+
+	switch {
+	case isInteger(t):
+		p.checkInteger(t, v, op)
+	case t == fields.FT_BOOLEAN:
+		switch strings.ToLower(val) {
+		case "true", "false", "0", "1":
+		default:
+			if _, err := strconv.ParseUint(val, 0, 64); err != nil {
+				if startsNumeric(val) {
+					p.fail(v.pos, "\"%s\" is not a valid boolean", val)
+				}
+				p.verified = false
+			}
+		}
+	case t == fields.FT_FLOAT || t == fields.FT_DOUBLE || t == fields.FT_RELATIVE_TIME:
+		if _, err := strconv.ParseFloat(val, 64); err != nil {
+			if startsNumeric(val) {
+				p.fail(v.pos, "\"%s\" is not a valid number", val)
+			}
+			p.verified = false
+		}
+	case t == fields.FT_IPv4:
+		p.checkAddress(v, 32, func(s string) bool {
+			ip := net.ParseIP(s)
+			return ip != nil && ip.To4() != nil && !strings.Contains(s, ":")
+		}, func(s string) bool {
+			return strings.Trim(s, "0123456789.") == ""
+		}, "IPv4")
+	case t == fields.FT_IPv6:
+		p.checkAddress(v, 128, func(s string) bool {
+			return net.ParseIP(s) != nil && strings.Contains(s, ":")
+		}, func(s string) bool {
+			return strings.Contains(s, ":")
+		}, "IPv6")
+	case t == fields.FT_ETHER:
+		if n, ok := parseBytes(val); ok {
+			if n != 6 && op != "contains" {
+				p.fail(v.pos, "\"%s\" is not a valid Ethernet address", val)
+			}
+		} else {
+			if strings.Contains(val, ":") {
+				p.fail(v.pos, "\"%s\" is not a valid Ethernet address", val)
+			}
+			// Could be a name from the ethers file
+			p.verified = false
+		}
+	case isBytes(t):
+		if _, ok := parseBytes(val); !ok {
+			if strings.Contains(val, ":") {
+				p.fail(v.pos, "\"%s\" is not a valid byte string", val)
+			}
+			p.verified = false
+		}
+	default:
+		// Strings, times and the rest are left to tshark
+		p.verified = false
+	}
+}
+
+func (p *parser) checkInteger(t fields.FieldType, v operand, op string) {
+	val := v.val
+	bits := integerBits[t]
+
+	var err error
+	if isSigned(t) {
+		_, err = strconv.ParseInt(val, 0, bits)
+	} else {
+		_, err = strconv.ParseUint(val, 0, bits)
+	}
+	if err == nil {
+		return
+	}
+
+	if nerr, ok := err.(*strconv.NumError); ok && nerr.Err == strconv.ErrRange {
+		if strings.HasPrefix(val, "-") {
+			if isSigned(t) {
+				p.fail(v.pos, "%s is too small for this field", val)
+			}
+			// tshark may accept this, e.g. in a set
+			p.verified = false
+			return
+		}
+		p.fail(v.pos, "%s is too big for this field, the maximum has %d bits", val, bits)
+	}
+
+	if strings.HasPrefix(val, "-") && !isSigned(t) {
+		if _, err := strconv.ParseInt(val, 0, 64); err == nil {
+			p.verified = false
+			return
+		}
+	}
+
+	if startsNumeric(val) {
+		p.fail(v.pos, "\"%s\" is not a valid number", val)
+	}
+
+	// Probably a value string e.g. tcp.flags.syn == set
+	p.verified = false
+}
+
+// checkAddress checks an IPv4 or IPv6 address, with an optional prefix
+// length. Anything that doesn't look like an address is taken to be a
+// hostname.
+func (p *parser) checkAddress(v operand, maxBits int, valid func(string) bool, looksLike func(string) bool, name string) {
+	val := v.val
+	addr := val
+	if i := strings.IndexByte(val, '/'); i != -1 {
+		addr = val[0:i]
+		bits, err := strconv.Atoi(val[i+1:])
+		if err != nil || bits < 0 || bits > maxBits {
+			p.fail(v.pos+i+1, "\"%s\" is not a valid prefix length for an %s address", val[i+1:], name)
+		}
+	}
+	if looksLike(addr) {
+		if !valid(addr) {
+			p.fail(v.pos, "\"%s\" is not a valid %s address", addr, name)
+		}
+		return
+	}
+	p.verified = false
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 78
+// End:
@@ -0,0 +1,158 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+package dfilter
+
+import (
+	"testing"
+
+	"github.com/gcla/termshark/v2/pkg/fields"
+	"github.com/stretchr/testify/assert"
+)
+
+//======================================================================
+
+type testFields map[string]fields.FieldType
+
+func (t testFields) Loaded() bool {
+	return true
+}
+
+func (t testFields) LookupField(name string) (bool, fields.Field) {
+	if ty, ok := t[name]; ok && ty != fields.FT_PROTOCOL {
+		return true, fields.Field{Name: name, Type: ty}
+	}
+	return false, fields.Field{}
+}
+
+func (t testFields) IsProtocol(name string) bool {
+	ty, ok := t[name]
+	return ok && ty == fields.FT_PROTOCOL
+}
+
+var flds = testFields{
+	"frame":              fields.FT_PROTOCOL,
+	"eth":                fields.FT_PROTOCOL,
+	"ip":                 fields.FT_PROTOCOL,
+	"ipv6":               fields.FT_PROTOCOL,
+	"tcp":                fields.FT_PROTOCOL,
+	"udp":                fields.FT_PROTOCOL,
+	"http":               fields.FT_PROTOCOL,
+	"eth.src":            fields.FT_ETHER,
+	"ip.src":             fields.FT_IPv4,
+	"ip.addr":            fields.FT_IPv4,
+	"ip.proto":           fields.FT_UINT8,
+	"ip.ttl":             fields.FT_UINT8,
+	"ipv6.addr":          fields.FT_IPv6,
+	"tcp.port":           fields.FT_UINT16,
+	"tcp.flags":          fields.FT_UINT16,
+	"tcp.flags.syn":      fields.FT_BOOLEAN,
+	"tcp.payload":        fields.FT_BYTES,
+	"tcp.analysis.flags": fields.FT_NONE,
+	"frame.time_delta":   fields.FT_RELATIVE_TIME,
+	"http.host":          fields.FT_STRING,
+}
+
+func TestValid1(t *testing.T) {
+	for _, f := range []string{
+		"tcp",
+		"tcp.port == 80",
+		"tcp.port==80",
+		"tcp.port eq 0x50 and !udp",
+		"not tcp.port == 80 || udp",
+		"(tcp.port == 80 or tcp.port == 443) && ip.src == 10.0.0.1",
+		"ip.addr == 10.0.0.0/8",
+		"ipv6.addr == fe80::1",
+		"eth.src == 00:11:22:33:44:55",
+		"eth.src == 00-11-22-33-44-55",
+		"eth.src[0:3] == 00:11:22",
+		"tcp.payload contains 47:45:54",
+		"tcp.payload contains \"GET\"",
+		"http.host == \"example.com\"",
+		"tcp.flags.syn == 1",
+		"tcp.port in {80 443 8000..8080}",
+		"frame.time_delta > 0.5",
+		"ip.ttl & 0x80",
+		"tcp.flags & 0x02 == 0x02",
+		"tcp.flags bitwise_and 0x12 != 0 && tcp.port == 80",
+		"tcp.analysis.flags",
+	} {
+		verified, err := Check(f, flds)
+		assert.NoError(t, err, f)
+		assert.True(t, verified, f)
+	}
+}
+
+func TestUnverified1(t *testing.T) {
+	for _, f := range []string{
+		"ip.proto == tcp",
+		"tcp.flags.syn == set",
+		"ip.src == myhost",
+		"http.host matches \"^www\"",
+		"len(http.host) > 5",
+		"http.host == example.com",
+		"tcp.port == ${udp.port}",
+	} {
+		verified, err := Check(f, flds)
+		assert.NoError(t, err, f)
+		assert.False(t, verified, f)
+	}
+}
+
+func TestInvalid1(t *testing.T) {
+	for _, tc := range []struct {
+		filter string
+		pos    int
+	}{
+		{"tcp.prot == 80", 0},
+		{"tcpp", 0},
+		{"tcp.port ==", 11},
+		{"tcp.port == 80 and", 18},
+		{"tcp.port == 80x", 12},
+		{"tcp.port == 70000", 12},
+		{"ip.src == 10.0.0.256", 10},
+		{"ip.src == 10.0.0.0/33", 19},
+		{"ipv6.addr == fe80:::1", 13},
+		{"eth.src == 00:11:22", 11},
+		{"(tcp", 0},
+		{"tcp.port contains 80", 9},
+		{"http.host == \"abc", 13},
+		{"tcp.payload[0:x] == 00", 11},
+		{"foo(tcp)", 0},
+		{"tcp.port in {}", 12},
+		{"tcp.port = 80", 9},
+		{"80 == 80", 0},
+		{"http.host & 0x02 == 0x02", 10},
+		{"tcp.flags & 0x2g == 0x02", 12},
+	} {
+		_, err := Check(tc.filter, flds)
+		if assert.Error(t, err, tc.filter) {
+			assert.IsType(t, &ParseError{}, err, tc.filter)
+			assert.Equal(t, tc.pos, err.(*ParseError).Pos, tc.filter)
+		}
+	}
+}
+
+func TestOperators1(t *testing.T) {
+	assert.Equal(t, []string{}, Operators(fields.FT_NONE))
+	assert.Equal(t, []string{"==", "!="}, Operators(fields.FT_BOOLEAN))
+	assert.Contains(t, Operators(fields.FT_UINT16), "&")
+	assert.NotContains(t, Operators(fields.FT_UINT16), "contains")
+	assert.Contains(t, Operators(fields.FT_STRING), "matches")
+
+	// Each operator offered passes the check
+	for _, op := range Operators(fields.FT_BYTES) {
+		verified, err := Check("tcp.payload "+op+" \"abc\"", flds)
+		assert.NoError(t, err, op)
+		if op != "matches" {
+			assert.True(t, verified, op)
+		}
+	}
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 78
+// End:
@@ -0,0 +1,64 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+// +build !windows
+
+package extcap
+
+import (
+	"os"
+	"os/exec"
+
+	"github.com/gcla/termshark/v2/pkg/system"
+)
+
+//======================================================================
+
+// Start runs the extcap binary to capture from the interface using the
+// user's answers, and makes this process's stdin the pcap it writes. The
+// binary writes to what it thinks is a fifo - in fact the write end of a
+// pipe, inherited as fd 3.
+func Start(intf Interface, answers map[string]string, filter string) (*exec.Cmd, error) {
+	config, err := Config(intf)
+	if err != nil {
+		return nil, err
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	args := []string{"--capture", "--extcap-interface", intf.Name, "--fifo", "/dev/fd/3"}
+	args = append(args, CaptureArgs(config, answers)...)
+	if filter != "" {
+		args = append(args, "--extcap-capture-filter", filter)
+	}
+
+	cmd := exec.Command(intf.Binary, args...)
+	cmd.ExtraFiles = []*os.File{w}
+	cmd.Stderr = os.Stderr
+
+	err = cmd.Start()
+	// The extcap binary has its own copy now
+	w.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	if err = system.Dup2(int(r.Fd()), 0); err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return nil, err
+	}
+
+	return cmd, nil
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 78
+// End:
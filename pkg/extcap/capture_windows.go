@@ -0,0 +1,24 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+package extcap
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+//======================================================================
+
+// Start is not yet supported on Windows, where extcap binaries expect a
+// named pipe.
+func Start(intf Interface, answers map[string]string, filter string) (*exec.Cmd, error) {
+	return nil, fmt.Errorf("Configured extcap interfaces are not supported on Windows")
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 78
+// End:
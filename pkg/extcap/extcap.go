@@ -0,0 +1,528 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+// Package extcap finds Wireshark's extcap interfaces - such as randpkt,
+// sshdump and udpdump - asks them which arguments they need, and remembers
+// the user's answers in the termshark profile so that they can be captured.
+package extcap
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gcla/termshark/v2"
+	"github.com/gcla/termshark/v2/configs/profiles"
+	log "github.com/sirupsen/logrus"
+)
+
+//======================================================================
+
+// The folders tshark -G folders reports extcap binaries are kept in. Older
+// versions of Wireshark have one, newer versions two.
+var folderSettings = []string{"Extcap path", "Personal Extcap path", "Global Extcap path"}
+
+// Matches {key=value} in an extcap sentence. A value ends at the first } that
+// is followed by { or the end of the line, so regular expressions like
+// (...){3} survive.
+var paramRE = regexp.MustCompile(`\{([a-z]+)=(.*?)\}(?:\s*$|\{)`)
+
+// AnswersEnv is the environment variable carrying extcap answers to
+// termshark's capture mode.
+const AnswersEnv = "TERMSHARK_EXTCAP_ARGS"
+
+var InvalidAnswerError = fmt.Errorf("Extcap answers must look like <interface> <--arg>=<value>")
+
+// Interface is an extcap interface and the binary that provides it.
+type Interface struct {
+	Name    string // e.g. randpkt
+	Display string // e.g. Random packet generator
+	Binary  string
+}
+
+// ArgKind says how an argument should be edited.
+type ArgKind int
+
+const (
+	TextArg ArgKind = iota
+	NumberArg
+	BooleanArg
+	SelectorArg
+	FileArg
+)
+
+// Value is one of the choices offered by a selector argument.
+type Value struct {
+	Value   string
+	Display string
+	Default bool
+}
+
+// Arg is an argument an extcap interface accepts, as described by the
+// output of --extcap-config.
+type Arg struct {
+	Number     int
+	Call       string // e.g. --count
+	Display    string
+	Type       string // e.g. integer, boolflag, selector
+	Default    string
+	Tooltip    string
+	Range      string // e.g. 1,5000
+	Validation string // a regular expression the whole value must match
+	Required   bool
+	Values     []Value
+}
+
+// Kind returns how the argument should be edited. Types termshark doesn't
+// know about are edited as text.
+func (a Arg) Kind() ArgKind {
+	switch a.Type {
+	case "integer", "unsigned", "long", "double":
+		return NumberArg
+	case "boolean", "boolflag":
+		return BooleanArg
+	case "selector", "radio":
+		return SelectorArg
+	case "fileselect":
+		return FileArg
+	default:
+		return TextArg
+	}
+}
+
+// DefaultValue returns the value used if the user provides none.
+func (a Arg) DefaultValue() string {
+	if a.Kind() == SelectorArg {
+		for _, v := range a.Values {
+			if v.Default {
+				return v.Value
+			}
+		}
+	}
+	return a.Default
+}
+
+// Validate checks the value provided for the argument is acceptable.
+func (a Arg) Validate(val string) error {
+	if val == "" {
+		if a.Required {
+			return fmt.Errorf("%s is required", a.Display)
+		}
+		return nil
+	}
+	switch a.Kind() {
+	case NumberArg:
+		var err error
+		switch a.Type {
+		case "double":
+			_, err = strconv.ParseFloat(val, 64)
+		case "unsigned":
+			_, err = strconv.ParseUint(val, 10, 64)
+		default:
+			_, err = strconv.ParseInt(val, 10, 64)
+		}
+		if err != nil {
+			return fmt.Errorf("%s must be a number", a.Display)
+		}
+		if err = a.checkRange(val); err != nil {
+			return err
+		}
+	case BooleanArg:
+		if _, err := strconv.ParseBool(val); err != nil {
+			return fmt.Errorf("%s must be true or false", a.Display)
+		}
+	case SelectorArg:
+		for _, v := range a.Values {
+			if v.Value == val {
+				return nil
+			}
+		}
+		return fmt.Errorf("%s must be one of the choices offered", a.Display)
+	default:
+		// Wireshark's regular expressions are PCRE; one Go can't compile can't be checked
+		if a.Validation != "" {
+			if re, err := regexp.Compile("^(?:" + a.Validation + ")$"); err == nil && !re.MatchString(val) {
+				return fmt.Errorf("%s is not in the expected format", a.Display)
+			}
+		}
+	}
+	return nil
+}
+
+// checkRange checks a number is within the argument's range, if it has one.
+// Either end of the range may be missing.
+func (a Arg) checkRange(val string) error {
+	if a.Range == "" {
+		return nil
+	}
+	bounds := strings.SplitN(a.Range, ",", 2)
+	if len(bounds) != 2 {
+		return nil
+	}
+	n, err := strconv.ParseFloat(val, 64)
+	if err != nil {
+		return nil
+	}
+	lo, loerr := strconv.ParseFloat(strings.TrimSpace(bounds[0]), 64)
+	hi, hierr := strconv.ParseFloat(strings.TrimSpace(bounds[1]), 64)
+	if (loerr == nil && n < lo) || (hierr == nil && n > hi) {
+		return fmt.Errorf("%s must be in the range %s", a.Display, a.Range)
+	}
+	return nil
+}
+
+//======================================================================
+
+// parseSentence splits a line of extcap output into its type, e.g. "arg",
+// and its {key=value} parameters.
+func parseSentence(line string) (string, map[string]string) {
+	line = strings.TrimSpace(line)
+	idx := strings.Index(line, " ")
+	if idx == -1 {
+		return line, map[string]string{}
+	}
+
+	params := make(map[string]string)
+	rest := line[idx+1:]
+	for {
+		loc := paramRE.FindStringSubmatchIndex(rest)
+		if loc == nil {
+			break
+		}
+		params[rest[loc[2]:loc[3]]] = rest[loc[4]:loc[5]]
+		// Start again from the { that ended the match, if there was one
+		next := loc[1]
+		if strings.HasSuffix(rest[loc[0]:loc[1]], "{") {
+			next--
+		}
+		rest = rest[next:]
+	}
+
+	return line[0:idx], params
+}
+
+// ParseInterfaces parses the output of <binary> --extcap-interfaces.
+func ParseInterfaces(r io.Reader, binary string) []Interface {
+	res := make([]Interface, 0)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		kind, params := parseSentence(scanner.Text())
+		if kind == "interface" && params["value"] != "" {
+			res = append(res, Interface{
+				Name:    params["value"],
+				Display: params["display"],
+				Binary:  binary,
+			})
+		}
+	}
+	return res
+}
+
+// ParseConfig parses the output of <binary> --extcap-interface <name>
+// --extcap-config. The arguments are returned in the order given by their
+// numbers.
+func ParseConfig(r io.Reader) ([]Arg, error) {
+	args := make(map[int]*Arg)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		kind, params := parseSentence(scanner.Text())
+		switch kind {
+		case "arg":
+			num, err := strconv.Atoi(params["number"])
+			if err != nil || params["call"] == "" {
+				return nil, fmt.Errorf("Could not parse extcap argument: %s", scanner.Text())
+			}
+			args[num] = &Arg{
+				Number:     num,
+				Call:       params["call"],
+				Display:    params["display"],
+				Type:       params["type"],
+				Default:    params["default"],
+				Tooltip:    params["tooltip"],
+				Range:      params["range"],
+				Validation: params["validation"],
+				Required:   params["required"] == "true",
+			}
+		case "value":
+			num, err := strconv.Atoi(params["arg"])
+			if err != nil {
+				return nil, fmt.Errorf("Could not parse extcap value: %s", scanner.Text())
+			}
+			// Values always follow the argument they belong to
+			if arg, ok := args[num]; ok {
+				arg.Values = append(arg.Values, Value{
+					Value:   params["value"],
+					Display: params["display"],
+					Default: params["default"] == "true",
+				})
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	nums := make([]int, 0, len(args))
+	for num := range args {
+		nums = append(nums, num)
+	}
+	sort.Ints(nums)
+
+	res := make([]Arg, 0, len(nums))
+	for _, num := range nums {
+		res = append(res, *args[num])
+	}
+	return res, nil
+}
+
+//======================================================================
+
+// Folders returns the folders holding extcap binaries.
+func Folders() []string {
+	res := make([]string, 0, 2)
+	settings, err := termshark.TsharkSettings(folderSettings...)
+	if err != nil {
+		log.Warnf("Could not find extcap folders: %v", err)
+		return res
+	}
+	for _, setting := range folderSettings {
+		if folder, ok := settings[setting]; ok && !termshark.StringInSlice(folder, res) {
+			res = append(res, folder)
+		}
+	}
+	return res
+}
+
+// Interfaces asks each extcap binary which interfaces it provides.
+func Interfaces() ([]Interface, error) {
+	res := make([]Interface, 0)
+	folders := Folders()
+	if len(folders) == 0 {
+		return nil, fmt.Errorf("Could not find the extcap folders in the output of tshark -G folders")
+	}
+	for _, folder := range folders {
+		files, err := ioutil.ReadDir(folder)
+		if err != nil {
+			log.Warnf("Could not read extcap folder %s: %v", folder, err)
+			continue
+		}
+		for _, file := range files {
+			if file.IsDir() || file.Mode()&0111 == 0 {
+				continue
+			}
+			binary := filepath.Join(folder, file.Name())
+			out, err := exec.Command(binary, "--extcap-interfaces").Output()
+			if err != nil {
+				log.Warnf("Could not list the interfaces of extcap %s: %v", binary, err)
+				continue
+			}
+			res = append(res, ParseInterfaces(bytes.NewReader(out), binary)...)
+		}
+	}
+	return res, nil
+}
+
+// Lookup returns the extcap interface with the given name.
+func Lookup(name string) (Interface, bool) {
+	intfs, err := Interfaces()
+	if err != nil {
+		return Interface{}, false
+	}
+	for _, intf := range intfs {
+		if intf.Name == name {
+			return intf, true
+		}
+	}
+	return Interface{}, false
+}
+
+// Config asks the extcap binary which arguments the interface accepts.
+func Config(intf Interface) ([]Arg, error) {
+	out, err := exec.Command(intf.Binary, "--extcap-interface", intf.Name, "--extcap-config").Output()
+	if err != nil {
+		return nil, err
+	}
+	return ParseConfig(bytes.NewReader(out))
+}
+
+//======================================================================
+
+// CaptureArgs returns the arguments given to the extcap binary to capture,
+// using the user's answers - keyed by each argument's call e.g. --count - and
+// the defaults for those not answered.
+func CaptureArgs(args []Arg, answers map[string]string) []string {
+	res := make([]string, 0)
+	for _, arg := range args {
+		val, ok := answers[arg.Call]
+		if !ok {
+			val = arg.DefaultValue()
+		}
+		if val == "" {
+			continue
+		}
+		if arg.Type == "boolflag" {
+			if b, err := strconv.ParseBool(val); err == nil && b {
+				res = append(res, arg.Call)
+			}
+			continue
+		}
+		res = append(res, arg.Call, val)
+	}
+	return res
+}
+
+// RewriteCaptureArgs changes the capture command's arguments so that the
+// interface is read from stdin, where the extcap binary's output will be. The
+// capture filter is removed and returned, because it must be given to the
+// extcap binary instead. The interface's capture options - snapshot length,
+// monitor mode and so on - are removed too, since they don't apply to stdin.
+func RewriteCaptureArgs(args []string, iface string) ([]string, string) {
+	res := make([]string, 0, len(args))
+	filter := ""
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "-i" && i+1 < len(args) && args[i+1] == iface:
+			res = append(res, "-i", "-")
+			i++
+		case args[i] == "-f" && i+1 < len(args):
+			filter = args[i+1]
+			i++
+		case args[i] == "-p" || args[i] == "-I":
+		case (args[i] == "-s" || args[i] == "-B" || args[i] == "-y" || args[i] == "--time-stamp-type") && i+1 < len(args):
+			i++
+		default:
+			res = append(res, args[i])
+		}
+	}
+	return res, filter
+}
+
+//======================================================================
+
+// GetAnswers returns the user's answers for the interface's arguments, saved
+// in the current profile and keyed by each argument's call.
+func GetAnswers(iface string) map[string]string {
+	return answersFor(profiles.ConfStringSlice("main.extcap-args", []string{}), iface)
+}
+
+func answersFor(strs []string, iface string) map[string]string {
+	res := make(map[string]string)
+	for _, s := range strs {
+		if name, call, val, err := ParseAnswer(s); err == nil && name == iface {
+			res[call] = val
+		}
+	}
+	return res
+}
+
+// ConfiguredInterfaces returns the interfaces with answers saved in the
+// current profile.
+func ConfiguredInterfaces() []string {
+	res := make([]string, 0)
+	for _, s := range profiles.ConfStringSlice("main.extcap-args", []string{}) {
+		if name, _, _, err := ParseAnswer(s); err == nil && !termshark.StringInSlice(name, res) {
+			res = append(res, name)
+		}
+	}
+	return res
+}
+
+// HasAnswers returns true if answers for the interface are saved in the
+// current profile.
+func HasAnswers(iface string) bool {
+	return len(GetAnswers(iface)) > 0
+}
+
+// SetAnswers saves the answers for the interface in the current profile,
+// replacing any saved before.
+func SetAnswers(iface string, answers map[string]string) {
+	strs := make([]string, 0)
+	for _, s := range profiles.ConfStringSlice("main.extcap-args", []string{}) {
+		if name, _, _, err := ParseAnswer(s); err == nil && name != iface {
+			strs = append(strs, s)
+		}
+	}
+	calls := make([]string, 0, len(answers))
+	for call := range answers {
+		calls = append(calls, call)
+	}
+	sort.Strings(calls)
+	for _, call := range calls {
+		strs = append(strs, FormatAnswer(iface, call, answers[call]))
+	}
+	if len(strs) == 0 {
+		profiles.DeleteConf("main.extcap-args")
+	} else {
+		profiles.SetConf("main.extcap-args", strs)
+	}
+}
+
+// Environ returns the environment for termshark's capture mode, used to
+// capture from the interfaces. It carries the answers for any of them that
+// are configured extcap interfaces, since the capture process may not be
+// using the same profile. The answers are JSON-encoded, because a value might
+// contain any character.
+func Environ(ifaces []string) []string {
+	strs := make([]string, 0)
+	for _, iface := range ifaces {
+		answers := GetAnswers(iface)
+		for call, val := range answers {
+			strs = append(strs, FormatAnswer(iface, call, val))
+		}
+	}
+	res := os.Environ()
+	if len(strs) > 0 {
+		if b, err := json.Marshal(strs); err == nil {
+			res = append(res, fmt.Sprintf("%s=%s", AnswersEnv, string(b)))
+		}
+	}
+	return res
+}
+
+// EnvAnswers returns the answers passed to the capture process in its
+// environment by Environ, for the interface.
+func EnvAnswers(iface string) map[string]string {
+	strs := make([]string, 0)
+	if env := os.Getenv(AnswersEnv); env != "" {
+		if err := json.Unmarshal([]byte(env), &strs); err != nil {
+			log.Warnf("Could not read the extcap answers in %s: %v", AnswersEnv, err)
+		}
+	}
+	return answersFor(strs, iface)
+}
+
+// FormatAnswer returns an answer in the form it's saved in the profile, e.g.
+// "randpkt --count=100".
+func FormatAnswer(iface string, call string, val string) string {
+	return fmt.Sprintf("%s %s=%s", iface, call, val)
+}
+
+// ParseAnswer parses an answer in the form returned by FormatAnswer.
+func ParseAnswer(s string) (string, string, string, error) {
+	toks := strings.SplitN(s, " ", 2)
+	if len(toks) != 2 || toks[0] == "" {
+		return "", "", "", InvalidAnswerError
+	}
+	kv := strings.SplitN(toks[1], "=", 2)
+	if len(kv) != 2 || !strings.HasPrefix(kv[0], "-") {
+		return "", "", "", InvalidAnswerError
+	}
+	return toks[0], kv[0], kv[1], nil
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 78
+// End:
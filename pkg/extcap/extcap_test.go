@@ -0,0 +1,146 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+package extcap
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+//======================================================================
+
+var randpktConfig = `arg {number=0}{call=--maxbytes}{display=Max bytes in a packet}{type=unsigned}{range=1,5000}{default=5000}{tooltip=The max bytes in a packet}
+arg {number=1}{call=--count}{display=Number of packets}{type=long}{default=1000}{tooltip=Number of packets to generate (-1 for infinite)}
+arg {number=2}{call=--delay}{display=Packet delay (ms)}{type=integer}{default=0}{tooltip=Milliseconds to wait after writing each packet}
+arg {number=3}{call=--random-type}{display=Random type}{type=boolflag}{default=false}{tooltip=The packets type is randomly chosen}
+arg {number=5}{call=--type}{display=Type of packet}{type=selector}{tooltip=Type of packet to generate}
+value {arg=5}{value=arp}{display=Address Resolution Protocol}{default=false}
+value {arg=5}{value=dns}{display=Domain Name Service}{default=true}
+arg {number=4}{call=--host}{display=Host}{type=string}{required=true}{validation=^[a-z]{3}[0-9]*$}
+`
+
+func TestInterfaces1(t *testing.T) {
+	intfs := ParseInterfaces(strings.NewReader(`extcap {version=1.0}{help=https://www.wireshark.org}
+interface {value=randpkt}{display=Random packet generator}
+`), "/usr/lib/wireshark/extcap/randpktdump")
+	assert.Equal(t, []Interface{
+		{Name: "randpkt", Display: "Random packet generator", Binary: "/usr/lib/wireshark/extcap/randpktdump"},
+	}, intfs)
+}
+
+func TestConfig1(t *testing.T) {
+	args, err := ParseConfig(strings.NewReader(randpktConfig))
+	assert.NoError(t, err)
+	assert.Equal(t, 6, len(args))
+
+	assert.Equal(t, "--maxbytes", args[0].Call)
+	assert.Equal(t, "1,5000", args[0].Range)
+	assert.Equal(t, NumberArg, args[0].Kind())
+	assert.Equal(t, BooleanArg, args[3].Kind())
+
+	// Ordered by number, not by position in the output
+	assert.Equal(t, "--host", args[4].Call)
+	assert.True(t, args[4].Required)
+	assert.Equal(t, TextArg, args[4].Kind())
+
+	assert.Equal(t, "--type", args[5].Call)
+	assert.Equal(t, SelectorArg, args[5].Kind())
+	assert.Equal(t, 2, len(args[5].Values))
+	assert.Equal(t, "dns", args[5].DefaultValue())
+
+	_, err = ParseConfig(strings.NewReader("arg {number=x}{call=--count}\n"))
+	assert.Error(t, err)
+}
+
+func TestSentence1(t *testing.T) {
+	kind, params := parseSentence("arg {number=4}{call=--host}{validation=^[a-z]{3}[0-9]*$}")
+	assert.Equal(t, "arg", kind)
+	assert.Equal(t, "^[a-z]{3}[0-9]*$", params["validation"])
+	assert.Equal(t, "--host", params["call"])
+}
+
+func TestValidate1(t *testing.T) {
+	args, err := ParseConfig(strings.NewReader(randpktConfig))
+	assert.NoError(t, err)
+
+	assert.NoError(t, args[0].Validate("100"))
+	assert.Error(t, args[0].Validate("-100"))
+	assert.NoError(t, args[0].Validate("5000"))
+	assert.Error(t, args[0].Validate("5001"))
+	assert.Error(t, args[0].Validate("0"))
+	assert.NoError(t, args[4].Validate("abc12"))
+	assert.Error(t, args[4].Validate("ab1"))
+	assert.NoError(t, args[1].Validate("-1"))
+	assert.Error(t, args[1].Validate("lots"))
+	assert.NoError(t, args[3].Validate("true"))
+	assert.Error(t, args[4].Validate(""))
+	assert.NoError(t, args[5].Validate("arp"))
+	assert.Error(t, args[5].Validate("tcp"))
+}
+
+func TestCaptureArgs1(t *testing.T) {
+	args, err := ParseConfig(strings.NewReader(randpktConfig))
+	assert.NoError(t, err)
+
+	assert.Equal(t,
+		[]string{"--maxbytes", "5000", "--count", "1000", "--delay", "0", "--type", "dns"},
+		CaptureArgs(args, map[string]string{}))
+	assert.Equal(t,
+		[]string{"--maxbytes", "5000", "--count", "10", "--delay", "0", "--random-type", "--host", "abc", "--type", "arp"},
+		CaptureArgs(args, map[string]string{"--count": "10", "--random-type": "true", "--host": "abc", "--type": "arp"}))
+}
+
+func TestRewriteCaptureArgs1(t *testing.T) {
+	args, filter := RewriteCaptureArgs([]string{"-i", "randpkt", "-s", "96", "-w", "/tmp/x.pcap", "-f", "tcp port 80"}, "randpkt")
+	assert.Equal(t, []string{"-i", "-", "-w", "/tmp/x.pcap"}, args)
+	assert.Equal(t, "tcp port 80", filter)
+
+	// The interface's capture options don't apply to stdin
+	args, _ = RewriteCaptureArgs([]string{"-i", "randpkt", "-p", "-B", "4", "-I", "-y", "EN10MB", "--time-stamp-type", "host", "-w", "/tmp/x.pcap"}, "randpkt")
+	assert.Equal(t, []string{"-i", "-", "-w", "/tmp/x.pcap"}, args)
+}
+
+func TestEnvAnswers1(t *testing.T) {
+	saved, ok := os.LookupEnv(AnswersEnv)
+	defer func() {
+		if ok {
+			os.Setenv(AnswersEnv, saved)
+		} else {
+			os.Unsetenv(AnswersEnv)
+		}
+	}()
+
+	b, err := json.Marshal([]string{FormatAnswer("sshdump", "--remote-filter", "not port 22\nand not arp"), FormatAnswer("randpkt", "--count", "10")})
+	assert.NoError(t, err)
+	os.Setenv(AnswersEnv, string(b))
+
+	// A newline in a value doesn't split the answer
+	assert.Equal(t, map[string]string{"--remote-filter": "not port 22\nand not arp"}, EnvAnswers("sshdump"))
+	assert.Equal(t, map[string]string{"--count": "10"}, EnvAnswers("randpkt"))
+}
+
+func TestAnswers1(t *testing.T) {
+	iface, call, val, err := ParseAnswer(FormatAnswer("randpkt", "--count", "a=b"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"randpkt", "--count", "a=b"}, []string{iface, call, val})
+
+	for _, s := range []string{"", "randpkt", "randpkt count=1", " --count=1", "randpkt --count"} {
+		_, _, _, err = ParseAnswer(s)
+		assert.Error(t, err, s)
+	}
+
+	assert.Equal(t, map[string]string{"--count": "1"},
+		answersFor([]string{"randpkt --count=1", "sshdump --remote-host=x", "junk"}, "randpkt"))
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 78
+// End:
@@ -125,6 +125,16 @@ var FieldTypeMap = map[string]FieldType{
 	"FT_NUM_TYPES":         FT_NUM_TYPES,
 }
 
+// String returns the name tshark uses for the type e.g. FT_UINT16.
+func (t FieldType) String() string {
+	for k, v := range FieldTypeMap {
+		if v == t {
+			return k
+		}
+	}
+	return "FT_NONE"
+}
+
 func ParseFieldType(s string) (res FieldType, ok bool) {
 	res, ok = FieldTypeMap[s]
 	return
@@ -270,8 +280,21 @@ func dedup(s []string) []string {
 	return s[0 : i+1]
 }
 
+// Loaded returns true if the fields and protocols have been read from the
+// cache or from tshark.
+func (t *TSharkFields) Loaded() bool {
+	return t.ser != nil
+}
+
+// LookupField returns the field with the name provided e.g. tcp.port. Fields
+// are keyed by protocol, then by the rest of the name, which may itself
+// contain dots e.g. tcp.analysis.flags.
 func (t *TSharkFields) LookupField(name string) (bool, Field) {
-	fields := strings.Split(name, ".")
+	if t.ser == nil {
+		return false, Field{}
+	}
+
+	fields := strings.SplitN(name, ".", 2)
 
 	cur := t.ser.Fields.(map[string]interface{})
 	for i := 0; i < len(fields); i++ {
@@ -300,6 +323,83 @@ func (t *TSharkFields) LookupField(name string) (bool, Field) {
 	return false, Field{}
 }
 
+// IsProtocol returns true if name is a protocol tshark knows about e.g. tcp.
+func (t *TSharkFields) IsProtocol(name string) bool {
+	if t.ser == nil {
+		return false
+	}
+	_, ok := t.ser.Protocols[name]
+	return ok
+}
+
+// Protocols returns, in sorted order, the names of the protocols tshark knows
+// about.
+func (t *TSharkFields) Protocols() []string {
+	return t.ProtocolCompletions("")
+}
+
+// ProtocolFields returns, sorted by name, the fields of the protocol
+// provided e.g. tcp.port, tcp.flags.syn for tcp.
+func (t *TSharkFields) ProtocolFields(proto string) []Field {
+	res := make([]Field, 0)
+
+	if t.ser == nil {
+		return res
+	}
+
+	if fields, ok := t.ser.Fields.(map[string]interface{})[proto]; ok {
+		res = collectFields(fields, res)
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Name < res[j].Name
+	})
+
+	return res
+}
+
+func collectFields(val interface{}, res []Field) []Field {
+	switch val := val.(type) {
+	case Field:
+		res = append(res, val)
+	case map[string]interface{}:
+		for _, v := range val {
+			res = collectFields(v, res)
+		}
+	}
+	return res
+}
+
+// ProtocolCompletions returns, in sorted order, the names of the protocols
+// tshark knows about that start with prefix e.g. for a Decode As target.
+func (t *TSharkFields) ProtocolCompletions(prefix string) []string {
+	var err error
+	res := make([]string, 0)
+
+	t.once.Do(func() {
+		err = t.Init()
+	})
+
+	if err != nil {
+		log.Warnf("Protocol completion error: %v", err)
+	}
+
+	// might be nil if I am still loading from tshark -G
+	if t.ser == nil {
+		return res
+	}
+
+	for k, _ := range t.ser.Protocols {
+		if strings.HasPrefix(k, prefix) {
+			res = append(res, k)
+		}
+	}
+
+	sort.Strings(res)
+
+	return res
+}
+
 func (t *TSharkFields) Completions(prefix string, cb IPrefixCompleterCallback) {
 	var err error
 	res := make([]string, 0, 100)
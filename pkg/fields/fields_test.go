@@ -4,6 +4,7 @@
 package fields
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -25,6 +26,37 @@ func TestFields1(t *testing.T) {
 
 	assert.IsType(t, Field{}, m2)
 	assert.Equal(t, m2.(Field).Type, FT_UINT16)
+
+	ok, f := fields.LookupField("tcp.port")
+	assert.Equal(t, true, ok)
+	assert.Equal(t, FT_UINT16, f.Type)
+
+	ok, _ = fields.LookupField("tcp.analysis.flags")
+	assert.Equal(t, true, ok)
+
+	ok, _ = fields.LookupField("tcp.nosuchfield")
+	assert.Equal(t, false, ok)
+
+	assert.Equal(t, true, fields.IsProtocol("tcp"))
+	assert.Equal(t, false, fields.IsProtocol("tcp.port"))
+}
+
+func TestValues1(t *testing.T) {
+	vals, err := countValues(strings.NewReader("10.0.0.1\n10.0.0.2\t10.0.0.1\n\n10.0.0.3\n10.0.0.2\n10.0.0.1\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, []ValueCount{
+		{Value: "10.0.0.1", Count: 3},
+		{Value: "10.0.0.2", Count: 2},
+		{Value: "10.0.0.3", Count: 1},
+	}, vals)
+}
+
+func TestValueStrings1(t *testing.T) {
+	vals, err := parseValueStrings(strings.NewReader("V\tip.proto\t6\tTCP\nV\tip.proto\t17\tUDP\nR\tip.dsfield.dscp\t0\t7\tCS0\nT\ttcp.flags.syn\tSet\tNot set\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, []ValueString{{Value: "6", Name: "TCP"}, {Value: "17", Name: "UDP"}}, vals["ip.proto"])
+	assert.Equal(t, []ValueString{{Value: "1", Name: "Set"}, {Value: "0", Name: "Not set"}}, vals["tcp.flags.syn"])
+	assert.Equal(t, 2, len(vals))
 }
 
 //======================================================================
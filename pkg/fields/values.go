@@ -0,0 +1,188 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+package fields
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gcla/termshark/v2"
+	log "github.com/sirupsen/logrus"
+)
+
+//======================================================================
+
+// IValueCompleter provides completions for the value compared with a field
+// e.g. after "ip.addr == ". The prefix is what has been typed of the value so
+// far.
+type IValueCompleter interface {
+	ValueCompletions(field string, prefix string, cb IPrefixCompleterCallback)
+}
+
+// ValueCount is a value of a field found in a capture, and the number of
+// times it was seen.
+type ValueCount struct {
+	Value string
+	Count int
+}
+
+// Only keep this many of the most frequent values for each field
+const maxValues = 500
+
+// tshark joins multiple occurrences of a field in one packet with this
+const valueAggregator = "\t"
+
+type valuesKey struct {
+	pcap   string
+	filter string
+	field  string
+}
+
+type valuesEntry struct {
+	size   int64
+	values []ValueCount
+}
+
+// FieldValues computes, and caches, the values of fields found in a
+// capture. They are computed with tshark -T fields the first time they are
+// asked for, and again only if the file changes size e.g. during a live
+// capture.
+type FieldValues struct {
+	sync.Mutex
+	cache   map[valuesKey]valuesEntry
+	pending map[valuesKey]chan struct{}
+}
+
+func NewFieldValues() *FieldValues {
+	return &FieldValues{
+		cache:   make(map[valuesKey]valuesEntry),
+		pending: make(map[valuesKey]chan struct{}),
+	}
+}
+
+// Values returns the values of field in the packets of pcap that match
+// filter, most frequent first. The args are passed to tshark e.g. to apply
+// profile settings. This can take a while for a large capture, so should be
+// called outside of the UI goroutine.
+func (f *FieldValues) Values(pcap string, filter string, field string, args []string) ([]ValueCount, error) {
+	key := valuesKey{pcap: pcap, filter: filter, field: field}
+
+	for {
+		size, _ := termshark.FileSizeDifferentTo(pcap, -1)
+
+		f.Lock()
+		if entry, ok := f.cache[key]; ok && entry.size == size {
+			f.Unlock()
+			return entry.values, nil
+		}
+		// Another goroutine is running tshark for the same values - wait for it
+		if ch, ok := f.pending[key]; ok {
+			f.Unlock()
+			<-ch
+			continue
+		}
+		ch := make(chan struct{})
+		f.pending[key] = ch
+		f.Unlock()
+
+		values, err := runValues(pcap, filter, field, args)
+
+		f.Lock()
+		if err == nil {
+			f.cache[key] = valuesEntry{size: size, values: values}
+		}
+		delete(f.pending, key)
+		close(ch)
+		f.Unlock()
+
+		return values, err
+	}
+}
+
+// Clear drops all cached values e.g. when a new source is loaded.
+func (f *FieldValues) Clear() {
+	f.Lock()
+	defer f.Unlock()
+	f.cache = make(map[valuesKey]valuesEntry)
+}
+
+func runValues(pcap string, filter string, field string, args []string) ([]ValueCount, error) {
+	cmdArgs := []string{"-r", pcap, "-T", "fields", "-e", field, "-E", "occurrence=a", "-E", "aggregator=" + valueAggregator}
+	if filter != "" {
+		cmdArgs = append(cmdArgs, "-Y", filter)
+	}
+	cmdArgs = append(cmdArgs, args...)
+
+	cmd := exec.Command(termshark.TSharkBin(), cmdArgs...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	if err = cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	values, err := countValues(out)
+
+	if werr := cmd.Wait(); werr != nil {
+		log.Warnf("Could not read values of %s from %s: %v (%s)", field, pcap, werr, strings.TrimSpace(stderr.String()))
+		return nil, werr
+	}
+
+	return values, err
+}
+
+// countValues reads tshark -T fields output for a single field, one line per
+// packet, and returns the distinct values, most frequent first.
+func countValues(r io.Reader) ([]ValueCount, error) {
+	counts := make(map[string]int)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		for _, val := range strings.Split(scanner.Text(), valueAggregator) {
+			if val != "" {
+				counts[val]++
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	res := make([]ValueCount, 0, len(counts))
+	for val, count := range counts {
+		res = append(res, ValueCount{Value: val, Count: count})
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Count != res[j].Count {
+			return res[i].Count > res[j].Count
+		}
+		return res[i].Value < res[j].Value
+	})
+
+	if len(res) > maxValues {
+		res = res[0:maxValues]
+	}
+
+	return res, nil
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 78
+// End:
@@ -0,0 +1,107 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+package fields
+
+import (
+	"bufio"
+	"io"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/gcla/termshark/v2"
+)
+
+//======================================================================
+
+// ValueString is a named value of a field e.g. 6 is TCP for ip.proto.
+type ValueString struct {
+	Value string
+	Name  string
+}
+
+// ValueStrings holds the names tshark gives to the values of fields,
+// including the names of true and false for booleans. They are read once,
+// with tshark -G values, the first time they are needed.
+type ValueStrings struct {
+	once sync.Once
+	vals map[string][]ValueString
+	err  error
+}
+
+func NewValueStrings() *ValueStrings {
+	return &ValueStrings{}
+}
+
+// Lookup returns the named values of field, in the order tshark lists them.
+// The first call runs tshark, so should be made outside of the UI goroutine.
+func (v *ValueStrings) Lookup(field string) ([]ValueString, error) {
+	v.once.Do(func() {
+		v.vals, v.err = loadValueStrings()
+	})
+	if v.err != nil {
+		return nil, v.err
+	}
+	return v.vals[field], nil
+}
+
+func loadValueStrings() (map[string][]ValueString, error) {
+	cmd := exec.Command(termshark.TSharkBin(), []string{"-G", "values"}...)
+
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	if err = cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	res, err := parseValueStrings(out)
+
+	if werr := cmd.Wait(); werr != nil && err == nil {
+		err = werr
+	}
+
+	return res, err
+}
+
+// parseValueStrings reads the output of tshark -G values. The lines used look
+// like
+//
+//	V	ip.proto	6	TCP
+//	T	tcp.flags.syn	Set	Not set
+//
+// Range strings (R) are ignored.
+func parseValueStrings(r io.Reader) (map[string][]ValueString, error) {
+	res := make(map[string][]ValueString)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		switch {
+		case fields[0] == "V" && len(fields) >= 4:
+			res[fields[1]] = append(res[fields[1]], ValueString{Value: fields[2], Name: fields[3]})
+		case fields[0] == "T" && len(fields) >= 4:
+			res[fields[1]] = append(res[fields[1]],
+				ValueString{Value: "1", Name: fields[2]},
+				ValueString{Value: "0", Name: fields[3]},
+			)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 78
+// End:
@@ -0,0 +1,125 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+// Package fuzzy matches short patterns against strings the way command palettes do -
+// the characters of the pattern must appear in order, but not necessarily together.
+package fuzzy
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+//======================================================================
+
+const (
+	matchScore       = 1
+	consecutiveBonus = 5
+	wordStartBonus   = 8
+	firstCharBonus   = 10
+)
+
+// Match returns true if each character of pattern appears in target, in order,
+// ignoring case. The score is higher when the characters are consecutive or start
+// words, so "cs" scores better against "Conversation Statistics" than "Clear Last".
+// Every placement of the pattern is considered, not just the leftmost one, so the
+// "s" above is matched at "Statistics" rather than inside "Conversation". An empty
+// pattern matches everything with a score of 0.
+func Match(pattern string, target string) (int, bool) {
+	pat := []rune(strings.ToLower(pattern))
+	tgt := []rune(target)
+
+	if len(pat) == 0 {
+		return 0, true
+	}
+
+	// best[ti] is the highest score for the pattern so far with its last
+	// character at tgt[ti], or -1 if it can't end there.
+	best := make([]int, len(tgt))
+	next := make([]int, len(tgt))
+	for pi := 0; pi < len(pat); pi++ {
+		// Highest score for the previous characters ending before ti-1
+		before := -1
+		for ti := 0; ti < len(tgt); ti++ {
+			next[ti] = -1
+			if pi > 0 && ti >= 2 && best[ti-2] > before {
+				before = best[ti-2]
+			}
+			if unicode.ToLower(tgt[ti]) != pat[pi] {
+				continue
+			}
+			prev := 0
+			if pi > 0 {
+				prev = before
+				if ti >= 1 && best[ti-1] >= 0 && best[ti-1]+consecutiveBonus > prev {
+					prev = best[ti-1] + consecutiveBonus
+				}
+				if prev < 0 {
+					continue
+				}
+			}
+			next[ti] = prev + charScore(tgt, ti)
+		}
+		best, next = next, best
+	}
+
+	score := -1
+	for _, s := range best {
+		if s > score {
+			score = s
+		}
+	}
+	if score < 0 {
+		return 0, false
+	}
+	return score, true
+}
+
+func charScore(r []rune, i int) int {
+	score := matchScore
+	if i == 0 {
+		score += firstCharBonus
+	} else if isWordStart(r, i) {
+		score += wordStartBonus
+	}
+	return score
+}
+
+func isWordStart(r []rune, i int) bool {
+	p := r[i-1]
+	if !unicode.IsLetter(p) && !unicode.IsDigit(p) {
+		return true
+	}
+	return unicode.IsLower(p) && unicode.IsUpper(r[i])
+}
+
+// Rank returns the indices of the targets that match pattern, best first. Targets
+// with the same score keep their order.
+func Rank(pattern string, targets []string) []int {
+	type scored struct {
+		idx   int
+		score int
+	}
+	matches := make([]scored, 0, len(targets))
+	for i, t := range targets {
+		if score, ok := Match(pattern, t); ok {
+			matches = append(matches, scored{idx: i, score: score})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].score > matches[j].score
+	})
+	res := make([]int, 0, len(matches))
+	for _, m := range matches {
+		res = append(res, m.idx)
+	}
+	return res
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 90
+// End:
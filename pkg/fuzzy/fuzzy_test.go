@@ -0,0 +1,68 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+package fuzzy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+//======================================================================
+
+func TestMatch1(t *testing.T) {
+	_, ok := Match("conv", "Analysis: Conversations")
+	assert.True(t, ok)
+	_, ok = Match("CONV", "Analysis: Conversations")
+	assert.True(t, ok)
+	_, ok = Match("anco", "Analysis: Conversations")
+	assert.True(t, ok)
+	_, ok = Match("vnoc", "Analysis: Conversations")
+	assert.False(t, ok)
+	_, ok = Match("xyz", "Analysis: Conversations")
+	assert.False(t, ok)
+
+	score, ok := Match("", "anything")
+	assert.True(t, ok)
+	assert.Equal(t, 0, score)
+
+	s1, _ := Match("rs", "Reassemble stream")
+	s2, _ := Match("rs", "Refresh Screen")
+	s3, _ := Match("rs", "Capture file properties")
+	assert.Equal(t, s1, s2)
+	assert.True(t, s1 > s3)
+}
+
+func TestMatchWordStarts1(t *testing.T) {
+	// The leftmost "s" is inside "Conversation"; the word start should win
+	s1, ok := Match("cs", "Conversation Statistics")
+	assert.True(t, ok)
+	s2, _ := Match("cs", "Clear Last")
+	assert.True(t, s1 > s2)
+	assert.Equal(t, firstCharBonus+wordStartBonus+2*matchScore, s1)
+
+	// Consecutive characters still score when there's no better word start
+	s3, _ := Match("st", "Stats")
+	assert.Equal(t, firstCharBonus+consecutiveBonus+2*matchScore, s3)
+}
+
+func TestRank1(t *testing.T) {
+	targets := []string{
+		"Menu: Refresh Screen",
+		"Analysis: Reassemble stream",
+		":streams",
+		"Analysis: Conversations",
+	}
+	// Both match "stre" at the start of a word, so they keep their order
+	assert.Equal(t, []int{1, 2}, Rank("stre", targets))
+	assert.Equal(t, []int{0, 1, 2, 3}, Rank("", targets))
+	assert.Equal(t, []int{}, Rank("qqq", targets))
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 78
+// End:
@@ -0,0 +1,95 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+// Package jumplist keeps a browser-like history of the places the user has
+// jumped from, so they can go back and forward, like vim's jump list.
+package jumplist
+
+//======================================================================
+
+// Pos is one place in the history - the display filter applied, the packet
+// selected and the pane with focus.
+type Pos struct {
+	Filter string
+	Packet int
+	Pane   string // "list", "struct" or "hex"
+}
+
+// List holds the positions jumped from. When the user goes back, the current
+// position is kept at the end so they can go forward to it again.
+type List struct {
+	entries []Pos
+	idx     int // index of the current position, or len(entries) if it's not in the list
+	max     int
+}
+
+// New returns an empty list that keeps at most max positions.
+func New(max int) *List {
+	return &List{
+		entries: make([]Pos, 0),
+		max:     max,
+	}
+}
+
+// Add records pos as a place jumped from. Any positions that could have been
+// reached by going forward are discarded, like a browser.
+func (l *List) Add(pos Pos) {
+	if l.idx < len(l.entries) {
+		l.entries = l.entries[0:l.idx]
+	}
+	if len(l.entries) == 0 || l.entries[len(l.entries)-1] != pos {
+		l.entries = append(l.entries, pos)
+	}
+	if len(l.entries) > l.max {
+		l.entries = l.entries[len(l.entries)-l.max:]
+	}
+	l.idx = len(l.entries)
+}
+
+// Back returns the position before the current one, cur. It returns false if
+// there is none.
+func (l *List) Back(cur Pos) (Pos, bool) {
+	if l.idx == len(l.entries) {
+		if l.idx == 0 {
+			return Pos{}, false
+		}
+		l.Add(cur)
+		l.idx = len(l.entries) - 1
+	}
+	if l.idx == 0 {
+		return Pos{}, false
+	}
+	l.idx--
+	return l.entries[l.idx], true
+}
+
+// Forward returns the position after the current one, if the user has gone
+// back. It returns false if there is none.
+func (l *List) Forward() (Pos, bool) {
+	if l.idx+1 >= len(l.entries) {
+		return Pos{}, false
+	}
+	l.idx++
+	return l.entries[l.idx], true
+}
+
+// Entries returns the positions in the list, oldest first, and the index of
+// the current position - len(entries) if it's newer than them all.
+func (l *List) Entries() ([]Pos, int) {
+	res := make([]Pos, len(l.entries))
+	copy(res, l.entries)
+	return res, l.idx
+}
+
+// Clear empties the list.
+func (l *List) Clear() {
+	l.entries = l.entries[:0]
+	l.idx = 0
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 78
+// End:
@@ -0,0 +1,82 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+package jumplist
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+//======================================================================
+
+func TestJumps1(t *testing.T) {
+	l := New(10)
+	_, ok := l.Back(Pos{Packet: 1})
+	assert.False(t, ok)
+
+	l.Add(Pos{Packet: 1})
+	l.Add(Pos{Packet: 5})
+	l.Add(Pos{Packet: 5}) // not repeated
+
+	p, ok := l.Back(Pos{Packet: 9})
+	assert.True(t, ok)
+	assert.Equal(t, Pos{Packet: 5}, p)
+	p, ok = l.Back(p)
+	assert.True(t, ok)
+	assert.Equal(t, Pos{Packet: 1}, p)
+	_, ok = l.Back(p)
+	assert.False(t, ok)
+
+	p, ok = l.Forward()
+	assert.True(t, ok)
+	assert.Equal(t, Pos{Packet: 5}, p)
+	p, ok = l.Forward()
+	assert.True(t, ok)
+	assert.Equal(t, Pos{Packet: 9}, p)
+	_, ok = l.Forward()
+	assert.False(t, ok)
+
+	entries, idx := l.Entries()
+	assert.Equal(t, []Pos{{Packet: 1}, {Packet: 5}, {Packet: 9}}, entries)
+	assert.Equal(t, 2, idx)
+}
+
+func TestJumps2(t *testing.T) {
+	l := New(4)
+	l.Add(Pos{Packet: 1})
+	l.Add(Pos{Packet: 2, Filter: "tcp"})
+	l.Add(Pos{Packet: 3})
+
+	// Going back then jumping somewhere new discards what was ahead
+	p, _ := l.Back(Pos{Packet: 4})
+	p, _ = l.Back(p)
+	assert.Equal(t, Pos{Packet: 2, Filter: "tcp"}, p)
+	l.Add(Pos{Packet: 2, Filter: "tcp", Pane: "hex"})
+	_, ok := l.Forward()
+	assert.False(t, ok)
+
+	entries, idx := l.Entries()
+	assert.Equal(t, []Pos{{Packet: 1}, {Packet: 2, Filter: "tcp", Pane: "hex"}}, entries)
+	assert.Equal(t, 2, idx)
+
+	// Only the newest are kept
+	l.Add(Pos{Packet: 7})
+	l.Add(Pos{Packet: 8})
+	l.Add(Pos{Packet: 9})
+	entries, _ = l.Entries()
+	assert.Equal(t, []Pos{{Packet: 2, Filter: "tcp", Pane: "hex"}, {Packet: 7}, {Packet: 8}, {Packet: 9}}, entries)
+
+	l.Clear()
+	entries, idx = l.Entries()
+	assert.Equal(t, 0, len(entries))
+	assert.Equal(t, 0, idx)
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 78
+// End:
@@ -14,9 +14,11 @@ import (
 
 	"github.com/gcla/termshark/v2"
 	"github.com/gcla/termshark/v2/configs/profiles"
-	"github.com/gcla/termshark/v2/pkg/summary"
+	"github.com/gcla/termshark/v2/pkg/extcap"
 	"github.com/gcla/termshark/v2/pkg/shark"
+	"github.com/gcla/termshark/v2/pkg/summary"
 	"github.com/kballard/go-shellquote"
+	"github.com/spf13/viper"
 )
 
 //======================================================================
@@ -107,6 +109,30 @@ func (c *Command) Pid() int {
 
 //======================================================================
 
+// ProfileArgs returns the tshark flags that follow from settings held in the
+// current termshark profile, such as a TLS keylog file, Decode As rules or
+// preference overrides. Each tshark process that dissects packets includes
+// these, so a reload picks up any change.
+func ProfileArgs() []string {
+	return ProfileArgsFrom(profiles.Current())
+}
+
+func ProfileArgsFrom(v *viper.Viper) []string {
+	res := make([]string, 0)
+	if keylog := shark.TLSKeylogFileFrom(v); keylog != "" {
+		res = append(res, "-o", fmt.Sprintf("tls.keylog_file:%s", keylog))
+	}
+	for _, rule := range shark.GetDecodeAsFrom(v) {
+		res = append(res, "-d", rule.String())
+	}
+	for _, pref := range shark.GetPrefOverridesFrom(v) {
+		res = append(res, "-o", pref.String())
+	}
+	return res
+}
+
+//======================================================================
+
 type Commands struct {
 	DecodeAs []string
 	Args     []string
@@ -126,11 +152,14 @@ func MakeCommands(decodeAs []string, args []string, pdml []string, psml []string
 }
 
 var _ ILoaderCmds = Commands{}
+var _ IWatchCmds = Commands{}
 
 func (c Commands) Iface(ifaces []string, captureFilter string, tmpfile string) IBasicCommand {
 	args := make([]string, 0)
 	for _, iface := range ifaces {
 		args = append(args, "-i", iface)
+		// Snaplen, promiscuous mode etc apply to the preceding -i
+		args = append(args, shark.GetCaptureOptions(iface).Args()...)
 	}
 	args = append(args, "-w", tmpfile)
 	if captureFilter != "" {
@@ -151,8 +180,9 @@ func (c Commands) Iface(ifaces []string, captureFilter string, tmpfile string) I
 	// which will then run dumpcap and if that fails, tshark. The idea
 	// is to use the most specialized/efficient capture method if that
 	// works, but fall back to tshark if needed e.g. for randpkt, sshcapture, etc
-	// (extcap interfaces).
-	res.Cmd.Env = append(os.Environ(), "TERMSHARK_CAPTURE_MODE=1")
+	// (extcap interfaces). Extcap interfaces the user has configured are run by
+	// termshark itself, with the answers passed in the environment.
+	res.Cmd.Env = append(extcap.Environ(ifaces), "TERMSHARK_CAPTURE_MODE=1")
 	res.Cmd.Stdin = os.Stdin
 	res.Cmd.Stderr = os.Stderr
 	res.Cmd.Stdout = os.Stdout
@@ -212,6 +242,7 @@ func (c Commands) Psml(pcap interface{}, displayFilter string) IPcapCommand {
 	if c.Color {
 		args = append(args, "--color")
 	}
+	args = append(args, ProfileArgs()...)
 	args = append(args, c.PsmlArgs...)
 	args = append(args, c.Args...)
 
@@ -229,12 +260,22 @@ func (c Commands) Psml(pcap interface{}, displayFilter string) IPcapCommand {
 	return &Command{Cmd: cmd}
 }
 
+// Watch is like Psml, but has tshark run the Lua script from
+// shark.WatchScript, so the same process checks each packet against the
+// watch filters.
+func (c Commands) Watch(pcap interface{}, displayFilter string, script string) IPcapCommand {
+	cmd := c.Psml(pcap, displayFilter).(*Command)
+	cmd.Args = append(cmd.Args, "-X", "lua_script:"+script)
+	return cmd
+}
+
 func (c Commands) Pcap(pcap string, displayFilter string) IPcapCommand {
 	// need to use stdout and -w - otherwise, tshark writes one-line text output
 	args := []string{"-r", pcap, "-x"}
 	if displayFilter != "" {
 		args = append(args, "-Y", displayFilter)
 	}
+	args = append(args, ProfileArgs()...)
 	args = append(args, c.Args...)
 	return &Command{Cmd: exec.Command(termshark.TSharkBin(), args...)}
 }
@@ -250,6 +291,7 @@ func (c Commands) Pdml(pcap string, displayFilter string) IPcapCommand {
 	for _, arg := range c.DecodeAs {
 		args = append(args, "-d", arg)
 	}
+	args = append(args, ProfileArgs()...)
 	args = append(args, c.PdmlArgs...)
 	args = append(args, c.Args...)
 
@@ -0,0 +1,133 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+package pcap
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+//======================================================================
+
+// DataSource is one of the sources of a packet's bytes. The first is always
+// the frame itself; others hold e.g. reassembled, decompressed or decrypted
+// data.
+type DataSource struct {
+	Name string // e.g. "Frame (66 bytes)", "Reassembled TCP (2920 bytes)"
+	Data []byte
+}
+
+// FrameSourceName names the frame's data source when it is the packet's only
+// one - tshark -x doesn't name it then.
+const FrameSourceName = "Frame"
+
+// tshark -x precedes each data source with its name when a packet has more than one
+var dataSourceRe = regexp.MustCompile(`^([^ ].* \([0-9]+ bytes?\)):$`)
+
+// hexDumpParser reads the output of tshark -x one line at a time. Each packet
+// is a hexdump of each of its data sources, then a blank line e.g.
+//
+//	Frame (1514 bytes):
+//	0000  00 0c 29 6b a9 f7 00 04 96 98 89 ab 08 00 45 00   ..)k..........E.
+//	...
+//	Reassembled TCP (2920 bytes):
+//	0000  48 54 54 50 2f 31 2e 31 20 32 30 30 20 4f 4b 0d   HTTP/1.1 200 OK.
+//	...
+type hexDumpParser struct {
+	sources []DataSource
+}
+
+// parseLine reads one line of tshark -x output. When the line ends a packet,
+// it returns the packet's data sources and true. A line that is neither a
+// data source's name nor part of a hexdump is skipped, and an error returned.
+func (p *hexDumpParser) parseLine(line string) ([]DataSource, bool, error) {
+	line = strings.TrimRight(line, "\r\n")
+
+	if strings.TrimSpace(line) == "" {
+		res := p.sources
+		if len(res) == 0 {
+			res = []DataSource{{Name: FrameSourceName, Data: []byte{}}}
+		}
+		p.sources = nil
+		return res, true, nil
+	}
+
+	if m := dataSourceRe.FindStringSubmatch(line); m != nil {
+		p.sources = append(p.sources, DataSource{Name: m[1], Data: make([]byte, 0)})
+		return nil, false, nil
+	}
+
+	bytes, ok := parseHexDumpLine(line)
+	if !ok {
+		return nil, false, fmt.Errorf("Unexpected hexdump line: %q", line)
+	}
+	if len(p.sources) == 0 {
+		p.sources = append(p.sources, DataSource{Name: FrameSourceName, Data: make([]byte, 0)})
+	}
+	cur := &p.sources[len(p.sources)-1]
+	cur.Data = append(cur.Data, bytes...)
+
+	return nil, false, nil
+}
+
+// parseHexDumpLine returns the bytes in a line like
+//
+//	0010  05 9f 6a 5d 40 00 40 2f 99 96 0a 36 74 ae 0a 36   ..j]@.@/...6t..6
+//
+// A line holds at most 16 bytes, and the ASCII follows the last of them after
+// some spaces - so stop reading at whichever comes first, because the ASCII
+// might itself look like hex.
+func parseHexDumpLine(line string) ([]byte, bool) {
+	i := 0
+	for i < len(line) && isHexDigit(line[i]) {
+		i++
+	}
+	if i < 4 || i >= len(line) || line[i] != ' ' {
+		return nil, false
+	}
+
+	res := make([]byte, 0, 16)
+	for len(res) < 16 {
+		spaces := 0
+		for i < len(line) && line[i] == ' ' {
+			spaces++
+			i++
+		}
+		// The first byte follows the offset after two spaces; others are
+		// separated by one, or two in the middle of the line
+		if spaces == 0 || spaces > 2 || i+2 > len(line) || !isHexDigit(line[i]) || !isHexDigit(line[i+1]) {
+			break
+		}
+		if i+2 < len(line) && line[i+2] != ' ' {
+			break
+		}
+		res = append(res, hexValue(line[i])<<4|hexValue(line[i+1]))
+		i += 2
+	}
+
+	return res, len(res) > 0
+}
+
+func isHexDigit(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+func hexValue(c byte) byte {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0'
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10
+	default:
+		return c - 'A' + 10
+	}
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 78
+// End:
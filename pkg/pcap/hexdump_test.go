@@ -0,0 +1,89 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+package pcap
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+//======================================================================
+
+func parseHexDump(dump string) [][]DataSource {
+	res := make([][]DataSource, 0)
+	var p hexDumpParser
+	for _, line := range strings.SplitAfter(dump, "\n") {
+		if line == "" {
+			continue
+		}
+		if sources, ok, err := p.parseLine(line); err == nil && ok {
+			res = append(res, sources)
+		}
+	}
+	return res
+}
+
+func TestHexDump1(t *testing.T) {
+	dump := `0000  00 0c 29 6b a9 f7 00 04 96 98 89 ab 08 00 45 00   ..)k..........E.
+0010  00 20 ab cd                                       . ..
+
+Frame (18 bytes):
+0000  00 0c 29 6b a9 f7 00 04  96 98 89 ab 08 00 45 00   ..)k.... ......E.
+0010  de ad                                              ..
+Reassembled TCP (5 bytes):
+0000  48 54 54 50 2f                                    HTTP/
+
+`
+	packets := parseHexDump(dump)
+	assert.Equal(t, 2, len(packets))
+
+	// The ASCII isn't mistaken for bytes
+	assert.Equal(t, []DataSource{
+		{Name: FrameSourceName, Data: []byte{
+			0x00, 0x0c, 0x29, 0x6b, 0xa9, 0xf7, 0x00, 0x04, 0x96, 0x98, 0x89, 0xab, 0x08, 0x00, 0x45, 0x00,
+			0x00, 0x20, 0xab, 0xcd,
+		}},
+	}, packets[0])
+
+	assert.Equal(t, 2, len(packets[1]))
+	assert.Equal(t, "Frame (18 bytes)", packets[1][0].Name)
+	assert.Equal(t, 18, len(packets[1][0].Data))
+	assert.Equal(t, []byte{0xde, 0xad}, packets[1][0].Data[16:])
+	assert.Equal(t, DataSource{Name: "Reassembled TCP (5 bytes)", Data: []byte("HTTP/")}, packets[1][1])
+}
+
+func TestHexDump2(t *testing.T) {
+	_, ok := parseHexDumpLine("Decrypted TLS (41 bytes):")
+	assert.False(t, ok)
+	_, ok = parseHexDumpLine("abc  00 01")
+	assert.False(t, ok)
+	b, ok := parseHexDumpLine("0000  ab cd ef 01 23 45 67 89 ab cd ef 01 23 45 67 89  ab cd ef 01")
+	assert.True(t, ok)
+	assert.Equal(t, 16, len(b))
+}
+
+func TestHexDump3(t *testing.T) {
+	var p hexDumpParser
+	_, _, err := p.parseLine("0000  00 01 02 03                                       ....\n")
+	assert.NoError(t, err)
+
+	// A malformed line is reported, and the rest of the packet still parsed
+	_, _, err = p.parseLine("0010  zz 01\n")
+	assert.Error(t, err)
+	_, _, err = p.parseLine("0010  04 05                                             ..\n")
+	assert.NoError(t, err)
+	sources, done, err := p.parseLine("\n")
+	assert.NoError(t, err)
+	assert.True(t, done)
+	assert.Equal(t, []DataSource{{Name: FrameSourceName, Data: []byte{0, 1, 2, 3, 4, 5}}}, sources)
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 78
+// End:
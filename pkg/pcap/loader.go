@@ -10,6 +10,7 @@ import (
 	"encoding/xml"
 	"fmt"
 	"io"
+	"math"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -137,7 +138,9 @@ func (c *PacketLoader) Renew() {
 	if c.ParentLoader != nil {
 		c.ParentLoader.CloseMain()
 	}
+	watcher := c.ParentLoader.watcher
 	c.ParentLoader = NewPcapLoader(c.ParentLoader.cmds, c.runner, c.ParentLoader.opt)
+	c.ParentLoader.watcher = watcher
 }
 
 type ParentLoader struct {
@@ -163,6 +166,8 @@ type ParentLoader struct {
 
 	runner IMainRunner
 	opt    Options // held only to pass to the PDML and PSML loaders when renewed
+
+	watcher IWatcher // if set, the PSML process of a live capture checks its watch filters too
 }
 
 type InterfaceLoader struct {
@@ -275,6 +280,7 @@ type iPsmlLoaderEnv interface {
 	DisplayFilter() string
 	InterfaceFile() string
 	PacketSources() []IPacketSource
+	Watcher() IWatcher
 }
 
 // IMainRunner is implemented by a type that runs a closure on termshark's main loop
@@ -381,6 +387,12 @@ func (p *ParentLoader) CaptureFilter() string {
 	return p.captureFilter
 }
 
+// SetCaptureFilter changes the capture filter used when the interface capture
+// is next started - for example, when ClearPcap restarts it.
+func (p *ParentLoader) SetCaptureFilter(filter string) {
+	p.captureFilter = filter
+}
+
 func (p *ParentLoader) TurnOffPipe() {
 	// Switch over to  the temp pcap file. If a new filter is applied
 	// after stopping, we should read from the temp file and not the fifo
@@ -395,6 +407,17 @@ func (p *ParentLoader) PacketSources() []IPacketSource {
 	return p.psrcs
 }
 
+// SetWatcher has the PSML process of each live capture check the packets
+// against the watcher's filters too. Call from the main goroutine before
+// loading; it's kept when the loader is renewed.
+func (p *ParentLoader) SetWatcher(w IWatcher) {
+	p.watcher = w
+}
+
+func (p *ParentLoader) Watcher() IWatcher {
+	return p.watcher
+}
+
 func (p *ParentLoader) PsmlStoppedDeliberately() bool {
 	return p.psmlStoppedDeliberately_
 }
@@ -734,7 +757,7 @@ type iPdmlLoaderEnv interface {
 	StartStage2ChanFn() chan struct{}
 	PacketCacheFn() *lru.Cache // i -> [pdml(i * 1000)..pdml(i+1*1000)]
 	updateCacheEntryWithPdml(row int, pdml []IPdmlPacket, done bool)
-	updateCacheEntryWithPcap(row int, pcap [][]byte, done bool)
+	updateCacheEntryWithPcap(row int, pcap [][]byte, sources [][]DataSource, done bool)
 	LengthOfPdmlCacheEntry(row int) (int, error)
 	LengthOfPcapCacheEntry(row int) (int, error)
 	CacheAt(row int) (CacheEntry, bool)
@@ -1221,11 +1244,11 @@ func (c *PdmlLoader) loadPcapSync(row int, visible bool, ps iPdmlLoaderEnv, cb i
 			pcapPidChan <- pid
 
 			packets := make([][]byte, 0, c.opt.PacketsPerLoad)
+			sources := make([][]DataSource, 0, c.opt.PacketsPerLoad)
 			issuedKill := false
 			readAllRequiredPcap := false
-			re := regexp.MustCompile(`([0-9a-f][0-9a-f] )`)
 			rd := bufio.NewReader(pcapOut)
-			packet := make([]byte, 0)
+			var parser hexDumpParser
 
 			for {
 				line, err := rd.ReadString('\n')
@@ -1240,14 +1263,21 @@ func (c *PdmlLoader) loadPcapSync(row int, visible bool, ps iPdmlLoaderEnv, cb i
 					break
 				}
 
-				parseResults := re.FindAllStringSubmatch(string(line), -1)
-
-				if len(parseResults) < 1 {
-					packets = append(packets, packet)
-					packet = make([]byte, 0)
+				// The frame's bytes are followed by any other data sources e.g. reassembled TCP
+				packetSources, done, err := parser.parseLine(line)
+				if err != nil {
+					err = fmt.Errorf("Could not read PCAP packet: %v", err)
+					if !issuedKill {
+						HandleError(PdmlCode, app, err, cb)
+					}
+					continue
+				}
+				if done {
+					packets = append(packets, packetSources[0].Data)
+					sources = append(sources, packetSources)
 
 					readEnough := (len(packets) >= c.KillAfterReadingThisMany)
-					ps.updateCacheEntryWithPcap(row, packets, false)
+					ps.updateCacheEntryWithPcap(row, packets, sources, false)
 
 					if readEnough && !issuedKill {
 						// Shortcut - we never take more than abcdex - so just kill here
@@ -1255,19 +1285,6 @@ func (c *PdmlLoader) loadPcapSync(row int, visible bool, ps iPdmlLoaderEnv, cb i
 						readAllRequiredPcap = true
 						pcapCancelFn()
 					}
-				} else {
-					// Ignore line number
-					for _, parsedByte := range parseResults[1:] {
-						b, err := strconv.ParseUint(string(parsedByte[0][0:2]), 16, 8)
-						if err != nil {
-							err = fmt.Errorf("Could not read PCAP packet: %v", err)
-							if !issuedKill {
-								HandleError(PdmlCode, app, err, cb)
-							}
-							break
-						}
-						packet = append(packet, byte(b))
-					}
 				}
 			}
 
@@ -1285,7 +1302,7 @@ func (c *PdmlLoader) loadPcapSync(row int, visible bool, ps iPdmlLoaderEnv, cb i
 			if !ps.ReadingFromFifo() && readAllRequiredPcap {
 				markComplete = true
 			}
-			ps.updateCacheEntryWithPcap(row, packets, markComplete)
+			ps.updateCacheEntryWithPcap(row, packets, sources, markComplete)
 
 		}, &c.stage2Wg, Goroutinewg)
 
@@ -1513,10 +1530,34 @@ func (p *PsmlLoader) loadPsmlSync(iloader *InterfaceLoader, e iPsmlLoaderEnv, cb
 			}
 		}
 
+		// The packets of a live capture are checked against the watch filters by the
+		// same process, using a Lua script - so a watch needs no process of its own.
+		var watchFilters []string
+		watcher := e.Watcher()
+		wcmds, canWatch := e.Commands().(IWatchCmds)
+		if p.ReadingFromFifo() && watcher != nil && canWatch {
+			watchFilters = watcher.WatchFilters()
+		}
+		watchScript := ""
+		if len(watchFilters) > 0 {
+			watchScript, err = writeWatchScript(watchFilters)
+			if err != nil {
+				log.Warnf("Could not write watch script: %v", err)
+				watchFilters = nil
+			} else {
+				defer os.Remove(watchScript)
+			}
+		}
+
 		// Set c.PsmlCmd before it's referenced in the goroutine below. We want to be
 		// sure that if if psmlCmd is nil then that means the process has finished (not
 		// has not yet started)
-		p.PsmlCmd = e.Commands().Psml(p.PcapPsml, e.DisplayFilter())
+		watched := &watchMatches{watcher: watcher}
+		if watchScript != "" {
+			p.PsmlCmd = wcmds.Watch(p.PcapPsml, e.DisplayFilter(), watchScript)
+		} else {
+			p.PsmlCmd = e.Commands().Psml(p.PcapPsml, e.DisplayFilter())
+		}
 
 		// this channel always needs to be signalled or else the goroutine below won't terminate.
 		// Closing it will pass a zero-value int (pid) to the goroutine which will understand that
@@ -1840,6 +1881,8 @@ func (p *PsmlLoader) loadPsmlSync(iloader *InterfaceLoader, e iPsmlLoaderEnv, cb
 					})
 					p.Unlock()
 
+					watched.packet(pidx, curPsml[1:])
+
 				case "section":
 					ready = false
 					// Means we got </section> without any char data i.e. empty <section>
@@ -1852,6 +1895,11 @@ func (p *PsmlLoader) loadPsmlSync(iloader *InterfaceLoader, e iPsmlLoaderEnv, cb
 				switch tok.Name.Local {
 				case "structure":
 					structure = true
+				case "watch":
+					// Written by the watch script - not part of the PSML
+					if rule, frame, ok := parseWatchElement(tok); ok && rule < len(watchFilters) {
+						watched.matched(watchFilters[rule], frame)
+					}
 				case "packet":
 					curPsml = make([]string, 0, 10)
 					curCounts = make([]int, 0, 10)
@@ -1887,6 +1935,9 @@ func (p *PsmlLoader) loadPsmlSync(iloader *InterfaceLoader, e iPsmlLoaderEnv, cb
 			}
 		}
 
+		// No more packets will be read, so any still pending were hidden
+		watched.flush(math.MaxInt32, nil)
+
 	}, Goroutinewg)
 
 }
@@ -1978,7 +2029,7 @@ func (p *PsmlLoader) updateCacheEntryWithPdml(row int, pdml []IPdmlPacket, done
 	p.PacketCache.Add(row, ce)
 }
 
-func (p *PsmlLoader) updateCacheEntryWithPcap(row int, pcap [][]byte, done bool) {
+func (p *PsmlLoader) updateCacheEntryWithPcap(row int, pcap [][]byte, sources [][]DataSource, done bool) {
 	var ce CacheEntry
 	p.Lock()
 	defer p.Unlock()
@@ -1986,6 +2037,7 @@ func (p *PsmlLoader) updateCacheEntryWithPcap(row int, pcap [][]byte, done bool)
 		ce = ce2.(CacheEntry)
 	}
 	ce.Pcap = pcap
+	ce.DataSources = sources
 	ce.PcapComplete = done
 	p.PacketCache.Add(row, ce)
 }
@@ -2103,6 +2155,10 @@ func (i *InterfaceLoader) loadIfacesSync(e iIfaceLoaderEnv, cb interface{}, app
 	// Process goroutine
 
 	termshark.TrackedGo(func() {
+		e.MainRun(gowid.RunFunction(func(app gowid.IApp) {
+			HandleBegin(IfaceCode, app, cb)
+		}))
+
 		defer func() {
 			// if psrc is a PipeSource, then we open /dev/fd/3 in termshark, and reroute descriptor
 			// stdin to number 3 when termshark starts. So to kill the process writing in, we need
@@ -2114,6 +2170,7 @@ func (i *InterfaceLoader) loadIfacesSync(e iIfaceLoaderEnv, cb interface{}, app
 			}
 
 			e.MainRun(gowid.RunFunction(func(gowid.IApp) {
+				HandleEnd(IfaceCode, app, cb)
 				i.state = NotLoading
 				i.ifaceCancelFn = nil
 			}))
@@ -2255,7 +2312,8 @@ func (c *InterfaceLoader) IsLoading() bool {
 
 type CacheEntry struct {
 	Pdml         []IPdmlPacket
-	Pcap         [][]byte
+	Pcap         [][]byte       // the bytes of each frame
+	DataSources  [][]DataSource // each packet's data sources, starting with the frame
 	PdmlComplete bool
 	PcapComplete bool
 }
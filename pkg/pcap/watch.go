@@ -0,0 +1,261 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+package pcap
+
+import (
+	"context"
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+
+	"github.com/gcla/termshark/v2"
+	"github.com/gcla/termshark/v2/pkg/format"
+	"github.com/gcla/termshark/v2/pkg/shark"
+	log "github.com/sirupsen/logrus"
+)
+
+//======================================================================
+
+// IWatchCmds is implemented by loader commands that can have the PSML
+// process check a live capture against watch filters too.
+type IWatchCmds interface {
+	ILoaderCmds
+	Watch(pcap interface{}, displayFilter string, script string) IPcapCommand
+}
+
+// IWatcher is given to the loader with SetWatcher to have the PSML process of
+// each live capture check the packets against extra display filters. The
+// process reads the packets anyway, so no other is needed. Needs tshark built
+// with Lua - see termshark.TSharkSupportsLua.
+type IWatcher interface {
+	// WatchFilters returns the filters to check. It's called as each PSML load of a
+	// live capture starts, not in the app goroutine.
+	WatchFilters() []string
+	// WatchMatched is called, not in the app goroutine, when a packet matches one of
+	// the filters, with the packet's PSML sections. If the display filter hides the
+	// packet, row is nil.
+	WatchMatched(filter string, frame int, row []string)
+}
+
+type watchMatch struct {
+	filter string
+	frame  int
+}
+
+// watchMatches holds the matches for packets whose PSML hasn't been read yet.
+// The watch script reports a match before tshark prints the packet, if it
+// prints it at all.
+type watchMatches struct {
+	watcher IWatcher
+	pending []watchMatch
+}
+
+// matched records a match from the watch script. Packets before frame that
+// are still pending were hidden by the display filter.
+func (w *watchMatches) matched(filter string, frame int) {
+	w.flush(frame-1, nil)
+	w.pending = append(w.pending, watchMatch{filter: filter, frame: frame})
+}
+
+// packet passes on the matches for the packet just read, with its PSML
+// sections. Any before it were hidden by the display filter.
+func (w *watchMatches) packet(frame int, row []string) {
+	w.flush(frame-1, nil)
+	w.flush(frame, row)
+}
+
+// flush passes on the matches up to and including frame, with row.
+func (w *watchMatches) flush(frame int, row []string) {
+	i := 0
+	for ; i < len(w.pending) && w.pending[i].frame <= frame; i++ {
+		w.watcher.WatchMatched(w.pending[i].filter, w.pending[i].frame, row)
+	}
+	w.pending = w.pending[i:]
+}
+
+// WatchPsml follows a live capture file the way the loader's PSML pipeline
+// does - tail -f tmp | tshark -r - -T psml - but with its own display
+// filter, and calls cb with the PSML row of each packet that matches. The
+// first element of each row is the packet number. It returns when ctx is
+// cancelled or the processes end. It's for tshark without Lua, which can't
+// use an IWatcher.
+func WatchPsml(ctx context.Context, cmds ILoaderCmds, tmpfile string, filter string, cb func([]string)) error {
+	return followCapture(ctx, cmds, tmpfile,
+		func(r io.Reader) IPcapCommand {
+			return cmds.Psml(r, filter)
+		},
+		func(out io.Reader) error {
+			return ReadPsmlRows(out, cb)
+		},
+	)
+}
+
+// writeWatchScript writes the Lua script from shark.WatchScript for the
+// filters to a temporary file, and returns its name.
+func writeWatchScript(filters []string) (string, error) {
+	script, err := ioutil.TempFile("", "termshark-watch-*.lua")
+	if err != nil {
+		return "", err
+	}
+
+	_, err = script.WriteString(shark.WatchScript(filters))
+	if cerr := script.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(script.Name())
+		return "", err
+	}
+
+	return script.Name(), nil
+}
+
+// parseWatchElement returns the rule and frame of a <watch rule="i" frame="n"/>
+// element written by the script from shark.WatchScript.
+func parseWatchElement(tok xml.StartElement) (int, int, bool) {
+	rule, frame := -1, -1
+	for _, attr := range tok.Attr {
+		i, err := strconv.Atoi(attr.Value)
+		if err != nil {
+			return 0, 0, false
+		}
+		switch attr.Name.Local {
+		case "rule":
+			rule = i
+		case "frame":
+			frame = i
+		}
+	}
+	if rule < 0 || frame < 0 {
+		return 0, 0, false
+	}
+	return rule, frame, true
+}
+
+// followCapture pipes tail -f tmpfile into the tshark command made by
+// mkcmd, and reads its output with read until ctx is cancelled or the
+// processes end.
+func followCapture(ctx context.Context, cmds ILoaderCmds, tmpfile string, mkcmd func(io.Reader) IPcapCommand, read func(io.Reader) error) error {
+	var err error
+
+	waitForFileData(ctx, tmpfile, func(e error) {
+		err = e
+	})
+	if err != nil {
+		return err
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+
+	tailCmd := cmds.Tail(tmpfile)
+	tailCmd.SetStdout(pw)
+	psmlCmd := mkcmd(pr)
+
+	psmlOut, err := psmlCmd.StdoutReader()
+	if err != nil {
+		pr.Close()
+		pw.Close()
+		return err
+	}
+
+	err = psmlCmd.Start()
+	// tshark has its own copy now
+	pr.Close()
+	if err != nil {
+		pw.Close()
+		return err
+	}
+
+	err = tailCmd.Start()
+	pw.Close()
+	if err != nil {
+		termshark.KillIfPossible(psmlCmd)
+		psmlCmd.Wait()
+		return err
+	}
+
+	done := make(chan struct{})
+	termshark.TrackedGo(func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
+		for _, cmd := range []IBasicCommand{tailCmd, psmlCmd} {
+			if err := termshark.KillIfPossible(cmd); err != nil {
+				log.Infof("Did not kill watch process: %v", err)
+			}
+		}
+	}, Goroutinewg)
+
+	err = read(psmlOut)
+
+	close(done)
+	tailCmd.Wait()
+	psmlCmd.Wait()
+
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+// ReadPsmlRows reads PSML and calls cb with the sections of each packet.
+func ReadPsmlRows(r io.Reader, cb func([]string)) error {
+	d := xml.NewDecoder(r)
+
+	var row []string
+	inPacket := false
+	inSection := false
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			switch tok.Name.Local {
+			case "packet":
+				row = make([]string, 0, 10)
+				inPacket = true
+			case "section":
+				if inPacket {
+					row = append(row, "")
+					inSection = true
+				}
+			}
+		case xml.EndElement:
+			switch tok.Name.Local {
+			case "packet":
+				if inPacket {
+					cb(row)
+				}
+				inPacket = false
+			case "section":
+				inSection = false
+			}
+		case xml.CharData:
+			if inSection {
+				row[len(row)-1] += string(format.TranslateHexCodes(tok))
+			}
+		}
+	}
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 78
+// End:
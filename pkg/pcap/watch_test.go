@@ -0,0 +1,112 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+package pcap
+
+import (
+	"encoding/xml"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+//======================================================================
+
+func TestReadPsmlRows1(t *testing.T) {
+	psml := `<?xml version="1.0" encoding="utf-8"?>
+<psml version="0" creator="wireshark/3.6.2">
+<structure>
+<section>No.</section>
+<section>Protocol</section>
+<section>Info</section>
+</structure>
+
+<packet>
+<section>3</section>
+<section>DNS</section>
+<section>Standard query 0x1234 A example.com</section>
+</packet>
+
+<packet>
+<section>7</section>
+<section></section>
+<section>a &amp; b</section>
+</packet>
+
+</psml>
+`
+	rows := make([][]string, 0)
+	err := ReadPsmlRows(strings.NewReader(psml), func(row []string) {
+		rows = append(rows, row)
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{
+		{"3", "DNS", "Standard query 0x1234 A example.com"},
+		{"7", "", "a & b"},
+	}, rows)
+}
+
+func TestParseWatchElement1(t *testing.T) {
+	d := xml.NewDecoder(strings.NewReader(`<psml><watch rule="2" frame="155"/><watch rule="1"/><watch rule="x" frame="3"/></psml>`))
+	res := make([][]int, 0)
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			break
+		}
+		if tok, ok := tok.(xml.StartElement); ok && tok.Name.Local == "watch" {
+			if rule, frame, ok := parseWatchElement(tok); ok {
+				res = append(res, []int{rule, frame})
+			} else {
+				res = append(res, nil)
+			}
+		}
+	}
+	assert.Equal(t, [][]int{{2, 155}, nil, nil}, res)
+}
+
+type testWatcher struct {
+	matches []string
+}
+
+func (w *testWatcher) WatchFilters() []string {
+	return nil
+}
+
+func (w *testWatcher) WatchMatched(filter string, frame int, row []string) {
+	w.matches = append(w.matches, fmt.Sprintf("%s %d %v", filter, frame, row))
+}
+
+func TestWatchMatches1(t *testing.T) {
+	w := &testWatcher{}
+	m := &watchMatches{watcher: w}
+
+	m.matched("dns", 3)
+	m.matched("udp", 3)
+	assert.Empty(t, w.matches)
+	m.packet(3, []string{"DNS"})
+	// Packet 5 is hidden by the display filter - the next match says so
+	m.matched("tcp", 5)
+	m.matched("tcp", 8)
+	m.packet(9, []string{"TCP"})
+	m.matched("tcp", 10)
+	m.flush(math.MaxInt32, nil)
+
+	assert.Equal(t, []string{
+		"dns 3 [DNS]",
+		"udp 3 [DNS]",
+		"tcp 5 []",
+		"tcp 8 []",
+		"tcp 10 []",
+	}, w.matches)
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 78
+// End:
@@ -8,9 +8,11 @@ package pdmltree
 
 import (
 	"bytes"
+	"encoding/hex"
 	"encoding/xml"
 	"fmt"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -18,6 +20,7 @@ import (
 	"github.com/gcla/gowid"
 	"github.com/gcla/gowid/gwutil"
 	"github.com/gcla/gowid/widgets/tree"
+	"github.com/gcla/termshark/v2/pkg/fields"
 	"github.com/gcla/termshark/v2/widgets/hexdumper2"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
@@ -106,13 +109,28 @@ var _ tree.IModel = (*ExpandedModel)(nil)
 // This ignores the first child, "Frame 15", because its range covers the whole packet
 // which results in me always including that in the layers for any position.
 func (n *Model) HexLayers(pos int, includeFirst bool) []hexdumper2.LayerStyler {
+	return n.hexLayers(pos, includeFirst, func(*Model) bool {
+		return true
+	})
+}
+
+// SourceHexLayers is like HexLayers, but for a position in one of the packet's data
+// sources - only the protocols whose bytes are in that source are considered. sources
+// holds the bytes of each data source, starting with the frame.
+func (n *Model) SourceHexLayers(pos int, includeFirst bool, sources [][]byte, source int) []hexdumper2.LayerStyler {
+	return n.hexLayers(pos, includeFirst, func(c *Model) bool {
+		return c.DataSource(sources) == source
+	})
+}
+
+func (n *Model) hexLayers(pos int, includeFirst bool, inSource func(*Model) bool) []hexdumper2.LayerStyler {
 	res := make([]hexdumper2.LayerStyler, 0)
 	sidx := 1
 	if includeFirst {
 		sidx = 0
 	}
 	for _, c := range n.Children_[sidx:] {
-		if c.Pos <= pos && pos < c.Pos+c.Size {
+		if c.Pos <= pos && pos < c.Pos+c.Size && inSource(c) {
 			res = append(res, hexdumper2.LayerStyler{
 				Start:         c.Pos,
 				End:           c.Pos + c.Size,
@@ -134,6 +152,66 @@ func (n *Model) HexLayers(pos int, includeFirst bool) []hexdumper2.LayerStyler {
 	return res
 }
 
+// DataSource returns the index of the data source holding this node's bytes, given the
+// bytes of each of the packet's data sources - the frame first, then e.g. reassembled or
+// decrypted data. tshark doesn't say which source a field comes from, but a field's value
+// holds its bytes, so they are looked for at the field's position in each source,
+// starting with that of its parent. A node without a value, like a protocol, uses the
+// first of its descendents that has one, or else its parent's data source.
+func (n *Model) DataSource(sources [][]byte) int {
+	if len(sources) < 2 {
+		return 0
+	}
+	pref := 0
+	if n.Parent != nil {
+		pref = n.Parent.DataSource(sources)
+	}
+	if idx, ok := n.ownDataSource(sources, pref); ok {
+		return idx
+	}
+	return pref
+}
+
+func (n *Model) ownDataSource(sources [][]byte, pref int) (int, bool) {
+	if data := n.valueBytes(); len(data) > 0 {
+		matches := func(i int) bool {
+			return i < len(sources) && n.Pos >= 0 && n.Pos+len(data) <= len(sources[i]) &&
+				bytes.Equal(sources[i][n.Pos:n.Pos+len(data)], data)
+		}
+		if matches(pref) {
+			return pref, true
+		}
+		for i := range sources {
+			if matches(i) {
+				return i, true
+			}
+		}
+	}
+	for _, c := range n.Children_ {
+		if idx, ok := c.ownDataSource(sources, pref); ok {
+			return idx, true
+		}
+	}
+	return 0, false
+}
+
+// valueBytes returns the bytes of a field from its value attribute, or nil if they aren't
+// there. A bitfield's value is masked, so its bytes are in its unmaskedvalue attribute.
+func (n *Model) valueBytes() []byte {
+	val, ok := n.Attrs["unmaskedvalue"]
+	if !ok {
+		val = n.Attrs["value"]
+	}
+	if n.Size <= 0 || len(val) != 2*n.Size {
+		return nil
+	}
+	res, err := hex.DecodeString(val)
+	if err != nil {
+		return nil
+	}
+	return res
+}
+
 // Implement xml.Unmarshaler. Create a Model struct by unmarshaling the
 // provided XML. Takes special action before deferring to DecodeElement.
 func (n *Model) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
@@ -219,6 +297,81 @@ func (p *Model) streamIndex(proto string) gwutil.IntOption {
 	return res
 }
 
+// ConversationFilter returns a display filter that matches the packets of the
+// most specific conversation this packet belongs to - the TCP or UDP stream if
+// there is one, otherwise the IP or ethernet endpoints. Returns false if none
+// can be found.
+func (p *Model) ConversationFilter() (string, bool) {
+	if idx := p.TCPStreamIndex(); !idx.IsNone() {
+		return fmt.Sprintf("tcp.stream eq %d", idx.Val()), true
+	}
+	if idx := p.UDPStreamIndex(); !idx.IsNone() {
+		return fmt.Sprintf("udp.stream eq %d", idx.Val()), true
+	}
+	for _, proto := range []string{"ip", "ipv6", "eth"} {
+		src, dst := p.fieldShow(proto+".src"), p.fieldShow(proto+".dst")
+		if src != "" && dst != "" {
+			return fmt.Sprintf("%s.addr eq %s && %s.addr eq %s", proto, src, proto, dst), true
+		}
+	}
+	return "", false
+}
+
+// fieldShow returns the shown value of the first field with the given name, or ""
+func (p *Model) fieldShow(name string) string {
+	if showNode := xmlquery.FindOne(p.QueryModel, fmt.Sprintf("//field[@name='%s']/@show", name)); showNode != nil {
+		return showNode.InnerText()
+	}
+	return ""
+}
+
+// IFieldTypes provides the type of a field given its name e.g. tcp.port - see
+// fields.TSharkFields.
+type IFieldTypes interface {
+	LookupField(name string) (bool, fields.Field)
+}
+
+// FrameRef returns the number of the packet this field refers to, if it is a
+// frame-reference field (FT_FRAMENUM) such as tcp.analysis.acks_frame or
+// dns.response_in. Returns false otherwise.
+func (p *Model) FrameRef(types IFieldTypes) (int, bool) {
+	if p.NodeName != "field" || p.Name == "" {
+		return 0, false
+	}
+	ok, field := types.LookupField(p.Name)
+	if !ok || field.Type != fields.FT_FRAMENUM {
+		return 0, false
+	}
+	num, err := strconv.Atoi(p.Show)
+	if err != nil || num <= 0 {
+		return 0, false
+	}
+	return num, true
+}
+
+// FrameRefs returns the numbers of the packets referred to by the
+// frame-reference fields in this node and its descendents, sorted and without
+// repeats.
+func (p *Model) FrameRefs(types IFieldTypes) []int {
+	seen := make(map[int]struct{})
+	p.collectFrameRefs(types, seen)
+	res := make([]int, 0, len(seen))
+	for num := range seen {
+		res = append(res, num)
+	}
+	sort.Ints(res)
+	return res
+}
+
+func (p *Model) collectFrameRefs(types IFieldTypes, seen map[int]struct{}) {
+	if num, ok := p.FrameRef(types); ok {
+		seen[num] = struct{}{}
+	}
+	for _, c := range p.Children_ {
+		c.collectFrameRefs(types, seen)
+	}
+}
+
 func (p *Model) ApplyExpandedPaths(exp *ExpandedPaths) {
 	if exp != nil {
 		p.MakeParentLinks(exp) // TODO - fixup
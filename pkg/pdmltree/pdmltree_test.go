@@ -6,6 +6,7 @@ package pdmltree
 import (
 	"testing"
 
+	"github.com/gcla/termshark/v2/pkg/fields"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -205,6 +206,98 @@ func TestPdml1(t *testing.T) {
 	assert.Equal(t, 13, len(tree.Children_[0].Children_))
 }
 
+func TestConversationFilter1(t *testing.T) {
+	tree := DecodePacket([]byte(p1))
+	filter, ok := tree.ConversationFilter()
+	assert.True(t, ok)
+	assert.Equal(t, "tcp.stream eq 0", filter)
+}
+
+var p2 string = `<packet>
+  <proto name="frame" showname="Frame 4: 90 bytes on wire (720 bits), 90 bytes captured (720 bits)" size="90" pos="0">
+    <field name="frame.number" showname="Frame Number: 4" size="0" pos="0" show="4"/>
+  </proto>
+  <proto name="tcp" showname="Transmission Control Protocol, Src Port: 53, Dst Port: 41230" size="20" pos="34">
+    <field name="tcp.analysis" showname="SEQ/ACK analysis" size="0" pos="34" show="" value="">
+      <field name="tcp.analysis.acks_frame" showname="This is an ACK to the segment in frame: 3" size="0" pos="34" show="3"/>
+    </field>
+  </proto>
+  <proto name="dns" showname="Domain Name System (response)" size="36" pos="54">
+    <field name="dns.response_to" showname="Request In: 3" size="0" pos="54" show="3"/>
+    <field name="dns.retransmit_request_in" showname="Retransmitted request. Original request in: 1" hide="yes" size="0" pos="54" show="1"/>
+    <field name="dns.time" showname="Time: 0.020000000 seconds" size="0" pos="54" show="0.020000000"/>
+  </proto>
+</packet>`
+
+type testFieldTypes map[string]fields.FieldType
+
+func (t testFieldTypes) LookupField(name string) (bool, fields.Field) {
+	typ, ok := t[name]
+	return ok, fields.Field{Name: name, Type: typ}
+}
+
+func TestFrameRefs1(t *testing.T) {
+	types := testFieldTypes{
+		"frame.number":              fields.FT_UINT32,
+		"tcp.analysis.acks_frame":   fields.FT_FRAMENUM,
+		"dns.response_to":           fields.FT_FRAMENUM,
+		"dns.retransmit_request_in": fields.FT_FRAMENUM,
+		"dns.time":                  fields.FT_RELATIVE_TIME,
+	}
+	tree := DecodePacket([]byte(p2))
+
+	_, ok := tree.Children_[0].Children_[0].FrameRef(types)
+	assert.False(t, ok)
+	num, ok := tree.Children_[1].Children_[0].Children_[0].FrameRef(types)
+	assert.True(t, ok)
+	assert.Equal(t, 3, num)
+
+	// Hidden fields aren't shown, so aren't followed
+	assert.Equal(t, []int{3}, tree.FrameRefs(types))
+
+	assert.Equal(t, []int{}, DecodePacket([]byte(p1)).FrameRefs(types))
+}
+
+// A packet whose HTTP is in a second data source, e.g. reassembled TCP
+var p3 string = `<packet>
+  <proto name="frame" showname="Frame 9: 6 bytes on wire (48 bits), 6 bytes captured (48 bits)" size="6" pos="0">
+    <field name="frame.number" showname="Frame Number: 9" size="0" pos="0" show="9"/>
+  </proto>
+  <proto name="tcp" showname="Transmission Control Protocol, Src Port: 1" size="4" pos="0">
+    <field name="tcp.srcport" showname="Source Port: 1" size="2" pos="0" show="1" value="0001"/>
+  </proto>
+  <proto name="http" showname="Hypertext Transfer Protocol" size="4" pos="0">
+    <field name="http.method" showname="Method: GE" size="2" pos="0" show="GE" value="4745"/>
+    <field name="http.extra" showname="Extra: 0x0203" size="2" pos="2" show="0x0203" value="0203"/>
+  </proto>
+</packet>`
+
+func TestDataSource1(t *testing.T) {
+	dummy := make(ExpandedPaths, 0)
+	tree := DecodePacket([]byte(p3))
+	tree.ApplyExpandedPaths(&dummy)
+
+	sources := [][]byte{
+		{0x00, 0x01, 0x02, 0x03, 0x47, 0x45},
+		{0x47, 0x45, 0x02, 0x03},
+	}
+	tcp, http := tree.Children_[1], tree.Children_[2]
+
+	assert.Equal(t, 0, tcp.DataSource(sources))
+	assert.Equal(t, 1, http.DataSource(sources))
+	// These bytes are in both sources, so the field follows its protocol
+	assert.Equal(t, 1, http.Children_[1].DataSource(sources))
+	assert.Equal(t, 0, http.DataSource(sources[0:1]))
+
+	assert.Equal(t, 3, len(tree.HexLayers(2, false)))
+	layers := tree.SourceHexLayers(2, false, sources, 1)
+	assert.Equal(t, 2, len(layers))
+	assert.Equal(t, 0, layers[0].Start)
+	assert.Equal(t, 4, layers[0].End)
+	assert.Equal(t, 2, layers[1].Start)
+	assert.Equal(t, 4, layers[1].End)
+}
+
 //======================================================================
 // Local Variables:
 // mode: Go
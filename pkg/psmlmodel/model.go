@@ -16,15 +16,26 @@ import (
 	"github.com/gcla/gowid/widgets/table"
 	"github.com/gcla/gowid/widgets/text"
 	"github.com/gcla/termshark/v2/widgets/expander"
+	"github.com/gcla/termshark/v2/widgets/ifwidget"
 )
 
 //======================================================================
 
+// Gutter is shown to the left of the first column of marked rows
+const Gutter = ">"
+
+// IRowMarker decides whether a row is marked in the gutter to the left of the
+// first column e.g. because it is related to the selected packet.
+type IRowMarker interface {
+	IsMarked(row table.RowId) bool
+}
+
 // Model is a table model that provides a widget that will render
 // in one row only when not selected.
 type Model struct {
 	*table.SimpleModel
 	styler gowid.ICellStyler
+	Marker IRowMarker // if not nil, the first column has a gutter for markers
 }
 
 func New(m *table.SimpleModel, st gowid.ICellStyler) *Model {
@@ -44,7 +55,29 @@ func (c *Model) CellWidget(i int, s string) gowid.IWidget {
 }
 
 func (c *Model) CellWidgets(row table.RowId) []gowid.IWidget {
-	return table.SimpleCellWidgets(c, row)
+	res := table.SimpleCellWidgets(c, row)
+	if c.Marker != nil && len(res) > 0 && res[0] != nil {
+		// Decided at render time so the marker follows e.g. the selected packet
+		// without the table's rows being rebuilt
+		gutter := ifwidget.New(
+			text.New(Gutter),
+			text.New(" "),
+			func() bool {
+				return c.Marker.IsMarked(row)
+			},
+		)
+		res[0] = columns.New([]gowid.IContainerWidget{
+			&gowid.ContainerWidget{
+				IWidget: gutter,
+				D:       gowid.RenderWithUnits{U: 1},
+			},
+			&gowid.ContainerWidget{
+				IWidget: res[0],
+				D:       gowid.RenderWithWeight{W: 1},
+			},
+		})
+	}
+	return res
 }
 
 // table.ITable2
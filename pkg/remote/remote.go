@@ -0,0 +1,311 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+// Package remote provides a server that lets other programs drive a running
+// termshark over a UNIX socket. Clients send requests as JSON objects, one
+// per line, and receive a JSON response for each, in order. Events - e.g. the
+// selected packet changing - are written to every connected client as they
+// happen, interleaved with the responses.
+package remote
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/gcla/termshark/v2"
+	log "github.com/sirupsen/logrus"
+)
+
+//======================================================================
+
+// Request is a command sent by a client e.g.
+//
+//	{"id": 1, "command": "goto", "args": ["123"]}
+type Request struct {
+	Id      int      `json:"id,omitempty"`
+	Command string   `json:"command"`
+	Args    []string `json:"args,omitempty"`
+}
+
+// Response is sent to the client for each request. Id is copied from the
+// request.
+type Response struct {
+	Id     int         `json:"id,omitempty"`
+	Ok     bool        `json:"ok"`
+	Error  string      `json:"error,omitempty"`
+	Result interface{} `json:"result,omitempty"`
+}
+
+// Event is sent to every client when something of interest happens in
+// termshark.
+type Event struct {
+	Event string      `json:"event"`
+	Data  interface{} `json:"data,omitempty"`
+}
+
+// IHandler runs a client's request and returns the result to send back. It
+// is called from the client's goroutine.
+type IHandler interface {
+	HandleRequest(req Request) (interface{}, error)
+}
+
+type HandlerFunc func(req Request) (interface{}, error)
+
+func (f HandlerFunc) HandleRequest(req Request) (interface{}, error) {
+	return f(req)
+}
+
+type SocketInUseError struct {
+	Path string
+}
+
+func (e SocketInUseError) Error() string {
+	return fmt.Sprintf("Another process is listening on %s", e.Path)
+}
+
+//======================================================================
+
+type client struct {
+	conn   net.Conn
+	lock   sync.Mutex // serializes responses and events
+	enc    *json.Encoder
+	events chan Event    // written to the client by writeEvents
+	done   chan struct{} // closed when the client disconnects
+}
+
+// A client that stops reading is disconnected when a write to it takes this
+// long, or when this many events are waiting to be written to it.
+const writeTimeout = 2 * time.Second
+const maxQueuedEvents = 256
+
+func (c *client) send(v interface{}) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	return c.enc.Encode(v)
+}
+
+// writeEvents sends the client its events, in order, until it disconnects.
+// Broadcast queues them so that a slow client can't hold up termshark.
+func (c *client) writeEvents() {
+	for {
+		select {
+		case ev := <-c.events:
+			if err := c.send(ev); err != nil {
+				log.Infof("Dropping remote control client: %v", err)
+				c.conn.Close()
+				return
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// Server accepts connections on a UNIX socket and runs the requests it
+// receives with its handler.
+type Server struct {
+	path     string
+	listener net.Listener
+	handler  IHandler
+	lock     sync.Mutex
+	clients  map[*client]struct{}
+	closed   bool
+}
+
+// Listen creates the socket at path and starts accepting clients. A socket
+// left behind by a termshark that has exited is replaced; one that is still
+// in use is an error. The socket drives termshark, which may be capturing, so
+// only the user can connect to it.
+func Listen(path string, handler IHandler) (*Server, error) {
+	if fi, err := os.Stat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, SocketInUseError{Path: path}
+		}
+		os.Remove(path)
+	}
+
+	listener, err := listenPrivate(path)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &Server{
+		path:     path,
+		listener: listener,
+		handler:  handler,
+		clients:  make(map[*client]struct{}),
+	}
+
+	termshark.TrackedGo(func() {
+		res.accept()
+	}, Goroutinewg)
+
+	return res, nil
+}
+
+// listenPrivate listens on a socket at path that only the user can connect
+// to. The socket is created in a new directory that only the user can enter,
+// made private, then moved to path - so another user has no chance to
+// connect between the socket being created and its mode being changed.
+func listenPrivate(path string) (net.Listener, error) {
+	dir, err := ioutil.TempDir(filepath.Dir(path), ".termshark-remote")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	tmp := filepath.Join(dir, "sock")
+	listener, err := net.Listen("unix", tmp)
+	if err != nil {
+		return nil, err
+	}
+	// The socket is moved, so Close must not remove whatever is at tmp
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+
+	if err = os.Chmod(tmp, 0600); err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	return listener, nil
+}
+
+func (s *Server) Path() string {
+	return s.path
+}
+
+func (s *Server) accept() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			s.lock.Lock()
+			closed := s.closed
+			s.lock.Unlock()
+			if !closed {
+				log.Warnf("Remote control socket stopped accepting clients: %v", err)
+			}
+			return
+		}
+
+		c := &client{
+			conn:   conn,
+			enc:    json.NewEncoder(conn),
+			events: make(chan Event, maxQueuedEvents),
+			done:   make(chan struct{}),
+		}
+
+		s.lock.Lock()
+		if s.closed {
+			s.lock.Unlock()
+			conn.Close()
+			return
+		}
+		s.clients[c] = struct{}{}
+		s.lock.Unlock()
+
+		termshark.TrackedGo(func() {
+			s.serve(c)
+		}, Goroutinewg)
+		termshark.TrackedGo(func() {
+			c.writeEvents()
+		}, Goroutinewg)
+	}
+}
+
+func (s *Server) serve(c *client) {
+	defer func() {
+		s.lock.Lock()
+		delete(s.clients, c)
+		s.lock.Unlock()
+		c.conn.Close()
+		close(c.done)
+	}()
+
+	scanner := bufio.NewScanner(c.conn)
+	scanner.Buffer(make([]byte, 0, 4096), 1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		if err := c.send(s.handle(scanner.Bytes())); err != nil {
+			return
+		}
+	}
+}
+
+func (s *Server) handle(line []byte) Response {
+	var req Request
+	if err := json.Unmarshal(line, &req); err != nil {
+		return Response{Error: fmt.Sprintf("Could not parse request: %v", err)}
+	}
+	if req.Command == "" {
+		return Response{Id: req.Id, Error: "No command in request"}
+	}
+	res, err := s.handler.HandleRequest(req)
+	if err != nil {
+		return Response{Id: req.Id, Error: err.Error()}
+	}
+	return Response{Id: req.Id, Ok: true, Result: res}
+}
+
+// Broadcast queues the event for all connected clients, and doesn't wait for
+// it to be written. A client that can't keep up is disconnected.
+func (s *Server) Broadcast(ev Event) {
+	s.lock.Lock()
+	clients := make([]*client, 0, len(s.clients))
+	for c := range s.clients {
+		clients = append(clients, c)
+	}
+	s.lock.Unlock()
+
+	for _, c := range clients {
+		select {
+		case c.events <- ev:
+		default:
+			log.Infof("Dropping remote control client: %d events not yet read", maxQueuedEvents)
+			c.conn.Close()
+		}
+	}
+}
+
+// Close stops accepting clients, disconnects those connected, and removes
+// the socket.
+func (s *Server) Close() error {
+	s.lock.Lock()
+	if s.closed {
+		s.lock.Unlock()
+		return nil
+	}
+	s.closed = true
+	for c := range s.clients {
+		c.conn.Close()
+	}
+	s.lock.Unlock()
+
+	err := s.listener.Close()
+	os.Remove(s.path)
+	return err
+}
+
+//======================================================================
+
+var Goroutinewg *sync.WaitGroup
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 78
+// End:
@@ -0,0 +1,98 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+package remote
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+//======================================================================
+
+func init() {
+	Goroutinewg = &sync.WaitGroup{}
+}
+
+func echoHandler(req Request) (interface{}, error) {
+	if req.Command == "fail" {
+		return nil, fmt.Errorf("Failed")
+	}
+	return strings.Join(append([]string{req.Command}, req.Args...), " "), nil
+}
+
+func TestServer1(t *testing.T) {
+	dir, err := ioutil.TempDir("", "termshark-remote")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "sock")
+
+	srv, err := Listen(path, HandlerFunc(echoHandler))
+	assert.NoError(t, err)
+
+	fi, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), fi.Mode().Perm())
+	// The directory the socket was made private in is gone
+	files, err := ioutil.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(files))
+
+	_, err = Listen(path, HandlerFunc(echoHandler))
+	assert.IsType(t, SocketInUseError{}, err)
+
+	conn, err := net.Dial("unix", path)
+	assert.NoError(t, err)
+	defer conn.Close()
+	rd := bufio.NewReader(conn)
+
+	next := func(v interface{}) {
+		line, err := rd.ReadBytes('\n')
+		assert.NoError(t, err)
+		assert.NoError(t, json.Unmarshal(line, v))
+	}
+
+	fmt.Fprintf(conn, "{\"id\": 1, \"command\": \"goto\", \"args\": [\"5\"]}\n")
+	var resp Response
+	next(&resp)
+	assert.Equal(t, Response{Id: 1, Ok: true, Result: "goto 5"}, resp)
+
+	fmt.Fprintf(conn, "{\"id\": 2, \"command\": \"fail\"}\n")
+	resp = Response{}
+	next(&resp)
+	assert.Equal(t, Response{Id: 2, Error: "Failed"}, resp)
+
+	fmt.Fprintf(conn, "not json\n")
+	resp = Response{}
+	next(&resp)
+	assert.False(t, resp.Ok)
+	assert.NotEqual(t, "", resp.Error)
+
+	srv.Broadcast(Event{Event: "loaded"})
+	var ev Event
+	next(&ev)
+	assert.Equal(t, "loaded", ev.Event)
+
+	assert.NoError(t, srv.Close())
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+
+	Goroutinewg.Wait()
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 78
+// End:
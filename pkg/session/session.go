@@ -0,0 +1,156 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+// Package session saves and loads termshark sessions - the pcap being viewed,
+// the display filter, the selected packet and the state of the views - so that
+// the user can pick up where they left off.
+package session
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gcla/termshark/v2"
+	"github.com/gcla/termshark/v2/widgets/resizable"
+)
+
+//======================================================================
+
+const suffix = ".json"
+
+// Stream describes an open stream reassembly view e.g. TCP stream 6
+type Stream struct {
+	Proto          string `json:"proto"` // "tcp" or "udp"
+	Index          int    `json:"index"`
+	PreviousFilter string `json:"previous-filter,omitempty"` // the display filter before the stream was opened
+}
+
+// Convs describes an open conversations view
+type Convs struct {
+	UseFilter    bool `json:"use-filter,omitempty"`
+	AbsoluteTime bool `json:"absolute-time,omitempty"`
+	ResolveNames bool `json:"resolve-names,omitempty"`
+}
+
+// Search describes the packet search bar
+type Search struct {
+	Open          bool   `json:"open,omitempty"`
+	Type          string `json:"type,omitempty"`   // "filter", "hex", "string" or "regex"
+	Target        string `json:"target,omitempty"` // "list", "details" or "bytes"
+	CaseSensitive bool   `json:"case-sensitive,omitempty"`
+	Value         string `json:"value,omitempty"`
+}
+
+// Session is everything termshark needs to restore the UI as it was
+type Session struct {
+	Pcap     string                        `json:"pcap"`
+	Filter   string                        `json:"filter,omitempty"`
+	Packet   int                           `json:"packet,omitempty"` // the selected packet number, or 0
+	Expanded [][]string                    `json:"expanded,omitempty"`
+	Marks    map[string]termshark.JumpPos  `json:"marks,omitempty"` // file-local marks, "a" through "z"
+	Layout   string                        `json:"layout,omitempty"`
+	Offsets  map[string][]resizable.Offset `json:"offsets,omitempty"` // keyed like the config e.g. "mainview"
+	Stream   *Stream                       `json:"stream,omitempty"`
+	Convs    *Convs                        `json:"convs,omitempty"`
+	Search   *Search                       `json:"search,omitempty"`
+}
+
+//======================================================================
+
+// CheckName returns an error if name can't be used to name a session file.
+func CheckName(name string) error {
+	if name == "" {
+		return fmt.Errorf("No session name given")
+	}
+	if strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+		return fmt.Errorf("Invalid session name: %s", name)
+	}
+	return nil
+}
+
+func sessionFile(dir string, name string) (string, error) {
+	if err := CheckName(name); err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, name+suffix), nil
+}
+
+// Save writes the session to dir with the given name, replacing any session
+// of the same name. The directory is created if necessary.
+func Save(dir string, name string, s *Session) error {
+	p, err := sessionFile(dir, name)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(p, data, 0644)
+}
+
+// Load reads the named session from dir.
+func Load(dir string, name string) (*Session, error) {
+	p, err := sessionFile(dir, name)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(p)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("No session named %s", name)
+	} else if err != nil {
+		return nil, err
+	}
+	res := &Session{}
+	if err := json.Unmarshal(data, res); err != nil {
+		return nil, fmt.Errorf("Could not read session %s: %v", name, err)
+	}
+	if res.Pcap == "" {
+		return nil, fmt.Errorf("Session %s has no pcap", name)
+	}
+	return res, nil
+}
+
+// Delete removes the named session from dir.
+func Delete(dir string, name string) error {
+	p, err := sessionFile(dir, name)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(p)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("No session named %s", name)
+	}
+	return err
+}
+
+// Names returns the sorted names of the sessions saved in dir.
+func Names(dir string) []string {
+	res := make([]string, 0)
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return res
+	}
+	for _, f := range files {
+		if !f.IsDir() && strings.HasSuffix(f.Name(), suffix) {
+			res = append(res, strings.TrimSuffix(f.Name(), suffix))
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 78
+// End:
@@ -0,0 +1,69 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+package session
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/gcla/termshark/v2"
+	"github.com/gcla/termshark/v2/widgets/resizable"
+	"github.com/stretchr/testify/assert"
+)
+
+//======================================================================
+
+func TestSession1(t *testing.T) {
+	dir, err := ioutil.TempDir("", "termshark-session")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	assert.Equal(t, []string{}, Names(dir))
+
+	s := &Session{
+		Pcap:     "/tmp/foo.pcap",
+		Filter:   "tcp",
+		Packet:   12,
+		Expanded: [][]string{{"ip"}, {"tcp", "tcp.flags"}},
+		Marks: map[string]termshark.JumpPos{
+			"a": {Pos: 3, Summary: "10.0.0.1 -> 10.0.0.2"},
+		},
+		Offsets: map[string][]resizable.Offset{
+			"mainview": {{Col1: 0, Col2: 2, Adjust: 4}},
+		},
+		Stream: &Stream{Proto: "tcp", Index: 6, PreviousFilter: "tcp"},
+		Search: &Search{Open: true, Type: "string", Target: "list", Value: "GET"},
+	}
+
+	assert.NoError(t, Save(dir, "work", s))
+	assert.NoError(t, Save(dir, "another", &Session{Pcap: "/tmp/bar.pcap"}))
+	assert.Equal(t, []string{"another", "work"}, Names(dir))
+
+	s2, err := Load(dir, "work")
+	assert.NoError(t, err)
+	assert.Equal(t, s, s2)
+
+	assert.NoError(t, Delete(dir, "another"))
+	assert.Equal(t, []string{"work"}, Names(dir))
+
+	_, err = Load(dir, "another")
+	assert.Error(t, err)
+	assert.Error(t, Delete(dir, "another"))
+}
+
+func TestSessionNames1(t *testing.T) {
+	assert.NoError(t, CheckName("work"))
+	assert.Error(t, CheckName(""))
+	assert.Error(t, CheckName(".."))
+	assert.Error(t, CheckName("a/b"))
+	assert.Error(t, Save(os.TempDir(), "../escape", &Session{}))
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 78
+// End:
@@ -0,0 +1,124 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+package shark
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gcla/termshark/v2"
+	"github.com/gcla/termshark/v2/configs/profiles"
+	"github.com/gcla/termshark/v2/pkg/shark/wiresharkcfg"
+)
+
+//======================================================================
+
+// CaptureFilterKeywords are the words of the pcap-filter language offered as
+// completions when editing a capture filter.
+var CaptureFilterKeywords = []string{
+	"and", "arp", "broadcast", "dst", "ether", "gateway", "greater", "host",
+	"icmp", "icmp6", "ip", "ip6", "len", "less", "multicast", "net", "not",
+	"or", "port", "portrange", "proto", "rarp", "sctp", "src", "tcp", "udp",
+	"vlan", "wlan",
+}
+
+// GetWiresharkCaptureFilters returns the saved capture filters of the
+// Wireshark profile linked to the current termshark profile. Like Wireshark,
+// if the profile has no cfilters file, those of the Default profile are used,
+// and failing that, the global defaults.
+func GetWiresharkCaptureFilters() ([]wiresharkcfg.SavedFilter, error) {
+	candidates := make([]string, 0, 3)
+	if prof := profiles.ConfString("main.wireshark-profile", ""); prof != "" {
+		if fname, err := termshark.WiresharkProfileFile(prof, "cfilters"); err == nil {
+			candidates = append(candidates, fname)
+		}
+	}
+	if fname, err := termshark.WiresharkProfileFile("", "cfilters"); err == nil {
+		candidates = append(candidates, fname)
+	}
+	if folder, err := termshark.TsharkSetting("Global configuration"); err == nil {
+		candidates = append(candidates, filepath.Join(folder, "cfilters"))
+	}
+
+	for _, fname := range candidates {
+		if _, err := os.Stat(fname); err == nil {
+			return wiresharkcfg.ReadSavedFilters(fname)
+		}
+	}
+
+	return nil, fmt.Errorf("Could not find Wireshark's saved capture filters")
+}
+
+// CaptureFilterCompletions returns the completions for the word being typed
+// in a capture filter. With nothing typed yet, the saved filters are offered
+// in full; otherwise, the matching pcap-filter keywords.
+func CaptureFilterCompletions(prefix string, saved []wiresharkcfg.SavedFilter) []string {
+	res := make([]string, 0)
+	if prefix == "" {
+		for _, f := range saved {
+			res = append(res, f.Expression)
+		}
+		return res
+	}
+	for _, kw := range CaptureFilterKeywords {
+		if strings.HasPrefix(kw, prefix) {
+			res = append(res, kw)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// CompileCaptureFilterArgs returns the dumpcap flags, up to but not including
+// -f, that compile a capture filter for the interface. The interface's capture
+// options are included because the link-layer type - and monitor mode, which
+// changes the available link-layer types - affect the compiled program.
+func CompileCaptureFilterArgs(iface string) []string {
+	res := []string{"-d", "-i", iface}
+	opts := GetCaptureOptions(iface)
+	if opts.MonitorMode {
+		res = append(res, "-I")
+	}
+	if opts.LinkType != "" {
+		res = append(res, "-y", opts.LinkType)
+	}
+	return res
+}
+
+// CompileCaptureFilter compiles the capture filter for the interface with
+// dumpcap -d and returns the BPF program, one instruction per line. If the
+// filter does not compile, the error holds dumpcap's explanation.
+func CompileCaptureFilter(iface string, filter string) ([]string, error) {
+	cmd := exec.Command(termshark.DumpcapBin(), append(CompileCaptureFilterArgs(iface), "-f", filter)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%s", msg)
+		}
+		return nil, err
+	}
+
+	res := make([]string, 0)
+	for _, line := range strings.Split(string(out), "\n") {
+		if line = strings.TrimRight(line, "\r"); line != "" {
+			res = append(res, line)
+		}
+	}
+	return res, nil
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 78
+// End:
@@ -0,0 +1,32 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+package shark
+
+import (
+	"testing"
+
+	"github.com/gcla/termshark/v2/pkg/shark/wiresharkcfg"
+	"github.com/stretchr/testify/assert"
+)
+
+//======================================================================
+
+func TestCaptureFilterCompletions1(t *testing.T) {
+	saved := []wiresharkcfg.SavedFilter{
+		{Name: "Ethernet address 00:00:5e:00:53:00", Expression: "ether host 00:00:5e:00:53:00"},
+		{Name: "No ARP", Expression: "not arp"},
+	}
+
+	assert.Equal(t, []string{"ether host 00:00:5e:00:53:00", "not arp"}, CaptureFilterCompletions("", saved))
+	assert.Equal(t, []string{"port", "portrange", "proto"}, CaptureFilterCompletions("p", saved))
+	assert.Equal(t, []string{"icmp", "icmp6", "ip", "ip6"}, CaptureFilterCompletions("i", nil))
+	assert.Equal(t, []string{}, CaptureFilterCompletions("xyz", saved))
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 78
+// End:
@@ -0,0 +1,213 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+package shark
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gcla/termshark/v2/configs/profiles"
+	"github.com/spf13/viper"
+)
+
+//======================================================================
+
+// CaptureOptions are the settings used when capturing from an interface. They
+// are passed to the capture command after the interface's -i flag, so dumpcap
+// (or tshark) applies them to that interface only. The zero value of each
+// field means dumpcap's default.
+type CaptureOptions struct {
+	Interface     string
+	Snaplen       int    // -s
+	NoPromiscuous bool   // -p
+	BufferSize    int    // -B, in MiB
+	MonitorMode   bool   // -I
+	LinkType      string // -y e.g. EN10MB
+	TimestampType string // --time-stamp-type e.g. adapter_unsynced
+}
+
+var InvalidCaptureOptionsError = fmt.Errorf("Capture options must look like snaplen=<n>,buffer=<n>,...,interface=<name>")
+
+// Options for this run of termshark only e.g. from the command-line, keyed by
+// interface. They take priority over those saved in the profile.
+var sessionCaptureOptions = map[string]CaptureOptions{}
+var sessionCaptureOptionsLock sync.Mutex
+
+// Args returns the capture command flags that follow the interface's -i flag.
+func (c CaptureOptions) Args() []string {
+	res := make([]string, 0)
+	if c.Snaplen > 0 {
+		res = append(res, "-s", strconv.Itoa(c.Snaplen))
+	}
+	if c.NoPromiscuous {
+		res = append(res, "-p")
+	}
+	if c.BufferSize > 0 {
+		res = append(res, "-B", strconv.Itoa(c.BufferSize))
+	}
+	if c.MonitorMode {
+		res = append(res, "-I")
+	}
+	if c.LinkType != "" {
+		res = append(res, "-y", c.LinkType)
+	}
+	if c.TimestampType != "" {
+		res = append(res, "--time-stamp-type", c.TimestampType)
+	}
+	return res
+}
+
+// IsDefault returns true if the options don't change anything.
+func (c CaptureOptions) IsDefault() bool {
+	return len(c.Args()) == 0
+}
+
+// String returns the options in the form they are saved in the profile. The
+// interface comes last because its name might contain anything.
+func (c CaptureOptions) String() string {
+	res := make([]string, 0)
+	if c.Snaplen > 0 {
+		res = append(res, fmt.Sprintf("snaplen=%d", c.Snaplen))
+	}
+	if c.NoPromiscuous {
+		res = append(res, "promiscuous=false")
+	}
+	if c.BufferSize > 0 {
+		res = append(res, fmt.Sprintf("buffer=%d", c.BufferSize))
+	}
+	if c.MonitorMode {
+		res = append(res, "monitor=true")
+	}
+	if c.LinkType != "" {
+		res = append(res, fmt.Sprintf("linktype=%s", c.LinkType))
+	}
+	if c.TimestampType != "" {
+		res = append(res, fmt.Sprintf("tstype=%s", c.TimestampType))
+	}
+	res = append(res, fmt.Sprintf("interface=%s", c.Interface))
+	return strings.Join(res, ",")
+}
+
+// ParseCaptureOptions parses options in the form returned by String.
+func ParseCaptureOptions(s string) (CaptureOptions, error) {
+	var res CaptureOptions
+
+	idx := strings.Index(s, "interface=")
+	if idx == -1 || (idx > 0 && s[idx-1] != ',') {
+		return res, InvalidCaptureOptionsError
+	}
+	res.Interface = s[idx+len("interface="):]
+	if res.Interface == "" {
+		return res, InvalidCaptureOptionsError
+	}
+
+	var err error
+	for _, opt := range strings.Split(strings.TrimSuffix(s[0:idx], ","), ",") {
+		if opt == "" {
+			continue
+		}
+		kv := strings.SplitN(opt, "=", 2)
+		if len(kv) != 2 {
+			return res, InvalidCaptureOptionsError
+		}
+		switch kv[0] {
+		case "snaplen":
+			res.Snaplen, err = strconv.Atoi(kv[1])
+		case "promiscuous":
+			var b bool
+			b, err = strconv.ParseBool(kv[1])
+			res.NoPromiscuous = !b
+		case "buffer":
+			res.BufferSize, err = strconv.Atoi(kv[1])
+		case "monitor":
+			res.MonitorMode, err = strconv.ParseBool(kv[1])
+		case "linktype":
+			res.LinkType = kv[1]
+		case "tstype":
+			res.TimestampType = kv[1]
+		default:
+			err = InvalidCaptureOptionsError
+		}
+		if err != nil {
+			return CaptureOptions{}, InvalidCaptureOptionsError
+		}
+	}
+
+	return res, nil
+}
+
+// GetCaptureOptions returns the options for the given interface - those set
+// for this run with SetSessionCaptureOptions, else those saved in the current
+// profile. If there are none, the defaults are returned.
+func GetCaptureOptions(iface string) CaptureOptions {
+	sessionCaptureOptionsLock.Lock()
+	opts, ok := sessionCaptureOptions[iface]
+	sessionCaptureOptionsLock.Unlock()
+	if ok {
+		return opts
+	}
+	for _, opts := range GetAllCaptureOptions() {
+		if opts.Interface == iface {
+			return opts
+		}
+	}
+	return CaptureOptions{Interface: iface}
+}
+
+// GetAllCaptureOptions returns the options saved in the current profile, one
+// per interface.
+func GetAllCaptureOptions() []CaptureOptions {
+	return GetAllCaptureOptionsFrom(profiles.Current())
+}
+
+func GetAllCaptureOptionsFrom(v *viper.Viper) []CaptureOptions {
+	res := make([]CaptureOptions, 0)
+	for _, s := range profiles.ConfStringSliceFrom(v, profiles.Default(), "main.capture-options", []string{}) {
+		if opts, err := ParseCaptureOptions(s); err == nil {
+			res = append(res, opts)
+		}
+	}
+	return res
+}
+
+// SetSessionCaptureOptions sets the options for their interface for this run
+// of termshark only; they are not saved in the profile.
+func SetSessionCaptureOptions(opts CaptureOptions) {
+	sessionCaptureOptionsLock.Lock()
+	defer sessionCaptureOptionsLock.Unlock()
+	sessionCaptureOptions[opts.Interface] = opts
+}
+
+// SetCaptureOptions saves the options for their interface in the current
+// profile, replacing any saved before - and any set for this run only.
+// Default options are not saved.
+func SetCaptureOptions(opts CaptureOptions) {
+	sessionCaptureOptionsLock.Lock()
+	delete(sessionCaptureOptions, opts.Interface)
+	sessionCaptureOptionsLock.Unlock()
+
+	strs := make([]string, 0)
+	for _, cur := range GetAllCaptureOptions() {
+		if cur.Interface != opts.Interface {
+			strs = append(strs, cur.String())
+		}
+	}
+	if !opts.IsDefault() {
+		strs = append(strs, opts.String())
+	}
+	if len(strs) == 0 {
+		profiles.DeleteConf("main.capture-options")
+	} else {
+		profiles.SetConf("main.capture-options", strs)
+	}
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 78
+// End:
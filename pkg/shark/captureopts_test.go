@@ -0,0 +1,62 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+package shark
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+//======================================================================
+
+func TestCaptureOptions1(t *testing.T) {
+	opts := CaptureOptions{
+		Interface:     `\Device\NPF_{78032B7E}`,
+		Snaplen:       96,
+		NoPromiscuous: true,
+		BufferSize:    4,
+		MonitorMode:   true,
+		LinkType:      "IEEE802_11_RADIO",
+		TimestampType: "adapter_unsynced",
+	}
+	assert.Equal(t, []string{"-s", "96", "-p", "-B", "4", "-I", "-y", "IEEE802_11_RADIO", "--time-stamp-type", "adapter_unsynced"}, opts.Args())
+
+	opts2, err := ParseCaptureOptions(opts.String())
+	assert.NoError(t, err)
+	assert.Equal(t, opts, opts2)
+
+	opts2, err = ParseCaptureOptions("interface=eth0")
+	assert.NoError(t, err)
+	assert.Equal(t, CaptureOptions{Interface: "eth0"}, opts2)
+	assert.True(t, opts2.IsDefault())
+
+	// Interface names come last, so might contain anything
+	opts2, err = ParseCaptureOptions("snaplen=128,interface=Local Area Connection, 2")
+	assert.NoError(t, err)
+	assert.Equal(t, CaptureOptions{Interface: "Local Area Connection, 2", Snaplen: 128}, opts2)
+}
+
+func TestCaptureOptions2(t *testing.T) {
+	for _, s := range []string{"", "snaplen=96", "interface=", "snaplen=big,interface=eth0", "color=red,interface=eth0", "myinterface=eth0"} {
+		_, err := ParseCaptureOptions(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestCaptureOptions3(t *testing.T) {
+	opts := CaptureOptions{Interface: "wlan0", NoPromiscuous: true, MonitorMode: true}
+	SetSessionCaptureOptions(opts)
+	defer func() {
+		sessionCaptureOptions = map[string]CaptureOptions{}
+	}()
+	assert.Equal(t, opts, GetCaptureOptions("wlan0"))
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 78
+// End:
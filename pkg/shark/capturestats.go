@@ -0,0 +1,195 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+package shark
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gcla/termshark/v2"
+)
+
+//======================================================================
+
+// Rates are only recomputed once at least this long has passed, so that
+// counters reported in quick succession don't produce wild swings.
+const minRateInterval = 500 * time.Millisecond
+
+var InvalidInterfaceStatsError = fmt.Errorf("Could not parse dumpcap statistics")
+
+// The number of packets a network interface or its driver dropped, and the
+// bytes it received, on Linux. libpcap reports the drops as ps_ifdrop, but
+// dumpcap -S only shows ps_drop.
+var ifDropsPath = "/sys/class/net/%s/statistics/rx_dropped"
+var ifBytesPath = "/sys/class/net/%s/statistics/rx_bytes"
+
+// InterfaceStats are the counters dumpcap -S reports for an interface, along
+// with the interface's own counters if the system reports them. They count all
+// packets seen by the interface, whatever the capture filter. dumpcap -S opens
+// its own handle on the interface, so its kernel drops are those of that handle
+// and not of the capture's - they are only a guide.
+type InterfaceStats struct {
+	Interface      string
+	Received       uint64
+	KernelDropped  uint64 // no room in dumpcap -S's capture buffer - libpcap's ps_drop
+	IfDropped      uint64 // dropped by the interface or its driver since the capture started
+	IfDroppedKnown bool   // false if the system doesn't count the interface's drops
+	IfBytes        uint64 // received by the interface since the capture started
+	IfBytesKnown   bool   // false if the system doesn't count the interface's bytes
+}
+
+// Dropped returns true if the interface or its driver has dropped packets.
+// Kernel drops aren't counted because they belong to dumpcap -S's handle.
+func (s InterfaceStats) Dropped() bool {
+	return s.IfDropped > 0
+}
+
+// ParseInterfaceStats parses a line of the machine-readable output of
+// dumpcap -S -M, e.g. "eth0\t1234\t5" - the interface, then the packets
+// received and dropped by the kernel.
+func ParseInterfaceStats(line string) (InterfaceStats, error) {
+	var res InterfaceStats
+	var err error
+
+	toks := strings.Split(strings.TrimRight(line, "\r\n"), "\t")
+	if len(toks) != 3 || toks[0] == "" {
+		return res, InvalidInterfaceStatsError
+	}
+	res.Interface = toks[0]
+	if res.Received, err = strconv.ParseUint(toks[1], 10, 64); err != nil {
+		return InterfaceStats{}, InvalidInterfaceStatsError
+	}
+	if res.KernelDropped, err = strconv.ParseUint(toks[2], 10, 64); err != nil {
+		return InterfaceStats{}, InvalidInterfaceStatsError
+	}
+	return res, nil
+}
+
+// readInterfaceCounter returns one of the interface's counters since it came
+// up - path is e.g. ifDropsPath - and false if the system doesn't say.
+func readInterfaceCounter(path string, iface string) (uint64, bool) {
+	b, err := ioutil.ReadFile(fmt.Sprintf(path, iface))
+	if err != nil {
+		return 0, false
+	}
+	res, err := strconv.ParseUint(strings.TrimSpace(string(b)), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return res, true
+}
+
+// WatchInterfaceStats runs dumpcap -S for the interfaces and calls cb with
+// each interface's counters as dumpcap reports them, about once a second. It
+// returns when ctx is cancelled or dumpcap exits.
+func WatchInterfaceStats(ctx context.Context, ifaces []string, cb func(InterfaceStats)) error {
+	args := []string{"-S", "-M"}
+	ifDropsAtStart := make(map[string]uint64)
+	ifBytesAtStart := make(map[string]uint64)
+	for _, iface := range ifaces {
+		args = append(args, "-i", iface)
+		if drops, ok := readInterfaceCounter(ifDropsPath, iface); ok {
+			ifDropsAtStart[iface] = drops
+		}
+		if bytes, ok := readInterfaceCounter(ifBytesPath, iface); ok {
+			ifBytesAtStart[iface] = bytes
+		}
+	}
+	cmd := exec.CommandContext(ctx, termshark.DumpcapBin(), args...)
+
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+
+	if err = cmd.Start(); err != nil {
+		return err
+	}
+
+	scanner := bufio.NewScanner(out)
+	for scanner.Scan() {
+		if stats, err := ParseInterfaceStats(scanner.Text()); err == nil {
+			if start, ok := ifDropsAtStart[stats.Interface]; ok {
+				if drops, ok := readInterfaceCounter(ifDropsPath, stats.Interface); ok && drops >= start {
+					stats.IfDropped, stats.IfDroppedKnown = drops-start, true
+				}
+			}
+			if start, ok := ifBytesAtStart[stats.Interface]; ok {
+				if bytes, ok := readInterfaceCounter(ifBytesPath, stats.Interface); ok && bytes >= start {
+					stats.IfBytes, stats.IfBytesKnown = bytes-start, true
+				}
+			}
+			cb(stats)
+		}
+	}
+
+	err = cmd.Wait()
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+//======================================================================
+
+// CaptureRate works out how quickly a counter is increasing, per second.
+type CaptureRate struct {
+	last    uint64
+	at      time.Time
+	rate    float64
+	started bool
+}
+
+// Update records the counter's value at the given time and returns the
+// current rate.
+func (r *CaptureRate) Update(val uint64, at time.Time) float64 {
+	if !r.started {
+		r.last, r.at, r.started = val, at, true
+		return r.rate
+	}
+	elapsed := at.Sub(r.at)
+	if elapsed < minRateInterval {
+		return r.rate
+	}
+	if val < r.last {
+		// The counter was reset
+		r.rate = 0
+	} else {
+		r.rate = float64(val-r.last) / elapsed.Seconds()
+	}
+	r.last, r.at = val, at
+	return r.rate
+}
+
+// Rate returns the rate computed by the last update.
+func (r *CaptureRate) Rate() float64 {
+	return r.rate
+}
+
+// FormatBytes returns a size in bytes in a short, readable form e.g. 1.5 MiB.
+func FormatBytes(n float64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	i := 0
+	for n >= 1024 && i < len(units)-1 {
+		n /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%.0f %s", n, units[i])
+	}
+	return fmt.Sprintf("%.1f %s", n, units[i])
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 78
+// End:
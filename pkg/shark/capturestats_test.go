@@ -0,0 +1,80 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+package shark
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+//======================================================================
+
+func TestInterfaceStats1(t *testing.T) {
+	stats, err := ParseInterfaceStats("eth0\t1234\t5\n")
+	assert.NoError(t, err)
+	assert.Equal(t, InterfaceStats{Interface: "eth0", Received: 1234, KernelDropped: 5}, stats)
+
+	stats, err = ParseInterfaceStats(`\Device\NPF_{78032B7E}` + "\t0\t0")
+	assert.NoError(t, err)
+	assert.Equal(t, InterfaceStats{Interface: `\Device\NPF_{78032B7E}`}, stats)
+
+	for _, s := range []string{"", "eth0", "eth0\t12", "eth0\tmany\t0", "eth0\t1\t-1", "\t1\t1", "eth0\t1\t2\t3"} {
+		_, err = ParseInterfaceStats(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestInterfaceDrops1(t *testing.T) {
+	dir, err := ioutil.TempDir("", "termshark-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "%s")
+
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "eth0"), []byte("42\n"), 0644))
+	drops, ok := readInterfaceCounter(path, "eth0")
+	assert.True(t, ok)
+	assert.Equal(t, uint64(42), drops)
+
+	_, ok = readInterfaceCounter(path, "eth1")
+	assert.False(t, ok)
+
+	assert.True(t, InterfaceStats{IfDropped: 1}.Dropped())
+	// Only a guide - they're dumpcap -S's own drops
+	assert.False(t, InterfaceStats{KernelDropped: 1}.Dropped())
+	assert.False(t, InterfaceStats{Received: 1}.Dropped())
+}
+
+func TestCaptureRate1(t *testing.T) {
+	var r CaptureRate
+	start := time.Now()
+
+	assert.Equal(t, 0.0, r.Update(100, start))
+	assert.Equal(t, 50.0, r.Update(200, start.Add(2*time.Second)))
+	// Too soon - keep the last rate
+	assert.Equal(t, 50.0, r.Update(1000, start.Add(2100*time.Millisecond)))
+	assert.Equal(t, 100.0, r.Update(300, start.Add(3*time.Second)))
+	// Counter reset
+	assert.Equal(t, 0.0, r.Update(10, start.Add(4*time.Second)))
+	assert.Equal(t, 0.0, r.Rate())
+}
+
+func TestFormatBytes1(t *testing.T) {
+	assert.Equal(t, "0 B", FormatBytes(0))
+	assert.Equal(t, "1023 B", FormatBytes(1023))
+	assert.Equal(t, "1.5 KiB", FormatBytes(1536))
+	assert.Equal(t, "2.0 MiB", FormatBytes(2*1024*1024))
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 78
+// End:
@@ -0,0 +1,196 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+package shark
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gcla/termshark/v2"
+	"github.com/gcla/termshark/v2/configs/profiles"
+	"github.com/gcla/termshark/v2/pkg/shark/wiresharkcfg"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+//======================================================================
+
+// TempColors are the colors Wireshark uses for its temporary "colorize
+// conversation" rules, in order. The foreground is always black.
+var TempColors = []string{
+	"#ffc0c0", "#ffc0ff", "#e0c0e0", "#c0c0ff", "#c0e0e0",
+	"#c0ffff", "#c0ffc0", "#ffffc0", "#e0e0c0", "#e0e0e0",
+}
+
+// Run this many tshark processes at once when matching coloring rules
+const colorRuleWorkers = 4
+
+// GetColorRules returns the coloring rules saved in the current termshark
+// profile, and true if there are any. Each is stored in the format of a line
+// of Wireshark's colorfilters file.
+func GetColorRules() ([]wiresharkcfg.ColorFilter, bool) {
+	return GetColorRulesFrom(profiles.Current())
+}
+
+func GetColorRulesFrom(v *viper.Viper) ([]wiresharkcfg.ColorFilter, bool) {
+	res := make([]wiresharkcfg.ColorFilter, 0)
+	strs := profiles.ConfStringSliceFrom(v, profiles.Default(), "main.color-rules", []string{})
+	for _, s := range strs {
+		if c, err := wiresharkcfg.ParseColorFilter(s); err == nil {
+			res = append(res, c)
+		}
+	}
+	return res, len(strs) > 0
+}
+
+// SetColorRules saves the coloring rules in the current termshark profile.
+// From then on, termshark colors packets itself using these rules.
+func SetColorRules(rules []wiresharkcfg.ColorFilter) {
+	strs := make([]string, 0, len(rules))
+	for _, rule := range rules {
+		strs = append(strs, rule.String())
+	}
+	profiles.SetConf("main.color-rules", strs)
+}
+
+// ResetColorRules removes the coloring rules from the current termshark
+// profile, so that the Wireshark profile's rules apply again.
+func ResetColorRules() {
+	profiles.DeleteConf("main.color-rules")
+}
+
+// GetWiresharkColorRules returns the coloring rules of the Wireshark profile
+// linked to the current termshark profile. Like Wireshark, if the profile has
+// no colorfilters file, those of the Default profile are used, and failing
+// that, the global defaults.
+func GetWiresharkColorRules() ([]wiresharkcfg.ColorFilter, error) {
+	candidates := make([]string, 0, 3)
+	if prof := profiles.ConfString("main.wireshark-profile", ""); prof != "" {
+		if fname, err := termshark.WiresharkProfileFile(prof, "colorfilters"); err == nil {
+			candidates = append(candidates, fname)
+		}
+	}
+	if fname, err := termshark.WiresharkProfileFile("", "colorfilters"); err == nil {
+		candidates = append(candidates, fname)
+	}
+	if folder, err := termshark.TsharkSetting("Global configuration"); err == nil {
+		candidates = append(candidates, filepath.Join(folder, "colorfilters"))
+	}
+
+	for _, fname := range candidates {
+		res, err := wiresharkcfg.ReadColorFilters(fname)
+		if err == nil {
+			return res, nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+
+	return nil, fmt.Errorf("Could not find Wireshark's coloring rules")
+}
+
+// MatchColorRules works out which of the rules applies to each packet in the
+// pcap numbered from first to last - or to the end of the pcap if last is 0 -
+// so that only the packets added to a live capture since the last run need be
+// checked. The result maps the frame number to the index of the first enabled
+// rule that matches. Each rule is checked with its own tshark process, so this
+// works with any tshark, not just those that support --color. If tshark fails
+// on a rule - e.g. it rejects the filter, or the last packet of a live capture
+// is cut short - the problem is logged and the packets matched up to then are
+// kept.
+func MatchColorRules(ctx context.Context, pcap string, rules []wiresharkcfg.ColorFilter, first int, last int, args []string) (map[int]int, error) {
+	res := make(map[int]int)
+
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, colorRuleWorkers)
+
+	for i, rule := range rules {
+		if rule.Disabled || rule.Filter == "" {
+			continue
+		}
+		i, rule := i, rule
+		sem <- struct{}{}
+		termshark.TrackedGo(func() {
+			defer func() {
+				<-sem
+			}()
+			frames, err := matchColorRule(ctx, pcap, FrameRangeFilter(rule.Filter, first, last), args)
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				log.Warnf("Could not apply coloring rule %s: %v", rule.Name, err)
+			}
+			lock.Lock()
+			defer lock.Unlock()
+			for _, frame := range frames {
+				if cur, ok := res[frame]; !ok || i < cur {
+					res[frame] = i
+				}
+			}
+		}, &wg)
+	}
+
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	return res, nil
+}
+
+// FrameRangeFilter restricts a display filter to the packets numbered from
+// first to last, or to the end of the capture if last is 0.
+func FrameRangeFilter(filter string, first int, last int) string {
+	switch {
+	case last > 0:
+		return fmt.Sprintf("frame.number >= %d && frame.number <= %d && (%s)", first, last, filter)
+	case first > 1:
+		return fmt.Sprintf("frame.number >= %d && (%s)", first, filter)
+	default:
+		return filter
+	}
+}
+
+func matchColorRule(ctx context.Context, pcap string, filter string, args []string) ([]int, error) {
+	cmdArgs := append([]string{"-r", pcap, "-Y", filter, "-T", "fields", "-e", "frame.number"}, args...)
+	cmd := exec.CommandContext(ctx, termshark.TSharkBin(), cmdArgs...)
+
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	if err = cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	res := make([]int, 0, 128)
+	scanner := bufio.NewScanner(out)
+	for scanner.Scan() {
+		if frame, err := strconv.Atoi(strings.TrimSpace(scanner.Text())); err == nil {
+			res = append(res, frame)
+		}
+	}
+
+	// Return what was matched, even if tshark failed part way through
+	return res, cmd.Wait()
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 78
+// End:
@@ -0,0 +1,25 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+package shark
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+//======================================================================
+
+func TestFrameRangeFilter1(t *testing.T) {
+	assert.Equal(t, "tcp || udp", FrameRangeFilter("tcp || udp", 1, 0))
+	assert.Equal(t, "frame.number >= 101 && (tcp || udp)", FrameRangeFilter("tcp || udp", 101, 0))
+	assert.Equal(t, "frame.number >= 101 && frame.number <= 250 && (tcp || udp)", FrameRangeFilter("tcp || udp", 101, 250))
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 78
+// End:
@@ -0,0 +1,127 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+package shark
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gcla/termshark/v2/configs/profiles"
+	"github.com/spf13/viper"
+)
+
+//======================================================================
+
+// DecodeAs is one tshark Decode As rule e.g. tcp.port==8888,http. It is
+// passed to tshark with -d.
+type DecodeAs struct {
+	Selector string // e.g. tcp.port
+	Value    string // e.g. 8888
+	Protocol string // e.g. http
+}
+
+var InvalidDecodeAsError = fmt.Errorf("Decode As must look like <layer type>==<selector>,<decode-as protocol>")
+
+// DecodeAsSelectors are the layer types offered in the Decode As editor. tshark
+// -d accepts others (see tshark -d .) but these cover the common cases.
+var DecodeAsSelectors = []string{
+	"tcp.port",
+	"udp.port",
+	"sctp.port",
+	"sctp.ppi",
+	"dccp.port",
+	"ip.proto",
+	"ipv6.nxt",
+	"ethertype",
+	"vlan.etype",
+	"ppp.protocol",
+	"tls.port",
+	"dtls.port",
+	"http.content_type",
+	"media_type",
+}
+
+// decodeAsFieldSelectors maps fields found in the PDML to the Decode As layer
+// type that would apply to them.
+var decodeAsFieldSelectors = map[string]string{
+	"tcp.port":     "tcp.port",
+	"tcp.srcport":  "tcp.port",
+	"tcp.dstport":  "tcp.port",
+	"udp.port":     "udp.port",
+	"udp.srcport":  "udp.port",
+	"udp.dstport":  "udp.port",
+	"sctp.port":    "sctp.port",
+	"sctp.srcport": "sctp.port",
+	"sctp.dstport": "sctp.port",
+	"dccp.port":    "dccp.port",
+	"dccp.srcport": "dccp.port",
+	"dccp.dstport": "dccp.port",
+	"ip.proto":     "ip.proto",
+	"ipv6.nxt":     "ipv6.nxt",
+	"eth.type":     "ethertype",
+	"vlan.etype":   "vlan.etype",
+}
+
+func (d DecodeAs) String() string {
+	return fmt.Sprintf("%s==%s,%s", d.Selector, d.Value, d.Protocol)
+}
+
+// ParseDecodeAs parses a rule in tshark's -d syntax.
+func ParseDecodeAs(s string) (DecodeAs, error) {
+	eq := strings.Index(s, "==")
+	if eq == -1 {
+		return DecodeAs{}, InvalidDecodeAsError
+	}
+	comma := strings.LastIndex(s, ",")
+	if comma < eq {
+		return DecodeAs{}, InvalidDecodeAsError
+	}
+	res := DecodeAs{
+		Selector: strings.TrimSpace(s[0:eq]),
+		Value:    strings.TrimSpace(s[eq+2 : comma]),
+		Protocol: strings.TrimSpace(s[comma+1:]),
+	}
+	if res.Selector == "" || res.Value == "" || res.Protocol == "" {
+		return DecodeAs{}, InvalidDecodeAsError
+	}
+	return res, nil
+}
+
+// DecodeAsSelectorFor returns the Decode As layer type that corresponds to the
+// PDML field name provided e.g. tcp.srcport => tcp.port.
+func DecodeAsSelectorFor(field string) (string, bool) {
+	res, ok := decodeAsFieldSelectors[field]
+	return res, ok
+}
+
+// GetDecodeAs returns the Decode As rules saved in the current profile.
+func GetDecodeAs() []DecodeAs {
+	return GetDecodeAsFrom(profiles.Current())
+}
+
+func GetDecodeAsFrom(v *viper.Viper) []DecodeAs {
+	res := make([]DecodeAs, 0)
+	for _, s := range profiles.ConfStringSliceFrom(v, profiles.Default(), "main.decode-as", []string{}) {
+		if d, err := ParseDecodeAs(s); err == nil {
+			res = append(res, d)
+		}
+	}
+	return res
+}
+
+// SetDecodeAs saves the Decode As rules in the current profile.
+func SetDecodeAs(rules []DecodeAs) {
+	strs := make([]string, 0, len(rules))
+	for _, rule := range rules {
+		strs = append(strs, rule.String())
+	}
+	profiles.SetConf("main.decode-as", strs)
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 78
+// End:
@@ -0,0 +1,46 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+package shark
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+//======================================================================
+
+func TestDecodeAs1(t *testing.T) {
+	d, err := ParseDecodeAs("tcp.port==8888,http")
+	assert.NoError(t, err)
+	assert.Equal(t, DecodeAs{Selector: "tcp.port", Value: "8888", Protocol: "http"}, d)
+	assert.Equal(t, "tcp.port==8888,http", d.String())
+
+	d, err = ParseDecodeAs("udp.port == 5000-5010 , rtp")
+	assert.NoError(t, err)
+	assert.Equal(t, DecodeAs{Selector: "udp.port", Value: "5000-5010", Protocol: "rtp"}, d)
+}
+
+func TestDecodeAs2(t *testing.T) {
+	for _, s := range []string{"", "tcp.port", "tcp.port==8888", "tcp.port,http==8888", "==8888,http", "tcp.port==8888,"} {
+		_, err := ParseDecodeAs(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestDecodeAs3(t *testing.T) {
+	sel, ok := DecodeAsSelectorFor("tcp.dstport")
+	assert.True(t, ok)
+	assert.Equal(t, "tcp.port", sel)
+
+	_, ok = DecodeAsSelectorFor("frame.len")
+	assert.False(t, ok)
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 78
+// End:
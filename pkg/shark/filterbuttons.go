@@ -0,0 +1,90 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+package shark
+
+import (
+	"github.com/gcla/termshark/v2"
+	"github.com/gcla/termshark/v2/configs/profiles"
+	"github.com/gcla/termshark/v2/pkg/shark/wiresharkcfg"
+	"github.com/spf13/viper"
+)
+
+//======================================================================
+
+// GetFilterButtons returns the filter buttons saved in the current termshark
+// profile. Each is stored in the format of a line of Wireshark's
+// dfilter_buttons file.
+func GetFilterButtons() []wiresharkcfg.FilterButton {
+	return GetFilterButtonsFrom(profiles.Current())
+}
+
+func GetFilterButtonsFrom(v *viper.Viper) []wiresharkcfg.FilterButton {
+	res := make([]wiresharkcfg.FilterButton, 0)
+	for _, s := range profiles.ConfStringSliceFrom(v, profiles.Default(), "main.filter-buttons", []string{}) {
+		if b, err := wiresharkcfg.ParseFilterButton(s); err == nil {
+			res = append(res, b)
+		}
+	}
+	return res
+}
+
+// SetFilterButtons saves the filter buttons in the current termshark profile.
+func SetFilterButtons(buttons []wiresharkcfg.FilterButton) {
+	strs := make([]string, 0, len(buttons))
+	for _, b := range buttons {
+		strs = append(strs, b.String())
+	}
+	profiles.SetConf("main.filter-buttons", strs)
+}
+
+// GetWiresharkFilterButtons returns the filter buttons of the Wireshark
+// profile linked to the current termshark profile, or of Wireshark's Default
+// profile if there is no link.
+func GetWiresharkFilterButtons() ([]wiresharkcfg.FilterButton, error) {
+	fname, err := termshark.WiresharkProfileFile(profiles.ConfString("main.wireshark-profile", ""), "dfilter_buttons")
+	if err != nil {
+		return nil, err
+	}
+	return wiresharkcfg.ReadFilterButtons(fname)
+}
+
+// GetWiresharkSavedFilters returns the saved display filters of the linked
+// Wireshark profile, or of Wireshark's Default profile if there is no link.
+func GetWiresharkSavedFilters() ([]wiresharkcfg.SavedFilter, error) {
+	fname, err := termshark.WiresharkProfileFile(profiles.ConfString("main.wireshark-profile", ""), "dfilters")
+	if err != nil {
+		return nil, err
+	}
+	return wiresharkcfg.ReadSavedFilters(fname)
+}
+
+// MergeFilterButtons combines Wireshark's filter buttons with termshark's. A
+// termshark button replaces the Wireshark button with the same label - a
+// disabled termshark button hides it. Disabled buttons are not returned.
+func MergeFilterButtons(wsButtons []wiresharkcfg.FilterButton, tsButtons []wiresharkcfg.FilterButton) []wiresharkcfg.FilterButton {
+	own := make(map[string]struct{})
+	for _, b := range tsButtons {
+		own[b.Label] = struct{}{}
+	}
+
+	res := make([]wiresharkcfg.FilterButton, 0, len(wsButtons)+len(tsButtons))
+	for _, b := range wsButtons {
+		if _, ok := own[b.Label]; !ok && b.Enabled {
+			res = append(res, b)
+		}
+	}
+	for _, b := range tsButtons {
+		if b.Enabled {
+			res = append(res, b)
+		}
+	}
+	return res
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 78
+// End:
@@ -0,0 +1,40 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+package shark
+
+import (
+	"testing"
+
+	"github.com/gcla/termshark/v2/pkg/shark/wiresharkcfg"
+	"github.com/stretchr/testify/assert"
+)
+
+//======================================================================
+
+func TestMergeFilterButtons1(t *testing.T) {
+	ws := []wiresharkcfg.FilterButton{
+		{Enabled: true, Label: "HTTP", Expression: "http"},
+		{Enabled: true, Label: "DNS", Expression: "dns"},
+		{Enabled: false, Label: "ARP", Expression: "arp"},
+		{Enabled: true, Label: "ICMP", Expression: "icmp"},
+	}
+	ts := []wiresharkcfg.FilterButton{
+		{Enabled: true, Label: "DNS", Expression: "dns && udp"},
+		{Enabled: false, Label: "ICMP", Expression: "icmp"},
+		{Enabled: true, Label: "SYN", Expression: "tcp.flags.syn == 1"},
+	}
+
+	assert.Equal(t, []wiresharkcfg.FilterButton{
+		{Enabled: true, Label: "HTTP", Expression: "http"},
+		{Enabled: true, Label: "DNS", Expression: "dns && udp"},
+		{Enabled: true, Label: "SYN", Expression: "tcp.flags.syn == 1"},
+	}, MergeFilterButtons(ws, ts))
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 78
+// End:
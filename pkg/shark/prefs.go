@@ -0,0 +1,107 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+package shark
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/gcla/termshark/v2"
+	"github.com/gcla/termshark/v2/configs/profiles"
+	"github.com/gcla/termshark/v2/pkg/shark/wiresharkcfg"
+	"github.com/spf13/viper"
+)
+
+//======================================================================
+
+// PrefOverride is a Wireshark preference value set in a termshark profile. It
+// is passed to tshark with -o and takes precedence over the Wireshark profile.
+type PrefOverride struct {
+	Name  string
+	Value string
+}
+
+func (p PrefOverride) String() string {
+	return fmt.Sprintf("%s:%s", p.Name, p.Value)
+}
+
+// LoadCurrentPrefsArgs returns the tshark flags that list every preference
+// with its value in the Wireshark profile provided, or the default profile
+// if it is empty. tshark requires -G to be the first flag.
+func LoadCurrentPrefsArgs(prof string) []string {
+	res := []string{"-G", "currentprefs"}
+	if prof != "" {
+		res = append(res, "-C", prof)
+	}
+	return res
+}
+
+// LoadCurrentPrefs runs tshark to find every preference it supports, with the
+// value currently in effect for the linked Wireshark profile (if any).
+func LoadCurrentPrefs() ([]wiresharkcfg.Pref, error) {
+	args := LoadCurrentPrefsArgs(profiles.ConfString("main.wireshark-profile", ""))
+
+	out, err := exec.Command(termshark.TSharkBin(), args...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("Could not run tshark to read preferences: %v", err)
+	}
+
+	return wiresharkcfg.ParsePrefs(bytes.NewReader(out))
+}
+
+// GetPrefOverrides returns the preference overrides saved in the current
+// profile, sorted by name.
+func GetPrefOverrides() []PrefOverride {
+	return GetPrefOverridesFrom(profiles.Current())
+}
+
+func GetPrefOverridesFrom(v *viper.Viper) []PrefOverride {
+	res := make([]PrefOverride, 0)
+	for _, s := range profiles.ConfStringSliceFrom(v, profiles.Default(), "main.pref-overrides", []string{}) {
+		pieces := strings.SplitN(s, ":", 2)
+		if len(pieces) == 2 && pieces[0] != "" {
+			res = append(res, PrefOverride{Name: pieces[0], Value: pieces[1]})
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Name < res[j].Name
+	})
+	return res
+}
+
+// SetPrefOverride saves, in the current profile, a value for the named
+// preference.
+func SetPrefOverride(name string, value string) {
+	setPrefOverrides(name, &value)
+}
+
+// DeletePrefOverride removes the named preference from the current profile's
+// overrides.
+func DeletePrefOverride(name string) {
+	setPrefOverrides(name, nil)
+}
+
+func setPrefOverrides(name string, value *string) {
+	strs := make([]string, 0)
+	for _, o := range GetPrefOverrides() {
+		if o.Name != name {
+			strs = append(strs, o.String())
+		}
+	}
+	if value != nil {
+		strs = append(strs, PrefOverride{Name: name, Value: *value}.String())
+	}
+	sort.Strings(strs)
+	profiles.SetConf("main.pref-overrides", strs)
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 78
+// End:
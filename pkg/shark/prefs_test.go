@@ -0,0 +1,25 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+package shark
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+//======================================================================
+
+func TestLoadCurrentPrefsArgs1(t *testing.T) {
+	assert.Equal(t, []string{"-G", "currentprefs"}, LoadCurrentPrefsArgs(""))
+	// -G must come first, or tshark rejects it
+	assert.Equal(t, []string{"-G", "currentprefs", "-C", "My Profile"}, LoadCurrentPrefsArgs("My Profile"))
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 78
+// End:
@@ -0,0 +1,38 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+package shark
+
+import (
+	"os"
+
+	"github.com/gcla/termshark/v2/configs/profiles"
+	"github.com/spf13/viper"
+)
+
+//======================================================================
+
+// TLSKeylogFile returns the TLS keylog file termshark should hand to tshark
+// for the current profile, or "" if TLS decryption is not configured.
+func TLSKeylogFile() string {
+	return TLSKeylogFileFrom(profiles.Current())
+}
+
+// TLSKeylogFileFrom returns the TLS keylog file configured in v, falling back
+// to the default config. An explicit file takes precedence; otherwise, if the
+// profile says to follow SSLKEYLOGFILE, the environment variable is used - the
+// same file a browser writes its session keys to.
+func TLSKeylogFileFrom(v *viper.Viper) string {
+	res := profiles.ConfStringFrom(v, profiles.Default(), "main.tls-keylog-file", "")
+	if res == "" && profiles.ConfBoolFrom(v, profiles.Default(), "main.tls-keylog-from-env", false) {
+		res = os.Getenv("SSLKEYLOGFILE")
+	}
+	return res
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 78
+// End:
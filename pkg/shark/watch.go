@@ -0,0 +1,218 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+package shark
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gcla/termshark/v2/configs/profiles"
+	"github.com/gcla/termshark/v2/pkg/shark/wiresharkcfg"
+)
+
+//======================================================================
+
+// WatchAction is what termshark does when a watch rule matches a packet.
+type WatchAction int
+
+const (
+	WatchBell WatchAction = iota
+	WatchFlash
+	WatchMark
+	WatchCommand
+	WatchStop
+)
+
+// WatchActions are the names of the actions, in order, as saved in the
+// profile.
+var WatchActions = []string{"bell", "flash", "mark", "command", "stop"}
+
+var InvalidWatchRuleError = fmt.Errorf("Watch rules need a display filter and an action.")
+
+func (a WatchAction) String() string {
+	if int(a) >= 0 && int(a) < len(WatchActions) {
+		return WatchActions[a]
+	}
+	return "unknown"
+}
+
+// ParseWatchAction returns the action with the given name.
+func ParseWatchAction(s string) (WatchAction, error) {
+	for i, name := range WatchActions {
+		if name == s {
+			return WatchAction(i), nil
+		}
+	}
+	return 0, fmt.Errorf("Unknown watch action %s - expected one of %s", s, strings.Join(WatchActions, ", "))
+}
+
+// WatchRule is a display filter, checked against each packet of a live
+// capture as it arrives, and what to do when it matches. Param is the shell
+// command to run for WatchCommand, and the mark to set (a-z) for WatchMark.
+type WatchRule struct {
+	Enabled bool
+	Filter  string
+	Action  WatchAction
+	Param   string
+}
+
+// String returns the rule in the form it's saved in the profile - a line in
+// the format of a Wireshark UAT file e.g. "TRUE","bell","tcp.flags.reset == 1","".
+func (r WatchRule) String() string {
+	enabled := "FALSE"
+	if r.Enabled {
+		enabled = "TRUE"
+	}
+	return wiresharkcfg.FormatUATLine(enabled, r.Action.String(), r.Filter, r.Param)
+}
+
+// Describe returns a short description of the rule's action.
+func (r WatchRule) Describe() string {
+	switch r.Action {
+	case WatchMark:
+		return fmt.Sprintf("mark '%s", r.MarkName())
+	case WatchCommand:
+		return fmt.Sprintf("run %s", r.Param)
+	default:
+		return r.Action.String()
+	}
+}
+
+// MarkName returns the mark set by a WatchMark rule - w if none is given.
+func (r WatchRule) MarkName() string {
+	if r.Param == "" {
+		return "w"
+	}
+	return r.Param
+}
+
+// Validate checks the rule has what its action needs.
+func (r WatchRule) Validate() error {
+	if strings.TrimSpace(r.Filter) == "" {
+		return InvalidWatchRuleError
+	}
+	switch r.Action {
+	case WatchCommand:
+		if strings.TrimSpace(r.Param) == "" {
+			return fmt.Errorf("Please provide a command to run.")
+		}
+	case WatchMark:
+		if r.Param != "" && (len(r.Param) != 1 || r.Param[0] < 'a' || r.Param[0] > 'z') {
+			return fmt.Errorf("The mark must be a letter from a to z.")
+		}
+	}
+	return nil
+}
+
+// ParseWatchRule parses a rule in the form returned by String.
+func ParseWatchRule(line string) (WatchRule, error) {
+	vals, err := wiresharkcfg.ParseUATLine(line)
+	if err != nil {
+		return WatchRule{}, err
+	}
+	if len(vals) < 3 {
+		return WatchRule{}, fmt.Errorf("Expected at least 3 fields in watch rule %s", line)
+	}
+	action, err := ParseWatchAction(vals[1])
+	if err != nil {
+		return WatchRule{}, err
+	}
+	res := WatchRule{
+		Enabled: strings.EqualFold(vals[0], "TRUE"),
+		Action:  action,
+		Filter:  vals[2],
+	}
+	if len(vals) > 3 {
+		res.Param = vals[3]
+	}
+	return res, res.Validate()
+}
+
+// GetWatchRules returns the watch rules saved in the current termshark
+// profile. Rules that can't be parsed are skipped.
+func GetWatchRules() []WatchRule {
+	res := make([]WatchRule, 0)
+	for _, s := range profiles.ConfStringSlice("main.watch-rules", []string{}) {
+		if r, err := ParseWatchRule(s); err == nil {
+			res = append(res, r)
+		}
+	}
+	return res
+}
+
+// SetWatchRules saves the watch rules in the current termshark profile.
+func SetWatchRules(rules []WatchRule) {
+	if len(rules) == 0 {
+		profiles.DeleteConf("main.watch-rules")
+		return
+	}
+	strs := make([]string, 0, len(rules))
+	for _, r := range rules {
+		strs = append(strs, r.String())
+	}
+	profiles.SetConf("main.watch-rules", strs)
+}
+
+// WatchCommandEnv returns the environment variables describing a matching
+// packet, for the shell command run by a WatchCommand rule.
+func WatchCommandEnv(rule WatchRule, num int, summary string) []string {
+	return []string{
+		fmt.Sprintf("TERMSHARK_PACKET_NUMBER=%d", num),
+		"TERMSHARK_PACKET_SUMMARY=" + summary,
+		"TERMSHARK_WATCH_FILTER=" + rule.Filter,
+	}
+}
+
+// WatchScript returns a Lua script which lets the tshark process reading a
+// live capture check each packet against the filters too. It adds a tap
+// listener for each filter that writes <watch rule="i" frame="n"/> to stdout
+// when packet n matches, where i is the index of the filter. The taps see
+// every packet, whatever tshark's display filter, and run before it prints
+// the packet - so with -T psml these elements come before the packet's PSML,
+// if it's printed at all.
+func WatchScript(filters []string) string {
+	var b strings.Builder
+	b.WriteString("local filters = {\n")
+	for _, f := range filters {
+		fmt.Fprintf(&b, "\t%s,\n", luaQuote(f))
+	}
+	b.WriteString(`}
+for i, filter in ipairs(filters) do
+	local tap = Listener.new(nil, filter)
+	function tap.packet(pinfo)
+		io.write(string.format('<watch rule="%d" frame="%d"/>\n', i - 1, pinfo.number))
+		io.stdout:flush()
+	end
+end
+`)
+	return b.String()
+}
+
+// luaQuote returns s as a Lua string literal. Control characters are written
+// as decimal escapes, which every version of Lua understands.
+func luaQuote(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < 0x20 || c == 0x7f:
+			fmt.Fprintf(&b, "\\%03d", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 78
+// End:
@@ -0,0 +1,68 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+package shark
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+//======================================================================
+
+func TestWatchRule1(t *testing.T) {
+	r, err := ParseWatchRule(`"TRUE","bell","tcp.flags.reset == 1",""`)
+	assert.NoError(t, err)
+	assert.Equal(t, WatchRule{Enabled: true, Action: WatchBell, Filter: "tcp.flags.reset == 1"}, r)
+
+	r = WatchRule{Action: WatchCommand, Filter: `http.host == "a,b"`, Param: `notify-send "$TERMSHARK_PACKET_SUMMARY"`}
+	r2, err := ParseWatchRule(r.String())
+	assert.NoError(t, err)
+	assert.Equal(t, r, r2)
+
+	for _, s := range []string{
+		``,
+		`"TRUE","bell"`,
+		`"TRUE","beep","tcp",""`,
+		`"TRUE","bell","",""`,
+		`"TRUE","command","tcp",""`,
+		`"TRUE","mark","tcp","W"`,
+	} {
+		_, err = ParseWatchRule(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestWatchRule2(t *testing.T) {
+	assert.Equal(t, "w", WatchRule{Action: WatchMark}.MarkName())
+	assert.Equal(t, "mark 'q", WatchRule{Action: WatchMark, Param: "q"}.Describe())
+	assert.Equal(t, "stop", WatchRule{Action: WatchStop}.Describe())
+	assert.Equal(t,
+		[]string{"TERMSHARK_PACKET_NUMBER=12", "TERMSHARK_PACKET_SUMMARY=x : y", "TERMSHARK_WATCH_FILTER=dns"},
+		WatchCommandEnv(WatchRule{Filter: "dns"}, 12, "x : y"))
+}
+
+func TestWatchScript1(t *testing.T) {
+	filters := []string{"dns", `http.host == "a\\b"`, "tcp\n"}
+	assert.Equal(t, `local filters = {
+	"dns",
+	"http.host == \"a\\\\b\"",
+	"tcp\010",
+}
+for i, filter in ipairs(filters) do
+	local tap = Listener.new(nil, filter)
+	function tap.packet(pinfo)
+		io.write(string.format('<watch rule="%d" frame="%d"/>\n', i - 1, pinfo.number))
+		io.stdout:flush()
+	end
+end
+`, WatchScript(filters))
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 78
+// End:
@@ -0,0 +1,142 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+package wiresharkcfg
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+//======================================================================
+
+// ColorFilter is one of Wireshark's coloring rules, as stored in a profile's
+// colorfilters file. Colors are 16 bits per channel, as Wireshark stores them.
+type ColorFilter struct {
+	Name       string
+	Filter     string
+	Disabled   bool
+	Background [3]uint16
+	Foreground [3]uint16
+}
+
+// A rule looks like this - background first, then foreground. A disabled rule
+// has a leading !
+//
+// @Bad TCP@tcp.analysis.flags && !tcp.analysis.window_update@[4718,10030,11796][63479,34695,34695]
+var colorFilterRE = regexp.MustCompile(`^(!?)@([^@]*)@(.*)@\[(\d+),(\d+),(\d+)\]\[(\d+),(\d+),(\d+)\]\s*$`)
+
+var colorHexRE = regexp.MustCompile(`^#?([0-9a-fA-F]{2})([0-9a-fA-F]{2})([0-9a-fA-F]{2})$`)
+
+// String returns the rule in the format of a line of the colorfilters file.
+func (c ColorFilter) String() string {
+	disabled := ""
+	if c.Disabled {
+		disabled = "!"
+	}
+	return fmt.Sprintf("%s@%s@%s@[%d,%d,%d][%d,%d,%d]", disabled, c.Name, c.Filter,
+		c.Background[0], c.Background[1], c.Background[2],
+		c.Foreground[0], c.Foreground[1], c.Foreground[2],
+	)
+}
+
+// ForegroundHex returns the foreground color in #rrggbb form.
+func (c ColorFilter) ForegroundHex() string {
+	return colorToHex(c.Foreground)
+}
+
+// BackgroundHex returns the background color in #rrggbb form.
+func (c ColorFilter) BackgroundHex() string {
+	return colorToHex(c.Background)
+}
+
+func colorToHex(c [3]uint16) string {
+	return fmt.Sprintf("#%02x%02x%02x", c[0]>>8, c[1]>>8, c[2]>>8)
+}
+
+// ColorFromHex converts a color in #rrggbb form to Wireshark's 16 bits per
+// channel.
+func ColorFromHex(s string) ([3]uint16, error) {
+	var res [3]uint16
+	m := colorHexRE.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return res, fmt.Errorf("Colors must look like #rrggbb, not %s", s)
+	}
+	for i := 0; i < 3; i++ {
+		v, _ := strconv.ParseUint(m[i+1], 16, 8)
+		res[i] = uint16(v) * 0x101
+	}
+	return res, nil
+}
+
+// ParseColorFilter parses a single line of a colorfilters file.
+func ParseColorFilter(line string) (ColorFilter, error) {
+	m := colorFilterRE.FindStringSubmatch(line)
+	if m == nil {
+		return ColorFilter{}, fmt.Errorf("Could not parse coloring rule %s", line)
+	}
+	res := ColorFilter{
+		Disabled: m[1] == "!",
+		Name:     m[2],
+		Filter:   m[3],
+	}
+	for i := 0; i < 3; i++ {
+		bg, err := strconv.ParseUint(m[4+i], 10, 16)
+		if err != nil {
+			return ColorFilter{}, fmt.Errorf("Invalid background color in coloring rule %s", line)
+		}
+		fg, err := strconv.ParseUint(m[7+i], 10, 16)
+		if err != nil {
+			return ColorFilter{}, fmt.Errorf("Invalid foreground color in coloring rule %s", line)
+		}
+		res.Background[i] = uint16(bg)
+		res.Foreground[i] = uint16(fg)
+	}
+	return res, nil
+}
+
+// ParseColorFilters reads the content of a Wireshark colorfilters file, in
+// order. Comments and lines that can't be parsed are skipped.
+func ParseColorFilters(r io.Reader) ([]ColorFilter, error) {
+	res := make([]ColorFilter, 0)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if c, err := ParseColorFilter(line); err == nil {
+			res = append(res, c)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// ReadColorFilters reads the colorfilters file provided.
+func ReadColorFilters(filename string) ([]ColorFilter, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return ParseColorFilters(file)
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 110
+// End:
@@ -0,0 +1,64 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+package wiresharkcfg
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var colorFiltersInput = `# DO NOT EDIT THIS FILE!  It was created by Wireshark
+@Bad TCP@tcp.analysis.flags && !tcp.analysis.window_update@[4718,10030,11796][63479,34695,34695]
+!@HSRP State Change@hsrp.state != 8 && hsrp.state != 16@[4718,10030,11796][65535,64764,40092]
+@TCP@tcp@[59367,59110,65535][4718,10030,11796]
+@Broken@tcp@[1,2][3,4,5]
+`
+
+func TestColorFilters1(t *testing.T) {
+	filters, err := ParseColorFilters(strings.NewReader(colorFiltersInput))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(filters))
+
+	assert.Equal(t, ColorFilter{
+		Name:       "Bad TCP",
+		Filter:     "tcp.analysis.flags && !tcp.analysis.window_update",
+		Background: [3]uint16{4718, 10030, 11796},
+		Foreground: [3]uint16{63479, 34695, 34695},
+	}, filters[0])
+	assert.True(t, filters[1].Disabled)
+	assert.Equal(t, "hsrp.state != 8 && hsrp.state != 16", filters[1].Filter)
+
+	// Round trip
+	for _, f := range filters {
+		f2, err := ParseColorFilter(f.String())
+		assert.NoError(t, err)
+		assert.Equal(t, f, f2)
+	}
+
+	assert.Equal(t, "#12272e", filters[0].BackgroundHex())
+	assert.Equal(t, "#f78787", filters[0].ForegroundHex())
+}
+
+func TestColorFromHex1(t *testing.T) {
+	c, err := ColorFromHex("#ffc0c0")
+	assert.NoError(t, err)
+	assert.Equal(t, [3]uint16{65535, 49344, 49344}, c)
+	assert.Equal(t, "#ffc0c0", colorToHex(c))
+
+	c, err = ColorFromHex("000000")
+	assert.NoError(t, err)
+	assert.Equal(t, [3]uint16{0, 0, 0}, c)
+
+	_, err = ColorFromHex("red")
+	assert.Error(t, err)
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 78
+// End:
@@ -0,0 +1,236 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+package wiresharkcfg
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+//======================================================================
+
+// FilterButton is one of Wireshark's display filter buttons, as stored in a
+// profile's dfilter_buttons file.
+type FilterButton struct {
+	Enabled    bool
+	Label      string // e.g. HTTP
+	Expression string // e.g. http || tcp.port == 8080
+	Comment    string
+}
+
+// SavedFilter is one of Wireshark's saved display filters, as stored in a
+// profile's dfilters file.
+type SavedFilter struct {
+	Name       string
+	Expression string
+}
+
+// String returns the button in the format of a line of the dfilter_buttons
+// file e.g. "TRUE","HTTP","http",""
+func (b FilterButton) String() string {
+	enabled := "FALSE"
+	if b.Enabled {
+		enabled = "TRUE"
+	}
+	return fmt.Sprintf("\"%s\",\"%s\",\"%s\",\"%s\"", enabled, uatEscape(b.Label), uatEscape(b.Expression), uatEscape(b.Comment))
+}
+
+// ParseFilterButton parses a single line of a dfilter_buttons file.
+func ParseFilterButton(line string) (FilterButton, error) {
+	vals, err := parseUATLine(line)
+	if err != nil {
+		return FilterButton{}, err
+	}
+	if len(vals) < 3 {
+		return FilterButton{}, fmt.Errorf("Expected at least 3 fields in filter button %s", line)
+	}
+	res := FilterButton{
+		Enabled:    strings.EqualFold(vals[0], "TRUE"),
+		Label:      vals[1],
+		Expression: vals[2],
+	}
+	if len(vals) > 3 {
+		res.Comment = vals[3]
+	}
+	return res, nil
+}
+
+// ParseFilterButtons reads the content of a Wireshark dfilter_buttons file.
+// Comments and blank lines are skipped, as are lines that can't be parsed.
+func ParseFilterButtons(r io.Reader) ([]FilterButton, error) {
+	res := make([]FilterButton, 0)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if b, err := ParseFilterButton(line); err == nil {
+			res = append(res, b)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// ParseSavedFilters reads the content of a Wireshark dfilters file. Each line
+// looks like
+//
+//	"TCP only" tcp
+func ParseSavedFilters(r io.Reader) ([]SavedFilter, error) {
+	res := make([]SavedFilter, 0)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "\"") {
+			continue
+		}
+		end := strings.Index(line[1:], "\"")
+		if end == -1 {
+			continue
+		}
+		res = append(res, SavedFilter{
+			Name:       line[1 : end+1],
+			Expression: strings.TrimSpace(line[end+2:]),
+		})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// ReadFilterButtons reads the dfilter_buttons file provided. A file that does
+// not exist has no buttons.
+func ReadFilterButtons(filename string) ([]FilterButton, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []FilterButton{}, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	return ParseFilterButtons(file)
+}
+
+// ReadSavedFilters reads the dfilters or cfilters file provided. A file that
+// does not exist has no filters.
+func ReadSavedFilters(filename string) ([]SavedFilter, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []SavedFilter{}, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	return ParseSavedFilters(file)
+}
+
+// parseUATLine splits a line of a Wireshark UAT (user accessible table) file
+// into its quoted, comma-separated values. Within a value, Wireshark writes
+// quotes, backslashes and non-printable characters as \xNN.
+func parseUATLine(line string) ([]string, error) {
+	res := make([]string, 0, 4)
+	i := 0
+	for {
+		for i < len(line) && line[i] == ' ' {
+			i++
+		}
+		if i >= len(line) || line[i] != '"' {
+			return nil, fmt.Errorf("Expected a quoted value at position %d of %s", i, line)
+		}
+		i++
+
+		var val strings.Builder
+		closed := false
+		for i < len(line) && !closed {
+			switch {
+			case line[i] == '"':
+				closed = true
+				i++
+			case line[i] == '\\' && i+3 < len(line) && line[i+1] == 'x':
+				b, err := strconv.ParseUint(line[i+2:i+4], 16, 8)
+				if err != nil {
+					return nil, fmt.Errorf("Invalid escape at position %d of %s", i, line)
+				}
+				val.WriteByte(byte(b))
+				i += 4
+			case line[i] == '\\' && i+1 < len(line):
+				val.WriteByte(line[i+1])
+				i += 2
+			default:
+				val.WriteByte(line[i])
+				i++
+			}
+		}
+		if !closed {
+			return nil, fmt.Errorf("Unterminated value in %s", line)
+		}
+		res = append(res, val.String())
+
+		for i < len(line) && line[i] == ' ' {
+			i++
+		}
+		if i >= len(line) {
+			break
+		}
+		if line[i] != ',' {
+			return nil, fmt.Errorf("Expected a comma at position %d of %s", i, line)
+		}
+		i++
+	}
+	return res, nil
+}
+
+// ParseUATLine splits a line in the format of a Wireshark UAT file into its
+// values. Termshark uses the same format for some of its own settings.
+func ParseUATLine(line string) ([]string, error) {
+	return parseUATLine(line)
+}
+
+// FormatUATLine is the reverse of ParseUATLine.
+func FormatUATLine(vals ...string) string {
+	quoted := make([]string, 0, len(vals))
+	for _, val := range vals {
+		quoted = append(quoted, fmt.Sprintf("\"%s\"", uatEscape(val)))
+	}
+	return strings.Join(quoted, ",")
+}
+
+// uatEscape is the reverse of the unescaping in parseUATLine.
+func uatEscape(s string) string {
+	var res strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '"' || c == '\\' || c < ' ' || c > '~' {
+			fmt.Fprintf(&res, "\\x%02x", c)
+		} else {
+			res.WriteByte(c)
+		}
+	}
+	return res.String()
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 110
+// End:
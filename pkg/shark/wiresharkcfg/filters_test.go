@@ -0,0 +1,63 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+package wiresharkcfg
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var buttonsInput = `# This file is automatically generated, DO NOT MODIFY.
+"TRUE","HTTP","http || tcp.port == 8080","Web traffic"
+"FALSE","DNS","dns",""
+"TRUE","Host","http.host == \x22example.com\x22",""
+not a button
+`
+
+var savedFiltersInput = `"Ethernet address 00:00:5e:00:53:00" eth.addr == 00:00:5e:00:53:00
+"TCP only" tcp
+"No ARP" not arp
+`
+
+func TestFilterButtons1(t *testing.T) {
+	buttons, err := ParseFilterButtons(strings.NewReader(buttonsInput))
+	assert.NoError(t, err)
+	assert.Equal(t, []FilterButton{
+		{Enabled: true, Label: "HTTP", Expression: "http || tcp.port == 8080", Comment: "Web traffic"},
+		{Enabled: false, Label: "DNS", Expression: "dns"},
+		{Enabled: true, Label: "Host", Expression: "http.host == \"example.com\""},
+	}, buttons)
+
+	// Round trip
+	for _, b := range buttons {
+		b2, err := ParseFilterButton(b.String())
+		assert.NoError(t, err)
+		assert.Equal(t, b, b2)
+	}
+	assert.Equal(t, `"TRUE","Host","http.host == \x22example.com\x22",""`, buttons[2].String())
+
+	_, err = ParseFilterButton(`"TRUE","HTTP`)
+	assert.Error(t, err)
+	_, err = ParseFilterButton(`"TRUE"`)
+	assert.Error(t, err)
+}
+
+func TestSavedFilters1(t *testing.T) {
+	filters, err := ParseSavedFilters(strings.NewReader(savedFiltersInput))
+	assert.NoError(t, err)
+	assert.Equal(t, []SavedFilter{
+		{Name: "Ethernet address 00:00:5e:00:53:00", Expression: "eth.addr == 00:00:5e:00:53:00"},
+		{Name: "TCP only", Expression: "tcp"},
+		{Name: "No ARP", Expression: "not arp"},
+	}, filters)
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 78
+// End:
@@ -0,0 +1,150 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+package wiresharkcfg
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+)
+
+//======================================================================
+
+// Pref is a single preference from a Wireshark preferences file, or from the
+// output of tshark -G currentprefs, along with the comment that documents it.
+// Unlike Config, which only holds the values, this keeps the information needed
+// to present preferences to the user.
+type Pref struct {
+	Name    string // e.g. tcp.analyze_sequence_numbers
+	Value   string // e.g. TRUE
+	Comment string // e.g. "Analyze TCP sequence numbers\nTRUE or FALSE (case-insensitive)"
+	Default bool   // true if the preference is commented out i.e. has its default value
+}
+
+// A preference line looks like "tcp.desegment_tcp_streams: TRUE", or with a
+// leading # if the preference has its default value. The comment lines that
+// precede it have a space after the #.
+var prefRE = regexp.MustCompile(`^(#?)([A-Za-z0-9_.\-]+):\s?(.*)$`)
+
+// Protocol returns the protocol part of the preference name e.g. tcp.
+func (p Pref) Protocol() string {
+	return strings.SplitN(p.Name, ".", 2)[0]
+}
+
+// ParsePrefs reads preferences in the format Wireshark uses for its preferences
+// file. Values that span several lines (e.g. lists) are joined with spaces.
+func ParsePrefs(r io.Reader) ([]Pref, error) {
+	res := make([]Pref, 0, 256)
+	comment := make([]string, 0, 8)
+	inPref := false // true if the previous line was a preference, so the next might continue it
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		switch {
+		case inPref && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")):
+			// A continuation of a list value
+			res[len(res)-1].Value = strings.TrimSpace(res[len(res)-1].Value + " " + strings.TrimSpace(line))
+			continue
+		case inPref && res[len(res)-1].Default && strings.HasPrefix(line, "#\t"):
+			// A continuation of a commented-out list value
+			res[len(res)-1].Value = strings.TrimSpace(res[len(res)-1].Value + " " + strings.TrimSpace(line[1:]))
+			continue
+		}
+
+		inPref = false
+
+		switch {
+		case strings.TrimSpace(line) == "":
+			comment = comment[:0]
+		case strings.HasPrefix(line, "##"):
+			// section header e.g. ####### Protocols ########
+			comment = comment[:0]
+		case prefRE.MatchString(line):
+			m := prefRE.FindStringSubmatch(line)
+			res = append(res, Pref{
+				Name:    m[2],
+				Value:   strings.TrimSpace(m[3]),
+				Comment: strings.Join(comment, "\n"),
+				Default: m[1] == "#",
+			})
+			inPref = true
+			comment = comment[:0]
+		case strings.HasPrefix(line, "#"):
+			comment = append(comment, strings.TrimSpace(line[1:]))
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// UpdatePrefsFile sets the preference name to value in the Wireshark
+// preferences file provided, creating the file if necessary.
+func UpdatePrefsFile(filename string, name string, value string) error {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	err = ioutil.WriteFile(filename, []byte(UpdatePrefs(string(data), name, value)), 0644)
+	if err != nil {
+		return fmt.Errorf("Could not write Wireshark preferences %s: %v", filename, err)
+	}
+
+	return nil
+}
+
+// UpdatePrefs returns the content of a preferences file with name set to value.
+// An existing line for the preference - commented out or not - is replaced,
+// along with any continuation lines; otherwise the preference is appended.
+func UpdatePrefs(content string, name string, value string) string {
+	lines := strings.Split(content, "\n")
+	res := make([]string, 0, len(lines)+2)
+	newLine := fmt.Sprintf("%s: %s", name, value)
+	done := false
+	skipping := false
+
+	for _, line := range lines {
+		if skipping {
+			if strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") || strings.HasPrefix(line, "#\t") {
+				continue
+			}
+			skipping = false
+		}
+		if m := prefRE.FindStringSubmatch(line); !done && m != nil && m[2] == name {
+			res = append(res, newLine)
+			done = true
+			skipping = true
+			continue
+		}
+		res = append(res, line)
+	}
+
+	if !done {
+		if len(res) > 0 && res[len(res)-1] == "" {
+			res = append(res[0:len(res)-1], newLine, "")
+		} else {
+			res = append(res, newLine)
+		}
+	}
+
+	return strings.Join(res, "\n")
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 110
+// End:
@@ -0,0 +1,96 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+package wiresharkcfg
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var prefsInput = `# Configuration file for Wireshark 3.2.3.
+#
+# This file is regenerated each time preferences are saved within
+# Wireshark. Making manual changes should be safe, however.
+
+####### User Interface: Columns ########
+
+# Packet list hidden columns
+# List all columns to hide in the packet list.
+#gui.column.hidden: 
+
+# Packet list column format
+# Each pair of strings consists of a column title and its format
+#gui.column.format: 
+#	"No.", "%m",
+#	"Time", "%t"
+
+####### Protocols ########
+
+# Whether subdissector can request TCP streams to be reassembled
+# TRUE or FALSE (case-insensitive)
+tcp.desegment_tcp_streams: FALSE
+
+# Analyze TCP sequence numbers
+# TRUE or FALSE (case-insensitive)
+#tcp.analyze_sequence_numbers: TRUE
+
+# A list of ports
+uat.foo: "a",
+	"b"
+`
+
+func TestParsePrefs1(t *testing.T) {
+	prefs, err := ParsePrefs(strings.NewReader(prefsInput))
+	assert.NoError(t, err)
+	assert.Equal(t, 5, len(prefs))
+
+	assert.Equal(t, Pref{
+		Name:    "gui.column.hidden",
+		Value:   "",
+		Comment: "Packet list hidden columns\nList all columns to hide in the packet list.",
+		Default: true,
+	}, prefs[0])
+
+	assert.Equal(t, "gui.column.format", prefs[1].Name)
+	assert.Equal(t, `"No.", "%m", "Time", "%t"`, prefs[1].Value)
+
+	assert.Equal(t, Pref{
+		Name:    "tcp.desegment_tcp_streams",
+		Value:   "FALSE",
+		Comment: "Whether subdissector can request TCP streams to be reassembled\nTRUE or FALSE (case-insensitive)",
+		Default: false,
+	}, prefs[2])
+	assert.Equal(t, "tcp", prefs[2].Protocol())
+
+	assert.Equal(t, true, prefs[3].Default)
+	assert.Equal(t, "TRUE", prefs[3].Value)
+
+	assert.Equal(t, `"a", "b"`, prefs[4].Value)
+	assert.Equal(t, "A list of ports", prefs[4].Comment)
+}
+
+func TestUpdatePrefs1(t *testing.T) {
+	// Replace a commented-out preference
+	res := UpdatePrefs(prefsInput, "tcp.analyze_sequence_numbers", "FALSE")
+	assert.Contains(t, res, "\ntcp.analyze_sequence_numbers: FALSE\n")
+	assert.NotContains(t, res, "#tcp.analyze_sequence_numbers")
+
+	// Replace a list, including its continuation lines
+	res = UpdatePrefs(prefsInput, "gui.column.format", `"No.", "%m"`)
+	assert.Contains(t, res, "gui.column.format: \"No.\", \"%m\"\n\n")
+	assert.NotContains(t, res, "%t")
+
+	// Append a new preference
+	res = UpdatePrefs(prefsInput, "http.tcp.port", "8080")
+	assert.True(t, strings.HasSuffix(res, "\nhttp.tcp.port: 8080\n"))
+
+	prefs, err := ParsePrefs(strings.NewReader(res))
+	assert.NoError(t, err)
+	assert.Equal(t, 6, len(prefs))
+
+	assert.Equal(t, "x.y: z\n", UpdatePrefs("", "x.y", "z"))
+}
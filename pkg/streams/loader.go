@@ -16,6 +16,7 @@ import (
 	"github.com/gcla/gowid"
 	"github.com/gcla/termshark/v2"
 	"github.com/gcla/termshark/v2/pkg/pcap"
+	"github.com/gcla/termshark/v2/pkg/shark"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -39,13 +40,21 @@ func MakeCommands() commands {
 var _ ILoaderCmds = commands{}
 
 func (c commands) Stream(pcapfile string, proto string, idx int) pcap.IPcapCommand {
+	// If TLS can be decrypted, follow the decrypted application data rather
+	// than the raw TCP payload. tshark identifies a TLS stream by its TCP stream
+	// index.
+	if proto == "tcp" && shark.TLSKeylogFile() != "" {
+		proto = "tls"
+	}
 	args := []string{"-r", pcapfile, "-q", "-z", fmt.Sprintf("follow,%s,raw,%d", proto, idx)}
+	args = append(args, pcap.ProfileArgs()...)
 	return &pcap.Command{Cmd: exec.Command(termshark.TSharkBin(), args...)}
 }
 
 // startAt is zero-indexed
 func (c commands) Indexer(pcapfile string, proto string, idx int) pcap.IPcapCommand {
 	args := []string{"-T", "pdml", "-r", pcapfile, "-Y", fmt.Sprintf("%s.stream eq %d", proto, idx)}
+	args = append(args, pcap.ProfileArgs()...)
 	return &pcap.Command{Cmd: exec.Command(termshark.TSharkBin(), args...)}
 }
 
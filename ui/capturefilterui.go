@@ -0,0 +1,297 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gcla/gowid"
+	"github.com/gcla/gowid/widgets/button"
+	"github.com/gcla/gowid/widgets/columns"
+	"github.com/gcla/gowid/widgets/dialog"
+	"github.com/gcla/gowid/widgets/divider"
+	"github.com/gcla/gowid/widgets/framed"
+	"github.com/gcla/gowid/widgets/menu"
+	"github.com/gcla/gowid/widgets/pile"
+	"github.com/gcla/gowid/widgets/styled"
+	"github.com/gcla/gowid/widgets/text"
+	"github.com/gcla/termshark/v2"
+	"github.com/gcla/termshark/v2/pkg/fields"
+	"github.com/gcla/termshark/v2/pkg/pcap"
+	"github.com/gcla/termshark/v2/pkg/shark"
+	"github.com/gcla/termshark/v2/pkg/shark/wiresharkcfg"
+	"github.com/gcla/termshark/v2/ui/menuutil"
+	"github.com/gcla/termshark/v2/widgets/filter"
+	"github.com/gdamore/tcell/v2"
+	log "github.com/sirupsen/logrus"
+)
+
+//======================================================================
+
+// captureFilterCompleter offers pcap-filter keywords as completions. With nothing
+// typed yet, it offers the saved capture filters instead.
+type captureFilterCompleter struct {
+	saved []wiresharkcfg.SavedFilter
+}
+
+var _ fields.IPrefixCompleter = captureFilterCompleter{}
+
+func (c captureFilterCompleter) Completions(prefix string, cb fields.IPrefixCompleterCallback) {
+	cb.Call(shark.CaptureFilterCompletions(prefix, c.saved))
+}
+
+//======================================================================
+
+// openCaptureFilterUi opens the capture filter editor for the interface being
+// captured, or if there isn't one, for an interface the user picks.
+func openCaptureFilterUi(app gowid.IApp) {
+	pickCaptureInterface(openCaptureFilterFor, app)
+}
+
+// openCaptureFilterFor opens the capture filter editor for the interface. The filter
+// is checked as it's typed by compiling it with dumpcap for the interface's link-layer
+// type. If the interface is being captured, the capture can be restarted with the new
+// filter.
+func openCaptureFilterFor(iface string, app gowid.IApp) {
+	var filterDialog *dialog.Widget
+
+	saved, err := shark.GetWiresharkCaptureFilters()
+	if err != nil {
+		log.Warnf("Could not read saved capture filters: %v", err)
+	}
+
+	capturing := termshark.StringInSlice(iface, Loader.Interfaces()) && Loader.InterfaceLoader.IsLoading()
+
+	validator := &filter.CaptureFilterValidator{
+		Args: shark.CompileCaptureFilterArgs(iface),
+	}
+
+	filterWidget := filter.New("capturefilter", filter.Options{
+		Completer:  captureFilterCompleter{saved: saved},
+		MenuOpener: &multiMenu1Opener,
+		Position:   filter.Below,
+		Validator:  validator,
+	})
+
+	// dumpcap's explanation of why the filter doesn't compile
+	problemText := text.New("")
+
+	filterWidget.OnValid(gowid.MakeWidgetCallback("cb", func(app gowid.IApp, w gowid.IWidget) {
+		problemText.SetText("", app)
+	}))
+	filterWidget.OnEmpty(gowid.MakeWidgetCallback("cb", func(app gowid.IApp, w gowid.IWidget) {
+		problemText.SetText("", app)
+	}))
+	filterWidget.OnInvalid(gowid.MakeWidgetCallback("cb", func(app gowid.IApp, w gowid.IWidget) {
+		if err := filterWidget.ValidationError(); err != nil {
+			problemText.SetText(err.Error(), app)
+		}
+	}))
+
+	if capturing {
+		filterWidget.SetValue(Loader.CaptureFilter(), app)
+	}
+
+	bpfBtn := button.New(text.New("Show BPF"))
+	bpfBtn.OnClick(gowid.MakeWidgetCallback("cb", func(app gowid.IApp, w gowid.IWidget) {
+		openCaptureFilterBPF(iface, filterWidget.Value(), app)
+	}))
+
+	filterRow := []gowid.IContainerWidget{
+		&gowid.ContainerWidget{
+			IWidget: text.New("Filter: "),
+			D:       fixed,
+		},
+		&gowid.ContainerWidget{
+			IWidget: filterWidget,
+			D:       weight(1),
+		},
+		&gowid.ContainerWidget{
+			IWidget: text.New(" "),
+			D:       fixed,
+		},
+		&gowid.ContainerWidget{
+			IWidget: styled.NewExt(
+				bpfBtn,
+				gowid.MakePaletteRef("button"),
+				gowid.MakePaletteRef("button-focus"),
+			),
+			D: fixed,
+		},
+	}
+
+	if len(saved) > 0 {
+		savedSite, savedBtn := makeSavedCaptureFilters(saved, filterWidget)
+		filterRow = append(filterRow,
+			&gowid.ContainerWidget{
+				IWidget: text.New(" "),
+				D:       fixed,
+			},
+			&gowid.ContainerWidget{
+				IWidget: savedSite,
+				D:       fixed,
+			},
+			&gowid.ContainerWidget{
+				IWidget: savedBtn,
+				D:       fixed,
+			},
+		)
+	}
+
+	buttons := []dialog.Button{dialog.Cancel}
+	if capturing {
+		applyBtn := dialog.Button{
+			Msg: "Apply",
+			Action: gowid.MakeWidgetCallback("exec", gowid.WidgetChangedFunction(func(app gowid.IApp, _ gowid.IWidget) {
+				newFilter := filterWidget.Value()
+				if newFilter != "" && !filterWidget.IsValid() {
+					OpenError("The capture filter is not valid.", app)
+					return
+				}
+				if newFilter == Loader.CaptureFilter() {
+					OpenError("Same filter - nothing to do", app)
+					return
+				}
+				filterDialog.Close(app)
+				restartCaptureWithFilter(newFilter)
+			})),
+		}
+		buttons = []dialog.Button{applyBtn, dialog.Cancel}
+	}
+
+	msg := fmt.Sprintf("Capture filter for %s:", iface)
+	if capturing {
+		msg = fmt.Sprintf("Capture filter for %s. Apply restarts the capture, clearing the current packets.", iface)
+	}
+
+	filterDialog = dialog.New(
+		framed.NewSpace(
+			pile.NewFlow(
+				text.New(msg),
+				divider.NewBlank(),
+				columns.New(filterRow),
+				divider.NewBlank(),
+				problemText,
+			),
+		),
+		dialog.Options{
+			Buttons:         buttons,
+			NoShadow:        true,
+			BackgroundStyle: gowid.MakePaletteRef("dialog"),
+			BorderStyle:     gowid.MakePaletteRef("dialog"),
+			ButtonStyle:     gowid.MakePaletteRef("dialog-button"),
+			Modal:           true,
+			FocusOnWidget:   true,
+		},
+	)
+
+	// Stop the filter widget's validation goroutines when the dialog goes away
+	dialogOpen := false
+	filterDialog.OnOpenClose(gowid.MakeWidgetCallback("cb", func(app gowid.IApp, widget gowid.IWidget) {
+		dialogOpen = !dialogOpen
+		if !dialogOpen {
+			if err := filterWidget.Close(); err != nil {
+				log.Warnf("Unexpected result closing capture filter dialog: %v", err)
+			}
+		}
+	}))
+
+	filterDialog.Open(appView, ratio(0.7), app)
+}
+
+// makeSavedCaptureFilters returns a button which opens a drop down of the saved
+// capture filters, and the site at which the drop down opens. Choosing one
+// replaces the filter being edited.
+func makeSavedCaptureFilters(saved []wiresharkcfg.SavedFilter, filterWidget *filter.Widget) (*menu.SiteWidget, gowid.IWidget) {
+	savedBtn := button.New(text.New("Saved"))
+	savedSite := menu.NewSite(menu.SiteOptions{YOffset: 1})
+
+	var savedMenu *menu.Widget
+	items := make([]menuutil.SimpleMenuItem, 0, len(saved))
+	for _, f := range saved {
+		f := f
+		items = append(items, menuutil.SimpleMenuItem{
+			Txt: fmt.Sprintf("%s: %s", f.Name, f.Expression),
+			CB: func(app gowid.IApp, w gowid.IWidget) {
+				multiMenu1Opener.CloseMenu(savedMenu, app)
+				filterWidget.SetValue(f.Expression, app)
+			},
+		})
+	}
+
+	savedListBox, savedWidth := menuutil.MakeMenu(items, nil)
+
+	savedMenu = menu.New("savedcapturefilters", savedListBox, units(savedWidth), menu.Options{
+		Modal:             true,
+		OpenCloser:        &multiMenu1Opener,
+		CloseKeysProvided: true,
+		CloseKeys: []gowid.IKey{
+			gowid.MakeKey('q'),
+			gowid.MakeKeyExt(tcell.KeyLeft),
+			gowid.MakeKeyExt(tcell.KeyEscape),
+			gowid.MakeKeyExt(tcell.KeyCtrlC),
+		},
+	})
+
+	savedBtn.OnClick(gowid.MakeWidgetCallback("cb", func(app gowid.IApp, w gowid.IWidget) {
+		multiMenu1Opener.OpenMenu(savedMenu, savedSite, app)
+	}))
+
+	return savedSite, styled.NewExt(
+		savedBtn,
+		gowid.MakePaletteRef("button"),
+		gowid.MakePaletteRef("button-focus"),
+	)
+}
+
+// openCaptureFilterBPF compiles the capture filter with dumpcap and shows the BPF
+// program - or why it won't compile.
+func openCaptureFilterBPF(iface string, filt string, app gowid.IApp) {
+	OpenPleaseWait(appView, app)
+
+	termshark.TrackedGo(func() {
+		prog, err := shark.CompileCaptureFilter(iface, filt)
+
+		app.Run(gowid.RunFunction(func(app gowid.IApp) {
+			ClosePleaseWait(app)
+			if err != nil {
+				OpenLongError(fmt.Sprintf("Could not compile capture filter for %s:\n\n%v", iface, err), app)
+				return
+			}
+			OpenMessageForCopy(strings.Join(prog, "\n"), appView, app)
+		}))
+	}, Goroutinewg)
+}
+
+// restartCaptureWithFilter clears the current packets and restarts the live
+// capture using the new capture filter.
+func restartCaptureWithFilter(filt string) {
+	Loader.SetCaptureFilter(filt)
+	Loader.ClearPcap(
+		pcap.HandlerList{
+			SimpleErrors{},
+			MakePacketViewUpdater(),
+			MakeUpdateCurrentCaptureInTitle(),
+			ManageStreamCache{},
+			ManageJumps{},
+			ManageCapinfoCache{},
+			ManageFieldValuesCache{},
+			ManageCaptureStats{},
+			ManageWatchRules{},
+			SetStructWidgets{Loader}, // for OnClear
+			ClearMarksHandler{},
+			ManageSearchData{},
+			NotifyRemoteClients{},
+			CancelledMessage{},
+		},
+	)
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 110
+// End:
@@ -0,0 +1,360 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+package ui
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gcla/gowid"
+	"github.com/gcla/gowid/widgets/button"
+	"github.com/gcla/gowid/widgets/checkbox"
+	"github.com/gcla/gowid/widgets/columns"
+	"github.com/gcla/gowid/widgets/dialog"
+	"github.com/gcla/gowid/widgets/divider"
+	"github.com/gcla/gowid/widgets/edit"
+	"github.com/gcla/gowid/widgets/framed"
+	"github.com/gcla/gowid/widgets/list"
+	"github.com/gcla/gowid/widgets/menu"
+	"github.com/gcla/gowid/widgets/pile"
+	"github.com/gcla/gowid/widgets/selectable"
+	"github.com/gcla/gowid/widgets/styled"
+	"github.com/gcla/gowid/widgets/text"
+	"github.com/gcla/termshark/v2"
+	"github.com/gcla/termshark/v2/configs/profiles"
+	"github.com/gcla/termshark/v2/pkg/extcap"
+	"github.com/gcla/termshark/v2/pkg/shark"
+	"github.com/gcla/termshark/v2/ui/menuutil"
+	"github.com/gdamore/tcell/v2"
+	log "github.com/sirupsen/logrus"
+)
+
+//======================================================================
+
+var invalidCaptureOptionsErr = fmt.Errorf("Snapshot length and buffer size must be whole numbers, or empty for the default.")
+
+// openCaptureOptionsUi opens the capture options for the given interface. If
+// none is provided, the interface currently being captured is used, and failing
+// that, the user picks one from those tshark -D reports.
+func openCaptureOptionsUi(iface string, app gowid.IApp) {
+	if iface != "" {
+		openCaptureOptionsFor(iface, app)
+	} else {
+		pickCaptureInterface(openCaptureOptionsFor, app)
+	}
+}
+
+// pickCaptureInterface calls onPick with the interface currently being captured.
+// If there isn't exactly one, the user picks one from those tshark -D reports.
+func pickCaptureInterface(onPick func(string, gowid.IApp), app gowid.IApp) {
+	if ifaces := Loader.Interfaces(); len(ifaces) == 1 {
+		onPick(ifaces[0], app)
+		return
+	}
+
+	OpenPleaseWait(appView, app)
+
+	termshark.TrackedGo(func() {
+		ifaces, err := termshark.Interfaces()
+		// tshark -D lists extcap interfaces too - this is to tell which they are
+		intfs, extErr := extcap.Interfaces()
+		if extErr != nil {
+			log.Warnf("Could not enumerate extcap interfaces: %v", extErr)
+		}
+
+		app.Run(gowid.RunFunction(func(app gowid.IApp) {
+			ClosePleaseWait(app)
+			if err != nil {
+				OpenError(fmt.Sprintf("Could not enumerate network interfaces: %v", err), app)
+				return
+			}
+			if extErr == nil {
+				setExtcapInterfaces(intfs)
+			}
+			openInterfacePicker(captureInterfaceNames(ifaces), onPick, app)
+		}))
+	}, Goroutinewg)
+}
+
+// captureInterfaceNames returns the interfaces in tshark -D order. Like the
+// command-line, each interface is known by the first of its names.
+func captureInterfaceNames(ifaces map[int][]string) []string {
+	idxs := make([]int, 0, len(ifaces))
+	for idx := range ifaces {
+		idxs = append(idxs, idx)
+	}
+	sort.Ints(idxs)
+
+	res := make([]string, 0, len(idxs))
+	for _, idx := range idxs {
+		if names := ifaces[idx]; len(names) > 0 {
+			res = append(res, names[0])
+		}
+	}
+	return res
+}
+
+func openInterfacePicker(ifaces []string, onPick func(string, gowid.IApp), app gowid.IApp) {
+	var pickerDialog *dialog.Widget
+
+	ifaceWidgets := make([]gowid.IWidget, 0, len(ifaces)+len(Loader.Interfaces()))
+	addIface := func(iface string, current bool) {
+		lbl := iface
+		if current {
+			lbl = fmt.Sprintf("%s (capturing)", iface)
+		}
+		if isExtcapInterface(iface) {
+			lbl = fmt.Sprintf("%s (extcap)", lbl)
+		}
+		if !shark.GetCaptureOptions(iface).IsDefault() {
+			lbl = fmt.Sprintf("%s *", lbl)
+		}
+		btn := button.NewBare(text.New(lbl))
+		btn.OnClick(gowid.MakeWidgetCallback("cb", gowid.WidgetChangedFunction(func(app gowid.IApp, w gowid.IWidget) {
+			pickerDialog.Close(app)
+			onPick(iface, app)
+		})))
+		ifaceWidgets = append(ifaceWidgets, styled.NewInvertedFocus(selectable.New(btn), gowid.MakePaletteRef("default")))
+	}
+
+	for _, iface := range Loader.Interfaces() {
+		addIface(iface, true)
+	}
+	for _, iface := range ifaces {
+		if !termshark.StringInSlice(iface, Loader.Interfaces()) {
+			addIface(iface, false)
+		}
+	}
+
+	if len(ifaceWidgets) == 0 {
+		ifaceWidgets = append(ifaceWidgets, text.New("No interfaces found."))
+	}
+
+	view := pile.NewFlow(
+		text.New("Choose an interface. Those marked with * have capture options set."),
+		divider.NewUnicode(),
+		// Do this so the list box scrolls inside the dialog
+		&gowid.ContainerWidget{
+			IWidget: list.New(list.NewSimpleListWalker(ifaceWidgets)),
+			D:       weight(1),
+		},
+	)
+
+	pickerDialog = dialog.New(
+		framed.NewSpace(view),
+		dialog.Options{
+			Buttons:         dialog.CloseOnly,
+			NoShadow:        true,
+			BackgroundStyle: gowid.MakePaletteRef("dialog"),
+			BorderStyle:     gowid.MakePaletteRef("dialog"),
+			ButtonStyle:     gowid.MakePaletteRef("dialog-button"),
+			Modal:           true,
+			FocusOnWidget:   true,
+		},
+	)
+
+	dialog.OpenExt(pickerDialog, appView, ratio(0.6), ratio(0.6), app)
+}
+
+// openCaptureOptionsFor asks dumpcap which link-layer and timestamp types the
+// interface supports, then opens the options dialog.
+func openCaptureOptionsFor(iface string, app gowid.IApp) {
+	opts := shark.GetCaptureOptions(iface)
+
+	OpenPleaseWait(appView, app)
+
+	termshark.TrackedGo(func() {
+		linkTypes, err := termshark.InterfaceLinkTypes(iface, opts.MonitorMode)
+		if err != nil {
+			log.Warnf("Could not determine link-layer types of %s: %v", iface, err)
+		}
+		tsTypes, err := termshark.InterfaceTimestampTypes(iface)
+		if err != nil {
+			log.Warnf("Could not determine timestamp types of %s: %v", iface, err)
+		}
+
+		app.Run(gowid.RunFunction(func(app gowid.IApp) {
+			ClosePleaseWait(app)
+			openCaptureOptionsDialog(opts, linkTypes, tsTypes, app)
+		}))
+	}, Goroutinewg)
+}
+
+// makeCaptureChoice returns a button which opens a drop down of the choices
+// provided, and the site at which the drop down opens. The current choice is
+// held in *val - empty means dumpcap's default.
+func makeCaptureChoice(name string, val *string, choices []termshark.InterfaceCapability) (*menu.SiteWidget, gowid.IWidget) {
+	choiceLabel := func() string {
+		if *val == "" {
+			return "default"
+		}
+		return *val
+	}
+
+	choiceBtn := button.New(text.New(choiceLabel()))
+	choiceSite := menu.NewSite(menu.SiteOptions{YOffset: 1})
+
+	var choiceMenu *menu.Widget
+	items := make([]menuutil.SimpleMenuItem, 0, len(choices)+1)
+	addItem := func(txt string, choice string) {
+		items = append(items, menuutil.SimpleMenuItem{
+			Txt: txt,
+			CB: func(app gowid.IApp, w gowid.IWidget) {
+				multiMenu1Opener.CloseMenu(choiceMenu, app)
+				*val = choice
+				choiceBtn.SetSubWidget(text.New(choiceLabel()), app)
+			},
+		})
+	}
+
+	addItem("default", "")
+	for _, choice := range choices {
+		txt := choice.Name
+		if choice.Description != "" {
+			txt = fmt.Sprintf("%s (%s)", choice.Name, choice.Description)
+		}
+		addItem(txt, choice.Name)
+	}
+
+	choiceListBox, choiceWidth := menuutil.MakeMenu(items, nil)
+
+	choiceMenu = menu.New(name, choiceListBox, units(choiceWidth), menu.Options{
+		Modal:             true,
+		OpenCloser:        &multiMenu1Opener,
+		CloseKeysProvided: true,
+		CloseKeys: []gowid.IKey{
+			gowid.MakeKey('q'),
+			gowid.MakeKeyExt(tcell.KeyLeft),
+			gowid.MakeKeyExt(tcell.KeyEscape),
+			gowid.MakeKeyExt(tcell.KeyCtrlC),
+		},
+	})
+
+	choiceBtn.OnClick(gowid.MakeWidgetCallback("cb", func(app gowid.IApp, w gowid.IWidget) {
+		multiMenu1Opener.OpenMenu(choiceMenu, choiceSite, app)
+	}))
+
+	return choiceSite, styled.NewExt(
+		choiceBtn,
+		gowid.MakePaletteRef("button"),
+		gowid.MakePaletteRef("button-focus"),
+	)
+}
+
+func openCaptureOptionsDialog(opts shark.CaptureOptions, linkTypes []termshark.InterfaceCapability,
+	tsTypes []termshark.InterfaceCapability, app gowid.IApp) {
+
+	var optsDialog *dialog.Widget
+
+	intText := func(i int) string {
+		if i <= 0 {
+			return ""
+		}
+		return strconv.Itoa(i)
+	}
+
+	snaplenWidget := edit.New(edit.Options{
+		Text: intText(opts.Snaplen),
+	})
+	bufferWidget := edit.New(edit.Options{
+		Text: intText(opts.BufferSize),
+	})
+	promiscCheck := checkbox.New(!opts.NoPromiscuous)
+	monitorCheck := checkbox.New(opts.MonitorMode)
+
+	linkType := opts.LinkType
+	linkTypeSite, linkTypeBtn := makeCaptureChoice("capturelinktype", &linkType, linkTypes)
+	tsType := opts.TimestampType
+	tsTypeSite, tsTypeBtn := makeCaptureChoice("capturetstype", &tsType, tsTypes)
+
+	parseInt := func(s string) (int, error) {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			return 0, nil
+		}
+		res, err := strconv.Atoi(s)
+		if err != nil || res < 0 {
+			return 0, invalidCaptureOptionsErr
+		}
+		return res, nil
+	}
+
+	okBtn := dialog.Button{
+		Msg: "Ok",
+		Action: gowid.MakeWidgetCallback("exec", gowid.WidgetChangedFunction(func(app gowid.IApp, _ gowid.IWidget) {
+			newOpts := shark.CaptureOptions{
+				Interface:     opts.Interface,
+				NoPromiscuous: !promiscCheck.IsChecked(),
+				MonitorMode:   monitorCheck.IsChecked(),
+				LinkType:      linkType,
+				TimestampType: tsType,
+			}
+			var err error
+			if newOpts.Snaplen, err = parseInt(snaplenWidget.Text()); err != nil {
+				OpenError(err.Error(), app)
+				return
+			}
+			if newOpts.BufferSize, err = parseInt(bufferWidget.Text()); err != nil {
+				OpenError(err.Error(), app)
+				return
+			}
+
+			optsDialog.Close(app)
+			shark.SetCaptureOptions(newOpts)
+
+			if termshark.StringInSlice(opts.Interface, Loader.Interfaces()) && newOpts != opts {
+				OpenMessage(fmt.Sprintf("The new options for %s take effect when the capture restarts e.g. after clear-packets.", opts.Interface), appView, app)
+			}
+		})),
+	}
+
+	labelled := func(lbl string, w gowid.IWidget) gowid.IWidget {
+		return columns.NewWithDim(
+			gowid.RenderWithWeight{1},
+			&gowid.ContainerWidget{
+				IWidget: text.New(lbl),
+				D:       fixed,
+			},
+			w,
+		)
+	}
+
+	optsDialog = dialog.New(
+		framed.NewSpace(
+			pile.NewFlow(
+				text.New(fmt.Sprintf("Capture options for %s in profile %s:", opts.Interface, profiles.CurrentName())),
+				divider.NewBlank(),
+				labelled("Snapshot length:  ", framed.NewUnicode(snaplenWidget)),
+				labelled("Buffer size (MiB):", framed.NewUnicode(bufferWidget)),
+				divider.NewBlank(),
+				columns.NewFixed(promiscCheck, text.New(" Promiscuous mode")),
+				columns.NewFixed(monitorCheck, text.New(" Monitor mode")),
+				divider.NewBlank(),
+				columns.NewFixed(text.New("Link-layer type: "), linkTypeSite, linkTypeBtn),
+				divider.NewBlank(),
+				columns.NewFixed(text.New("Timestamp type:  "), tsTypeSite, tsTypeBtn),
+			),
+		),
+		dialog.Options{
+			Buttons:         []dialog.Button{okBtn, dialog.Cancel},
+			NoShadow:        true,
+			BackgroundStyle: gowid.MakePaletteRef("dialog"),
+			BorderStyle:     gowid.MakePaletteRef("dialog"),
+			ButtonStyle:     gowid.MakePaletteRef("dialog-button"),
+			Modal:           true,
+			FocusOnWidget:   true,
+		},
+	)
+
+	optsDialog.Open(appView, ratio(0.6), app)
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 110
+// End:
@@ -0,0 +1,261 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+package ui
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gcla/gowid"
+	"github.com/gcla/gowid/widgets/dialog"
+	"github.com/gcla/gowid/widgets/framed"
+	"github.com/gcla/gowid/widgets/text"
+	"github.com/gcla/termshark/v2"
+	"github.com/gcla/termshark/v2/pkg/pcap"
+	"github.com/gcla/termshark/v2/pkg/shark"
+	log "github.com/sirupsen/logrus"
+)
+
+//======================================================================
+
+type captureIfaceStats struct {
+	stats      shark.InterfaceStats
+	packetRate shark.CaptureRate
+	byteRate   shark.CaptureRate
+}
+
+// These are only accessed from the app goroutine
+var captureStats map[string]*captureIfaceStats
+var captureStatsOrder []string // interfaces in the order given to dumpcap
+var captureFileSize int64
+var captureFileRate shark.CaptureRate
+var captureStatsCancel context.CancelFunc
+
+// Shown in the title bar once packets are dropped
+var dropsIndicator *text.Widget
+
+//======================================================================
+
+// ManageCaptureStats runs dumpcap -S while interfaces are being captured, to keep
+// count of the packets each receives and drops.
+type ManageCaptureStats struct{}
+
+var _ pcap.IBeforeBegin = ManageCaptureStats{}
+var _ pcap.IAfterEnd = ManageCaptureStats{}
+var _ pcap.INewSource = ManageCaptureStats{}
+var _ pcap.IClear = ManageCaptureStats{}
+
+func (t ManageCaptureStats) BeforeBegin(code pcap.HandlerCode, app gowid.IApp) {
+	if code&pcap.IfaceCode == 0 {
+		return
+	}
+	startCaptureStats(app)
+}
+
+func (t ManageCaptureStats) AfterEnd(code pcap.HandlerCode, app gowid.IApp) {
+	if code&pcap.IfaceCode == 0 {
+		return
+	}
+	stopCaptureStats()
+}
+
+// The drops of the last capture no longer apply
+func (t ManageCaptureStats) OnNewSource(code pcap.HandlerCode, app gowid.IApp) {
+	setDropsIndicator("", app)
+}
+
+func (t ManageCaptureStats) OnClear(code pcap.HandlerCode, app gowid.IApp) {
+	setDropsIndicator("", app)
+}
+
+func setDropsIndicator(msg string, app gowid.IApp) {
+	if dropsIndicator != nil {
+		dropsIndicator.SetText(msg, app)
+	}
+}
+
+func startCaptureStats(app gowid.IApp) {
+	stopCaptureStats()
+
+	captureStats = make(map[string]*captureIfaceStats)
+	captureStatsOrder = make([]string, 0)
+	captureFileSize = 0
+	captureFileRate = shark.CaptureRate{}
+	setDropsIndicator("", app)
+
+	// Pipes and fifos have no counters to report
+	for _, psrc := range Loader.PacketSources() {
+		if psrc.IsInterface() {
+			captureStatsOrder = append(captureStatsOrder, psrc.Name())
+			captureStats[psrc.Name()] = &captureIfaceStats{
+				stats: shark.InterfaceStats{Interface: psrc.Name()},
+			}
+		}
+	}
+	if len(captureStatsOrder) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(Loader.Context())
+	captureStatsCancel = cancel
+	ifaces := captureStatsOrder
+
+	termshark.TrackedGo(func() {
+		err := shark.WatchInterfaceStats(ctx, ifaces, func(stats shark.InterfaceStats) {
+			app.Run(gowid.RunFunction(func(app gowid.IApp) {
+				// Ignore stragglers from a previous capture
+				if ctx.Err() == nil {
+					updateCaptureStats(stats, app)
+				}
+			}))
+		})
+		if err != nil {
+			log.Warnf("Could not collect capture statistics for %v: %v", ifaces, err)
+		}
+	}, Goroutinewg)
+}
+
+func stopCaptureStats() {
+	if captureStatsCancel != nil {
+		captureStatsCancel()
+		captureStatsCancel = nil
+	}
+}
+
+// Runs in app goroutine
+func updateCaptureStats(stats shark.InterfaceStats, app gowid.IApp) {
+	cur, ok := captureStats[stats.Interface]
+	if !ok {
+		return
+	}
+	now := time.Now()
+	cur.stats = stats
+	cur.packetRate.Update(stats.Received, now)
+	if stats.IfBytesKnown {
+		cur.byteRate.Update(stats.IfBytes, now)
+	}
+	updateCaptureFileStats(now)
+
+	// Don't interrupt the user with a dialog mid-capture - say so in the title bar. Only
+	// the interface's own drops count; dumpcap -S's kernel drops are those of its handle.
+	dropping := make([]string, 0)
+	for _, iface := range captureStatsOrder {
+		if captureStats[iface].stats.Dropped() {
+			dropping = append(dropping, iface)
+		}
+	}
+	if len(dropping) > 0 {
+		setDropsIndicator(fmt.Sprintf(" [dropping packets on %s - see capture statistics]", strings.Join(dropping, ", ")), app)
+	}
+}
+
+// Runs in app goroutine
+func updateCaptureFileStats(now time.Time) {
+	if Loader.InterfaceFile() == "" {
+		return
+	}
+	if fi, err := os.Stat(Loader.InterfaceFile()); err == nil {
+		captureFileSize = fi.Size()
+		captureFileRate.Update(uint64(captureFileSize), now)
+	}
+}
+
+// captureStatsSummary describes the current live capture, one interface per line.
+func captureStatsSummary() string {
+	if Loader.InterfaceFile() == "" || len(Loader.Interfaces()) == 0 {
+		return "No live capture."
+	}
+
+	var b strings.Builder
+
+	if len(captureStatsOrder) > 0 {
+		fmt.Fprintf(&b, "%-24s %12s %12s %12s %12s %12s\n", "Interface", "Received", "Kernel drops", "If drops", "Packets/s", "Bytes/s")
+		for _, iface := range captureStatsOrder {
+			cur := captureStats[iface]
+			ifDrops := "-"
+			if cur.stats.IfDroppedKnown {
+				ifDrops = fmt.Sprintf("%d", cur.stats.IfDropped)
+			}
+			byteRate := "-"
+			if cur.stats.IfBytesKnown {
+				byteRate = shark.FormatBytes(cur.byteRate.Rate())
+			}
+			fmt.Fprintf(&b, "%-24s %12d %12d %12s %12.1f %12s\n", iface, cur.stats.Received, cur.stats.KernelDropped, ifDrops, cur.packetRate.Rate(), byteRate)
+		}
+		b.WriteString("\nThese are interface-level counters, for all traffic on the interface whatever the capture filter.\n")
+		b.WriteString("They come from a separate dumpcap -S, so kernel drops are packets there was no room for in its\n")
+		b.WriteString("buffer, not the capture's - only a guide. Interface drops are packets the interface or its driver\n")
+		b.WriteString("dropped, and bytes are those the interface received, where the system counts them.\n\n")
+	}
+
+	fmt.Fprintf(&b, "Capture file: %s\n", Loader.InterfaceFile())
+	fmt.Fprintf(&b, "Size:         %s (%s/s)", shark.FormatBytes(float64(captureFileSize)), shark.FormatBytes(captureFileRate.Rate()))
+	if !Loader.InterfaceLoader.IsLoading() {
+		b.WriteString("\n\nThe capture has stopped.")
+	}
+
+	return b.String()
+}
+
+// openCaptureStatsUi shows the live capture statistics, refreshed each second.
+func openCaptureStatsUi(app gowid.IApp) {
+	updateCaptureFileStats(time.Now())
+
+	statsText := text.New(captureStatsSummary())
+
+	statsDialog := dialog.New(
+		framed.NewSpace(statsText),
+		dialog.Options{
+			Buttons:         dialog.CloseOnly,
+			NoShadow:        true,
+			BackgroundStyle: gowid.MakePaletteRef("dialog"),
+			BorderStyle:     gowid.MakePaletteRef("dialog"),
+			ButtonStyle:     gowid.MakePaletteRef("dialog-button"),
+			Modal:           true,
+			FocusOnWidget:   false,
+		},
+	)
+
+	stop := make(chan struct{})
+	quit := Loader.Context().Done()
+	ticker := time.NewTicker(time.Second)
+
+	termshark.TrackedGo(func() {
+		defer ticker.Stop()
+	Loop:
+		for {
+			select {
+			case <-ticker.C:
+				app.Run(gowid.RunFunction(func(app gowid.IApp) {
+					updateCaptureFileStats(time.Now())
+					statsText.SetText(captureStatsSummary(), app)
+				}))
+			case <-stop:
+				break Loop
+			case <-quit:
+				break Loop
+			}
+		}
+	}, Goroutinewg)
+
+	dialogOpen := false
+	statsDialog.OnOpenClose(gowid.MakeWidgetCallback("cb", func(app gowid.IApp, widget gowid.IWidget) {
+		dialogOpen = !dialogOpen
+		if !dialogOpen {
+			close(stop)
+		}
+	}))
+
+	statsDialog.Open(appView, ratio(0.7), app)
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 110
+// End:
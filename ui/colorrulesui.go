@@ -0,0 +1,618 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+package ui
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/gcla/gowid"
+	"github.com/gcla/gowid/widgets/button"
+	"github.com/gcla/gowid/widgets/checkbox"
+	"github.com/gcla/gowid/widgets/columns"
+	"github.com/gcla/gowid/widgets/dialog"
+	"github.com/gcla/gowid/widgets/divider"
+	"github.com/gcla/gowid/widgets/edit"
+	"github.com/gcla/gowid/widgets/framed"
+	"github.com/gcla/gowid/widgets/list"
+	"github.com/gcla/gowid/widgets/pile"
+	"github.com/gcla/gowid/widgets/styled"
+	"github.com/gcla/gowid/widgets/text"
+	"github.com/gcla/termshark/v2"
+	"github.com/gcla/termshark/v2/configs/profiles"
+	"github.com/gcla/termshark/v2/pkg/pcap"
+	"github.com/gcla/termshark/v2/pkg/pdmltree"
+	"github.com/gcla/termshark/v2/pkg/shark"
+	"github.com/gcla/termshark/v2/pkg/shark/wiresharkcfg"
+	"github.com/gcla/termshark/v2/widgets/filter"
+	"github.com/gdamore/tcell/v2"
+	log "github.com/sirupsen/logrus"
+)
+
+//======================================================================
+
+// The filters of the temporary "colorize conversation" rules, one per color in
+// shark.TempColors. Empty if the color is unused. These are not saved.
+var tempColorRules [10]string
+
+// The result of the last run of the coloring rules - frame number to the index
+// of the rule in colorRuleColors that matched.
+var colorRuleMatches map[int]int
+var colorRuleColors []pcap.PacketColors
+
+// True if the rules replace tshark's own coloring, rather than adding to it
+var colorRulesReplaceTshark bool
+
+// Track the source the rules were last run against, and the last packet they
+// were run on, so that only the packets added to a live capture since need to
+// be colored. The generation lets a run that has been superseded discard its
+// results.
+var colorRulesPcap string
+var colorRulesLastFrame int
+var colorRulesGen int
+var colorRulesCancel context.CancelFunc
+
+var invalidColorRuleErr = fmt.Errorf("Please provide a name and a filter expression.")
+
+// colorRulesToApply returns the rules termshark must apply itself, in order of
+// precedence - the temporary conversation rules, then the rules saved in the
+// termshark profile. If tshark can't color packets, Wireshark's rules are used
+// in place of the latter. The second result is true if these rules replace
+// tshark's coloring altogether.
+func colorRulesToApply() ([]wiresharkcfg.ColorFilter, bool) {
+	res := make([]wiresharkcfg.ColorFilter, 0)
+	for i, filter := range tempColorRules {
+		if filter != "" {
+			bg, _ := wiresharkcfg.ColorFromHex(shark.TempColors[i])
+			res = append(res, wiresharkcfg.ColorFilter{
+				Name:       fmt.Sprintf("Conversation %d", i+1),
+				Filter:     filter,
+				Background: bg,
+			})
+		}
+	}
+
+	if rules, ok := shark.GetColorRules(); ok {
+		return append(res, rules...), true
+	}
+
+	if !PacketColorsSupported {
+		rules, err := shark.GetWiresharkColorRules()
+		if err != nil {
+			log.Warnf("Could not read Wireshark coloring rules: %v", err)
+		}
+		return append(res, rules...), true
+	}
+
+	return res, false
+}
+
+func cancelColorRuleMatches() {
+	if colorRulesCancel != nil {
+		colorRulesCancel()
+		colorRulesCancel = nil
+	}
+	colorRulesGen++
+}
+
+func clearColorRuleMatches() {
+	cancelColorRuleMatches()
+	colorRuleMatches = nil
+	colorRuleColors = nil
+	colorRulesPcap = ""
+	colorRulesLastFrame = 0
+}
+
+// lastLoadedFrame returns the number of the last packet in the packet list, or
+// 0 if it isn't known.
+func lastLoadedFrame() int {
+	psml := Loader.PsmlData()
+	if len(psml) == 0 || len(psml[len(psml)-1]) == 0 {
+		return 0
+	}
+	res, err := strconv.Atoi(psml[len(psml)-1][0])
+	if err != nil {
+		return 0
+	}
+	return res
+}
+
+// updateColorRuleMatches runs the coloring rules against the current source in
+// the background, then redraws the packet list. Unless force is true, only the
+// packets loaded since the last run are checked, and this is skipped if there
+// are none or if a run is already under way - the next call will pick up any
+// new packets. The packets keep their colors until the run completes.
+func updateColorRuleMatches(force bool, app gowid.IApp) {
+	if !PacketColors || Loader.Empty() || Loader.PcapPdml == "" {
+		return
+	}
+
+	pcapf := Loader.PcapPdml
+	last := lastLoadedFrame()
+	incremental := !force && pcapf == colorRulesPcap && colorRuleMatches != nil
+	if !force && (colorRulesCancel != nil || (incremental && last <= colorRulesLastFrame)) {
+		return
+	}
+
+	rules, replace := colorRulesToApply()
+
+	cancelColorRuleMatches()
+	if pcapf != colorRulesPcap {
+		colorRuleMatches = nil
+		colorRulesPcap = pcapf
+	}
+
+	if len(rules) == 0 {
+		colorRuleMatches = nil
+		colorRuleColors = nil
+		colorRulesLastFrame = last
+		return
+	}
+
+	first := 1
+	if incremental {
+		first = colorRulesLastFrame + 1
+	}
+
+	colors := make([]pcap.PacketColors, 0, len(rules))
+	for _, rule := range rules {
+		fg, _ := gowid.MakeRGBColorSafe(rule.ForegroundHex())
+		bg, _ := gowid.MakeRGBColorSafe(rule.BackgroundHex())
+		colors = append(colors, pcap.PacketColors{
+			FG: fg,
+			BG: bg,
+		})
+	}
+
+	args := pcap.ProfileArgs()
+	if prof := profiles.ConfString("main.wireshark-profile", ""); prof != "" {
+		args = append(args, "-C", prof)
+	}
+
+	var ctx context.Context
+	ctx, colorRulesCancel = context.WithCancel(Loader.Context())
+	gen := colorRulesGen
+
+	termshark.TrackedGo(func() {
+		matches, err := shark.MatchColorRules(ctx, pcapf, rules, first, last, args)
+
+		app.Run(gowid.RunFunction(func(app gowid.IApp) {
+			if gen != colorRulesGen {
+				return
+			}
+			colorRulesCancel()
+			colorRulesCancel = nil
+			if err != nil {
+				log.Warnf("Could not apply coloring rules: %v", err)
+				return
+			}
+			if incremental {
+				for frame, idx := range matches {
+					colorRuleMatches[frame] = idx
+				}
+			} else {
+				colorRuleMatches = matches
+			}
+			colorRuleColors = colors
+			colorRulesReplaceTshark = replace
+			colorRulesLastFrame = last
+			app.Redraw()
+		}))
+	}, Goroutinewg)
+}
+
+// colorRuleColorsAt returns the colors termshark's own rules give the packet at
+// the given table row. The second result is false if no rule matched.
+func colorRuleColorsAt(t *psmlTableRowWidget, row int) (pcap.PacketColors, bool) {
+	if colorRuleMatches == nil {
+		return pcap.PacketColors{}, false
+	}
+	rowId, ok := t.Model().RowIdentifier(row)
+	if !ok {
+		return pcap.PacketColors{}, false
+	}
+	psml := Loader.PsmlData()
+	if int(rowId) >= len(psml) || len(psml[rowId]) == 0 {
+		return pcap.PacketColors{}, false
+	}
+	frame, err := strconv.Atoi(psml[rowId][0])
+	if err != nil {
+		return pcap.PacketColors{}, false
+	}
+	idx, ok := colorRuleMatches[frame]
+	if !ok || idx >= len(colorRuleColors) {
+		return pcap.PacketColors{}, false
+	}
+	return colorRuleColors[idx], true
+}
+
+//======================================================================
+
+// colorizeConversation colors the conversation of the selected packet with
+// temporary rule n, from 1 to 10, like Wireshark's ctrl-1 to ctrl-0. If n is 0,
+// the first unused color is picked.
+func colorizeConversation(n int, app gowid.IApp) error {
+	var model *pdmltree.Model
+	if packetListView != nil {
+		if fxy, err := packetListView.FocusXY(); err == nil {
+			rid, _ := packetListView.Model().RowIdentifier(fxy.Row)
+			model = getCurrentStructModel(int(rid))
+		}
+	}
+	if model == nil {
+		return fmt.Errorf("No packet is selected.")
+	}
+
+	filter, ok := model.ConversationFilter()
+	if !ok {
+		return fmt.Errorf("The selected packet is not part of a conversation.")
+	}
+
+	if n == 0 {
+		for i, f := range tempColorRules {
+			if f == "" || f == filter {
+				n = i + 1
+				break
+			}
+		}
+		if n == 0 {
+			return fmt.Errorf("All %d colors are in use - pick one with a number prefix.", len(tempColorRules))
+		}
+	}
+	if n < 1 || n > len(tempColorRules) {
+		return fmt.Errorf("Please pick a color from 1 to %d.", len(tempColorRules))
+	}
+
+	// A conversation only needs one color
+	for i, f := range tempColorRules {
+		if f == filter {
+			tempColorRules[i] = ""
+		}
+	}
+	tempColorRules[n-1] = filter
+
+	if !PacketColors {
+		PacketColors = true
+		profiles.SetConf("main.packet-colors", PacketColors)
+	}
+
+	updateColorRuleMatches(true, app)
+	return nil
+}
+
+// clearTempColorRules removes the temporary conversation rules.
+func clearTempColorRules(app gowid.IApp) {
+	tempColorRules = [10]string{}
+	updateColorRuleMatches(true, app)
+}
+
+// colorizeKeyPress handles C in the packet list view, colorizing the selected
+// conversation. A number prefix picks the color, 0 meaning the 10th.
+func colorizeKeyPress(evk *tcell.EventKey, app gowid.IApp) bool {
+	if evk.Key() != tcell.KeyRune || evk.Rune() != 'C' {
+		return false
+	}
+	n := keyState.NumberPrefix
+	switch {
+	case n == -1:
+		n = 0
+	case n == 0:
+		n = 10
+	}
+	if err := colorizeConversation(n, app); err != nil {
+		OpenError(err.Error(), app)
+	}
+	return true
+}
+
+//======================================================================
+
+// openColorRulesUi opens the coloring rules editor. If the termshark profile has
+// no rules of its own, the editor starts with a copy of Wireshark's.
+func openColorRulesUi(app gowid.IApp) {
+	rules, ok := shark.GetColorRules()
+	if !ok {
+		var err error
+		rules, err = shark.GetWiresharkColorRules()
+		if err != nil {
+			log.Warnf("Could not read Wireshark coloring rules: %v", err)
+		}
+	}
+	openColorRulesWith(rules, 0, app)
+}
+
+// openColorRulesWith opens the editor with a working set of rules, focused on
+// the given row. The rules are only written to the profile when the user hits
+// Ok.
+func openColorRulesWith(rules []wiresharkcfg.ColorFilter, focus int, app gowid.IApp) {
+	var rulesDialog *dialog.Widget
+
+	styledBtn := func(w gowid.IWidget) gowid.IWidget {
+		return styled.NewExt(
+			w,
+			gowid.MakePaletteRef("button"),
+			gowid.MakePaletteRef("button-focus"),
+		)
+	}
+
+	// Reopen the editor with a modified copy of the rules
+	reopen := func(f func([]wiresharkcfg.ColorFilter) []wiresharkcfg.ColorFilter, focus int, app gowid.IApp) {
+		rulesDialog.Close(app)
+		newRules := make([]wiresharkcfg.ColorFilter, len(rules))
+		copy(newRules, rules)
+		openColorRulesWith(f(newRules), focus, app)
+	}
+
+	ruleWidgets := make([]gowid.IWidget, 0, len(rules))
+	for i, rule := range rules {
+		i, rule := i, rule
+
+		enabledCheck := checkbox.New(!rule.Disabled)
+		enabledCheck.OnClick(gowid.WidgetCallback{"cb", func(app gowid.IApp, w gowid.IWidget) {
+			rules[i].Disabled = !enabledCheck.IsChecked()
+		}})
+
+		upBtn := button.New(text.New("Up"))
+		upBtn.OnClick(gowid.MakeWidgetCallback("cb", func(app gowid.IApp, w gowid.IWidget) {
+			if i == 0 {
+				return
+			}
+			reopen(func(r []wiresharkcfg.ColorFilter) []wiresharkcfg.ColorFilter {
+				r[i-1], r[i] = r[i], r[i-1]
+				return r
+			}, i-1, app)
+		}))
+
+		downBtn := button.New(text.New("Down"))
+		downBtn.OnClick(gowid.MakeWidgetCallback("cb", func(app gowid.IApp, w gowid.IWidget) {
+			if i == len(rules)-1 {
+				return
+			}
+			reopen(func(r []wiresharkcfg.ColorFilter) []wiresharkcfg.ColorFilter {
+				r[i+1], r[i] = r[i], r[i+1]
+				return r
+			}, i+1, app)
+		}))
+
+		editBtn := button.New(text.New("Edit"))
+		editBtn.OnClick(gowid.MakeWidgetCallback("cb", func(app gowid.IApp, w gowid.IWidget) {
+			rulesDialog.Close(app)
+			openColorRuleEditor(rules, i, app)
+		}))
+
+		delBtn := button.New(text.New("Delete"))
+		delBtn.OnClick(gowid.MakeWidgetCallback("cb", func(app gowid.IApp, w gowid.IWidget) {
+			reopen(func(r []wiresharkcfg.ColorFilter) []wiresharkcfg.ColorFilter {
+				return append(r[0:i], r[i+1:]...)
+			}, i, app)
+		}))
+
+		fg, _ := gowid.MakeRGBColorSafe(rule.ForegroundHex())
+		bg, _ := gowid.MakeRGBColorSafe(rule.BackgroundHex())
+
+		ruleWidgets = append(ruleWidgets, columns.NewWithDim(
+			fixed,
+			enabledCheck,
+			&gowid.ContainerWidget{
+				IWidget: text.New(" "),
+				D:       fixed,
+			},
+			&gowid.ContainerWidget{
+				IWidget: styled.New(
+					text.New(rule.Name, text.Options{
+						Wrap:          text.WrapClip,
+						ClipIndicator: "...",
+					}),
+					gowid.MakePaletteEntry(fg, bg),
+				),
+				D: weight(1),
+			},
+			&gowid.ContainerWidget{
+				IWidget: text.New(" "+rule.Filter, text.Options{
+					Wrap:          text.WrapClip,
+					ClipIndicator: "...",
+				}),
+				D: weight(2),
+			},
+			styledBtn(upBtn),
+			styledBtn(downBtn),
+			styledBtn(editBtn),
+			styledBtn(delBtn),
+		))
+	}
+
+	if len(ruleWidgets) == 0 {
+		ruleWidgets = append(ruleWidgets, text.New("No coloring rules are set."))
+	}
+
+	rulesWalker := list.NewSimpleListWalker(ruleWidgets)
+	if focus > 0 && focus < len(ruleWidgets) {
+		rulesWalker.SetFocus(list.ListPos(focus), app)
+	}
+
+	addBtn := button.New(text.New("Add"))
+	addBtn.OnClick(gowid.MakeWidgetCallback("cb", func(app gowid.IApp, w gowid.IWidget) {
+		rulesDialog.Close(app)
+		openColorRuleEditor(rules, -1, app)
+	}))
+
+	resetBtn := button.New(text.New("Use Wireshark's Rules"))
+	resetBtn.OnClick(gowid.MakeWidgetCallback("cb", func(app gowid.IApp, w gowid.IWidget) {
+		rulesDialog.Close(app)
+		shark.ResetColorRules()
+		updateColorRuleMatches(true, app)
+		OpenMessage(fmt.Sprintf("Profile %s now uses Wireshark's coloring rules.", profiles.CurrentName()), appView, app)
+	}))
+
+	okBtn := dialog.Button{
+		Msg: "Ok",
+		Action: gowid.MakeWidgetCallback("exec", gowid.WidgetChangedFunction(func(app gowid.IApp, _ gowid.IWidget) {
+			rulesDialog.Close(app)
+			shark.SetColorRules(rules)
+			if !PacketColors {
+				PacketColors = true
+				profiles.SetConf("main.packet-colors", PacketColors)
+			}
+			updateColorRuleMatches(true, app)
+		})),
+	}
+
+	header := fmt.Sprintf("Coloring rules for profile %s. The first enabled rule that matches a packet wins.", profiles.CurrentName())
+	if _, ok := shark.GetColorRules(); !ok {
+		header = fmt.Sprintf("%s These are Wireshark's rules - hit Ok to save a copy in the termshark profile.", header)
+	}
+
+	view := pile.NewFlow(
+		text.New(header),
+		divider.NewBlank(),
+		// Do this so the list box scrolls inside the dialog
+		&gowid.ContainerWidget{
+			IWidget: list.New(rulesWalker),
+			D:       weight(1),
+		},
+		divider.NewUnicode(),
+		columns.NewFixed(styledBtn(addBtn), text.New(" "), styledBtn(resetBtn)),
+	)
+
+	rulesDialog = dialog.New(
+		framed.NewSpace(view),
+		dialog.Options{
+			Buttons:         []dialog.Button{okBtn, dialog.Cancel},
+			NoShadow:        true,
+			BackgroundStyle: gowid.MakePaletteRef("dialog"),
+			BorderStyle:     gowid.MakePaletteRef("dialog"),
+			ButtonStyle:     gowid.MakePaletteRef("dialog-button"),
+			Modal:           true,
+			FocusOnWidget:   true,
+		},
+	)
+
+	dialog.OpenExt(rulesDialog, appView, ratio(0.8), ratio(0.8), app)
+}
+
+// openColorRuleEditor edits the rule at index idx of the working set, or adds a
+// new rule if idx is -1. Either way, the rules editor is reopened afterwards.
+func openColorRuleEditor(rules []wiresharkcfg.ColorFilter, idx int, app gowid.IApp) {
+	var editDialog *dialog.Widget
+
+	rule := wiresharkcfg.ColorFilter{
+		Filter:     FilterWidget.Value(),
+		Background: [3]uint16{0xffff, 0xffff, 0xffff},
+	}
+	if idx >= 0 && idx < len(rules) {
+		rule = rules[idx]
+	}
+
+	nameWidget := edit.New(edit.Options{
+		Text: rule.Name,
+	})
+	filterWidget := edit.New(edit.Options{
+		Text: rule.Filter,
+	})
+	fgWidget := edit.New(edit.Options{
+		Text: rule.ForegroundHex(),
+	})
+	bgWidget := edit.New(edit.Options{
+		Text: rule.BackgroundHex(),
+	})
+
+	okBtn := dialog.Button{
+		Msg: "Ok",
+		Action: gowid.MakeWidgetCallback("exec", gowid.WidgetChangedFunction(func(app gowid.IApp, _ gowid.IWidget) {
+			newRule := wiresharkcfg.ColorFilter{
+				Name:     nameWidget.Text(),
+				Filter:   filterWidget.Text(),
+				Disabled: rule.Disabled,
+			}
+			if newRule.Name == "" || newRule.Filter == "" {
+				OpenError(invalidColorRuleErr.Error(), app)
+				return
+			}
+			var err error
+			if newRule.Foreground, err = wiresharkcfg.ColorFromHex(fgWidget.Text()); err != nil {
+				OpenError(err.Error(), app)
+				return
+			}
+			if newRule.Background, err = wiresharkcfg.ColorFromHex(bgWidget.Text()); err != nil {
+				OpenError(err.Error(), app)
+				return
+			}
+			filter.CheckDisplayFilterThen(newRule.Filter, FieldCompleter, app, func(err error, app gowid.IApp) {
+				if err != nil {
+					OpenError(fmt.Sprintf("Invalid filter: %v", err), app)
+					return
+				}
+
+				editDialog.Close(app)
+
+				newRules := make([]wiresharkcfg.ColorFilter, len(rules))
+				copy(newRules, rules)
+				focus := idx
+				if idx >= 0 && idx < len(newRules) {
+					newRules[idx] = newRule
+				} else {
+					newRules = append(newRules, newRule)
+					focus = len(newRules) - 1
+				}
+				openColorRulesWith(newRules, focus, app)
+			})
+		})),
+	}
+
+	cancelBtn := dialog.Button{
+		Msg: "Cancel",
+		Action: gowid.MakeWidgetCallback("exec", gowid.WidgetChangedFunction(func(app gowid.IApp, _ gowid.IWidget) {
+			editDialog.Close(app)
+			openColorRulesWith(rules, idx, app)
+		})),
+	}
+
+	labelled := func(lbl string, w gowid.IWidget) gowid.IWidget {
+		return columns.NewWithDim(
+			gowid.RenderWithWeight{1},
+			&gowid.ContainerWidget{
+				IWidget: text.New(lbl),
+				D:       fixed,
+			},
+			framed.NewUnicode(w),
+		)
+	}
+
+	title := "Add a coloring rule"
+	if idx >= 0 {
+		title = fmt.Sprintf("Edit coloring rule %s", rule.Name)
+	}
+
+	editDialog = dialog.New(
+		framed.NewSpace(
+			pile.NewFlow(
+				text.New(fmt.Sprintf("%s (colors look like #rrggbb):", title)),
+				divider.NewBlank(),
+				labelled("Name:       ", nameWidget),
+				labelled("Filter:     ", filterWidget),
+				labelled("Foreground: ", fgWidget),
+				labelled("Background: ", bgWidget),
+			),
+		),
+		dialog.Options{
+			Buttons:         []dialog.Button{okBtn, cancelBtn},
+			NoShadow:        true,
+			BackgroundStyle: gowid.MakePaletteRef("dialog"),
+			BorderStyle:     gowid.MakePaletteRef("dialog"),
+			ButtonStyle:     gowid.MakePaletteRef("dialog-button"),
+			Modal:           true,
+			FocusOnWidget:   true,
+		},
+	)
+
+	editDialog.Open(appView, ratio(0.6), app)
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 110
+// End:
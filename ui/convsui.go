@@ -47,6 +47,7 @@ import (
 
 var convsView *holder.Widget
 var convsUi *ConvsUiWidget
+var convsViewWithKeys gowid.IWidget // what is displayed when the conversations view is open
 var convCancel context.CancelFunc
 
 var convsPcapSize int64 // track size of source, if changes then recalculation conversations
@@ -259,6 +260,7 @@ func openConvsUi(app gowid.IApp) {
 		},
 	)
 
+	convsViewWithKeys = copyModeConvsView
 	appViewNoKeys.SetSubWidget(copyModeConvsView, app)
 }
 
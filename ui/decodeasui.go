@@ -0,0 +1,288 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+package ui
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/gcla/gowid"
+	"github.com/gcla/gowid/widgets/button"
+	"github.com/gcla/gowid/widgets/columns"
+	"github.com/gcla/gowid/widgets/dialog"
+	"github.com/gcla/gowid/widgets/divider"
+	"github.com/gcla/gowid/widgets/edit"
+	"github.com/gcla/gowid/widgets/framed"
+	"github.com/gcla/gowid/widgets/menu"
+	"github.com/gcla/gowid/widgets/pile"
+	"github.com/gcla/gowid/widgets/styled"
+	"github.com/gcla/gowid/widgets/text"
+	"github.com/gcla/termshark/v2/configs/profiles"
+	"github.com/gcla/termshark/v2/pkg/shark"
+	"github.com/gcla/termshark/v2/ui/menuutil"
+	"github.com/gcla/termshark/v2/widgets/appkeys"
+	"github.com/gdamore/tcell/v2"
+)
+
+//======================================================================
+
+// Limit the number of protocols offered in the completion menu - tshark knows
+// about thousands.
+const maxDecodeAsCompletions = 20
+
+var invalidDecodeAsErr = fmt.Errorf("Please provide a layer type, a value and a protocol.")
+
+// applyDecodeAs saves the rules to the current profile and reloads the current
+// source if they changed.
+func applyDecodeAs(rules []shark.DecodeAs, app gowid.IApp) {
+	prev := shark.GetDecodeAs()
+	shark.SetDecodeAs(rules)
+	if !reflect.DeepEqual(prev, shark.GetDecodeAs()) && !Loader.Empty() {
+		RequestReload(app)
+	}
+}
+
+// openDecodeAs opens the Decode As editor. The new rule is seeded with the
+// selector and value provided - e.g. from the field selected in the packet
+// structure view.
+func openDecodeAs(selector string, value string, app gowid.IApp) {
+	openDecodeAsWith(shark.GetDecodeAs(), selector, value, app)
+}
+
+// openDecodeAsWith opens the editor with a working set of rules. These are only
+// written to the profile when the user hits Ok.
+func openDecodeAsWith(rules []shark.DecodeAs, selector string, value string, app gowid.IApp) {
+	var decodeAsDialog *dialog.Widget
+
+	if selector == "" {
+		selector = shark.DecodeAsSelectors[0]
+	}
+
+	//
+	// The rules already in place, each with a button to remove it
+	//
+	ruleWidgets := make([]interface{}, 0, len(rules)+2)
+	if len(rules) == 0 {
+		ruleWidgets = append(ruleWidgets, text.New("No Decode As rules are set."))
+	} else {
+		for i, rule := range rules {
+			i := i
+			delBtn := button.New(text.New("Delete"))
+			delBtn.OnClick(gowid.MakeWidgetCallback("cb", func(app gowid.IApp, w gowid.IWidget) {
+				decodeAsDialog.Close(app)
+				newRules := make([]shark.DecodeAs, 0, len(rules)-1)
+				newRules = append(newRules, rules[0:i]...)
+				newRules = append(newRules, rules[i+1:]...)
+				openDecodeAsWith(newRules, selector, value, app)
+			}))
+
+			ruleWidgets = append(ruleWidgets, columns.NewWithDim(
+				gowid.RenderWithWeight{1},
+				text.New(fmt.Sprintf("%s == %s  =>  %s", rule.Selector, rule.Value, rule.Protocol)),
+				&gowid.ContainerWidget{
+					IWidget: styled.NewExt(
+						delBtn,
+						gowid.MakePaletteRef("button"),
+						gowid.MakePaletteRef("button-focus"),
+					),
+					D: fixed,
+				},
+			))
+		}
+	}
+
+	//
+	// The layer type drop down
+	//
+	selectorBtn := button.New(text.New(selector))
+	selectorSite := menu.NewSite(menu.SiteOptions{YOffset: 1})
+
+	var selectorMenu *menu.Widget
+	selectorItems := make([]menuutil.SimpleMenuItem, 0, len(shark.DecodeAsSelectors))
+	for _, sel := range shark.DecodeAsSelectors {
+		sel := sel
+		selectorItems = append(selectorItems, menuutil.SimpleMenuItem{
+			Txt: sel,
+			CB: func(app gowid.IApp, w gowid.IWidget) {
+				multiMenu1Opener.CloseMenu(selectorMenu, app)
+				selector = sel
+				selectorBtn.SetSubWidget(text.New(selector), app)
+			},
+		})
+	}
+
+	selectorListBox, selectorWidth := menuutil.MakeMenu(selectorItems, nil)
+
+	selectorMenu = menu.New("decodeasselector", selectorListBox, units(selectorWidth), menu.Options{
+		Modal:             true,
+		OpenCloser:        &multiMenu1Opener,
+		CloseKeysProvided: true,
+		CloseKeys: []gowid.IKey{
+			gowid.MakeKey('q'),
+			gowid.MakeKeyExt(tcell.KeyLeft),
+			gowid.MakeKeyExt(tcell.KeyEscape),
+			gowid.MakeKeyExt(tcell.KeyCtrlC),
+		},
+	})
+
+	selectorBtn.OnClick(gowid.MakeWidgetCallback("cb", func(app gowid.IApp, w gowid.IWidget) {
+		multiMenu1Opener.OpenMenu(selectorMenu, selectorSite, app)
+	}))
+
+	valueWidget := edit.New(edit.Options{
+		Text: value,
+	})
+
+	//
+	// The protocol - hit tab to complete from tshark's protocols
+	//
+	protoWidget := edit.New()
+	protoSite := menu.NewSite(menu.SiteOptions{YOffset: 1})
+
+	var protoMenu *menu.Widget
+	openProtoMenu := func(app gowid.IApp) {
+		protos := FieldCompleter.ProtocolCompletions(protoWidget.Text())
+		if len(protos) == 0 {
+			return
+		}
+		if len(protos) == 1 {
+			protoWidget.SetText(protos[0], app)
+			protoWidget.SetCursorPos(len(protos[0]), app)
+			return
+		}
+		if len(protos) > maxDecodeAsCompletions {
+			protos = protos[0:maxDecodeAsCompletions]
+		}
+		protoItems := make([]menuutil.SimpleMenuItem, 0, len(protos))
+		for _, proto := range protos {
+			proto := proto
+			protoItems = append(protoItems, menuutil.SimpleMenuItem{
+				Txt: proto,
+				CB: func(app gowid.IApp, w gowid.IWidget) {
+					multiMenu1Opener.CloseMenu(protoMenu, app)
+					protoWidget.SetText(proto, app)
+					protoWidget.SetCursorPos(len(proto), app)
+				},
+			})
+		}
+		protoListBox, protoWidth := menuutil.MakeMenu(protoItems, nil)
+		protoMenu = menu.New("decodeasproto", protoListBox, units(protoWidth), menu.Options{
+			Modal:             true,
+			OpenCloser:        &multiMenu1Opener,
+			CloseKeysProvided: true,
+			CloseKeys: []gowid.IKey{
+				gowid.MakeKey('q'),
+				gowid.MakeKeyExt(tcell.KeyLeft),
+				gowid.MakeKeyExt(tcell.KeyEscape),
+				gowid.MakeKeyExt(tcell.KeyCtrlC),
+			},
+		})
+		multiMenu1Opener.OpenMenu(protoMenu, protoSite, app)
+	}
+
+	protoWidgetExt := appkeys.New(
+		protoWidget,
+		func(ev *tcell.EventKey, app gowid.IApp) bool {
+			res := false
+			switch ev.Key() {
+			case tcell.KeyTAB:
+				openProtoMenu(app)
+				res = true
+			}
+			return res
+		},
+		appkeys.Options{
+			ApplyBefore: true,
+		},
+	)
+
+	addBtn := button.New(text.New("Add"))
+	addBtn.OnClick(gowid.MakeWidgetCallback("cb", func(app gowid.IApp, w gowid.IWidget) {
+		rule, err := shark.ParseDecodeAs(shark.DecodeAs{
+			Selector: selector,
+			Value:    valueWidget.Text(),
+			Protocol: protoWidget.Text(),
+		}.String())
+		if err != nil {
+			OpenError(invalidDecodeAsErr.Error(), app)
+			return
+		}
+		decodeAsDialog.Close(app)
+		openDecodeAsWith(append(rules[0:len(rules):len(rules)], rule), selector, "", app)
+	}))
+
+	okBtn := dialog.Button{
+		Msg: "Ok",
+		Action: gowid.MakeWidgetCallback("exec", gowid.WidgetChangedFunction(func(app gowid.IApp, _ gowid.IWidget) {
+			decodeAsDialog.Close(app)
+			applyDecodeAs(rules, app)
+		})),
+	}
+
+	styledBtn := func(w gowid.IWidget) gowid.IWidget {
+		return styled.NewExt(
+			w,
+			gowid.MakePaletteRef("button"),
+			gowid.MakePaletteRef("button-focus"),
+		)
+	}
+
+	dialogWidgets := make([]interface{}, 0, 16)
+	dialogWidgets = append(dialogWidgets,
+		text.New(fmt.Sprintf("Decode As rules for profile %s:", profiles.CurrentName())),
+		divider.NewBlank(),
+	)
+	dialogWidgets = append(dialogWidgets, ruleWidgets...)
+	dialogWidgets = append(dialogWidgets,
+		divider.NewUnicode(),
+		text.New("New rule (hit tab in the protocol field to complete):"),
+		divider.NewBlank(),
+		columns.NewFixed(
+			text.New("Field: "),
+			selectorSite,
+			styledBtn(selectorBtn),
+		),
+		divider.NewBlank(),
+		columns.NewWithDim(
+			gowid.RenderWithWeight{1},
+			&gowid.ContainerWidget{
+				IWidget: text.New("Value: "),
+				D:       fixed,
+			},
+			framed.NewUnicode(valueWidget),
+		),
+		columns.NewWithDim(
+			gowid.RenderWithWeight{1},
+			&gowid.ContainerWidget{
+				IWidget: text.New("Decode as: "),
+				D:       fixed,
+			},
+			pile.NewFlow(protoSite, framed.NewUnicode(protoWidgetExt)),
+		),
+		divider.NewBlank(),
+		columns.NewFixed(styledBtn(addBtn)),
+	)
+
+	decodeAsDialog = dialog.New(
+		framed.NewSpace(pile.NewFlow(dialogWidgets...)),
+		dialog.Options{
+			Buttons:         []dialog.Button{okBtn, dialog.Cancel},
+			NoShadow:        true,
+			BackgroundStyle: gowid.MakePaletteRef("dialog"),
+			BorderStyle:     gowid.MakePaletteRef("dialog"),
+			ButtonStyle:     gowid.MakePaletteRef("dialog-button"),
+			Modal:           true,
+			FocusOnWidget:   true,
+		},
+	)
+
+	decodeAsDialog.Open(appView, ratio(0.6), app)
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 110
+// End:
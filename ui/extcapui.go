@@ -0,0 +1,274 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+package ui
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gcla/gowid"
+	"github.com/gcla/gowid/widgets/checkbox"
+	"github.com/gcla/gowid/widgets/columns"
+	"github.com/gcla/gowid/widgets/dialog"
+	"github.com/gcla/gowid/widgets/divider"
+	"github.com/gcla/gowid/widgets/edit"
+	"github.com/gcla/gowid/widgets/framed"
+	"github.com/gcla/gowid/widgets/list"
+	"github.com/gcla/gowid/widgets/pile"
+	"github.com/gcla/gowid/widgets/text"
+	"github.com/gcla/termshark/v2"
+	"github.com/gcla/termshark/v2/configs/profiles"
+	"github.com/gcla/termshark/v2/pkg/extcap"
+)
+
+//======================================================================
+
+// The extcap interfaces found the last time they were looked for, keyed by name.
+// Only accessed from the app goroutine.
+var extcapInterfaces map[string]extcap.Interface
+
+// isExtcapInterface returns true if the interface was provided by an extcap binary
+// the last time they were looked for.
+func isExtcapInterface(iface string) bool {
+	_, ok := extcapInterfaces[iface]
+	return ok
+}
+
+// Runs in app goroutine
+func setExtcapInterfaces(intfs []extcap.Interface) {
+	extcapInterfaces = make(map[string]extcap.Interface)
+	for _, intf := range intfs {
+		extcapInterfaces[intf.Name] = intf
+	}
+}
+
+// openExtcapUi opens the configuration of the given extcap interface. If none is
+// provided, the user picks one of the extcap interfaces found.
+func openExtcapUi(iface string, app gowid.IApp) {
+	OpenPleaseWait(appView, app)
+
+	termshark.TrackedGo(func() {
+		intfs, err := extcap.Interfaces()
+
+		app.Run(gowid.RunFunction(func(app gowid.IApp) {
+			ClosePleaseWait(app)
+			if err != nil {
+				OpenError(fmt.Sprintf("Could not enumerate extcap interfaces: %v", err), app)
+				return
+			}
+			setExtcapInterfaces(intfs)
+
+			if iface != "" {
+				intf, ok := extcapInterfaces[iface]
+				if !ok {
+					OpenError(fmt.Sprintf("%s is not an extcap interface.", iface), app)
+					return
+				}
+				openExtcapConfigFor(intf, app)
+				return
+			}
+
+			names := make([]string, 0, len(intfs))
+			for _, intf := range intfs {
+				names = append(names, intf.Name)
+			}
+			openInterfacePicker(names, func(iface string, app gowid.IApp) {
+				if intf, ok := extcapInterfaces[iface]; ok {
+					openExtcapConfigFor(intf, app)
+				} else {
+					OpenError(fmt.Sprintf("%s is not an extcap interface.", iface), app)
+				}
+			}, app)
+		}))
+	}, Goroutinewg)
+}
+
+// openExtcapConfigFor asks the extcap binary which arguments the interface
+// accepts, then opens a dialog to answer them.
+func openExtcapConfigFor(intf extcap.Interface, app gowid.IApp) {
+	OpenPleaseWait(appView, app)
+
+	termshark.TrackedGo(func() {
+		args, err := extcap.Config(intf)
+
+		app.Run(gowid.RunFunction(func(app gowid.IApp) {
+			ClosePleaseWait(app)
+			if err != nil {
+				OpenError(fmt.Sprintf("Could not read the configuration of %s: %v", intf.Name, err), app)
+				return
+			}
+			if len(args) == 0 {
+				OpenMessage(fmt.Sprintf("%s has nothing to configure.", intf.Name), appView, app)
+				return
+			}
+			openExtcapConfigDialog(intf, args, app)
+		}))
+	}, Goroutinewg)
+}
+
+// openExtcapConfigDialog opens a form generated from the extcap interface's
+// arguments, filled in with the answers saved in the profile. Only answers which
+// differ from the extcap binary's defaults are saved.
+func openExtcapConfigDialog(intf extcap.Interface, args []extcap.Arg, app gowid.IApp) {
+	var configDialog *dialog.Widget
+
+	answers := extcap.GetAnswers(intf.Name)
+
+	// Each returns the value of an argument as typed or chosen by the user
+	values := make([]func() string, len(args))
+
+	labelWidth := 0
+	for _, arg := range args {
+		if len(arg.Display) > labelWidth {
+			labelWidth = len(arg.Display)
+		}
+	}
+
+	rows := make([]gowid.IWidget, 0, len(args)*2)
+	for i, arg := range args {
+		arg := arg
+		val, ok := answers[arg.Call]
+		if !ok {
+			val = arg.DefaultValue()
+		}
+
+		lbl := fmt.Sprintf("%-*s ", labelWidth+1, arg.Display+":")
+		if arg.Required {
+			lbl = fmt.Sprintf("%-*s*", labelWidth+1, arg.Display+":")
+		}
+
+		var row gowid.IWidget
+		switch arg.Kind() {
+		case extcap.BooleanArg:
+			b, _ := strconv.ParseBool(val)
+			check := checkbox.New(b)
+			values[i] = func() string {
+				return strconv.FormatBool(check.IsChecked())
+			}
+			row = columns.NewFixed(text.New(lbl+" "), check)
+		case extcap.SelectorArg:
+			choices := make([]termshark.InterfaceCapability, 0, len(arg.Values))
+			for _, v := range arg.Values {
+				choices = append(choices, termshark.InterfaceCapability{
+					Name:        v.Value,
+					Description: v.Display,
+				})
+			}
+			choice := new(string)
+			*choice = val
+			if *choice == arg.DefaultValue() {
+				*choice = ""
+			}
+			site, btn := makeCaptureChoice(fmt.Sprintf("extcap%d", arg.Number), choice, choices)
+			values[i] = func() string {
+				if *choice == "" {
+					return arg.DefaultValue()
+				}
+				return *choice
+			}
+			row = columns.NewFixed(text.New(lbl+" "), site, btn)
+		default:
+			valWidget := edit.New(edit.Options{
+				Text: val,
+			})
+			values[i] = func() string {
+				return strings.TrimSpace(valWidget.Text())
+			}
+			row = columns.NewWithDim(
+				gowid.RenderWithWeight{1},
+				&gowid.ContainerWidget{
+					IWidget: text.New(lbl),
+					D:       fixed,
+				},
+				framed.NewUnicode(valWidget),
+			)
+		}
+
+		rows = append(rows, row)
+		hint := arg.Tooltip
+		if hint == arg.Display {
+			hint = ""
+		}
+		if arg.Range != "" {
+			hint = strings.TrimSpace(fmt.Sprintf("%s (range %s)", hint, arg.Range))
+		}
+		if hint != "" {
+			rows = append(rows, text.New(fmt.Sprintf("%*s %s", labelWidth+2, "", hint)))
+		}
+	}
+
+	okBtn := dialog.Button{
+		Msg: "Ok",
+		Action: gowid.MakeWidgetCallback("exec", gowid.WidgetChangedFunction(func(app gowid.IApp, _ gowid.IWidget) {
+			newAnswers := make(map[string]string)
+			for i, arg := range args {
+				val := values[i]()
+				if err := arg.Validate(val); err != nil {
+					OpenError(err.Error(), app)
+					return
+				}
+				if !extcapDefault(arg, val) {
+					newAnswers[arg.Call] = val
+				}
+			}
+
+			configDialog.Close(app)
+			extcap.SetAnswers(intf.Name, newAnswers)
+
+			if termshark.StringInSlice(intf.Name, Loader.Interfaces()) {
+				OpenMessage(fmt.Sprintf("The new configuration of %s takes effect when the capture restarts e.g. after clear-packets.", intf.Name), appView, app)
+			}
+		})),
+	}
+
+	title := intf.Name
+	if intf.Display != "" {
+		title = fmt.Sprintf("%s (%s)", intf.Name, intf.Display)
+	}
+
+	view := pile.NewFlow(
+		text.New(fmt.Sprintf("Configuration of %s in profile %s. Those marked with * are required.", title, profiles.CurrentName())),
+		divider.NewUnicode(),
+		// Do this so the list box scrolls inside the dialog
+		&gowid.ContainerWidget{
+			IWidget: list.New(list.NewSimpleListWalker(rows)),
+			D:       weight(1),
+		},
+	)
+
+	configDialog = dialog.New(
+		framed.NewSpace(view),
+		dialog.Options{
+			Buttons:         []dialog.Button{okBtn, dialog.Cancel},
+			NoShadow:        true,
+			BackgroundStyle: gowid.MakePaletteRef("dialog"),
+			BorderStyle:     gowid.MakePaletteRef("dialog"),
+			ButtonStyle:     gowid.MakePaletteRef("dialog-button"),
+			Modal:           true,
+			FocusOnWidget:   true,
+		},
+	)
+
+	dialog.OpenExt(configDialog, appView, ratio(0.8), ratio(0.8), app)
+}
+
+// extcapDefault returns true if the value is what the extcap binary would use
+// anyway, meaning it needn't be saved.
+func extcapDefault(arg extcap.Arg, val string) bool {
+	def := arg.DefaultValue()
+	if arg.Kind() == extcap.BooleanArg {
+		b, _ := strconv.ParseBool(val)
+		d, _ := strconv.ParseBool(def)
+		return b == d
+	}
+	return val == def
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 110
+// End:
@@ -0,0 +1,464 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+package ui
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gcla/gowid"
+	"github.com/gcla/gowid/widgets/button"
+	"github.com/gcla/gowid/widgets/checkbox"
+	"github.com/gcla/gowid/widgets/columns"
+	"github.com/gcla/gowid/widgets/dialog"
+	"github.com/gcla/gowid/widgets/divider"
+	"github.com/gcla/gowid/widgets/edit"
+	"github.com/gcla/gowid/widgets/framed"
+	"github.com/gcla/gowid/widgets/list"
+	"github.com/gcla/gowid/widgets/menu"
+	"github.com/gcla/gowid/widgets/pile"
+	"github.com/gcla/gowid/widgets/selectable"
+	"github.com/gcla/gowid/widgets/styled"
+	"github.com/gcla/gowid/widgets/text"
+	"github.com/gcla/termshark/v2"
+	"github.com/gcla/termshark/v2/configs/profiles"
+	"github.com/gcla/termshark/v2/pkg/dfilter"
+	"github.com/gcla/termshark/v2/pkg/fields"
+	"github.com/gcla/termshark/v2/ui/menuutil"
+	"github.com/gcla/termshark/v2/widgets/filter"
+	"github.com/gdamore/tcell/v2"
+)
+
+//======================================================================
+
+// Don't build thousands of widgets when the search matches a lot of fields
+const maxFilterBuilderMatches = 200
+
+// Limit the size of the menu of value hints - some fields have hundreds
+const maxFilterBuilderHints = 30
+
+// The operator offered for testing a field's presence, rather than its value
+const presentOperator = "is present"
+
+// Read with tshark -G values the first time hints are requested
+var valueStrings = fields.NewValueStrings()
+
+var invalidFilterTargetErr = fmt.Errorf("Set the search type to Filter to search with a display filter.")
+
+// filterBuilderTarget is where the expression is inserted - the display
+// filter, or the search bar.
+type filterBuilderTarget int
+
+const (
+	displayFilterTarget filterBuilderTarget = iota
+	searchFilterTarget
+)
+
+// quoteFilterValue quotes a value compared with a string field, unless the
+// user has quoted it already.
+func quoteFilterValue(field fields.Field, op string, val string) string {
+	if strings.HasPrefix(val, "\"") {
+		return val
+	}
+	switch field.Type {
+	case fields.FT_STRING, fields.FT_STRINGZ, fields.FT_UINT_STRING, fields.FT_STRINGZPAD:
+		return strconv.Quote(val)
+	}
+	if op == "matches" {
+		return strconv.Quote(val)
+	}
+	return val
+}
+
+// joinFilterTerm adds a term to an expression. If the way the expression is
+// joined changes, from and to or, wrap what came before in parentheses so the
+// result doesn't depend on precedence.
+func joinFilterTerm(expr string, lastJoin string, join string, term string) string {
+	if expr == "" {
+		return term
+	}
+	if lastJoin != "" && lastJoin != join {
+		expr = fmt.Sprintf("(%s)", expr)
+	}
+	return fmt.Sprintf("%s %s %s", expr, join, term)
+}
+
+func filterBuilderMatches(search string) []fields.Field {
+	res := make([]fields.Field, 0, 64)
+	if i := strings.IndexByte(search, '.'); i != -1 {
+		for _, field := range FieldCompleter.ProtocolFields(search[0:i]) {
+			if strings.HasPrefix(field.Name, search) {
+				res = append(res, field)
+			}
+		}
+	} else {
+		for _, proto := range FieldCompleter.ProtocolCompletions(search) {
+			res = append(res, fields.Field{Name: proto, Type: fields.FT_PROTOCOL})
+		}
+	}
+	return res
+}
+
+func openFilterBuilder(target filterBuilderTarget, app gowid.IApp) {
+	if target == searchFilterTarget && profiles.ConfString("main.search-type", "filter") != "filter" {
+		OpenError(invalidFilterTargetErr.Error(), app)
+		return
+	}
+
+	var builderDialog *dialog.Widget
+
+	expr := ""
+	lastJoin := ""
+	var field fields.Field
+	op := presentOperator
+
+	exprText := text.New("")
+	fieldText := text.New("")
+	opText := text.New(op)
+	opBtn := button.New(opText)
+	valueWidget := edit.New()
+
+	updateExpr := func(app gowid.IApp) {
+		if expr == "" {
+			exprText.SetText("(empty - add a term below)", app)
+		} else {
+			exprText.SetText(expr, app)
+		}
+	}
+	updateExpr(app)
+
+	setField := func(f fields.Field, app gowid.IApp) {
+		field = f
+		fieldText.SetText(fmt.Sprintf("%s (%s)", f.Name, strings.TrimPrefix(f.Type.String(), "FT_")), app)
+		op = presentOperator
+		opText.SetText(op, app)
+		valueWidget.SetText("", app)
+	}
+
+	//
+	// The protocols and fields matching the search
+	//
+	fieldsList := list.New(list.NewSimpleListWalker([]gowid.IWidget{}))
+	searchWidget := edit.New(edit.Options{
+		Caption: "Search: ",
+	})
+
+	makeFieldsWalker := func(search string) list.IWalker {
+		matches := filterBuilderMatches(search)
+		widgets := make([]gowid.IWidget, 0, len(matches)+1)
+		for i, match := range matches {
+			if i == maxFilterBuilderMatches {
+				widgets = append(widgets, text.New(fmt.Sprintf("...and %d more", len(matches)-i)))
+				break
+			}
+			match := match
+			btn := button.NewBare(text.New(fmt.Sprintf("%s  (%s)", match.Name, strings.TrimPrefix(match.Type.String(), "FT_"))))
+			btn.OnClick(gowid.MakeWidgetCallback("cb", gowid.WidgetChangedFunction(func(app gowid.IApp, w gowid.IWidget) {
+				setField(match, app)
+				if match.Type == fields.FT_PROTOCOL {
+					// Browse the protocol's fields
+					searchWidget.SetText(match.Name+".", app)
+					searchWidget.SetCursorPos(len(match.Name)+1, app)
+				}
+			})))
+			widgets = append(widgets, styled.NewInvertedFocus(selectable.New(btn), gowid.MakePaletteRef("default")))
+		}
+		if len(widgets) == 0 {
+			widgets = append(widgets, text.New("No protocols or fields match."))
+		}
+		return list.NewSimpleListWalker(widgets)
+	}
+
+	fieldsList.SetWalker(makeFieldsWalker(""), app)
+	searchWidget.OnTextSet(gowid.MakeWidgetCallback("cb", gowid.WidgetChangedFunction(func(app gowid.IApp, w gowid.IWidget) {
+		fieldsList.SetWalker(makeFieldsWalker(searchWidget.Text()), app)
+	})))
+
+	//
+	// The operators that suit the field's type
+	//
+	opSite := menu.NewSite(menu.SiteOptions{YOffset: 1})
+	var opMenu *menu.Widget
+	opBtn.OnClick(gowid.MakeWidgetCallback("cb", func(app gowid.IApp, w gowid.IWidget) {
+		if field.Name == "" {
+			OpenError("Please choose a field first.", app)
+			return
+		}
+		ops := append([]string{presentOperator}, dfilter.Operators(field.Type)...)
+		opItems := make([]menuutil.SimpleMenuItem, 0, len(ops))
+		for _, o := range ops {
+			o := o
+			opItems = append(opItems, menuutil.SimpleMenuItem{
+				Txt: o,
+				CB: func(app gowid.IApp, w gowid.IWidget) {
+					multiMenu1Opener.CloseMenu(opMenu, app)
+					op = o
+					opText.SetText(op, app)
+				},
+			})
+		}
+		opListBox, opWidth := menuutil.MakeMenu(opItems, nil)
+		opMenu = menu.New("filterbuilderop", opListBox, units(opWidth), menu.Options{
+			Modal:             true,
+			OpenCloser:        &multiMenu1Opener,
+			CloseKeysProvided: true,
+			CloseKeys: []gowid.IKey{
+				gowid.MakeKey('q'),
+				gowid.MakeKeyExt(tcell.KeyLeft),
+				gowid.MakeKeyExt(tcell.KeyEscape),
+				gowid.MakeKeyExt(tcell.KeyCtrlC),
+			},
+		})
+		multiMenu1Opener.OpenMenu(opMenu, opSite, app)
+	}))
+
+	//
+	// Named values of the field, e.g. for enums and booleans
+	//
+	hintsBtn := button.New(text.New("Hints"))
+	hintsSite := menu.NewSite(menu.SiteOptions{YOffset: 1})
+	var hintsMenu *menu.Widget
+	openHints := func(hints []fields.ValueString, app gowid.IApp) {
+		if len(hints) == 0 {
+			OpenMessage(fmt.Sprintf("No named values are known for %s.", field.Name), appView, app)
+			return
+		}
+		if len(hints) > maxFilterBuilderHints {
+			hints = hints[0:maxFilterBuilderHints]
+		}
+		hintItems := make([]menuutil.SimpleMenuItem, 0, len(hints))
+		for _, hint := range hints {
+			hint := hint
+			hintItems = append(hintItems, menuutil.SimpleMenuItem{
+				Txt: fmt.Sprintf("%s (%s)", hint.Value, hint.Name),
+				CB: func(app gowid.IApp, w gowid.IWidget) {
+					multiMenu1Opener.CloseMenu(hintsMenu, app)
+					valueWidget.SetText(hint.Value, app)
+					valueWidget.SetCursorPos(len(hint.Value), app)
+					if op == presentOperator {
+						op = "=="
+						opText.SetText(op, app)
+					}
+				},
+			})
+		}
+		hintsListBox, hintsWidth := menuutil.MakeMenu(hintItems, nil)
+		hintsMenu = menu.New("filterbuilderhints", hintsListBox, units(hintsWidth), menu.Options{
+			Modal:             true,
+			OpenCloser:        &multiMenu1Opener,
+			CloseKeysProvided: true,
+			CloseKeys: []gowid.IKey{
+				gowid.MakeKey('q'),
+				gowid.MakeKeyExt(tcell.KeyLeft),
+				gowid.MakeKeyExt(tcell.KeyEscape),
+				gowid.MakeKeyExt(tcell.KeyCtrlC),
+			},
+		})
+		multiMenu1Opener.OpenMenu(hintsMenu, hintsSite, app)
+	}
+
+	hintsBtn.OnClick(gowid.MakeWidgetCallback("cb", func(app gowid.IApp, w gowid.IWidget) {
+		if field.Name == "" {
+			OpenError("Please choose a field first.", app)
+			return
+		}
+		name := field.Name
+		ty := field.Type
+		OpenPleaseWait(appView, app)
+		termshark.TrackedGo(func() {
+			hints, err := valueStrings.Lookup(name)
+			if err == nil && len(hints) == 0 && ty == fields.FT_BOOLEAN {
+				hints = []fields.ValueString{{Value: "1", Name: "True"}, {Value: "0", Name: "False"}}
+			}
+			app.Run(gowid.RunFunction(func(app gowid.IApp) {
+				ClosePleaseWait(app)
+				if err != nil {
+					OpenError(fmt.Sprintf("Could not read value names from tshark: %v", err), app)
+					return
+				}
+				openHints(hints, app)
+			}))
+		}, Goroutinewg)
+	}))
+
+	notCheckBox := checkbox.New(false)
+
+	//
+	// Add the term to the expression
+	//
+	addTerm := func(join string, app gowid.IApp) {
+		if field.Name == "" {
+			OpenError("Please choose a field first.", app)
+			return
+		}
+		term := field.Name
+		if op != presentOperator {
+			val := strings.TrimSpace(valueWidget.Text())
+			if val == "" {
+				OpenError("Please provide a value to compare with.", app)
+				return
+			}
+			term = fmt.Sprintf("%s %s %s", field.Name, op, quoteFilterValue(field, op, val))
+		}
+		if notCheckBox.IsChecked() {
+			if op == presentOperator {
+				term = "!" + term
+			} else {
+				term = fmt.Sprintf("!(%s)", term)
+			}
+		}
+		filter.CheckDisplayFilterThen(term, FieldCompleter, app, func(err error, app gowid.IApp) {
+			if err != nil {
+				OpenError(fmt.Sprintf("Invalid term %s: %v", term, err), app)
+				return
+			}
+			prev := expr
+			expr = joinFilterTerm(expr, lastJoin, join, term)
+			if prev != "" {
+				lastJoin = join
+			}
+			updateExpr(app)
+			notCheckBox.SetChecked(app, false)
+			valueWidget.SetText("", app)
+		})
+	}
+
+	styledBtn := func(w gowid.IWidget) gowid.IWidget {
+		return styled.NewExt(
+			w,
+			gowid.MakePaletteRef("button"),
+			gowid.MakePaletteRef("button-focus"),
+		)
+	}
+
+	andBtn := button.New(text.New("Add with and"))
+	andBtn.OnClick(gowid.MakeWidgetCallback("cb", func(app gowid.IApp, w gowid.IWidget) {
+		addTerm("&&", app)
+	}))
+	orBtn := button.New(text.New("Add with or"))
+	orBtn.OnClick(gowid.MakeWidgetCallback("cb", func(app gowid.IApp, w gowid.IWidget) {
+		addTerm("||", app)
+	}))
+	clearBtn := button.New(text.New("Clear"))
+	clearBtn.OnClick(gowid.MakeWidgetCallback("cb", func(app gowid.IApp, w gowid.IWidget) {
+		expr = ""
+		lastJoin = ""
+		updateExpr(app)
+	}))
+
+	insertBtn := dialog.Button{
+		Msg: "Insert",
+		Action: gowid.MakeWidgetCallback("exec", gowid.WidgetChangedFunction(func(app gowid.IApp, _ gowid.IWidget) {
+			if expr == "" {
+				OpenError("The expression is empty.", app)
+				return
+			}
+			builderDialog.Close(app)
+			insertFilterExpression(target, expr, app)
+		})),
+	}
+
+	targetName := "display filter"
+	if target == searchFilterTarget {
+		targetName = "search"
+	}
+
+	view := pile.NewFlow(
+		text.New(fmt.Sprintf("Build an expression to insert into the %s.", targetName)),
+		divider.NewBlank(),
+		columns.NewWithDim(
+			gowid.RenderWithWeight{1},
+			&gowid.ContainerWidget{
+				IWidget: text.New("Expression: "),
+				D:       fixed,
+			},
+			exprText,
+		),
+		divider.NewUnicode(),
+		text.New("Choose a protocol to see its fields, then choose a field:"),
+		framed.NewUnicode(searchWidget),
+		// Do this so the list box scrolls inside the dialog
+		&gowid.ContainerWidget{
+			IWidget: fieldsList,
+			D:       weight(1),
+		},
+		divider.NewUnicode(),
+		columns.NewWithDim(
+			gowid.RenderWithWeight{1},
+			&gowid.ContainerWidget{
+				IWidget: text.New("Field: "),
+				D:       fixed,
+			},
+			fieldText,
+		),
+		divider.NewBlank(),
+		columns.NewFixed(
+			text.New("Operator: "),
+			opSite,
+			styledBtn(opBtn),
+			text.New("  Not: "),
+			notCheckBox,
+		),
+		divider.NewBlank(),
+		columns.NewWithDim(
+			gowid.RenderWithWeight{1},
+			&gowid.ContainerWidget{
+				IWidget: text.New("Value: "),
+				D:       fixed,
+			},
+			framed.NewUnicode(valueWidget),
+			&gowid.ContainerWidget{
+				IWidget: pile.NewFlow(divider.NewBlank(), hintsSite, styledBtn(hintsBtn)),
+				D:       fixed,
+			},
+		),
+		divider.NewBlank(),
+		columns.NewFixed(
+			styledBtn(andBtn),
+			text.New(" "),
+			styledBtn(orBtn),
+			text.New(" "),
+			styledBtn(clearBtn),
+		),
+	)
+
+	builderDialog = dialog.New(
+		framed.NewSpace(view),
+		dialog.Options{
+			Buttons:         []dialog.Button{insertBtn, dialog.Cancel},
+			NoShadow:        true,
+			BackgroundStyle: gowid.MakePaletteRef("dialog"),
+			BorderStyle:     gowid.MakePaletteRef("dialog"),
+			ButtonStyle:     gowid.MakePaletteRef("dialog-button"),
+			Modal:           true,
+			FocusOnWidget:   true,
+		},
+	)
+
+	dialog.OpenExt(builderDialog, appView, ratio(0.8), ratio(0.8), app)
+}
+
+// insertFilterExpression puts the expression into the display filter or the
+// search bar, at the cursor, and moves focus there.
+func insertFilterExpression(target filterBuilderTarget, expr string, app gowid.IApp) {
+	switch target {
+	case searchFilterTarget:
+		if !searchOpen() {
+			filterHolder.SetSubWidget(filterWithSearch, app)
+		}
+		SearchWidget.InsertValue(expr, app)
+		setFocusOnSearch(app)
+	default:
+		FilterWidget.InsertValue(expr, app)
+		setFocusOnDisplayFilter(app)
+	}
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 110
+// End:
@@ -0,0 +1,268 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+package ui
+
+import (
+	"fmt"
+
+	"github.com/gcla/gowid"
+	"github.com/gcla/gowid/widgets/columns"
+	"github.com/gcla/gowid/widgets/dialog"
+	"github.com/gcla/gowid/widgets/divider"
+	"github.com/gcla/gowid/widgets/edit"
+	"github.com/gcla/gowid/widgets/framed"
+	"github.com/gcla/gowid/widgets/holder"
+	"github.com/gcla/gowid/widgets/menu"
+	"github.com/gcla/gowid/widgets/pile"
+	"github.com/gcla/gowid/widgets/text"
+	"github.com/gcla/termshark/v2/configs/profiles"
+	"github.com/gcla/termshark/v2/pkg/shark"
+	"github.com/gcla/termshark/v2/pkg/shark/wiresharkcfg"
+	"github.com/gcla/termshark/v2/ui/menuutil"
+	"github.com/gcla/termshark/v2/widgets/filter"
+	log "github.com/sirupsen/logrus"
+)
+
+//======================================================================
+
+// The hotkeys for the filter buttons menu, in order. q is left out because it closes
+// most menus.
+const filterButtonKeys = "123456789abcdefghijklmnoprstuvwxyz"
+
+var filterButtonsMenu *menu.Widget
+var filterButtonsSite *menu.SiteWidget
+var filterButtonsHolder *holder.Widget
+
+var invalidFilterButtonErr = fmt.Errorf("Please provide a label and a filter expression.")
+
+// filterButtons returns the filter buttons to show - those of the Wireshark
+// profile, adjusted by those saved in the termshark profile.
+func filterButtons() []wiresharkcfg.FilterButton {
+	wsButtons, err := shark.GetWiresharkFilterButtons()
+	if err != nil {
+		log.Warnf("Could not read Wireshark filter buttons: %v", err)
+	}
+	return shark.MergeFilterButtons(wsButtons, shark.GetFilterButtons())
+}
+
+func filterButtonLabels() []string {
+	res := make([]string, 0)
+	for _, b := range filterButtons() {
+		res = append(res, b.Label)
+	}
+	return res
+}
+
+func findFilterButton(label string) (wiresharkcfg.FilterButton, bool) {
+	for _, b := range filterButtons() {
+		if b.Label == label {
+			return b, true
+		}
+	}
+	return wiresharkcfg.FilterButton{}, false
+}
+
+func applyFilterButton(expr string, app gowid.IApp) {
+	FilterWidget.SetValue(expr, app)
+	RequestNewFilter(expr, app)
+}
+
+// makeFilterButtonsMenuWidget builds a menu of the filter buttons, each with a
+// single key to apply it, followed by Wireshark's saved display filters.
+func makeFilterButtonsMenuWidget() (gowid.IWidget, int) {
+	items := make([]menuutil.SimpleMenuItem, 0)
+	nkeys := 0 // dividers don't take a key
+
+	addItem := func(txt string, expr string) {
+		var key gowid.IKey
+		if nkeys < len(filterButtonKeys) {
+			key = gowid.MakeKey(rune(filterButtonKeys[nkeys]))
+			nkeys++
+		}
+		items = append(items, menuutil.SimpleMenuItem{
+			Txt: txt,
+			Key: key,
+			CB: func(app gowid.IApp, w gowid.IWidget) {
+				multiMenu1Opener.CloseMenu(filterButtonsMenu, app)
+				applyFilterButton(expr, app)
+			},
+		})
+	}
+
+	for _, b := range filterButtons() {
+		addItem(b.Label, b.Expression)
+	}
+
+	saved, err := shark.GetWiresharkSavedFilters()
+	if err != nil {
+		log.Warnf("Could not read Wireshark saved filters: %v", err)
+	}
+	if len(saved) > 0 && len(items) > 0 {
+		items = append(items, menuutil.MakeMenuDivider())
+	}
+	for _, f := range saved {
+		addItem(f.Name, f.Expression)
+	}
+
+	if len(items) > 0 {
+		items = append(items, menuutil.MakeMenuDivider())
+	}
+	items = append(items, menuutil.SimpleMenuItem{
+		Txt: "Add Button...",
+		Key: gowid.MakeKey('+'),
+		CB: func(app gowid.IApp, w gowid.IWidget) {
+			multiMenu1Opener.CloseMenu(filterButtonsMenu, app)
+			openFilterButtonEditor("", app)
+		},
+	})
+
+	return menuutil.MakeMenuWithHotKeys(items, nil)
+}
+
+// openFilterButtonsMenu rebuilds the menu each time so that changes to the
+// buttons, or to the linked Wireshark profile, are picked up.
+func openFilterButtonsMenu(app gowid.IApp) {
+	lb, _ := makeFilterButtonsMenuWidget()
+	filterButtonsHolder.SetSubWidget(lb, app)
+	multiMenu1Opener.OpenMenu(filterButtonsMenu, filterButtonsSite, app)
+}
+
+// saveFilterButton saves the button in the termshark profile, replacing the
+// button with the label orig, if any.
+func saveFilterButton(orig string, button wiresharkcfg.FilterButton) {
+	buttons := make([]wiresharkcfg.FilterButton, 0)
+	for _, b := range shark.GetFilterButtons() {
+		if b.Label != orig && b.Label != button.Label {
+			buttons = append(buttons, b)
+		}
+	}
+	buttons = append(buttons, button)
+	shark.SetFilterButtons(hideWiresharkFilterButton(orig, buttons))
+}
+
+// deleteFilterButton removes the button with the given label from the termshark
+// profile. If the button comes from the Wireshark profile, a disabled button with
+// the same label is saved to hide it.
+func deleteFilterButton(label string) error {
+	if _, ok := findFilterButton(label); !ok {
+		return fmt.Errorf("No filter button is labelled %s", label)
+	}
+	buttons := make([]wiresharkcfg.FilterButton, 0)
+	for _, b := range shark.GetFilterButtons() {
+		if b.Label != label {
+			buttons = append(buttons, b)
+		}
+	}
+	shark.SetFilterButtons(hideWiresharkFilterButton(label, buttons))
+	return nil
+}
+
+func hideWiresharkFilterButton(label string, buttons []wiresharkcfg.FilterButton) []wiresharkcfg.FilterButton {
+	for _, b := range buttons {
+		if b.Label == label {
+			return buttons
+		}
+	}
+	wsButtons, _ := shark.GetWiresharkFilterButtons()
+	for _, b := range wsButtons {
+		if b.Label == label && b.Enabled {
+			return append(buttons, wiresharkcfg.FilterButton{Label: label, Expression: b.Expression})
+		}
+	}
+	return buttons
+}
+
+// openFilterButtonEditor lets the user change the button with the given label,
+// or if label is empty, add a new button seeded with the current display filter.
+func openFilterButtonEditor(label string, app gowid.IApp) {
+	var editDialog *dialog.Widget
+
+	button := wiresharkcfg.FilterButton{
+		Label:      label,
+		Expression: FilterWidget.Value(),
+	}
+	if b, ok := findFilterButton(label); ok {
+		button = b
+	}
+
+	labelWidget := edit.New(edit.Options{
+		Text: button.Label,
+	})
+	exprWidget := edit.New(edit.Options{
+		Text: button.Expression,
+	})
+	commentWidget := edit.New(edit.Options{
+		Text: button.Comment,
+	})
+
+	okBtn := dialog.Button{
+		Msg: "Ok",
+		Action: gowid.MakeWidgetCallback("exec", gowid.WidgetChangedFunction(func(app gowid.IApp, _ gowid.IWidget) {
+			newButton := wiresharkcfg.FilterButton{
+				Enabled:    true,
+				Label:      labelWidget.Text(),
+				Expression: exprWidget.Text(),
+				Comment:    commentWidget.Text(),
+			}
+			if newButton.Label == "" || newButton.Expression == "" {
+				OpenError(invalidFilterButtonErr.Error(), app)
+				return
+			}
+			filter.CheckDisplayFilterThen(newButton.Expression, FieldCompleter, app, func(err error, app gowid.IApp) {
+				if err != nil {
+					OpenError(fmt.Sprintf("Invalid filter: %v", err), app)
+					return
+				}
+				editDialog.Close(app)
+				saveFilterButton(label, newButton)
+			})
+		})),
+	}
+
+	labelled := func(lbl string, w gowid.IWidget) gowid.IWidget {
+		return columns.NewWithDim(
+			gowid.RenderWithWeight{1},
+			&gowid.ContainerWidget{
+				IWidget: text.New(lbl),
+				D:       fixed,
+			},
+			framed.NewUnicode(w),
+		)
+	}
+
+	title := "Add a filter button"
+	if label != "" {
+		title = fmt.Sprintf("Edit filter button %s", label)
+	}
+
+	editDialog = dialog.New(
+		framed.NewSpace(
+			pile.NewFlow(
+				text.New(fmt.Sprintf("%s for profile %s:", title, profiles.CurrentName())),
+				divider.NewBlank(),
+				labelled("Label:   ", labelWidget),
+				labelled("Filter:  ", exprWidget),
+				labelled("Comment: ", commentWidget),
+			),
+		),
+		dialog.Options{
+			Buttons:         []dialog.Button{okBtn, dialog.Cancel},
+			NoShadow:        true,
+			BackgroundStyle: gowid.MakePaletteRef("dialog"),
+			BorderStyle:     gowid.MakePaletteRef("dialog"),
+			ButtonStyle:     gowid.MakePaletteRef("dialog-button"),
+			Modal:           true,
+			FocusOnWidget:   true,
+		},
+	)
+
+	editDialog.Open(appView, ratio(0.6), app)
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 110
+// End:
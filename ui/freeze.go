@@ -0,0 +1,81 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+package ui
+
+import (
+	"fmt"
+
+	"github.com/gcla/gowid"
+	"github.com/gcla/gowid/widgets/text"
+)
+
+//======================================================================
+
+// PacketListFrozen is true if the packet list should not change as packets arrive. The
+// capture carries on in the background; when the list is resumed, it catches up in one go.
+var PacketListFrozen bool
+
+var shownPacketCount int // the number of packets in the packet list's current model
+var frozenIndicator *text.Widget
+
+// Runs in app goroutine
+func togglePacketListFrozen(app gowid.IApp) {
+	if PacketListFrozen {
+		resumePacketList(app)
+	} else {
+		freezePacketList(app)
+	}
+}
+
+// Runs in app goroutine
+func freezePacketList(app gowid.IApp) {
+	if packetListView == nil {
+		OpenError("No packets to freeze.", app)
+		return
+	}
+	PacketListFrozen = true
+	updateFrozenIndicator(Loader, app)
+}
+
+// Runs in app goroutine
+func resumePacketList(app gowid.IApp) {
+	PacketListFrozen = false
+	updateFrozenIndicator(Loader, app)
+	if packetListView != nil {
+		updatePacketListWithData(Loader, app)
+	}
+}
+
+// unfreezePacketList drops the freeze without catching up, for when the packet list is
+// about to be rebuilt anyway - e.g. for a new filter or packet source.
+//
+// Runs in app goroutine
+func unfreezePacketList(psml iPsmlInfo, app gowid.IApp) {
+	PacketListFrozen = false
+	updateFrozenIndicator(psml, app)
+}
+
+// updateFrozenIndicator shows, in the title bar, how many packets have arrived since the
+// packet list was frozen.
+func updateFrozenIndicator(psml iPsmlInfo, app gowid.IApp) {
+	if frozenIndicator == nil {
+		return
+	}
+	if !PacketListFrozen {
+		frozenIndicator.SetText("", app)
+		return
+	}
+	pending := len(psml.PsmlData()) - shownPacketCount
+	if pending < 0 {
+		pending = 0
+	}
+	frozenIndicator.SetText(fmt.Sprintf(" [frozen, %d new - ctrl-s to resume]", pending), app)
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 110
+// End:
@@ -0,0 +1,237 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+package ui
+
+import (
+	"fmt"
+
+	"github.com/gcla/gowid"
+	"github.com/gcla/gowid/widgets/button"
+	"github.com/gcla/gowid/widgets/columns"
+	"github.com/gcla/gowid/widgets/holder"
+	"github.com/gcla/gowid/widgets/isselected"
+	"github.com/gcla/gowid/widgets/pile"
+	"github.com/gcla/gowid/widgets/styled"
+	"github.com/gcla/gowid/widgets/text"
+	"github.com/gcla/termshark/v2/pkg/pcap"
+	"github.com/gcla/termshark/v2/pkg/pdmltree"
+	"github.com/gcla/termshark/v2/widgets/hexdumper2"
+	"github.com/gcla/termshark/v2/widgets/ifwidget"
+	"github.com/gcla/termshark/v2/widgets/keepselected"
+	"github.com/gcla/termshark/v2/widgets/withscrollbar"
+)
+
+//======================================================================
+
+// packetHexView is the hex pane for one packet. A packet can have several
+// sources of bytes - the frame, then e.g. reassembled TCP, a decompressed
+// entity body or decrypted TLS. There is a hexdumper2 widget for each, and
+// when there is more than one, tabs above to switch between them.
+type packetHexView struct {
+	gowid.IWidget // displayed in the hex pane
+	names         []string
+	sources       [][]byte // the bytes of each data source
+	hexes         []*hexdumper2.Widget
+	scrolled      []gowid.IWidget // each hex widget with its scrollbar
+	cur           int             // the data source on display
+	holder        *holder.Widget
+}
+
+// newPacketHexView makes the hex pane for the packet at the row provided. The packet's decoded structure, if
+// loaded, is given by model, and styles the bytes of every data source.
+func newPacketHexView(row int, sources []pcap.DataSource, model *pdmltree.Model) *packetHexView {
+	res := &packetHexView{
+		names:    make([]string, 0, len(sources)),
+		sources:  make([][]byte, 0, len(sources)),
+		hexes:    make([]*hexdumper2.Widget, 0, len(sources)),
+		scrolled: make([]gowid.IWidget, 0, len(sources)),
+	}
+
+	for _, src := range sources {
+		b := make([]byte, len(src.Data))
+		copy(b, src.Data)
+
+		res.names = append(res.names, src.Name)
+		res.sources = append(res.sources, b)
+	}
+
+	if model != nil {
+		model.MakeParentLinks(nil)
+	}
+
+	for i, b := range res.sources {
+		i := i
+		layers := getLayersFromStructModel(model, 0, res.sources, i)
+		hex := hexdumper2.New(b, hexdumper2.Options{
+			StyledLayers:      layers,
+			CursorUnselected:  "hex-byte-unselected",
+			CursorSelected:    "hex-byte-selected",
+			LineNumUnselected: "hex-interval-unselected",
+			LineNumSelected:   "hex-interval-selected",
+			PaletteIfCopying:  "copy-mode",
+		})
+
+		// If the user moves the cursor in the hexdump, this callback will adjust the corresponding
+		// pdml tree/struct widget's currently selected layer. That in turn will result in a callback
+		// to the hex widget to set the active layers.
+		hex.OnPositionChanged(gowid.MakeWidgetCallback("cb", func(app gowid.IApp, target gowid.IWidget) {
+			// If we're not focused on hex, then don't expand the struct widget. That's because if
+			// we're focused on struct, then changing the struct position causes a callback to the
+			// hex to update layers - which can update the hex position - which invokes a callback
+			// to change the struct again. So ultimately, moving the struct moves the hex position
+			// which moves the struct and causes the struct to jump around. I need to check
+			// the alt view too because the user can click with the mouse and in one view have
+			// struct selected but in the other view have hex selected.
+
+			// Propagate the adjustments to pane positions if:
+			// - this was initiated from a non-struct pane e.g. the hex pane. Then we update struct
+			// - this was via an override e.g. search for packet bytes. Then hex is updated on match
+			//   which should then update the struct view
+			if currentlyFocusedViewNotStruct() || allowHexToStructRepositioning {
+				expandStructWidgetAtPosition(row, hex.Position(), res.sources, i, app)
+			}
+
+			// Ensure the behavior is reset after this callback runs. Just do it once.
+			allowHexToStructRepositioning = false
+		}))
+
+		res.hexes = append(res.hexes, hex)
+		res.scrolled = append(res.scrolled, withscrollbar.New(
+			hex,
+			withscrollbar.Options{
+				HideIfContentFits: true,
+			},
+		))
+	}
+
+	res.holder = holder.New(res.scrolled[0])
+
+	if len(res.sources) == 1 {
+		res.IWidget = res.holder
+		return res
+	}
+
+	colws := make([]interface{}, 0)
+	colws = append(colws,
+		text.New(vdiv),
+	)
+	for i, name := range res.names {
+		i := i
+		b := button.NewBare(text.New(fmt.Sprintf(" %s ", name)))
+		b.OnClick(gowid.MakeWidgetCallback("cb", func(app gowid.IApp, w gowid.IWidget) {
+			res.SetSource(i, app)
+		}))
+
+		bs := isselected.NewExt(
+			b,
+			styled.New(b, gowid.MakePaletteRef("button-selected")),
+			styled.New(b, gowid.MakePaletteRef("button-focus")),
+		)
+
+		// Show which data source is on display
+		tab := ifwidget.New(
+			styled.New(bs, gowid.MakeStyledAs(gowid.StyleReverse)),
+			bs,
+			func() bool {
+				return res.cur == i
+			},
+		)
+
+		colws = append(colws, tab, text.New(vdiv))
+	}
+
+	tabs := keepselected.New(columns.NewFixed(colws...))
+
+	res.IWidget = pile.New(
+		[]gowid.IContainerWidget{
+			&gowid.ContainerWidget{
+				IWidget: tabs,
+				D:       gowid.RenderWithUnits{U: 1},
+			},
+			&gowid.ContainerWidget{
+				IWidget: res.holder,
+				D:       gowid.RenderWithWeight{W: 1},
+			},
+		},
+		pile.Options{
+			StartRow: 1,
+		},
+	)
+
+	return res
+}
+
+var _ gowid.IComposite = (*packetHexView)(nil)
+
+func (v *packetHexView) SubWidget() gowid.IWidget {
+	return v.IWidget
+}
+
+// Source returns the index of the data source on display - 0 is the frame.
+func (v *packetHexView) Source() int {
+	return v.cur
+}
+
+// SetSource displays the data source with the index provided.
+func (v *packetHexView) SetSource(source int, app gowid.IApp) {
+	if source < 0 || source >= len(v.hexes) || source == v.cur {
+		return
+	}
+	v.cur = source
+	v.holder.SetSubWidget(v.scrolled[source], app)
+}
+
+// Hex returns the hexdumper2 widget for the data source with the index
+// provided, or the frame's if there's no such source.
+func (v *packetHexView) Hex(source int) *hexdumper2.Widget {
+	if source < 0 || source >= len(v.hexes) {
+		source = 0
+	}
+	return v.hexes[source]
+}
+
+// Sources returns the bytes of each of the packet's data sources, starting
+// with the frame.
+func (v *packetHexView) Sources() [][]byte {
+	return v.sources
+}
+
+//======================================================================
+
+// getHexViewToDisplay returns the hex pane for the packet at the row
+// provided, or nil if its bytes aren't loaded.
+func getHexViewToDisplay(row int) *packetHexView {
+	if val, ok := packetHexWidgets.Get(row); ok {
+		return val.(*packetHexView)
+	}
+
+	var res *packetHexView
+
+	pktsPerLoad := Loader.PacketsPerLoad()
+
+	row2 := (row / pktsPerLoad) * pktsPerLoad
+	if ws, ok := Loader.PacketCache.Get(row2); ok {
+		ce := ws.(pcap.CacheEntry)
+		if len(ce.DataSources) > row%pktsPerLoad && len(ce.DataSources[row%pktsPerLoad]) > 0 {
+			res = newPacketHexView(row, ce.DataSources[row%pktsPerLoad], getCurrentStructModel(row))
+		} else if len(ce.Pcap) > row%pktsPerLoad {
+			res = newPacketHexView(row, []pcap.DataSource{
+				{Name: pcap.FrameSourceName, Data: ce.Pcap[row%pktsPerLoad]},
+			}, getCurrentStructModel(row))
+		}
+	}
+
+	if res != nil {
+		packetHexWidgets.Add(row, res)
+	}
+
+	return res
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 110
+// End:
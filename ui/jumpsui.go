@@ -0,0 +1,202 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+package ui
+
+import (
+	"github.com/gcla/gowid"
+	"github.com/gcla/gowid/widgets/table"
+	"github.com/gcla/termshark/v2/pkg/jumplist"
+	"github.com/gcla/termshark/v2/pkg/pcap"
+)
+
+//======================================================================
+
+// A browser-like history of the places the user jumped from - to a mark, a
+// search hit or a new display filter. ctrl-o or alt-left goes back and
+// alt-right goes forward again.
+
+const maxJumps = 100
+
+var jumps = jumplist.New(maxJumps)
+
+// True while moving through the history, so those moves aren't recorded
+var jumpingInHistory bool
+
+// Selected once the display filter for a move through the history is applied
+var pendingJump *jumplist.Pos
+
+func currentJumpPos() (jumplist.Pos, bool) {
+	if packetListView == nil {
+		return jumplist.Pos{}, false
+	}
+	pn, err := packetNumberFromCurrentTableRow()
+	if err != nil {
+		return jumplist.Pos{}, false
+	}
+	return jumplist.Pos{
+		Filter: Loader.DisplayFilter(),
+		Packet: pn.Pos,
+		Pane:   currentPacketPane(),
+	}, true
+}
+
+// recordJump adds the current position to the history. Call it before
+// jumping elsewhere.
+func recordJump() {
+	if jumpingInHistory {
+		return
+	}
+	if pos, ok := currentJumpPos(); ok {
+		jumps.Add(pos)
+	}
+}
+
+// Runs in app goroutine
+func jumpBack(app gowid.IApp) {
+	cur, ok := currentJumpPos()
+	if !ok {
+		return
+	}
+	if pos, ok := jumps.Back(cur); ok {
+		goToJumpPos(pos, app)
+	}
+}
+
+// Runs in app goroutine
+func jumpForward(app gowid.IApp) {
+	if pos, ok := jumps.Forward(); ok {
+		goToJumpPos(pos, app)
+	}
+}
+
+func goToJumpPos(pos jumplist.Pos, app gowid.IApp) {
+	if pos.Filter == Loader.DisplayFilter() {
+		selectJumpPos(pos, app)
+		return
+	}
+	pendingJump = &pos
+
+	jumpingInHistory = true
+	defer func() {
+		jumpingInHistory = false
+	}()
+	FilterWidget.SetValue(pos.Filter, app)
+	RequestNewFilter(pos.Filter, app)
+}
+
+func selectJumpPos(pos jumplist.Pos, app gowid.IApp) {
+	if packetListView == nil {
+		return
+	}
+
+	jumpingInHistory = true
+	defer func() {
+		jumpingInHistory = false
+	}()
+
+	tableRow, err := tableRowFromPacketNumber(pos.Packet)
+	if err != nil {
+		OpenError(err.Error(), app)
+		return
+	}
+
+	tableCol := 0
+	curTablePos, err := packetListView.FocusXY()
+	if err == nil {
+		tableCol = curTablePos.Column
+	}
+
+	packetListView.SetFocusXY(app, table.Coords{Column: tableCol, Row: tableRow})
+
+	switch pos.Pane {
+	case "struct":
+		setFocusOnPacketStruct(app)
+	case "hex":
+		setFocusOnPacketHex(app)
+	case "list":
+		setFocusOnPacketList(app)
+	}
+}
+
+//======================================================================
+
+// ManageJumps empties the history when a new source is loaded or the packets
+// are cleared, and selects the packet for a move through the history once its
+// display filter is applied.
+type ManageJumps struct{}
+
+var _ pcap.INewSource = ManageJumps{}
+var _ pcap.IClear = ManageJumps{}
+var _ pcap.IAfterEnd = ManageJumps{}
+
+func clearJumps() {
+	jumps.Clear()
+	pendingJump = nil
+}
+
+func (t ManageJumps) OnNewSource(pcap.HandlerCode, gowid.IApp) {
+	clearJumps()
+}
+
+func (t ManageJumps) OnClear(pcap.HandlerCode, gowid.IApp) {
+	clearJumps()
+}
+
+func (t ManageJumps) AfterEnd(code pcap.HandlerCode, app gowid.IApp) {
+	if code&pcap.PsmlCode == 0 || pendingJump == nil {
+		return
+	}
+	pos := *pendingJump
+	pendingJump = nil
+	if pos.Filter == Loader.DisplayFilter() {
+		selectJumpPos(pos, app)
+	}
+}
+
+//======================================================================
+
+// For the Jumps template, like vim's :jumps
+type jumpEntry struct {
+	Current  bool
+	Distance int // from the current position
+	Packet   int
+	Pane     string
+	Filter   string
+}
+
+type getJumps struct{}
+
+func (g getJumps) None() bool {
+	entries, _ := jumps.Entries()
+	return len(entries) == 0
+}
+
+func (g getJumps) Entries() []jumpEntry {
+	entries, idx := jumps.Entries()
+	res := make([]jumpEntry, 0, len(entries)+1)
+	for i, e := range entries {
+		dist := idx - i
+		if dist < 0 {
+			dist = -dist
+		}
+		res = append(res, jumpEntry{
+			Current:  i == idx,
+			Distance: dist,
+			Packet:   e.Packet,
+			Pane:     e.Pane,
+			Filter:   e.Filter,
+		})
+	}
+	if idx == len(entries) {
+		res = append(res, jumpEntry{Current: true})
+	}
+	return res
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 78
+// End:
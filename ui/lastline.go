@@ -13,11 +13,13 @@ import (
 	"strings"
 
 	"github.com/gcla/gowid"
-	"github.com/gcla/gowid/gwutil"
 	"github.com/gcla/gowid/vim"
 	"github.com/gcla/termshark/v2"
 	"github.com/gcla/termshark/v2/configs/profiles"
+	"github.com/gcla/termshark/v2/pkg/extcap"
+	"github.com/gcla/termshark/v2/pkg/shark"
 	"github.com/gcla/termshark/v2/pkg/theme"
+	"github.com/gcla/termshark/v2/widgets/filter"
 	"github.com/gcla/termshark/v2/widgets/mapkeys"
 	"github.com/gcla/termshark/v2/widgets/minibuffer"
 	"github.com/rakyll/statik/fs"
@@ -36,6 +38,14 @@ var invalidMapCommandErr = fmt.Errorf("Invalid map command")
 var invalidFilterCommandErr = fmt.Errorf("Invalid filter command")
 var invalidThemeCommandErr = fmt.Errorf("Invalid theme command")
 var invalidProfileCommandErr = fmt.Errorf("Invalid profile command")
+var invalidTLSCommandErr = fmt.Errorf("Invalid tls command")
+var invalidFilterBuilderCommandErr = fmt.Errorf("Invalid build-filter command")
+var invalidFilterButtonCommandErr = fmt.Errorf("Invalid filter-button command")
+var invalidColorizeCommandErr = fmt.Errorf("Invalid colorize command")
+var invalidCaptureOptionsCommandErr = fmt.Errorf("Invalid capture-opts command")
+var invalidExtcapCommandErr = fmt.Errorf("Invalid extcap command")
+var invalidSourceCommandErr = fmt.Errorf("Invalid source command")
+var invalidSessionCommandErr = fmt.Errorf("Invalid session command")
 
 type minibufferFn func(gowid.IApp, ...string) error
 
@@ -51,6 +61,20 @@ func (m minibufferFn) Arguments([]string, gowid.IApp) []minibuffer.IArg {
 	return nil
 }
 
+// cmdlineHistory saves the commands run in the minibuffer in the current
+// profile.
+type cmdlineHistory struct{}
+
+var _ minibuffer.IHistory = cmdlineHistory{}
+
+func (h cmdlineHistory) Entries() []string {
+	return profiles.ConfStrings("main.cmdline-history")
+}
+
+func (h cmdlineHistory) Add(line string) {
+	termshark.AddToCmdlineHistory(line)
+}
+
 type quietMinibufferFn func(gowid.IApp, ...string) error
 
 func (m quietMinibufferFn) Run(app gowid.IApp, args ...string) error {
@@ -114,19 +138,8 @@ func newOnOffArg(sub string) substrArg {
 
 func newSetArg(sub string) substrArg {
 	return substrArg{
-		sub: sub,
-		candidates: []string{
-			"auto-scroll",
-			"copy-command-timeout",
-			"dark-mode",
-			"disable-shark-fin",
-			"packet-colors",
-			"pager",
-			"nopager",
-			"suppress-tshark-errors",
-			"term",
-			"noterm",
-		},
+		sub:        sub,
+		candidates: profiles.SettingNames(),
 	}
 }
 
@@ -155,6 +168,61 @@ func newProfileArg(sub string) substrArg {
 	}
 }
 
+func newSessionArg(sub string) substrArg {
+	return substrArg{
+		sub: sub,
+		candidates: []string{
+			"save",
+			"load",
+			"delete",
+			"list",
+		},
+	}
+}
+
+func newFilterBuilderArg(sub string) substrArg {
+	return substrArg{
+		sub: sub,
+		candidates: []string{
+			"display",
+			"search",
+		},
+	}
+}
+
+func newColorizeArg(sub string) substrArg {
+	return substrArg{
+		sub: sub,
+		candidates: []string{
+			"1", "2", "3", "4", "5", "6", "7", "8", "9", "10",
+			"clear",
+		},
+	}
+}
+
+func newFilterButtonArg(sub string) substrArg {
+	return substrArg{
+		sub: sub,
+		candidates: []string{
+			"add",
+			"apply",
+			"delete",
+			"edit",
+		},
+	}
+}
+
+func newTLSArg(sub string) substrArg {
+	return substrArg{
+		sub: sub,
+		candidates: []string{
+			"env",
+			"keylog",
+			"off",
+		},
+	}
+}
+
 //======================================================================
 
 type unhelpfulArg struct {
@@ -338,97 +406,174 @@ func (s profileArg) Completions() []string {
 
 //======================================================================
 
-func stringIn(s string, a []string) bool {
-	for _, s2 := range a {
-		if s == s2 {
-			return true
-		}
+// settingHook lets a setting be checked further, or applied to the running
+// UI, when changed with :set.
+type settingHook struct {
+	validate func(val interface{}) error
+	apply    func(val interface{}, app gowid.IApp)
+}
+
+var settingHooks = map[string]settingHook{
+	"auto-scroll": {
+		apply: func(val interface{}, app gowid.IApp) {
+			AutoScroll = val.(bool)
+		},
+	},
+	"dark-mode": {
+		apply: func(val interface{}, app gowid.IApp) {
+			SetDarkMode(val.(bool))
+		},
+	},
+	"packet-colors": {
+		apply: func(val interface{}, app gowid.IApp) {
+			PacketColors = val.(bool)
+			updateColorRuleMatches(true, app)
+		},
+	},
+	"term": {
+		validate: func(val interface{}) error {
+			return termshark.ValidateTerm(val.(string))
+		},
+	},
+	"tls-keylog-file": {
+		apply: func(val interface{}, app gowid.IApp) {
+			RequestReload(app)
+		},
+	},
+	"tls-keylog-from-env": {
+		apply: func(val interface{}, app gowid.IApp) {
+			RequestReload(app)
+		},
+	},
+	"wireshark-profile": {
+		validate: func(val interface{}) error {
+			if val.(string) != "" && !termshark.StringInSlice(val.(string), termshark.WiresharkProfileNames()) {
+				return fmt.Errorf("%s is not a valid Wireshark profile", val.(string))
+			}
+			return nil
+		},
+		// As for profile link
+		apply: func(val interface{}, app gowid.IApp) {
+			RequestReload(app)
+		},
+	},
+}
+
+// Names accepted by :set before every setting could be changed
+var settingAliases = map[string]string{
+	"copy-timeout": "copy-command-timeout",
+}
+
+func lookupSetting(name string) (profiles.Setting, bool) {
+	if alias, ok := settingAliases[name]; ok {
+		name = alias
 	}
-	return false
+	return profiles.LookupSetting(name)
+}
+
+func settingChangedMessage(s profiles.Setting, val interface{}) string {
+	msg := fmt.Sprintf("%s is now %s", s.Name, s.Format(val))
+	if s.Restart {
+		msg += "\n(Requires restart)"
+	}
+	return msg
 }
 
-func parseOnOff(str string) (bool, error) {
-	switch str {
-	case "on", "ON", "On":
-		return true, nil
-	case "off", "OFF", "Off":
-		return false, nil
+func describeSetting(s profiles.Setting) string {
+	val := s.Current()
+	def := "(default)"
+	if !s.IsDefault(val) {
+		def = fmt.Sprintf("(default is %s)", s.Format(s.Default))
+	}
+	res := fmt.Sprintf("%s = %s %s\n\n%s.\nType: %s", s.Name, s.Format(val), def, s.Description, s.Type)
+	if s.EditWith != "" {
+		res += fmt.Sprintf("\nChanged with %s.", s.EditWith)
+	} else if s.Restart {
+		res += "\nChanges need a restart."
 	}
-	return false, strconv.ErrSyntax
+	return res
+}
+
+// changedSettings lists each setting that does not have its default value
+func changedSettings() string {
+	lines := make([]string, 0)
+	for _, s := range profiles.Settings {
+		if val := s.Current(); !s.IsDefault(val) {
+			if s.EditWith != "" {
+				// These lists can be long - see set <key>?
+				lines = append(lines, fmt.Sprintf("%s = (%d entries)", s.Name, len(val.([]string))))
+			} else {
+				lines = append(lines, fmt.Sprintf("%s = %s", s.Name, s.Format(val)))
+			}
+		}
+	}
+	if len(lines) == 0 {
+		return "All settings have their default values."
+	}
+	return strings.Join(lines, "\n")
 }
 
 type setCommand struct{}
 
 var _ minibuffer.IAction = setCommand{}
 
+// set                 - show the settings changed from their defaults
+// set <key>?          - show a setting's value
+// set <key> <val>...  - change a setting
+// set <bool-key>      - turn a setting on
+// set no<key>         - return a setting to its default
 func (d setCommand) Run(app gowid.IApp, args ...string) error {
 	var err error
-	var b bool
-	var i uint64
-	switch len(args) {
-	case 3:
-		switch args[1] {
-		case "auto-scroll":
-			if b, err = parseOnOff(args[2]); err == nil {
-				AutoScroll = b
-				profiles.SetConf("main.auto-scroll", AutoScroll)
-				OpenMessage(fmt.Sprintf("Packet auto-scroll is now %s", gwutil.If(b, "on", "off").(string)), appView, app)
-			}
-		case "copy-timeout":
-			if i, err = strconv.ParseUint(args[2], 10, 32); err == nil {
-				profiles.SetConf("main.copy-command-timeout", i)
-				OpenMessage(fmt.Sprintf("Copy timeout is now %ds", i), appView, app)
-			}
-		case "dark-mode":
-			if b, err = parseOnOff(args[2]); err == nil {
-				SetDarkMode(b)
-			}
-		case "disable-shark-fin":
-			if b, err = strconv.ParseBool(args[2]); err == nil {
-				profiles.SetConf("main.disable-shark-fin", DarkMode)
-				OpenMessage(fmt.Sprintf("Shark-saver is now %s", gwutil.If(b, "off", "on").(string)), appView, app)
-			}
-		case "packet-colors":
-			if b, err = parseOnOff(args[2]); err == nil {
-				PacketColors = b
-				profiles.SetConf("main.packet-colors", PacketColors)
-				OpenMessage(fmt.Sprintf("Packet colors are now %s", gwutil.If(b, "on", "off").(string)), appView, app)
+
+	if len(args) == 1 {
+		commandMessage(changedSettings(), app)
+		return nil
+	}
+
+	name := args[1]
+	vals := args[2:]
+
+	if strings.HasSuffix(name, "?") && len(args) == 2 {
+		if s, ok := lookupSetting(strings.TrimSuffix(name, "?")); ok {
+			commandMessage(describeSetting(s), app)
+		} else {
+			err = fmt.Errorf("Unknown setting %s", strings.TrimSuffix(name, "?"))
+		}
+	} else if s, ok := lookupSetting(name); ok {
+		var val interface{}
+		if len(vals) == 0 && s.Type == profiles.BoolSetting {
+			vals = []string{"true"}
+		}
+		if val, err = s.Parse(vals); err == nil {
+			hook := settingHooks[s.Name]
+			if hook.validate != nil {
+				err = hook.validate(val)
 			}
-		case "suppress-tshark-errors":
-			if b, err = parseOnOff(args[2]); err == nil {
-				profiles.SetConf("main.suppress-tshark-errors", b)
-				if b {
-					OpenMessage("tshark errors will be suppressed.", appView, app)
-				} else {
-					OpenMessage("tshark errors will be displayed.", appView, app)
+			if err == nil {
+				profiles.SetConf(s.Key(), val)
+				if hook.apply != nil {
+					hook.apply(val, app)
 				}
+				commandMessage(settingChangedMessage(s, val), app)
 			}
-		case "term":
-			if err = termshark.ValidateTerm(args[2]); err == nil {
-				profiles.SetConf("main.term", args[2])
-				OpenMessage(fmt.Sprintf("Terminal type is now %s\n(Requires restart)", args[2]), appView, app)
-			}
-		case "pager":
-			profiles.SetConf("main.pager", args[2])
-			OpenMessage(fmt.Sprintf("Pager is now %s", args[2]), appView, app)
-		default:
-			err = invalidSetCommandErr
 		}
-	case 2:
-		switch args[1] {
-		case "noterm":
-			profiles.DeleteConf("main.term")
-			OpenMessage("Terminal type is now unset\n(Requires restart)", appView, app)
-		case "nopager":
-			profiles.DeleteConf("main.pager")
-			OpenMessage("Pager is now unset", appView, app)
-		default:
-			err = invalidSetCommandErr
+	} else if s, ok := lookupSetting(strings.TrimPrefix(name, "no")); ok && strings.HasPrefix(name, "no") && len(vals) == 0 {
+		if s.EditWith != "" {
+			err = fmt.Errorf("%s is changed with %s", s.Name, s.EditWith)
+		} else {
+			s.Reset()
+			val := s.Current()
+			if hook := settingHooks[s.Name]; hook.apply != nil {
+				hook.apply(val, app)
+			}
+			commandMessage(settingChangedMessage(s, val), app)
 		}
+	} else {
+		err = invalidSetCommandErr
 	}
 
 	if err != nil {
-		OpenMessage(fmt.Sprintf("Error: %s", err), appView, app)
+		commandError(err, app)
 	}
 
 	return err
@@ -442,22 +587,30 @@ func (d setCommand) Arguments(toks []string, app gowid.IApp) []minibuffer.IArg {
 	res := make([]minibuffer.IArg, 0)
 	res = append(res, newSetArg(toks[0]))
 
-	if len(toks) > 0 {
-		onOffCmds := []string{"auto-scroll", "dark-mode", "packet-colors", "suppress-tshark-errors"}
-		boolCmds := []string{"disable-shark-fin"}
-		intCmds := []string{"disk-cache-size-mb", "copy-command-timeout"}
+	s, ok := lookupSetting(toks[0])
+	if !ok {
+		return res
+	}
 
+	// A list takes any number of values; complete each of them
+	n := 1
+	if s.Type == profiles.StringListSetting && len(toks) > 2 {
+		n = len(toks) - 1
+	}
+
+	for i := 1; i <= n; i++ {
 		pref := ""
-		if len(toks) > 1 {
-			pref = toks[1]
+		if len(toks) > i {
+			pref = toks[i]
 		}
 
-		if stringIn(toks[0], boolCmds) {
-			res = append(res, newBoolArg(pref))
-		} else if stringIn(toks[0], intCmds) {
-			res = append(res, unhelpfulArg{})
-		} else if stringIn(toks[0], onOffCmds) {
+		switch {
+		case s.Type == profiles.BoolSetting:
 			res = append(res, newOnOffArg(pref))
+		case len(s.Choices) > 0:
+			res = append(res, newCachedArg(pref, s.Choices))
+		default:
+			res = append(res, unhelpfulArg{})
 		}
 	}
 
@@ -482,7 +635,7 @@ func (d readCommand) Run(app gowid.IApp, args ...string) error {
 	}
 
 	if err != nil {
-		OpenMessage(fmt.Sprintf("Error: %s", err), appView, app)
+		commandError(err, app)
 	}
 
 	return err
@@ -504,6 +657,42 @@ func (d readCommand) Arguments(toks []string, app gowid.IApp) []minibuffer.IArg
 
 //======================================================================
 
+type sourceCommand struct{}
+
+var _ minibuffer.IAction = sourceCommand{}
+
+func (d sourceCommand) Run(app gowid.IApp, args ...string) error {
+	var err error
+
+	if len(args) != 2 {
+		err = invalidSourceCommandErr
+		commandError(err, app)
+	} else if scriptDepth > 0 {
+		// A script sourced from a script is reported by the outermost
+		err = runScript(args[1], app)
+	} else {
+		err = runScriptReportingErrors(args[1], app)
+	}
+
+	return err
+}
+
+func (d sourceCommand) OfferCompletion() bool {
+	return true
+}
+
+func (d sourceCommand) Arguments(toks []string, app gowid.IApp) []minibuffer.IArg {
+	res := make([]minibuffer.IArg, 0)
+	pref := ""
+	if len(toks) > 0 {
+		pref = toks[0]
+	}
+	res = append(res, fileArg{substr: pref})
+	return res
+}
+
+//======================================================================
+
 type recentsCommand struct{}
 
 var _ minibuffer.IAction = recentsCommand{}
@@ -518,7 +707,7 @@ func (d recentsCommand) Run(app gowid.IApp, args ...string) error {
 	}
 
 	if err != nil {
-		OpenMessage(fmt.Sprintf("Error: %s", err), appView, app)
+		commandError(err, app)
 	}
 
 	return err
@@ -549,13 +738,32 @@ func (d filterCommand) Run(app gowid.IApp, args ...string) error {
 
 	if len(args) != 2 {
 		err = invalidFilterCommandErr
+	} else if scriptDepth > 0 {
+		// There's no one to hit enter in a script, so apply the filter. If tshark
+		// has to check it, the filter is applied - or the problem reported - once
+		// it's done.
+		applyFilter := func(err error, app gowid.IApp) {
+			if err != nil {
+				OpenError(fmt.Sprintf("Invalid filter %s: %v", args[1], err), app)
+				return
+			}
+			FilterWidget.SetValue(args[1], app)
+			if !Loader.Empty() {
+				RequestNewFilter(args[1], app)
+			}
+		}
+		if args[1] == "" {
+			applyFilter(nil, app)
+		} else {
+			filter.CheckDisplayFilterThen(args[1], FieldCompleter, app, applyFilter)
+		}
 	} else {
 		setFocusOnDisplayFilter(app)
 		FilterWidget.SetValue(args[1], app)
 	}
 
 	if err != nil {
-		OpenMessage(fmt.Sprintf("Error: %s", err), appView, app)
+		commandError(err, app)
 	}
 
 	return err
@@ -594,11 +802,11 @@ func (d themeCommand) Run(app gowid.IApp, args ...string) error {
 		profiles.SetConf(fmt.Sprintf("main.theme-%s", mode), args[1])
 		theme.Load(args[1], app)
 		SetupColors()
-		OpenMessage(fmt.Sprintf("Set %s theme for terminal mode %v.", args[1], app.GetColorMode()), appView, app)
+		commandMessage(fmt.Sprintf("Set %s theme for terminal mode %v.", args[1], app.GetColorMode()), app)
 	}
 
 	if err != nil {
-		OpenMessage(fmt.Sprintf("Error: %s", err), appView, app)
+		commandError(err, app)
 	}
 
 	return err
@@ -661,7 +869,7 @@ func (d profileCommand) Run(app gowid.IApp, args ...string) error {
 				err = ApplyCurrentProfile(app, cur, profiles.Current())
 			}
 			if err == nil {
-				OpenMessage(fmt.Sprintf("Now using profile %s.", args[2]), appView, app)
+				commandMessage(fmt.Sprintf("Now using profile %s.", args[2]), app)
 			}
 		case "link":
 			// gcla later todo - need to validate it is in list!
@@ -697,12 +905,12 @@ func (d profileCommand) Run(app gowid.IApp, args ...string) error {
 					if err == nil {
 						msg := fmt.Sprintf("Profile %s deleted.", args[2])
 						if curName == args[2] {
-							OpenMessage(fmt.Sprintf("%s Switched back to default profile.", msg), appView, app)
+							commandMessage(fmt.Sprintf("%s Switched back to default profile.", msg), app)
 						} else {
-							OpenMessage(msg, appView, app)
+							commandMessage(msg, app)
 						}
 					} else if err != nil {
-						OpenMessage(fmt.Sprintf("Error: %s", err), appView, app)
+						commandError(err, app)
 					}
 				},
 				app,
@@ -727,7 +935,7 @@ func (d profileCommand) Run(app gowid.IApp, args ...string) error {
 	}
 
 	if err != nil {
-		OpenMessage(fmt.Sprintf("Error: %s", err), appView, app)
+		commandError(err, app)
 	}
 
 	return err
@@ -764,25 +972,422 @@ func (d profileCommand) Arguments(toks []string, app gowid.IApp) []minibuffer.IA
 
 //======================================================================
 
+type sessionCommand struct {
+	names []string // for completion
+}
+
+var _ minibuffer.IAction = sessionCommand{}
+
+func newSessionCommand() *sessionCommand {
+	return &sessionCommand{
+		names: sessionNames(),
+	}
+}
+
+func (d sessionCommand) Run(app gowid.IApp, args ...string) error {
+	var err error
+
+	switch len(args) {
+	case 3:
+		switch args[1] {
+		case "save":
+			err = saveSession(args[2])
+			if err == nil {
+				commandMessage(fmt.Sprintf("Session %s saved.", args[2]), app)
+			}
+		case "load":
+			err = loadSession(args[2], app)
+		case "delete":
+			if !termshark.StringInSlice(args[2], sessionNames()) {
+				err = fmt.Errorf("No session named %s", args[2])
+				break
+			}
+			confirmAction(
+				fmt.Sprintf("Really delete session %s?", args[2]),
+				func(app gowid.IApp) {
+					if err := deleteSession(args[2]); err != nil {
+						commandError(err, app)
+					} else {
+						commandMessage(fmt.Sprintf("Session %s deleted.", args[2]), app)
+					}
+				},
+				app,
+			)
+		default:
+			err = invalidSessionCommandErr
+		}
+	case 1, 2:
+		if len(args) == 2 && args[1] != "list" {
+			err = invalidSessionCommandErr
+			break
+		}
+		if names := sessionNames(); len(names) == 0 {
+			commandMessage("No sessions are saved.", app)
+		} else {
+			commandMessage(fmt.Sprintf("Saved sessions:\n\n%s", strings.Join(names, "\n")), app)
+		}
+	default:
+		err = invalidSessionCommandErr
+	}
+
+	if err != nil {
+		commandError(err, app)
+	}
+
+	return err
+}
+
+func (d sessionCommand) OfferCompletion() bool {
+	return true
+}
+
+func (d sessionCommand) Arguments(toks []string, app gowid.IApp) []minibuffer.IArg {
+	res := make([]minibuffer.IArg, 0)
+	res = append(res, newSessionArg(toks[0]))
+
+	if len(toks) > 0 {
+		pref := ""
+		if len(toks) > 1 {
+			pref = toks[1]
+		}
+
+		switch toks[0] {
+		case "save", "load", "delete":
+			res = append(res, newCachedArg(pref, d.names))
+		}
+	}
+
+	return res
+}
+
+//======================================================================
+
+type tlsCommand struct{}
+
+var _ minibuffer.IAction = tlsCommand{}
+
+func (d tlsCommand) Run(app gowid.IApp, args ...string) error {
+	var err error
+
+	switch len(args) {
+	case 1:
+		openTLSKeylog(app)
+	case 2:
+		switch args[1] {
+		case "env":
+			err = setTLSKeylog("", true, app)
+		case "off":
+			err = setTLSKeylog("", false, app)
+		default:
+			err = invalidTLSCommandErr
+		}
+	case 3:
+		switch args[1] {
+		case "keylog":
+			err = setTLSKeylog(args[2], false, app)
+		default:
+			err = invalidTLSCommandErr
+		}
+	default:
+		err = invalidTLSCommandErr
+	}
+
+	if err != nil {
+		commandError(err, app)
+	}
+
+	return err
+}
+
+func (d tlsCommand) OfferCompletion() bool {
+	return true
+}
+
+func (d tlsCommand) Arguments(toks []string, app gowid.IApp) []minibuffer.IArg {
+	res := make([]minibuffer.IArg, 0)
+	res = append(res, newTLSArg(toks[0]))
+
+	if len(toks) > 1 && toks[0] == "keylog" {
+		res = append(res, fileArg{substr: toks[1]})
+	}
+
+	return res
+}
+
+//======================================================================
+
+type filterBuilderCommand struct{}
+
+var _ minibuffer.IAction = filterBuilderCommand{}
+
+func (d filterBuilderCommand) Run(app gowid.IApp, args ...string) error {
+	var err error
+
+	switch len(args) {
+	case 1:
+		openFilterBuilder(displayFilterTarget, app)
+	case 2:
+		switch args[1] {
+		case "display":
+			openFilterBuilder(displayFilterTarget, app)
+		case "search":
+			openFilterBuilder(searchFilterTarget, app)
+		default:
+			err = invalidFilterBuilderCommandErr
+		}
+	default:
+		err = invalidFilterBuilderCommandErr
+	}
+
+	if err != nil {
+		commandError(err, app)
+	}
+
+	return err
+}
+
+func (d filterBuilderCommand) OfferCompletion() bool {
+	return true
+}
+
+func (d filterBuilderCommand) Arguments(toks []string, app gowid.IApp) []minibuffer.IArg {
+	res := make([]minibuffer.IArg, 0)
+	res = append(res, newFilterBuilderArg(toks[0]))
+	return res
+}
+
+//======================================================================
+
+type filterButtonCommand struct{}
+
+var _ minibuffer.IAction = filterButtonCommand{}
+
+func (d filterButtonCommand) Run(app gowid.IApp, args ...string) error {
+	var err error
+
+	switch len(args) {
+	case 1:
+		setFocusOnDisplayFilter(app)
+		openFilterButtonsMenu(app)
+	case 2:
+		switch args[1] {
+		case "add":
+			openFilterButtonEditor("", app)
+		default:
+			err = invalidFilterButtonCommandErr
+		}
+	case 3:
+		b, ok := findFilterButton(args[2])
+		switch {
+		case args[1] == "add":
+			if ok {
+				err = fmt.Errorf("There is already a filter button labelled %s", args[2])
+			} else {
+				openFilterButtonEditor(args[2], app)
+			}
+		case args[1] != "apply" && args[1] != "edit" && args[1] != "delete":
+			err = invalidFilterButtonCommandErr
+		case !ok:
+			err = fmt.Errorf("No filter button is labelled %s", args[2])
+		case args[1] == "apply":
+			applyFilterButton(b.Expression, app)
+		case args[1] == "edit":
+			openFilterButtonEditor(args[2], app)
+		case args[1] == "delete":
+			err = deleteFilterButton(args[2])
+		}
+	default:
+		err = invalidFilterButtonCommandErr
+	}
+
+	if err != nil {
+		commandError(err, app)
+	}
+
+	return err
+}
+
+func (d filterButtonCommand) OfferCompletion() bool {
+	return true
+}
+
+func (d filterButtonCommand) Arguments(toks []string, app gowid.IApp) []minibuffer.IArg {
+	res := make([]minibuffer.IArg, 0)
+	res = append(res, newFilterButtonArg(toks[0]))
+
+	if len(toks) > 1 {
+		switch toks[0] {
+		case "apply", "edit", "delete":
+			res = append(res, newCachedArg(toks[1], filterButtonLabels()))
+		}
+	}
+
+	return res
+}
+
+//======================================================================
+
+type colorizeCommand struct{}
+
+var _ minibuffer.IAction = colorizeCommand{}
+
+func (d colorizeCommand) Run(app gowid.IApp, args ...string) error {
+	var err error
+
+	switch len(args) {
+	case 1:
+		err = colorizeConversation(0, app)
+	case 2:
+		if args[1] == "clear" {
+			clearTempColorRules(app)
+		} else if n, err2 := strconv.Atoi(args[1]); err2 == nil {
+			err = colorizeConversation(n, app)
+		} else {
+			err = invalidColorizeCommandErr
+		}
+	default:
+		err = invalidColorizeCommandErr
+	}
+
+	if err != nil {
+		commandError(err, app)
+	}
+
+	return err
+}
+
+func (d colorizeCommand) OfferCompletion() bool {
+	return true
+}
+
+func (d colorizeCommand) Arguments(toks []string, app gowid.IApp) []minibuffer.IArg {
+	res := make([]minibuffer.IArg, 0)
+	res = append(res, newColorizeArg(toks[0]))
+	return res
+}
+
+//======================================================================
+
+type captureOptionsCommand struct{}
+
+var _ minibuffer.IAction = captureOptionsCommand{}
+
+func (d captureOptionsCommand) Run(app gowid.IApp, args ...string) error {
+	var err error
+
+	switch len(args) {
+	case 1:
+		openCaptureOptionsUi("", app)
+	case 2:
+		openCaptureOptionsUi(args[1], app)
+	default:
+		err = invalidCaptureOptionsCommandErr
+	}
+
+	if err != nil {
+		commandError(err, app)
+	}
+
+	return err
+}
+
+func (d captureOptionsCommand) OfferCompletion() bool {
+	return true
+}
+
+func (d captureOptionsCommand) Arguments(toks []string, app gowid.IApp) []minibuffer.IArg {
+	res := make([]minibuffer.IArg, 0)
+	ifaces := Loader.Interfaces()
+	for _, opts := range shark.GetAllCaptureOptions() {
+		if !termshark.StringInSlice(opts.Interface, ifaces) {
+			ifaces = append(ifaces, opts.Interface)
+		}
+	}
+	res = append(res, newCachedArg(toks[0], ifaces))
+	return res
+}
+
+//======================================================================
+
+type extcapCommand struct{}
+
+var _ minibuffer.IAction = extcapCommand{}
+
+func (d extcapCommand) Run(app gowid.IApp, args ...string) error {
+	var err error
+
+	switch len(args) {
+	case 1:
+		openExtcapUi("", app)
+	case 2:
+		openExtcapUi(args[1], app)
+	default:
+		err = invalidExtcapCommandErr
+	}
+
+	if err != nil {
+		commandError(err, app)
+	}
+
+	return err
+}
+
+func (d extcapCommand) OfferCompletion() bool {
+	return true
+}
+
+func (d extcapCommand) Arguments(toks []string, app gowid.IApp) []minibuffer.IArg {
+	res := make([]minibuffer.IArg, 0)
+	ifaces := extcap.ConfiguredInterfaces()
+	for _, intf := range extcapInterfaces {
+		if !termshark.StringInSlice(intf.Name, ifaces) {
+			ifaces = append(ifaces, intf.Name)
+		}
+	}
+	res = append(res, newCachedArg(toks[0], ifaces))
+	return res
+}
+
+//======================================================================
+
 type mapCommand struct {
 	w *mapkeys.Widget
 }
 
 var _ minibuffer.IAction = mapCommand{}
 
+func checkKeyMappingView(view string) error {
+	if !termshark.StringInSlice(view, keyMappingViewNames) {
+		return fmt.Errorf("Unknown view '%s' - expected one of %s", view, strings.Join(keyMappingViewNames, ", "))
+	}
+	return nil
+}
+
+// map                      - show mappings
+// map <key> <keys>         - map key in every view
+// map <view> <key> <keys>  - map key only when view has focus
 func (d mapCommand) Run(app gowid.IApp, args ...string) error {
 	var err error
 
+	view := ""
+	if len(args) == 4 {
+		view = args[1]
+		args = []string{args[0], args[2], args[3]}
+	}
+
 	if len(args) == 3 {
 		key1 := vim.VimStringToKeys(args[1])
 		if len(key1) != 1 {
 			err = fmt.Errorf("Invalid: first map argument must be a single key (got '%s')", args[1])
-		} else {
+		} else if view != "" {
+			err = checkKeyMappingView(view)
+		}
+		if err == nil {
 			keys2 := vim.VimStringToKeys(args[2])
-			termshark.AddKeyMapping(termshark.KeyMapping{From: key1[0], To: keys2})
+			termshark.AddKeyMapping(termshark.KeyMapping{View: view, From: key1[0], To: keys2})
 			mappings := termshark.LoadKeyMappings()
 			for _, mapping := range mappings {
-				d.w.AddMapping(mapping.From, mapping.To, app)
+				applyKeyMapping(d.w, mapping, app)
 			}
 		}
 	} else if len(args) == 1 {
@@ -792,7 +1397,7 @@ func (d mapCommand) Run(app gowid.IApp, args ...string) error {
 	}
 
 	if err != nil {
-		OpenMessage(fmt.Sprintf("Error: %s", err), appView, app)
+		commandError(err, app)
 	}
 
 	return err
@@ -804,7 +1409,8 @@ func (d mapCommand) OfferCompletion() bool {
 
 func (d mapCommand) Arguments(toks []string, app gowid.IApp) []minibuffer.IArg {
 	res := make([]minibuffer.IArg, 0)
-	if len(toks) == 2 {
+	res = append(res, newCachedArg(toks[0], keyMappingViewNames))
+	if len(toks) > 1 {
 		res = append(res, unhelpfulArg{}, unhelpfulArg{})
 	}
 	return res
@@ -818,23 +1424,38 @@ type unmapCommand struct {
 
 var _ minibuffer.IAction = unmapCommand{}
 
+// unmap <key>         - remove the mapping for every view
+// unmap <view> <key>  - remove the mapping for view
 func (d unmapCommand) Run(app gowid.IApp, args ...string) error {
 	var err error
 
+	view := ""
+	if len(args) == 3 {
+		view = args[1]
+		args = []string{args[0], args[2]}
+	}
+
 	if len(args) != 2 {
 		err = invalidMapCommandErr
 	} else {
 		key1 := vim.VimStringToKeys(args[1])
-		d.w.ClearMappings(app)
-		termshark.RemoveKeyMapping(key1[0])
-		mappings := termshark.LoadKeyMappings()
-		for _, mapping := range mappings {
-			d.w.AddMapping(mapping.From, mapping.To, app)
+		if len(key1) != 1 {
+			err = fmt.Errorf("Invalid: unmap argument must be a single key (got '%s')", args[1])
+		} else if view != "" {
+			err = checkKeyMappingView(view)
+		}
+		if err == nil {
+			d.w.ClearMappings(app)
+			termshark.RemoveKeyMapping(view, key1[0])
+			mappings := termshark.LoadKeyMappings()
+			for _, mapping := range mappings {
+				applyKeyMapping(d.w, mapping, app)
+			}
 		}
 	}
 
 	if err != nil {
-		OpenMessage(fmt.Sprintf("Error: %s", err), appView, app)
+		commandError(err, app)
 	}
 
 	return err
@@ -846,7 +1467,10 @@ func (d unmapCommand) OfferCompletion() bool {
 
 func (d unmapCommand) Arguments(toks []string, app gowid.IApp) []minibuffer.IArg {
 	res := make([]minibuffer.IArg, 0)
-	res = append(res, unhelpfulArg{})
+	res = append(res, newCachedArg(toks[0], keyMappingViewNames))
+	if len(toks) > 1 {
+		res = append(res, unhelpfulArg{})
+	}
 	return res
 }
 
@@ -0,0 +1,106 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+package ui
+
+import (
+	"fmt"
+
+	"github.com/gcla/gowid"
+	"github.com/gcla/gowid/widgets/text"
+	"github.com/gcla/termshark/v2"
+	"github.com/gdamore/tcell/v2"
+)
+
+//======================================================================
+
+// Vim-style macros - qa starts recording keys into register a, q stops, and @a
+// plays them back. The keys are recorded by keyMapper, before mappings are
+// applied, and saved in the profile. Recording is turned on with
+// main.record-macros, since otherwise q opens the quit dialog.
+
+var macroRegister rune     // the register being recorded into, or 0
+var lastMacroRegister rune // for @@
+var macroIndicator *text.Widget
+
+func isMacroRegister(r rune) bool {
+	return r >= 'a' && r <= 'z'
+}
+
+// Runs in app goroutine
+func startMacroRecording(reg rune, app gowid.IApp) {
+	macroRegister = reg
+	keyMapper.StartRecording(app)
+	updateMacroIndicator(app)
+}
+
+// Runs in app goroutine
+func stopMacroRecording(app gowid.IApp) {
+	macros := termshark.LoadMacros()
+	macros[macroRegister] = keyMapper.StopRecording(app)
+	termshark.SaveMacros(macros)
+	macroRegister = 0
+	updateMacroIndicator(app)
+}
+
+// playMacro plays the keys in register reg count times. @@ plays the register
+// played last.
+//
+// Runs in app goroutine
+func playMacro(reg rune, count int, app gowid.IApp) {
+	if reg == '@' {
+		if lastMacroRegister == 0 {
+			OpenError("No macro has been played yet.", app)
+			return
+		}
+		reg = lastMacroRegister
+	}
+	seq, ok := termshark.LoadMacros()[reg]
+	if !ok {
+		OpenError(fmt.Sprintf("No macro is recorded in register %c.", reg), app)
+		return
+	}
+	lastMacroRegister = reg
+	for i := 0; i < count; i++ {
+		keyMapper.Play(seq, app)
+	}
+}
+
+// macroKeyPress handles the key after q or @. After q, anything but a register
+// opens the quit dialog, as q did before macros.
+func macroKeyPress(evk *tcell.EventKey, prior termshark.KeyState, app gowid.IApp) {
+	isrune := evk.Key() == tcell.KeyRune
+	if prior.PartialqCmd {
+		if isrune && isMacroRegister(evk.Rune()) {
+			startMacroRecording(evk.Rune(), app)
+		} else {
+			reallyQuit(app)
+		}
+	} else if prior.PartialAtCmd {
+		if isrune && (isMacroRegister(evk.Rune()) || evk.Rune() == '@') {
+			count := 1
+			if prior.NumberPrefix > 0 {
+				count = prior.NumberPrefix
+			}
+			playMacro(evk.Rune(), count, app)
+		}
+	}
+}
+
+func updateMacroIndicator(app gowid.IApp) {
+	if macroIndicator == nil {
+		return
+	}
+	if macroRegister == 0 {
+		macroIndicator.SetText("", app)
+	} else {
+		macroIndicator.SetText(fmt.Sprintf(" recording @%c ", macroRegister), app)
+	}
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 78
+// End:
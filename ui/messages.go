@@ -70,6 +70,8 @@ A wireshark-inspired tui for tshark. Analyze network traffic interactively from
 /__ - Go to display filter/stream search
 q__ - Quit
 tab - Switch panes
+C-p - Search all menus and commands
+C-s - Freeze/resume the live packet list
 c__ - Switch to copy-mode
 |__ - Cycle through pane layouts
 \__ - Toggle pane zoom
@@ -101,7 +103,14 @@ ma_____ - Mark current packet (use a through z)
 mA_____ - Mark current packet + pcap (use A through Z)
 'A_____ - Jump to packet + pcap marked 'A'
 ''_____ - After a jump; jump back to prior packet
+C-o____ - Go back through the jump history (or alt-left)
+A-right - Go forward through the jump history
+3C_____ - Colorize the selected conversation with color 3
 ZZ_____ - Quit without confirmation
+qa_____ - Record keys into macro a (q again to stop; set record-macros first)
+@a_____ - Play macro a
+3@a____ - Play macro a 3 times
+@@_____ - Play the last macro again
 
 See also help cmdline.{{end}}
 
@@ -111,45 +120,63 @@ Activate cmdline mode with the : key.
 
 Hit tab to see and choose possible completions.
 
+build-filter_ - Build a display filter expression from fields
 capinfo______ - Capture file properties
+capstats_____ - Live capture statistics - packets received, dropped etc
+capture-opts_ - Set snaplen, promiscuous mode etc for an interface
+cfilter______ - Check a capture filter, show its BPF and apply it
 clear-filter_ - Clear the display filter and apply
 clear-packets - Clear the current pcap
+color-rules__ - Edit the profile's packet coloring rules
+colorize_____ - Colorize the selected conversation (1-10 or clear)
 columns______ - Choose the columns to display
 config_______ - Show termshark's config file (Unix-only)
 convs________ - Open conversations view
+decode-as____ - Edit the profile's Decode As rules
+extcap_______ - Configure an extcap interface e.g. randpkt, sshdump
 filter_______ - Choose a display filter from recently-used
+filter-button - Apply, add, edit or delete a display filter button
+freeze_______ - Freeze or resume the live packet list
 help_________ - Various help dialogs
+jumps________ - Show the history of jumps (see help vim)
 load_________ - Load a pcap from the filesystem
 logs_________ - Show termshark's log file (Unix-only)
 map__________ - Map a keypress to a key sequence (see help map)
 marks________ - Show file-local and global packet marks
 menu_________ - Open the UI Misc menu
 no-theme_____ - Clear theme for the current terminal color mode
+palette______ - Search all menus and commands
+prefs________ - Browse and edit protocol preferences
 profile______ - Profile actions - create, use, delete, etc
 quit_________ - Quit termshark
 recents______ - Load a pcap from those recently-used
+session______ - Save, load or delete a named session
 set__________ - Set various config properties (see help set)
+source_______ - Run a file of commands, one per line
 streams______ - Open stream reassembly view
 theme________ - Choose a theme for the current terminal color mode
+tls__________ - Set a TLS keylog file for decryption
 unmap________ - Remove a keypress mapping
+watch________ - Edit rules that act when live packets match a filter
 wormhole_____ - Prepare to transfer the current pcap{{end}}
 
 {{define "SetHelp"}}{{template "NameVer" .}}
 
 Use the cmdline set command to change configuration.
 
-Type :set and hit tab for options.
+Type :set and hit tab for options. Every key in the
+main section of termshark.toml can be set.
 
-auto-scroll___________ - scroll during live captures
-copy-timeout__________ - wait this long before failing a copy
-dark-mode_____________ - enable or disable dark-mode
-disable-shark-fin_____ - switch off the secret shark fin
-packet-colors_________ - use colors in the packet list view
-pager_________________ - pager (used for termshark's log file)
-nopager_______________ - disable the pager (use PAGER instead)
-suppress-tshark-errors - don't show tshark errors in the UI
-term__________________ - make termshark assume this terminal type
-noterm________________ - disable the terminal type (use TERM){{end}}
+set___________________ - show settings changed from defaults
+set <key>?____________ - show a setting's value and purpose
+set <key> <value>_____ - change a setting
+set <key> <v1> <v2>...- set a list, e.g. set conv-types ip tcp
+set <bool-key>________ - turn a setting on
+set no<key>___________ - return a setting to its default
+
+Booleans accept on/off, true/false and yes/no. Changes
+take effect at once, unless termshark says a restart
+is needed.{{end}}
 
 {{define "MapHelp"}}{{template "NameVer" .}}
 
@@ -157,6 +184,15 @@ Use the cmdline map command to set key macros e.g.
 
 map <f1> ZZ       - hit f1 key to quit
 
+To make a mapping that applies only when one view has
+focus, name the view first e.g.
+
+map hex <f5> <tab><tab><down><tab>
+
+The views are list, struct, hex, stream, convs and
+minibuffer. A view's mapping takes precedence over a
+mapping of the same key for every view.
+
 Use vim-style syntax for key-presses. Printable characters
 represent themselves. Compound keys can be:
 
@@ -169,7 +205,10 @@ represent themselves. Compound keys can be:
 <pgup>, <pgdn>
 <home>, <end>
 
-Use the unmap command to remove a mapping.{{end}}
+Use the unmap command to remove a mapping, naming the
+view if it has one e.g. unmap hex <f5>
+
+{{template "Key Mappings" .}}{{end}}
 
 {{define "CopyModeHelp"}}{{template "NameVer" .}}
 
@@ -188,8 +227,14 @@ right___ - Narrow selection
 {{if not .GlobalMarks}}No cross-file marks are set{{else}}Mark Packet  File              Summary{{range $key, $value := .GlobalMarks }}
 {{printf " %-4c" $key}} {{printf "%-7d" $value.Pos}}{{printf "%-18s" $value.Base}}{{printf "%s" $value.Summary}}{{end}}{{end}}{{end}}
 
-{{define "Key Mappings"}}{{if .Maps.None}}No key mappings are set{{else}}  From          To   {{range $mapping := .Maps.Get }}
-{{printf "  %-14v" $mapping.From}}{{printf "%v" $mapping.To}}   {{end}}{{end}}
+{{define "Jumps"}}{{if .Jumps.None}}No jumps have been made{{else}} jump packet  pane    filter{{range $j := .Jumps.Entries }}
+{{if $j.Current}}>{{else}} {{end}}{{printf "%4d" $j.Distance}}{{if $j.Packet}} {{printf "%6d" $j.Packet}}  {{printf "%-7s" $j.Pane}} {{$j.Filter}}{{end}}{{end}}{{end}}{{end}}
+
+{{define "Key Mappings"}}{{if .Maps.None}}No key mappings are set{{else}}{{range $i, $group := .Maps.Groups }}{{if $i}}
+{{end}}{{$group.Title}}
+  From          To   {{range $mapping := $group.Mappings }}
+{{printf "  %-14v" $mapping.From}}{{printf "%v" $mapping.To}}   {{end}}
+{{end}}{{end}}
 
 {{end}}
 `))
@@ -0,0 +1,310 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gcla/gowid"
+	"github.com/gcla/gowid/vim"
+	"github.com/gcla/gowid/widgets/button"
+	"github.com/gcla/gowid/widgets/columns"
+	"github.com/gcla/gowid/widgets/dialog"
+	"github.com/gcla/gowid/widgets/divider"
+	"github.com/gcla/gowid/widgets/edit"
+	"github.com/gcla/gowid/widgets/framed"
+	"github.com/gcla/gowid/widgets/list"
+	"github.com/gcla/gowid/widgets/pile"
+	"github.com/gcla/gowid/widgets/selectable"
+	"github.com/gcla/gowid/widgets/styled"
+	"github.com/gcla/gowid/widgets/text"
+	"github.com/gcla/termshark/v2"
+	"github.com/gcla/termshark/v2/pkg/fuzzy"
+	"github.com/gcla/termshark/v2/ui/menuutil"
+	"github.com/gcla/termshark/v2/widgets/appkeys"
+	"github.com/gdamore/tcell/v2"
+)
+
+//======================================================================
+
+// paletteEntry is one action offered by the command palette - a menu item or a
+// minibuffer command.
+type paletteEntry struct {
+	name string // e.g. "Analysis: Conversations" or ":convs"
+	key  string // the keys that run it from anywhere, if any
+	run  func(app gowid.IApp)
+}
+
+// The keys, in vim syntax, that run a menu item from anywhere. A menu item's
+// own Key only works while its menu is open, so isn't shown.
+var menuItemKeys = map[string]string{
+	"Refresh Screen":  "<C-l>",
+	"Command Palette": "<C-p>",
+	"Search Packets":  "<C-f>",
+	"Help":            "?",
+	"Quit":            "Q",
+}
+
+// The keys, in vim syntax, that run a minibuffer command from anywhere
+var commandKeys = map[string]string{
+	"freeze":  "<C-s>",
+	"palette": "<C-p>",
+	"q!":      "ZZ",
+	"quit":    "Q",
+}
+
+// paletteKeys describes the keys that run an action - its built-in keys, if
+// any, and the keys the user has mapped to a sequence starting with one of
+// the sequences given, in vim syntax.
+func paletteKeys(builtin string, mappings []termshark.KeyMapping, seqs ...string) string {
+	res := make([]string, 0, 1)
+	if builtin != "" {
+		res = append(res, builtin)
+	}
+	for _, m := range mappings {
+		to := fmt.Sprintf("%v", m.To)
+		for _, seq := range seqs {
+			if seq == "" || !strings.HasPrefix(to, fmt.Sprintf("%v", vim.VimStringToKeys(seq))) {
+				continue
+			}
+			if m.View == "" {
+				res = append(res, fmt.Sprintf("%v", m.From))
+			} else {
+				res = append(res, fmt.Sprintf("%v (%s)", m.From, m.View))
+			}
+			break
+		}
+	}
+	return strings.Join(res, ", ")
+}
+
+func menuPaletteEntries(menuName string, items []menuutil.SimpleMenuItem, mappings []termshark.KeyMapping) []paletteEntry {
+	res := make([]paletteEntry, 0, len(items))
+	for _, item := range items {
+		if item.Txt == "" { // a divider
+			continue
+		}
+		item := item
+		res = append(res, paletteEntry{
+			name: fmt.Sprintf("%s: %s", menuName, item.Txt),
+			key:  paletteKeys(menuItemKeys[item.Txt], mappings, menuItemKeys[item.Txt]),
+			run: func(app gowid.IApp) {
+				item.CB(app, nil)
+			},
+		})
+	}
+	return res
+}
+
+// fieldPaletteEntries offers the actions of the menu opened from the packet
+// structure view, for the field selected there.
+func fieldPaletteEntries() []paletteEntry {
+	if curColumnFilter == "" {
+		return nil
+	}
+	filter := curColumnFilter
+	name := curColumnFilterName
+	val := curColumnFilterValue
+	filterStr := pdmlFilterString(filter, val)
+
+	return []paletteEntry{
+		{
+			name: fmt.Sprintf("Field: Apply as Column: %s", filter),
+			run: func(app gowid.IApp) {
+				useAsColumn(filter, name, app)
+			},
+		},
+		{
+			name: fmt.Sprintf("Field: Decode As: %s", filter),
+			run: func(app gowid.IApp) {
+				openDecodeAsForField(filter, val, app)
+			},
+		},
+		{
+			name: fmt.Sprintf("Field: Apply Filter: %s", filterStr),
+			run: func(app gowid.IApp) {
+				FilterWidget.SetValue(filterStr, app)
+				RequestNewFilter(filterStr, app)
+			},
+		},
+		{
+			name: fmt.Sprintf("Field: Prep Filter: %s", filterStr),
+			run: func(app gowid.IApp) {
+				FilterWidget.SetValue(filterStr, app)
+				setFocusOnDisplayFilter(app)
+			},
+		},
+	}
+}
+
+// commandPaletteEntries offers each minibuffer command. Those that take
+// arguments open the minibuffer with the command typed, ready for them.
+func commandPaletteEntries(mappings []termshark.KeyMapping, app gowid.IApp) []paletteEntry {
+	if MiniBuffer == nil {
+		setupMiniBuffer(app)
+	}
+	names := MiniBuffer.Commands()
+	res := make([]paletteEntry, 0, len(names))
+	for _, name := range names {
+		name := name
+		res = append(res, paletteEntry{
+			name: ":" + name,
+			key:  paletteKeys(commandKeys[name], mappings, commandKeys[name], ":"+name+"<enter>"),
+			run: func(app gowid.IApp) {
+				// Only asked now - finding a command's arguments can be slow e.g. listing a directory
+				if MiniBuffer.TakesArguments(name, app) {
+					lastLineMode(app)
+					MiniBuffer.SetCommandLine(name+" ", app)
+				} else if err := invokeCommand(app, name); err != nil {
+					OpenError(err.Error(), app)
+				}
+			},
+		})
+	}
+	return res
+}
+
+func paletteEntries(app gowid.IApp) []paletteEntry {
+	mappings := termshark.LoadKeyMappings()
+	res := make([]paletteEntry, 0)
+	res = append(res, menuPaletteEntries("Menu", generalMenuItems, mappings)...)
+	res = append(res, menuPaletteEntries("Analysis", analysisMenuItems, mappings)...)
+	res = append(res, fieldPaletteEntries()...)
+	res = append(res, commandPaletteEntries(mappings, app)...)
+	return res
+}
+
+// paletteMatches returns the entries matching search, best first.
+func paletteMatches(entries []paletteEntry, search string) []paletteEntry {
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, e.name)
+	}
+	res := make([]paletteEntry, 0)
+	for _, i := range fuzzy.Rank(search, names) {
+		res = append(res, entries[i])
+	}
+	return res
+}
+
+func paletteListWidgets(matches []paletteEntry, choose func(paletteEntry, gowid.IApp)) []gowid.IWidget {
+	res := make([]gowid.IWidget, 0, len(matches))
+
+	for _, entry := range matches {
+		entry := entry
+		btn := button.NewBare(text.New(entry.name, text.Options{
+			Wrap:          text.WrapClip,
+			ClipIndicator: "...",
+		}))
+		btn.OnClick(gowid.MakeWidgetCallback("cb", gowid.WidgetChangedFunction(func(app gowid.IApp, w gowid.IWidget) {
+			choose(entry, app)
+		})))
+
+		row := columns.New([]gowid.IContainerWidget{
+			&gowid.ContainerWidget{
+				IWidget: btn,
+				D:       weight(1),
+			},
+			&gowid.ContainerWidget{
+				IWidget: text.New(entry.key),
+				D:       fixed,
+			},
+		})
+
+		res = append(res, styled.NewInvertedFocus(selectable.New(row), gowid.MakePaletteRef("default")))
+	}
+
+	if len(res) == 0 {
+		res = append(res, text.New("No commands match."))
+	}
+
+	return res
+}
+
+// paletteKeyPress opens the command palette on ctrl-p. The main views treat
+// ctrl-p as cursor movement, so this is applied before they see the key.
+func paletteKeyPress(evk *tcell.EventKey, app gowid.IApp) bool {
+	if evk.Key() != tcell.KeyCtrlP {
+		return false
+	}
+	openCommandPalette(app)
+	return true
+}
+
+// openCommandPalette lets the user find any menu item or minibuffer command by
+// typing part of its name. Enter runs the best match.
+func openCommandPalette(app gowid.IApp) {
+	var paletteDialog *dialog.Widget
+
+	entries := paletteEntries(app)
+	matches := entries
+
+	choose := func(entry paletteEntry, app gowid.IApp) {
+		paletteDialog.Close(app)
+		entry.run(app)
+	}
+
+	paletteList := list.New(list.NewSimpleListWalker(paletteListWidgets(matches, choose)))
+
+	searchWidget := edit.New(edit.Options{
+		Caption: "> ",
+	})
+	searchWidget.OnTextSet(gowid.MakeWidgetCallback("cb", gowid.WidgetChangedFunction(func(app gowid.IApp, w gowid.IWidget) {
+		matches = paletteMatches(entries, searchWidget.Text())
+		paletteList.SetWalker(list.NewSimpleListWalker(paletteListWidgets(matches, choose)), app)
+	})))
+
+	searchWidgetExt := appkeys.New(
+		searchWidget,
+		func(ev *tcell.EventKey, app gowid.IApp) bool {
+			res := false
+			switch ev.Key() {
+			case tcell.KeyEnter:
+				if len(matches) > 0 {
+					choose(matches[0], app)
+				}
+				res = true
+			}
+			return res
+		},
+		appkeys.Options{
+			ApplyBefore: true,
+		},
+	)
+
+	view := pile.NewFlow(
+		text.New("Type to search the menus and commands. Enter runs the first match."),
+		divider.NewBlank(),
+		framed.NewUnicode(searchWidgetExt),
+		divider.NewUnicode(),
+		// Do this so the list box scrolls inside the dialog
+		&gowid.ContainerWidget{
+			IWidget: paletteList,
+			D:       weight(1),
+		},
+	)
+
+	paletteDialog = dialog.New(
+		framed.NewSpace(view),
+		dialog.Options{
+			Buttons:         dialog.CloseOnly,
+			NoShadow:        true,
+			BackgroundStyle: gowid.MakePaletteRef("dialog"),
+			BorderStyle:     gowid.MakePaletteRef("dialog"),
+			ButtonStyle:     gowid.MakePaletteRef("dialog-button"),
+			Modal:           true,
+			FocusOnWidget:   true,
+		},
+	)
+
+	dialog.OpenExt(paletteDialog, appView, ratio(0.6), ratio(0.7), app)
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 78
+// End:
@@ -0,0 +1,326 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+package ui
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/gcla/gowid"
+	"github.com/gcla/gowid/widgets/button"
+	"github.com/gcla/gowid/widgets/checkbox"
+	"github.com/gcla/gowid/widgets/columns"
+	"github.com/gcla/gowid/widgets/dialog"
+	"github.com/gcla/gowid/widgets/divider"
+	"github.com/gcla/gowid/widgets/edit"
+	"github.com/gcla/gowid/widgets/framed"
+	"github.com/gcla/gowid/widgets/list"
+	"github.com/gcla/gowid/widgets/paragraph"
+	"github.com/gcla/gowid/widgets/pile"
+	"github.com/gcla/gowid/widgets/selectable"
+	"github.com/gcla/gowid/widgets/styled"
+	"github.com/gcla/gowid/widgets/text"
+	"github.com/gcla/termshark/v2"
+	"github.com/gcla/termshark/v2/configs/profiles"
+	"github.com/gcla/termshark/v2/pkg/shark"
+	"github.com/gcla/termshark/v2/pkg/shark/wiresharkcfg"
+	log "github.com/sirupsen/logrus"
+)
+
+//======================================================================
+
+// The preferences tshark reports, and the Wireshark profile they were read with. Running
+// tshark -G currentprefs takes a moment, so only do it again if the link changes.
+var prefsCache []wiresharkcfg.Pref
+var prefsCacheProfile string
+
+// Preserved so that the list is still filtered on returning from editing a preference
+var prefsSearch string
+
+// These are not protocol preferences, and are not useful to termshark
+var prefsIgnored = []string{"gui.", "capture.", "console.", "extcap."}
+
+//======================================================================
+
+func openPrefsUi(app gowid.IApp) {
+	wsProf := profiles.ConfString("main.wireshark-profile", "")
+	if prefsCache != nil && prefsCacheProfile == wsProf {
+		openPrefsBrowser(app)
+		return
+	}
+
+	OpenPleaseWait(appView, app)
+
+	termshark.TrackedGo(func() {
+		prefs, err := shark.LoadCurrentPrefs()
+
+		app.Run(gowid.RunFunction(func(app gowid.IApp) {
+			ClosePleaseWait(app)
+			if err != nil {
+				OpenError(err.Error(), app)
+				return
+			}
+
+			prefsCache = make([]wiresharkcfg.Pref, 0, len(prefs))
+			for _, pref := range prefs {
+				if !prefIgnored(pref.Name) {
+					prefsCache = append(prefsCache, pref)
+				}
+			}
+			prefsCacheProfile = wsProf
+
+			log.Infof("Read %d protocol preferences from tshark", len(prefsCache))
+
+			openPrefsBrowser(app)
+		}))
+	}, Goroutinewg)
+}
+
+func prefIgnored(name string) bool {
+	for _, pref := range prefsIgnored {
+		if strings.HasPrefix(name, pref) {
+			return true
+		}
+	}
+	return false
+}
+
+// prefMatches returns true if the search term appears in the preference's name or its
+// documentation.
+func prefMatches(pref wiresharkcfg.Pref, search string) bool {
+	if search == "" {
+		return true
+	}
+	search = strings.ToLower(search)
+	return strings.Contains(strings.ToLower(pref.Name), search) || strings.Contains(strings.ToLower(pref.Comment), search)
+}
+
+func prefsListWidgets(search string, overrides map[string]string, open func(wiresharkcfg.Pref, gowid.IApp)) []gowid.IWidget {
+	res := make([]gowid.IWidget, 0, len(prefsCache))
+
+	for _, pref := range prefsCache {
+		if !prefMatches(pref, search) {
+			continue
+		}
+
+		pref := pref
+		mark := " "
+		val := pref.Value
+		if oval, ok := overrides[pref.Name]; ok {
+			mark = "*"
+			val = oval
+		}
+
+		summary := strings.SplitN(pref.Comment, "\n", 2)[0]
+
+		btn := button.NewBare(text.New(fmt.Sprintf("%s %s: %s  (%s)", mark, pref.Name, val, summary), text.Options{
+			Wrap:          text.WrapClip,
+			ClipIndicator: "...",
+		}))
+
+		btn.OnClick(gowid.MakeWidgetCallback("cb", gowid.WidgetChangedFunction(func(app gowid.IApp, w gowid.IWidget) {
+			open(pref, app)
+		})))
+
+		res = append(res, styled.NewInvertedFocus(selectable.New(btn), gowid.MakePaletteRef("default")))
+	}
+
+	if len(res) == 0 {
+		res = append(res, text.New("No preferences match."))
+	}
+
+	return res
+}
+
+func prefOverridesMap() map[string]string {
+	res := make(map[string]string)
+	for _, o := range shark.GetPrefOverrides() {
+		res[o.Name] = o.Value
+	}
+	return res
+}
+
+func openPrefsBrowser(app gowid.IApp) {
+	var prefsDialog *dialog.Widget
+
+	openEdit := func(pref wiresharkcfg.Pref, app gowid.IApp) {
+		prefsDialog.Close(app)
+		openPrefEditor(pref, app)
+	}
+
+	overrides := prefOverridesMap()
+
+	prefsList := list.New(list.NewSimpleListWalker(prefsListWidgets(prefsSearch, overrides, openEdit)))
+
+	searchWidget := edit.New(edit.Options{
+		Caption: "Search: ",
+		Text:    prefsSearch,
+	})
+	searchWidget.OnTextSet(gowid.MakeWidgetCallback("cb", gowid.WidgetChangedFunction(func(app gowid.IApp, w gowid.IWidget) {
+		prefsSearch = searchWidget.Text()
+		prefsList.SetWalker(list.NewSimpleListWalker(prefsListWidgets(prefsSearch, overrides, openEdit)), app)
+	})))
+
+	header := fmt.Sprintf("Protocol preferences for profile %s", profiles.CurrentName())
+	if wsProf := profiles.ConfString("main.wireshark-profile", ""); wsProf != "" {
+		header = fmt.Sprintf("%s (linked to Wireshark profile %s)", header, wsProf)
+	}
+
+	view := pile.NewFlow(
+		text.New(header),
+		text.New("Values marked with * are set by termshark. Select a preference to edit it."),
+		divider.NewBlank(),
+		framed.NewUnicode(searchWidget),
+		divider.NewUnicode(),
+		// Do this so the list box scrolls inside the dialog
+		&gowid.ContainerWidget{
+			IWidget: prefsList,
+			D:       weight(1),
+		},
+	)
+
+	prefsDialog = dialog.New(
+		framed.NewSpace(view),
+		dialog.Options{
+			Buttons:         dialog.CloseOnly,
+			NoShadow:        true,
+			BackgroundStyle: gowid.MakePaletteRef("dialog"),
+			BorderStyle:     gowid.MakePaletteRef("dialog"),
+			ButtonStyle:     gowid.MakePaletteRef("dialog-button"),
+			Modal:           true,
+			FocusOnWidget:   true,
+		},
+	)
+
+	dialog.OpenExt(prefsDialog, appView, ratio(0.8), ratio(0.8), app)
+}
+
+// openPrefEditor lets the user set a termshark override for a single preference, and, if
+// the profile is linked to a Wireshark profile, optionally write the value there too.
+func openPrefEditor(pref wiresharkcfg.Pref, app gowid.IApp) {
+	var editDialog *dialog.Widget
+
+	overrides := prefOverridesMap()
+	oval, overridden := overrides[pref.Name]
+
+	cur := pref.Value
+	if overridden {
+		cur = oval
+	}
+
+	valueWidget := edit.New(edit.Options{
+		Text: cur,
+	})
+
+	wsProf := profiles.ConfString("main.wireshark-profile", "")
+	writeBackCheckBox := checkbox.New(false)
+
+	apply := func(app gowid.IApp) {
+		prev := shark.GetPrefOverrides()
+		val := valueWidget.Text()
+
+		shark.SetPrefOverride(pref.Name, val)
+
+		if wsProf != "" && writeBackCheckBox.IsChecked() {
+			fname, err := termshark.WiresharkProfilePrefsFile(wsProf)
+			if err == nil {
+				err = wiresharkcfg.UpdatePrefsFile(fname, pref.Name, val)
+			}
+			if err != nil {
+				OpenError(err.Error(), app)
+			} else {
+				// The cached values are out of date now
+				prefsCache = nil
+			}
+		}
+
+		if !reflect.DeepEqual(prev, shark.GetPrefOverrides()) && !Loader.Empty() {
+			RequestReload(app)
+		}
+	}
+
+	setBtn := dialog.Button{
+		Msg: "Set",
+		Action: gowid.MakeWidgetCallback("exec", gowid.WidgetChangedFunction(func(app gowid.IApp, _ gowid.IWidget) {
+			editDialog.Close(app)
+			apply(app)
+			openPrefsUi(app)
+		})),
+	}
+
+	clearBtn := dialog.Button{
+		Msg: "Clear",
+		Action: gowid.MakeWidgetCallback("exec", gowid.WidgetChangedFunction(func(app gowid.IApp, _ gowid.IWidget) {
+			editDialog.Close(app)
+			if overridden {
+				shark.DeletePrefOverride(pref.Name)
+				if !Loader.Empty() {
+					RequestReload(app)
+				}
+			}
+			openPrefsUi(app)
+		})),
+	}
+
+	backBtn := dialog.Button{
+		Msg: "Back",
+		Action: gowid.MakeWidgetCallback("exec", gowid.WidgetChangedFunction(func(app gowid.IApp, _ gowid.IWidget) {
+			editDialog.Close(app)
+			openPrefsUi(app)
+		})),
+	}
+
+	status := fmt.Sprintf("Wireshark value: %s", pref.Value)
+	if pref.Default {
+		status = fmt.Sprintf("%s (default)", status)
+	}
+	if overridden {
+		status = fmt.Sprintf("%s\nTermshark override: %s", status, oval)
+	}
+
+	dialogWidgets := make([]interface{}, 0, 12)
+	dialogWidgets = append(dialogWidgets,
+		text.New(pref.Name),
+		divider.NewUnicode(),
+	)
+	for _, line := range strings.Split(pref.Comment, "\n") {
+		dialogWidgets = append(dialogWidgets, paragraph.New(line))
+	}
+	dialogWidgets = append(dialogWidgets,
+		divider.NewBlank(),
+		text.New(status),
+		divider.NewBlank(),
+		framed.NewUnicode(valueWidget),
+	)
+
+	if wsProf != "" {
+		dialogWidgets = append(dialogWidgets,
+			divider.NewBlank(),
+			columns.NewFixed(text.New(fmt.Sprintf("Also save to Wireshark profile %s: ", wsProf)), writeBackCheckBox),
+		)
+	}
+
+	editDialog = dialog.New(
+		framed.NewSpace(pile.NewFlow(dialogWidgets...)),
+		dialog.Options{
+			Buttons:         []dialog.Button{setBtn, clearBtn, backBtn},
+			NoShadow:        true,
+			BackgroundStyle: gowid.MakePaletteRef("dialog"),
+			BorderStyle:     gowid.MakePaletteRef("dialog"),
+			ButtonStyle:     gowid.MakePaletteRef("dialog-button"),
+			Modal:           true,
+			FocusOnWidget:   true,
+		},
+	)
+
+	editDialog.Open(appView, ratio(0.6), app)
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 110
+// End:
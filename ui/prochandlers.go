@@ -62,6 +62,7 @@ var _ pcap.IOnError = updatePacketViews{}
 var _ pcap.IClear = updatePacketViews{}
 var _ pcap.IBeforeBegin = updatePacketViews{}
 var _ pcap.IAfterEnd = updatePacketViews{}
+var _ pcap.INewSource = updatePacketViews{}
 
 func MakePacketViewUpdater() updatePacketViews {
 	res := updatePacketViews{}
@@ -71,16 +72,26 @@ func MakePacketViewUpdater() updatePacketViews {
 
 func (t updatePacketViews) OnClear(code pcap.HandlerCode, app gowid.IApp) {
 	clearPacketViews(app)
+	clearColorRuleMatches()
+	// The packets being studied are gone, so there's nothing to keep frozen
+	unfreezePacketList(t.Ld, app)
 	if packetListView != nil {
 		updatePacketListWithData(t.Ld, app)
 	}
 }
 
+// A new source replaces the packets being studied
+func (t updatePacketViews) OnNewSource(code pcap.HandlerCode, app gowid.IApp) {
+	unfreezePacketList(t.Ld, app)
+}
+
 func (t updatePacketViews) BeforeBegin(code pcap.HandlerCode, app gowid.IApp) {
 	if code&pcap.PsmlCode == 0 {
 		return
 	}
 	ch2 := Loader.PsmlFinishedChan
+	// The list is rebuilt for the new filter or source, so it can't stay frozen
+	unfreezePacketList(t.Ld, app)
 	clearPacketViews(app)
 	t.Ld.PsmlLoader.Lock()
 	defer t.Ld.PsmlLoader.Unlock()
@@ -242,6 +253,7 @@ func clearMarks() {
 		delete(marksMap, k)
 	}
 	lastJumpPos = -1
+	watchMarkedPackets = nil
 }
 
 func (t checkGlobalJumpAfterPsml) OnNewSource(code pcap.HandlerCode, app gowid.IApp) {
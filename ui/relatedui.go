@@ -0,0 +1,74 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+package ui
+
+import (
+	"strconv"
+
+	"github.com/gcla/gowid/widgets/table"
+	"github.com/gcla/termshark/v2/pkg/pdmltree"
+	"github.com/gcla/termshark/v2/pkg/psmlmodel"
+)
+
+//======================================================================
+
+// The packets referred to by the frame-reference fields of the selected
+// packet e.g. the request a DNS response answers, keyed by packet number.
+// They are marked in the packet list's gutter, like Wireshark's related
+// packets.
+var relatedPackets map[int]struct{}
+
+func setRelatedPackets(model *pdmltree.Model) {
+	relatedPackets = nil
+	if model == nil || FieldCompleter == nil {
+		return
+	}
+	for _, num := range model.FrameRefs(FieldCompleter) {
+		if relatedPackets == nil {
+			relatedPackets = make(map[int]struct{})
+		}
+		relatedPackets[num] = struct{}{}
+	}
+}
+
+func clearRelatedPackets() {
+	relatedPackets = nil
+}
+
+//======================================================================
+
+// packetListMarker marks the rows of the packet list that hold packets
+// related to the selected packet, or matched by a watch rule with the mark
+// action.
+type packetListMarker struct{}
+
+var _ psmlmodel.IRowMarker = packetListMarker{}
+
+func (r packetListMarker) IsMarked(row table.RowId) bool {
+	if len(relatedPackets) == 0 && len(watchMarkedPackets) == 0 {
+		return false
+	}
+	// The RowId is the index in the PSML array, whose first column is the
+	// packet number
+	data := Loader.PsmlData()
+	if int(row) >= len(data) || len(data[row]) == 0 {
+		return false
+	}
+	num, err := strconv.Atoi(data[row][0])
+	if err != nil {
+		return false
+	}
+	if _, ok := relatedPackets[num]; ok {
+		return true
+	}
+	_, ok := watchMarkedPackets[num]
+	return ok
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 78
+// End:
@@ -0,0 +1,262 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+package ui
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/gcla/gowid"
+	"github.com/gcla/termshark/v2/pkg/pcap"
+	"github.com/gcla/termshark/v2/pkg/pdmltree"
+	"github.com/gcla/termshark/v2/pkg/remote"
+	"github.com/gcla/termshark/v2/widgets/filter"
+)
+
+//======================================================================
+
+// How long a remote request waits for the UI goroutine to run it
+const remoteTimeout = 10 * time.Second
+
+// Non-nil if termshark was started with a remote control socket
+var remoteServer *remote.Server
+
+// The packet number last sent to remote clients in a selection event
+var lastRemoteSelection = -1
+
+type remotePacket struct {
+	Number  int           `json:"number"`
+	Summary string        `json:"summary"`
+	Fields  []remoteField `json:"fields,omitempty"`
+}
+
+type remoteField struct {
+	Name    string `json:"name"`
+	Show    string `json:"show,omitempty"`
+	Display string `json:"display,omitempty"`
+}
+
+type remoteLoaded struct {
+	Source  string `json:"source"`
+	Filter  string `json:"filter"`
+	Packets int    `json:"packets"`
+}
+
+type remoteResult struct {
+	res interface{}
+	err error
+}
+
+// StartRemoteControl listens for remote control clients on the UNIX socket
+// at path. Close the server returned when termshark exits.
+func StartRemoteControl(path string, app gowid.IApp) (*remote.Server, error) {
+	srv, err := remote.Listen(path, remoteHandler{app: app})
+	if err != nil {
+		return nil, err
+	}
+	remoteServer = srv
+	return srv, nil
+}
+
+type remoteHandler struct {
+	app gowid.IApp
+}
+
+var _ remote.IHandler = remoteHandler{}
+
+func (h remoteHandler) HandleRequest(req remote.Request) (interface{}, error) {
+	switch req.Command {
+	case "open":
+		if len(req.Args) < 1 || len(req.Args) > 2 {
+			return nil, fmt.Errorf("Usage: open <pcap> [<display filter>]")
+		}
+		pcapf, err := filepath.Abs(req.Args[0])
+		if err != nil {
+			return nil, err
+		}
+		if _, err := os.Stat(pcapf); err != nil {
+			return nil, err
+		}
+		// Not in the app goroutine, so tshark can be run here if need be
+		if len(req.Args) == 2 && req.Args[1] != "" {
+			if err := filter.CheckDisplayFilter(req.Args[1], FieldCompleter); err != nil {
+				return nil, err
+			}
+		}
+		return runRemote(h.app, func(app gowid.IApp) (interface{}, error) {
+			displayFilter := FilterWidget.Value()
+			if len(req.Args) == 2 {
+				displayFilter = req.Args[1]
+				FilterWidget.SetValue(displayFilter, app)
+			}
+			MaybeKeepThenRequestLoadPcap(pcapf, displayFilter, NoGlobalJump, app)
+			return nil, nil
+		})
+
+	case "filter":
+		if len(req.Args) != 1 {
+			return nil, fmt.Errorf("Usage: filter <display filter>")
+		}
+		if req.Args[0] != "" {
+			if err := filter.CheckDisplayFilter(req.Args[0], FieldCompleter); err != nil {
+				return nil, err
+			}
+		}
+		return runRemote(h.app, func(app gowid.IApp) (interface{}, error) {
+			if Loader.Empty() {
+				return nil, fmt.Errorf("No packets are loaded")
+			}
+			FilterWidget.SetValue(req.Args[0], app)
+			RequestNewFilter(req.Args[0], app)
+			return nil, nil
+		})
+
+	case "goto":
+		if len(req.Args) != 1 {
+			return nil, fmt.Errorf("Usage: goto <packet number>")
+		}
+		num, err := strconv.Atoi(req.Args[0])
+		if err != nil {
+			return nil, fmt.Errorf("Invalid packet number %s", req.Args[0])
+		}
+		return runRemote(h.app, func(app gowid.IApp) (interface{}, error) {
+			return nil, remoteGoto(num, app)
+		})
+
+	case "run":
+		if len(req.Args) == 0 {
+			return nil, fmt.Errorf("Usage: run <command> [<args>...]")
+		}
+		return runRemote(h.app, func(app gowid.IApp) (interface{}, error) {
+			return nil, invokeCommand(app, req.Args...)
+		})
+
+	case "packet":
+		return runRemote(h.app, func(app gowid.IApp) (interface{}, error) {
+			return currentRemotePacket()
+		})
+
+	default:
+		return nil, fmt.Errorf("Unknown command %s", req.Command)
+	}
+}
+
+// runRemote runs fn in the app goroutine and waits for the result.
+func runRemote(app gowid.IApp, fn func(app gowid.IApp) (interface{}, error)) (interface{}, error) {
+	resC := make(chan remoteResult, 1)
+	app.Run(gowid.RunFunction(func(app gowid.IApp) {
+		res, err := fn(app)
+		resC <- remoteResult{res: res, err: err}
+	}))
+	select {
+	case r := <-resC:
+		return r.res, r.err
+	case <-time.After(remoteTimeout):
+		return nil, fmt.Errorf("Timed out waiting for termshark")
+	}
+}
+
+// Runs in app goroutine
+func remoteGoto(num int, app gowid.IApp) error {
+	return goToPacketNumber(num, app)
+}
+
+// currentRemotePacket returns the number and summary of the selected packet,
+// and its fields if its PDML has been loaded.
+//
+// Runs in app goroutine
+func currentRemotePacket() (interface{}, error) {
+	if packetListView == nil {
+		return nil, fmt.Errorf("No packets are loaded")
+	}
+	fxy, err := packetListView.FocusXY()
+	if err != nil {
+		return nil, fmt.Errorf("No packet in focus: %v", err)
+	}
+	pn, err := packetNumberFromTableRow(fxy.Row)
+	if err != nil {
+		return nil, err
+	}
+	res := remotePacket{
+		Number:  pn.Pos,
+		Summary: pn.Summary,
+	}
+	if row, ok := packetListView.Model().RowIdentifier(fxy.Row); ok {
+		if model := getCurrentStructModel(int(row)); model != nil {
+			res.Fields = remoteFields(model, make([]remoteField, 0, 64))
+		}
+	}
+	return res, nil
+}
+
+func remoteFields(m *pdmltree.Model, res []remoteField) []remoteField {
+	for _, c := range m.Children_ {
+		res = append(res, remoteField{
+			Name:    c.Name,
+			Show:    c.Show,
+			Display: c.UiName,
+		})
+		res = remoteFields(c, res)
+	}
+	return res
+}
+
+// notifyRemoteSelection tells remote clients the selected packet has
+// changed.
+//
+// Runs in app goroutine
+func notifyRemoteSelection() {
+	if remoteServer == nil {
+		return
+	}
+	pn, err := packetNumberFromCurrentTableRow()
+	if err != nil || pn.Pos == lastRemoteSelection {
+		return
+	}
+	lastRemoteSelection = pn.Pos
+	remoteServer.Broadcast(remote.Event{
+		Event: "selection",
+		Data: remotePacket{
+			Number:  pn.Pos,
+			Summary: pn.Summary,
+		},
+	})
+}
+
+//======================================================================
+
+// NotifyRemoteClients tells remote control clients when packets have
+// finished loading.
+type NotifyRemoteClients struct{}
+
+var _ pcap.IClear = NotifyRemoteClients{}
+var _ pcap.IAfterEnd = NotifyRemoteClients{}
+
+func (t NotifyRemoteClients) OnClear(code pcap.HandlerCode, app gowid.IApp) {
+	lastRemoteSelection = -1
+}
+
+func (t NotifyRemoteClients) AfterEnd(code pcap.HandlerCode, app gowid.IApp) {
+	if code&pcap.PsmlCode == 0 || remoteServer == nil {
+		return
+	}
+	remoteServer.Broadcast(remote.Event{
+		Event: "loaded",
+		Data: remoteLoaded{
+			Source:  Loader.String(),
+			Filter:  Loader.DisplayFilter(),
+			Packets: len(Loader.PsmlData()),
+		},
+	})
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 78
+// End:
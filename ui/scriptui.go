@@ -0,0 +1,181 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+package ui
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gcla/gowid"
+	"github.com/gcla/termshark/v2/configs/profiles"
+	"github.com/gcla/termshark/v2/pkg/pcap"
+	"github.com/gcla/termshark/v2/widgets/minibuffer"
+	log "github.com/sirupsen/logrus"
+)
+
+//======================================================================
+
+// Scripts can source other scripts - this stops one that sources itself
+const maxScriptDepth = 8
+
+// Greater than 0 while a script is running
+var scriptDepth int
+
+// The script passed with --script, run once the first packet source has loaded
+var pendingScript string
+
+// The failures of the commands of the running script, and any it sources, with
+// their lines - shown together when the script is done
+var scriptErrors []string
+
+// scriptFailedError is returned by runScript if any of the script's commands
+// failed. The failures themselves are in scriptErrors.
+type scriptFailedError struct {
+	path string
+}
+
+func (e scriptFailedError) Error() string {
+	return fmt.Sprintf("Errors running %s", e.path)
+}
+
+// SetStartupScript arranges for the script at path to be run once the first
+// packet source has loaded - or once the UI starts, for a live capture.
+func SetStartupScript(path string) {
+	pendingScript = path
+}
+
+// runScript runs each command in the script at path as if it had been typed
+// in the minibuffer. A command that fails is added to scriptErrors with its
+// line, and the script carries on.
+//
+// Runs in app goroutine
+func runScript(path string, app gowid.IApp) error {
+	if scriptDepth >= maxScriptDepth {
+		return fmt.Errorf("Scripts are nested too deeply at %s", path)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	lines, err := minibuffer.ReadScript(f)
+	if err != nil {
+		return fmt.Errorf("Could not read %s: %v", path, err)
+	}
+
+	scriptDepth++
+	defer func() {
+		scriptDepth--
+	}()
+
+	failed := false
+	for _, line := range lines {
+		if err := invokeCommand(app, line.Words...); err != nil {
+			failed = true
+			// A sourced script has added its own failures
+			if _, ok := err.(scriptFailedError); !ok {
+				scriptErrors = append(scriptErrors, fmt.Sprintf("%s:%d: %v", path, line.Num, err))
+			}
+		}
+	}
+
+	if failed {
+		return scriptFailedError{path: path}
+	}
+	return nil
+}
+
+// runScriptReportingErrors runs the script at path, then shows any problems
+// found in one dialog.
+//
+// Runs in app goroutine
+func runScriptReportingErrors(path string, app gowid.IApp) error {
+	scriptErrors = nil
+	err := runScript(path, app)
+	msgs := scriptErrors
+	scriptErrors = nil
+	if _, ok := err.(scriptFailedError); err != nil && !ok {
+		msgs = append(msgs, err.Error())
+	}
+	if len(msgs) > 0 {
+		OpenError(fmt.Sprintf("Error running script:\n\n%s", strings.Join(msgs, "\n")), app)
+	}
+	return err
+}
+
+// commandMessage shows the outcome of a minibuffer command. There's no one to read
+// it when a script runs the command, so then it's only logged.
+//
+// Runs in app goroutine
+func commandMessage(msg string, app gowid.IApp) {
+	if scriptDepth > 0 {
+		log.Infof("Script: %s", msg)
+		return
+	}
+	OpenMessage(msg, appView, app)
+}
+
+// commandError reports the error returned by a minibuffer command. When a script runs
+// the command, the script reports the error itself, with the others, naming the line.
+//
+// Runs in app goroutine
+func commandError(err error, app gowid.IApp) {
+	if scriptDepth > 0 {
+		return
+	}
+	OpenMessage(fmt.Sprintf("Error: %s", err), appView, app)
+}
+
+// RunStartupScripts runs the current profile's termsharkrc, if there is one,
+// then the script passed with --script if its packets are ready. Call once
+// the UI has started.
+//
+// Runs in app goroutine
+func RunStartupScripts(app gowid.IApp) {
+	if dir, err := profiles.Dir(); err == nil {
+		rc := filepath.Join(dir, "termsharkrc")
+		if _, err := os.Stat(rc); err == nil {
+			runScriptReportingErrors(rc, app)
+		}
+	}
+
+	if Loader.InterfaceLoader.IsLoading() || !Loader.PsmlLoader.IsLoading() {
+		runPendingScript(app)
+	}
+}
+
+func runPendingScript(app gowid.IApp) {
+	if pendingScript == "" {
+		return
+	}
+	path := pendingScript
+	pendingScript = ""
+	runScriptReportingErrors(path, app)
+}
+
+//======================================================================
+
+// RunPendingScript runs the script passed with --script when a pcap file
+// has finished loading, if the UI is running by then.
+type RunPendingScript struct{}
+
+var _ pcap.IAfterEnd = RunPendingScript{}
+
+func (t RunPendingScript) AfterEnd(code pcap.HandlerCode, app gowid.IApp) {
+	if code&pcap.PsmlCode == 0 || !Running {
+		return
+	}
+	runPendingScript(app)
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 78
+// End:
@@ -226,12 +226,15 @@ func (s *BytesSearchCallbacks) SearchPacketsResult(res search.Result, app gowid.
 		// It looks better than having the found packet be at the top of the view
 		packetListView.GoToMiddle(app)
 
-		hex := getHexWidgetToDisplay(bytesRes.PacketRow)
+		// Matches are in the frame's bytes
+		hexView := getHexViewToDisplay(bytesRes.PacketRow)
+
+		if hexView != nil {
+			hexView.SetSource(0, app)
 
-		if hex != nil {
 			allowHexToStructRepositioning = true
 
-			hex.SetPosition(bytesRes.PacketPos, app)
+			hexView.Hex(0).SetPosition(bytesRes.PacketPos, app)
 		}
 
 		curPacketStructWidget.GoToMiddle(app)
@@ -0,0 +1,282 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+package ui
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gcla/gowid"
+	"github.com/gcla/gowid/widgets/table"
+	"github.com/gcla/termshark/v2"
+	"github.com/gcla/termshark/v2/configs/profiles"
+	"github.com/gcla/termshark/v2/pkg/pcap"
+	"github.com/gcla/termshark/v2/pkg/pdmltree"
+	"github.com/gcla/termshark/v2/pkg/session"
+	"github.com/gcla/termshark/v2/pkg/streams"
+	"github.com/gcla/termshark/v2/widgets/resizable"
+	"github.com/gcla/termshark/v2/widgets/streamwidget"
+)
+
+//======================================================================
+
+// The rest of a session loaded by :session load - applied once its pcap has
+// loaded with its filter
+var pendingSession *session.Session
+
+// Sessions are saved per-profile
+func sessionDir() (string, error) {
+	dir, err := profiles.Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "sessions"), nil
+}
+
+func sessionNames() []string {
+	dir, err := sessionDir()
+	if err != nil {
+		return []string{}
+	}
+	return session.Names(dir)
+}
+
+// The resizable widgets whose offsets are saved, named as in the config
+func sessionOffsetWidgets() map[string]resizable.IOffsets {
+	return map[string]resizable.IOffsets{
+		"mainview":           mainviewRows,
+		"altviewleft":        altview1Pile,
+		"altviewright":       altview1Cols,
+		"altview2horizontal": altview2Pile,
+		"altview2vertical":   altview2Cols,
+	}
+}
+
+// currentSession captures the state of the UI.
+func currentSession() (*session.Session, error) {
+	if Loader.Pcap() == "" {
+		return nil, fmt.Errorf("No pcap is loaded")
+	}
+
+	res := &session.Session{
+		Pcap:     Loader.Pcap(),
+		Filter:   Loader.DisplayFilter(),
+		Expanded: curExpandedStructNodes,
+		Marks:    make(map[string]termshark.JumpPos),
+		Layout:   profiles.ConfString("main.layout", "mainview"),
+		Offsets:  make(map[string][]resizable.Offset),
+	}
+
+	if packetListView != nil {
+		if pn, err := packetNumberFromCurrentTableRow(); err == nil {
+			res.Packet = pn.Pos
+		}
+	}
+
+	for k, v := range marksMap {
+		res.Marks[string(k)] = v
+	}
+
+	for name, w := range sessionOffsetWidgets() {
+		res.Offsets[name] = w.GetOffsets()
+	}
+
+	switch appViewNoKeys.SubWidget() {
+	case streamView:
+		if currentStreamKey != nil {
+			res.Stream = &session.Stream{
+				Proto: strings.ToLower(currentStreamKey.proto.String()),
+				Index: currentStreamKey.idx,
+			}
+			if swid, ok := streamViewNoKeysHolder.SubWidget().(*streamwidget.Widget); ok {
+				res.Stream.PreviousFilter = swid.PreviousFilter()
+			}
+		}
+	case convsViewWithKeys:
+		if convsUi != nil {
+			res.Convs = &session.Convs{
+				UseFilter:    convsUi.UseFilter(),
+				AbsoluteTime: convsUi.AbsoluteTime(),
+				ResolveNames: convsUi.ResolveNames(),
+			}
+		}
+	}
+
+	if SearchWidget != nil {
+		res.Search = &session.Search{
+			Open:          searchOpen(),
+			Type:          SearchWidget.SearchType(),
+			Target:        SearchWidget.SearchTarget(),
+			CaseSensitive: SearchWidget.CaseSensitive(),
+			Value:         SearchWidget.Value(),
+		}
+	}
+
+	return res, nil
+}
+
+// Runs in app goroutine
+func saveSession(name string) error {
+	dir, err := sessionDir()
+	if err != nil {
+		return err
+	}
+	s, err := currentSession()
+	if err != nil {
+		return err
+	}
+	return session.Save(dir, name, s)
+}
+
+// loadSession restores the layout straight away, then loads the session's pcap
+// with its filter, if necessary, and restores the rest once that is done.
+//
+// Runs in app goroutine
+func loadSession(name string, app gowid.IApp) error {
+	dir, err := sessionDir()
+	if err != nil {
+		return err
+	}
+	s, err := session.Load(dir, name)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(s.Pcap); err != nil {
+		return fmt.Errorf("Could not open the session's pcap: %v", err)
+	}
+
+	// The session's views are reopened once its packets are loaded
+	appViewNoKeys.SetSubWidget(mainView, app)
+
+	restoreSessionLayout(s, app)
+
+	pendingSession = s
+	if Loader.Pcap() != s.Pcap {
+		MaybeKeepThenRequestLoadPcap(s.Pcap, s.Filter, NoGlobalJump, app)
+	} else if Loader.DisplayFilter() != s.Filter {
+		FilterWidget.SetValue(s.Filter, app)
+		RequestNewFilter(s.Filter, app)
+	} else {
+		runPendingSession(app)
+	}
+
+	return nil
+}
+
+// Runs in app goroutine
+func deleteSession(name string) error {
+	dir, err := sessionDir()
+	if err != nil {
+		return err
+	}
+	return session.Delete(dir, name)
+}
+
+func restoreSessionLayout(s *session.Session, app gowid.IApp) {
+	switch s.Layout {
+	case "altview1":
+		mainViewNoKeys.SetSubWidget(altview1, app)
+	case "altview2":
+		mainViewNoKeys.SetSubWidget(altview2, app)
+	case "mainview":
+		mainViewNoKeys.SetSubWidget(mainview, app)
+	default:
+		s.Layout = ""
+	}
+	if s.Layout != "" {
+		profiles.SetConf("main.layout", s.Layout)
+	}
+
+	for name, w := range sessionOffsetWidgets() {
+		if offs, ok := s.Offsets[name]; ok {
+			w.SetOffsets(offs, app)
+		}
+	}
+}
+
+// runPendingSession restores the selected packet, marks, search and views of
+// a session loaded with :session load. It does nothing if a different pcap was
+// loaded in the meantime.
+//
+// Runs in app goroutine
+func runPendingSession(app gowid.IApp) {
+	s := pendingSession
+	pendingSession = nil
+	if s == nil || s.Pcap != Loader.Pcap() {
+		return
+	}
+
+	curExpandedStructNodes = make(pdmltree.ExpandedPaths, 0, len(s.Expanded))
+	curExpandedStructNodes = append(curExpandedStructNodes, s.Expanded...)
+
+	clearMarks()
+	for k, v := range s.Marks {
+		if r := []rune(k); len(r) == 1 && r[0] >= 'a' && r[0] <= 'z' {
+			marksMap[r[0]] = v
+		}
+	}
+
+	if s.Packet != 0 && packetListView != nil {
+		tableRow, err := tableRowFromPacketNumber(s.Packet)
+		if err != nil {
+			OpenError(err.Error(), app)
+		} else {
+			tableCol := 0
+			curTablePos, err := packetListView.FocusXY()
+			if err == nil {
+				tableCol = curTablePos.Column
+			}
+			packetListView.SetFocusXY(app, table.Coords{Column: tableCol, Row: tableRow})
+		}
+	}
+
+	if s.Search != nil && SearchWidget != nil {
+		SearchWidget.SetSearch(s.Search.Type, s.Search.Target, s.Search.CaseSensitive, app)
+		SearchWidget.SetValue(s.Search.Value, app)
+		if s.Search.Open {
+			filterHolder.SetSubWidget(filterWithSearch, app)
+		} else {
+			filterHolder.SetSubWidget(filterWithoutSearch, app)
+		}
+	}
+
+	if s.Stream != nil {
+		proto := streams.TCP
+		if s.Stream.Proto == "udp" {
+			proto = streams.UDP
+		}
+		openStreamReassembly(proto, s.Stream.Index, s.Stream.PreviousFilter, app)
+	} else if s.Convs != nil {
+		profiles.SetConf("main.conv-use-filter", s.Convs.UseFilter)
+		profiles.SetConf("main.conv-absolute-time", s.Convs.AbsoluteTime)
+		profiles.SetConf("main.conv-resolve-names", s.Convs.ResolveNames)
+		// Recalculate in case the settings differ from those last used
+		convsView = nil
+		openConvsUi(app)
+	}
+}
+
+//======================================================================
+
+// RestorePendingSession finishes restoring a session once its packets have
+// loaded.
+type RestorePendingSession struct{}
+
+var _ pcap.IAfterEnd = RestorePendingSession{}
+
+func (t RestorePendingSession) AfterEnd(code pcap.HandlerCode, app gowid.IApp) {
+	if code&pcap.PsmlCode == 0 {
+		return
+	}
+	runPendingSession(app)
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 78
+// End:
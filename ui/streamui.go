@@ -102,16 +102,21 @@ func startStreamReassembly(app gowid.IApp) {
 		}
 	}
 
-	filterProto := gwutil.If(proto == streams.TCP, "tcp", "udp").(string)
+	openStreamReassembly(proto, streamIndex.Val(), FilterWidget.Value(), app)
+}
 
-	filter := fmt.Sprintf("%s.stream eq %d", filterProto, streamIndex.Val())
+// openStreamReassembly filters the packet list to show only the given stream,
+// then opens the reassembly view for it. previousFilterValue is restored if the
+// user filters the stream out.
+func openStreamReassembly(proto streams.Protocol, idx int, previousFilterValue string, app gowid.IApp) {
+	filterProto := gwutil.If(proto == streams.TCP, "tcp", "udp").(string)
 
-	previousFilterValue := FilterWidget.Value()
+	filter := fmt.Sprintf("%s.stream eq %d", filterProto, idx)
 
 	FilterWidget.SetValue(filter, app)
 	RequestNewFilter(filter, app)
 
-	currentStreamKey = &streamKey{proto: proto, idx: streamIndex.Val()}
+	currentStreamKey = &streamKey{proto: proto, idx: idx}
 
 	newSize, reset := termshark.FileSizeDifferentTo(Loader.PcapPdml, streamsPcapSize)
 	if reset {
@@ -147,14 +152,14 @@ func startStreamReassembly(app gowid.IApp) {
 			app:   app,
 			name:  Loader.String(),
 			proto: proto,
-			idx:   streamIndex.Val(),
+			idx:   idx,
 			wid:   swid,
 		}
 
 		StreamLoader.StartLoad(
 			Loader.PcapPdml,
 			filterProto,
-			streamIndex.Val(),
+			idx,
 			app,
 			sh,
 		)
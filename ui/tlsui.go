@@ -0,0 +1,130 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+package ui
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/gcla/gowid"
+	"github.com/gcla/gowid/widgets/checkbox"
+	"github.com/gcla/gowid/widgets/columns"
+	"github.com/gcla/gowid/widgets/dialog"
+	"github.com/gcla/gowid/widgets/divider"
+	"github.com/gcla/gowid/widgets/edit"
+	"github.com/gcla/gowid/widgets/framed"
+	"github.com/gcla/gowid/widgets/pile"
+	"github.com/gcla/gowid/widgets/text"
+	"github.com/gcla/termshark/v2/configs/profiles"
+	"github.com/gcla/termshark/v2/pkg/shark"
+	"github.com/gcla/termshark/v2/widgets/appkeys"
+	"github.com/gdamore/tcell/v2"
+)
+
+//======================================================================
+
+// setTLSKeylog stores the TLS decryption settings in the current profile and,
+// if they change what tshark will be given, reloads the current source so that
+// decrypted TLS appears in the packet views.
+func setTLSKeylog(file string, fromEnv bool, app gowid.IApp) error {
+	if file != "" {
+		if _, err := os.Stat(file); err != nil {
+			return fmt.Errorf("Could not open keylog file %s: %v", file, err)
+		}
+	}
+
+	prev := shark.TLSKeylogFile()
+
+	profiles.SetConf("main.tls-keylog-file", file)
+	profiles.SetConf("main.tls-keylog-from-env", fromEnv)
+
+	cur := shark.TLSKeylogFile()
+
+	if cur != prev && !Loader.Empty() {
+		RequestReload(app)
+	}
+
+	if cur == "" {
+		OpenMessage("TLS decryption is now off.", appView, app)
+	} else {
+		OpenMessage(fmt.Sprintf("TLS will be decrypted using keylog file %s.", cur), appView, app)
+	}
+
+	return nil
+}
+
+func openTLSKeylog(app gowid.IApp) {
+	var tlsDialog *dialog.Widget
+
+	fileWidget := edit.New(edit.Options{
+		Text: profiles.ConfString("main.tls-keylog-file", ""),
+	})
+
+	envCheckBox := checkbox.New(profiles.ConfBool("main.tls-keylog-from-env", false))
+
+	okFunc := func(app gowid.IApp, _ gowid.IWidget) {
+		tlsDialog.Close(app)
+		if err := setTLSKeylog(fileWidget.Text(), envCheckBox.IsChecked(), app); err != nil {
+			OpenError(err.Error(), app)
+		}
+	}
+
+	fileWidgetExt := appkeys.New(
+		fileWidget,
+		func(ev *tcell.EventKey, app gowid.IApp) bool {
+			res := false
+			switch ev.Key() {
+			case tcell.KeyEnter:
+				okFunc(app, fileWidget)
+				res = true
+			}
+			return res
+		},
+		appkeys.Options{
+			ApplyBefore: true,
+		},
+	)
+
+	envMsg := "Use $SSLKEYLOGFILE if no file is given: "
+	if env := os.Getenv("SSLKEYLOGFILE"); env != "" {
+		envMsg = fmt.Sprintf("Use $SSLKEYLOGFILE (%s) if no file is given: ", env)
+	}
+
+	okBtn := dialog.Button{
+		Msg:    "Ok",
+		Action: gowid.MakeWidgetCallback("exec", gowid.WidgetChangedFunction(okFunc)),
+	}
+
+	tlsView := framed.NewSpace(pile.NewFlow(
+		text.New(fmt.Sprintf("TLS decryption for profile %s.", profiles.CurrentName())),
+		divider.NewBlank(),
+		text.New("Keylog file (NSS key log format):"),
+		divider.NewBlank(),
+		framed.NewUnicode(fileWidgetExt),
+		divider.NewBlank(),
+		columns.NewFixed(text.New(envMsg), envCheckBox),
+	))
+
+	tlsDialog = dialog.New(
+		tlsView,
+		dialog.Options{
+			Buttons:         []dialog.Button{okBtn, dialog.Cancel},
+			NoShadow:        true,
+			BackgroundStyle: gowid.MakePaletteRef("dialog"),
+			BorderStyle:     gowid.MakePaletteRef("dialog"),
+			ButtonStyle:     gowid.MakePaletteRef("dialog-button"),
+			Modal:           true,
+			FocusOnWidget:   true,
+		},
+	)
+
+	tlsDialog.Open(appView, ratio(0.6), app)
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 110
+// End:
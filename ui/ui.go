@@ -47,6 +47,7 @@ import (
 	"github.com/gcla/gowid/widgets/vpadding"
 	"github.com/gcla/termshark/v2"
 	"github.com/gcla/termshark/v2/configs/profiles"
+	"github.com/gcla/termshark/v2/pkg/dfilter"
 	"github.com/gcla/termshark/v2/pkg/fields"
 	"github.com/gcla/termshark/v2/pkg/noroot"
 	"github.com/gcla/termshark/v2/pkg/pcap"
@@ -94,6 +95,7 @@ const (
 // test
 var appViewNoKeys *holder.Widget
 var appView *holder.Widget
+var appViewNoDialogs gowid.IWidget // what appView holds when no dialog is open
 var mbView *holder.Widget
 var mainViewNoKeys *holder.Widget
 var mainView *appkeys.KeyWidget
@@ -172,6 +174,10 @@ var multiMenu2Opener MultiMenuOpener
 var tabViewsForward map[gowid.IWidget]gowid.IWidget
 var tabViewsBackward map[gowid.IWidget]gowid.IWidget
 
+// Kept for the command palette
+var generalMenuItems []menuutil.SimpleMenuItem
+var analysisMenuItems []menuutil.SimpleMenuItem
+
 var currentProfile *text.Widget
 var currentProfileWidget *columns.Widget
 var currentProfileWidgetHolder *holder.Widget
@@ -242,6 +248,7 @@ var NoGlobalJump termshark.GlobalJumpPos // leave as default, like a placeholder
 
 var Loader *pcap.PacketLoader
 var FieldCompleter *fields.TSharkFields // share this - safe once constructed
+var FieldValues *fields.FieldValues     // values of fields in the loaded packets, for filter completion
 
 var WriteToSelected bool       // true if the user provided the -w flag
 var WriteToDeleted bool        // true if the user deleted the temporary pcap before quitting
@@ -272,6 +279,7 @@ func init() {
 	TemplateData["Marks"] = marksMap
 	TemplateData["GlobalMarks"] = globalMarksMap
 	TemplateData["Maps"] = getMappings{}
+	TemplateData["Jumps"] = getJumps{}
 }
 
 type globalJump struct {
@@ -289,6 +297,33 @@ func (g getMappings) None() bool {
 	return len(termshark.LoadKeyMappings()) == 0
 }
 
+type keyMappingGroup struct {
+	Title    string
+	Mappings []termshark.KeyMapping
+}
+
+// Groups returns the mappings for every view first, then those for each
+// view in turn.
+func (g getMappings) Groups() []keyMappingGroup {
+	mappings := termshark.LoadKeyMappings()
+	res := make([]keyMappingGroup, 0)
+	for _, view := range append([]string{""}, keyMappingViewNames...) {
+		group := keyMappingGroup{Title: fmt.Sprintf("View: %s", view)}
+		if view == "" {
+			group.Title = "All views"
+		}
+		for _, mapping := range mappings {
+			if mapping.View == view {
+				group.Mappings = append(group.Mappings, mapping)
+			}
+		}
+		if len(group.Mappings) > 0 {
+			res = append(res, group)
+		}
+	}
+	return res
+}
+
 //======================================================================
 
 type MultiMenuOpener struct {
@@ -356,10 +391,9 @@ func useAsColumn(filter string, name string, app gowid.IApp) {
 	RequestReload(app)
 }
 
-// Build the menu dynamically when needed so I can include the filter in the widgets
-func makePdmlFilterMenu(filter string, val string) *menu.Widget {
-	sites := make(menuutil.SiteMap)
-
+// pdmlFilterString returns a display filter matching the field's value e.g.
+// tcp.port == 80, or just the field if there is no value.
+func pdmlFilterString(filter string, val string) string {
 	needQuotes := false
 
 	ok, field := FieldCompleter.LookupField(filter)
@@ -386,6 +420,25 @@ func makePdmlFilterMenu(filter string, val string) *menu.Widget {
 		}
 	}
 
+	return filterStr
+}
+
+// openDecodeAsForField opens the Decode As editor with the field's selector
+// and value filled in, if it has a selector.
+func openDecodeAsForField(filter string, val string, app gowid.IApp) {
+	if sel, ok := shark.DecodeAsSelectorFor(filter); ok {
+		openDecodeAs(sel, val, app)
+	} else {
+		openDecodeAs("", "", app)
+	}
+}
+
+// Build the menu dynamically when needed so I can include the filter in the widgets
+func makePdmlFilterMenu(filter string, val string) *menu.Widget {
+	sites := make(menuutil.SiteMap)
+
+	filterStr := pdmlFilterString(filter, val)
+
 	var pdmlFilterMenu *menu.Widget
 
 	openPdmlFilterMenu2 := func(prep bool, w gowid.IWidget, app gowid.IApp) {
@@ -436,6 +489,14 @@ func makePdmlFilterMenu(filter string, val string) *menu.Widget {
 				useAsColumn(curColumnFilter, curColumnFilterName, app)
 			},
 		},
+		menuutil.SimpleMenuItem{
+			Txt: "Decode As...",
+			Key: gowid.MakeKey('d'),
+			CB: func(app gowid.IApp, w gowid.IWidget) {
+				multiMenu1Opener.CloseMenu(pdmlFilterMenu, app)
+				openDecodeAsForField(filter, val, app)
+			},
+		},
 		menuutil.MakeMenuDivider(),
 		menuutil.SimpleMenuItem{
 			Txt: fmt.Sprintf("Apply Filter: %s", filterStr),
@@ -694,6 +755,8 @@ func clearPacketViews(app gowid.IApp) {
 	packetListViewHolder.SetSubWidget(nullw, app)
 	packetStructureViewHolder.SetSubWidget(nullw, app)
 	packetHexViewHolder.SetSubWidget(nullw, app)
+
+	clearRelatedPackets()
 }
 
 //======================================================================
@@ -880,7 +943,21 @@ func makeStructNodeWidget(pos tree.IPos, tr tree.IModel) gowid.IWidget {
 		gowid.MakeStyledAs(gowid.StyleBold),
 	)
 
-	structText := text.New(tr.Leaf())
+	var structText gowid.IWidget = text.New(tr.Leaf())
+
+	// A field like tcp.analysis.acks_frame refers to another packet - make it a link
+	// to that packet
+	if FieldCompleter != nil {
+		if num, ok := tr.(*pdmltree.Model).FrameRef(FieldCompleter); ok {
+			frameRefButton := button.NewBare(structText)
+			frameRefButton.OnClick(gowid.MakeWidgetCallback("cb", func(app gowid.IApp, w gowid.IWidget) {
+				if err := goToPacketNumber(num, app); err != nil {
+					OpenError(err.Error(), app)
+				}
+			}))
+			structText = styled.New(frameRefButton, gowid.MakeStyledAs(gowid.StyleUnderline))
+		}
+	}
 
 	structIfNotSel := columns.NewFixed(structText)
 	structIfSel := columns.NewFixed(structText, colSpace, pdmlMenuButtonSite, styledButton1)
@@ -1044,12 +1121,19 @@ func (t *psmlTableRowWidget) At(lpos list.IWalkerPosition) gowid.IWidget {
 	}
 	pos := int(lpos.(table.Position))
 
-	// Check the color array length because it might not yet be adequately
-	// populated from the arriving psml.
-	if pos >= 0 && PacketColors && pos < len(t.colors) {
-		res = styled.New(res,
-			gowid.MakePaletteEntry(t.colors[pos].FG, t.colors[pos].BG),
-		)
+	if pos >= 0 && PacketColors {
+		// Termshark's own coloring rules take precedence over tshark's
+		if colors, ok := colorRuleColorsAt(t, pos); ok {
+			res = styled.New(res,
+				gowid.MakePaletteEntry(colors.FG, colors.BG),
+			)
+		} else if !colorRulesReplaceTshark && pos < len(t.colors) {
+			// Check the color array length because it might not yet be adequately
+			// populated from the arriving psml.
+			res = styled.New(res,
+				gowid.MakePaletteEntry(t.colors[pos].FG, t.colors[pos].BG),
+			)
+		}
 	}
 
 	return res
@@ -1410,7 +1494,24 @@ func reallyQuit(app gowid.IApp) {
 }
 
 func lastLineMode(app gowid.IApp) {
+	setupMiniBuffer(app)
+	minibuffer.Open(MiniBuffer, mbView, ratio(1.0), app)
+}
+
+// invokeCommand runs a minibuffer command without opening the minibuffer -
+// for scripts and remote control.
+func invokeCommand(app gowid.IApp, words ...string) error {
+	if MiniBuffer == nil {
+		setupMiniBuffer(app)
+	}
+	return MiniBuffer.Invoke(app, words...)
+}
+
+// setupMiniBuffer makes a new minibuffer with termshark's commands
+// registered.
+func setupMiniBuffer(app gowid.IApp) {
 	MiniBuffer = minibuffer.New()
+	MiniBuffer.SetHistory(cmdlineHistory{})
 
 	MiniBuffer.Register("quit", minibufferFn(func(gowid.IApp, ...string) error {
 		reallyQuit(app)
@@ -1432,7 +1533,7 @@ func lastLineMode(app gowid.IApp) {
 		if profiles.Current() != profiles.Default() {
 			prof = fmt.Sprintf("in profile %s ", profiles.CurrentName())
 		}
-		OpenMessage(fmt.Sprintf("Cleared theme %sfor terminal mode %v.", prof, app.GetColorMode()), appView, app)
+		commandMessage(fmt.Sprintf("Cleared theme %sfor terminal mode %v.", prof, app.GetColorMode()), app)
 		return nil
 	}))
 
@@ -1450,6 +1551,14 @@ func lastLineMode(app gowid.IApp) {
 		startCapinfo(app)
 		return nil
 	}))
+	MiniBuffer.Register("capstats", minibufferFn(func(app gowid.IApp, s ...string) error {
+		openCaptureStatsUi(app)
+		return nil
+	}))
+	MiniBuffer.Register("watch", minibufferFn(func(app gowid.IApp, s ...string) error {
+		openWatchRulesUi(app)
+		return nil
+	}))
 
 	MiniBuffer.Register("columns", minibufferFn(func(gowid.IApp, ...string) error {
 		openEditColumns(app)
@@ -1471,16 +1580,34 @@ func lastLineMode(app gowid.IApp) {
 		return nil
 	}))
 
+	MiniBuffer.Register("freeze", minibufferFn(func(app gowid.IApp, s ...string) error {
+		togglePacketListFrozen(app)
+		return nil
+	}))
 	MiniBuffer.Register("clear-filter", minibufferFn(func(gowid.IApp, ...string) error {
 		FilterWidget.SetValue("", app)
 		RequestNewFilter(FilterWidget.Value(), app)
 		return nil
 	}))
 
+	MiniBuffer.Register("prefs", minibufferFn(func(app gowid.IApp, s ...string) error {
+		openPrefsUi(app)
+		return nil
+	}))
+
+	MiniBuffer.Register("palette", minibufferFn(func(app gowid.IApp, s ...string) error {
+		openCommandPalette(app)
+		return nil
+	}))
+
 	MiniBuffer.Register("marks", minibufferFn(func(gowid.IApp, ...string) error {
 		OpenTemplatedDialogExt(appView, "Marks", fixed, ratio(0.6), app)
 		return nil
 	}))
+	MiniBuffer.Register("jumps", minibufferFn(func(gowid.IApp, ...string) error {
+		OpenTemplatedDialogExt(appView, "Jumps", fixed, ratio(0.6), app)
+		return nil
+	}))
 
 	if runtime.GOOS != "windows" {
 		MiniBuffer.Register("logs", minibufferFn(func(gowid.IApp, ...string) error {
@@ -1499,15 +1626,33 @@ func lastLineMode(app gowid.IApp) {
 	MiniBuffer.Register("r", readCommand{complete: false})
 	MiniBuffer.Register("e", readCommand{complete: false})
 	MiniBuffer.Register("load", readCommand{complete: true})
+	MiniBuffer.Register("source", sourceCommand{})
 	MiniBuffer.Register("recents", recentsCommand{})
 	MiniBuffer.Register("filter", filterCommand{})
 	MiniBuffer.Register("theme", themeCommand{})
 	MiniBuffer.Register("profile", newProfileCommand())
+	MiniBuffer.Register("session", newSessionCommand())
+	MiniBuffer.Register("tls", tlsCommand{})
+	MiniBuffer.Register("build-filter", filterBuilderCommand{})
+	MiniBuffer.Register("filter-button", filterButtonCommand{})
+	MiniBuffer.Register("decode-as", minibufferFn(func(app gowid.IApp, s ...string) error {
+		openDecodeAs("", "", app)
+		return nil
+	}))
+	MiniBuffer.Register("color-rules", minibufferFn(func(app gowid.IApp, s ...string) error {
+		openColorRulesUi(app)
+		return nil
+	}))
+	MiniBuffer.Register("colorize", colorizeCommand{})
+	MiniBuffer.Register("capture-opts", captureOptionsCommand{})
+	MiniBuffer.Register("extcap", extcapCommand{})
+	MiniBuffer.Register("cfilter", minibufferFn(func(app gowid.IApp, s ...string) error {
+		openCaptureFilterUi(app)
+		return nil
+	}))
 	MiniBuffer.Register("map", mapCommand{w: keyMapper})
 	MiniBuffer.Register("unmap", unmapCommand{w: keyMapper})
 	MiniBuffer.Register("help", helpCommand{})
-
-	minibuffer.Open(MiniBuffer, mbView, ratio(1.0), app)
 }
 
 //======================================================================
@@ -1553,10 +1698,15 @@ func reallyClear(app gowid.IApp) {
 					MakePacketViewUpdater(),
 					MakeUpdateCurrentCaptureInTitle(),
 					ManageStreamCache{},
+					ManageJumps{},
 					ManageCapinfoCache{},
+					ManageFieldValuesCache{},
+					ManageCaptureStats{},
+					ManageWatchRules{},
 					SetStructWidgets{Loader}, // for OnClear
 					ClearMarksHandler{},
 					ManageSearchData{},
+					NotifyRemoteClients{},
 					CancelledMessage{},
 				},
 			)
@@ -1793,9 +1943,38 @@ func tableRowFromPacketNumber(savedPacket int) (int, error) {
 		return -1, fmt.Errorf("Error looking up packet %v", packetRowId)
 	}
 
+	// The caller is about to jump, so remember where from
+	recordJump()
+
 	return tableRow, nil
 }
 
+// goToPacketNumber selects the packet with the number provided, keeping the
+// current column, and saves the packet it jumps from as the last jump position.
+//
+// Runs in app goroutine
+func goToPacketNumber(num int, app gowid.IApp) error {
+	if packetListView == nil {
+		return fmt.Errorf("No packets are loaded")
+	}
+	tableRow, err := tableRowFromPacketNumber(num)
+	if err != nil {
+		return err
+	}
+
+	tableCol := 0
+	curTablePos, err := packetListView.FocusXY()
+	if err == nil {
+		tableCol = curTablePos.Column
+	}
+
+	pn, _ := packetNumberFromCurrentTableRow() // save for ''
+	lastJumpPos = pn.Pos
+
+	packetListView.SetFocusXY(app, table.Coords{Column: tableCol, Row: tableRow})
+	return nil
+}
+
 func packetNumberFromTableRow(tableRow int) (termshark.JumpPos, error) {
 	packetRowId, ok := packetListView.Model().RowIdentifier(tableRow)
 	if !ok {
@@ -1863,7 +2042,11 @@ func searchPacketsMainView(evk *tcell.EventKey, app gowid.IApp) bool {
 func vimKeysMainView(evk *tcell.EventKey, app gowid.IApp) bool {
 	handled := true
 
-	if evk.Key() == tcell.KeyCtrlW && keyState.PartialCtrlWCmd {
+	if evk.Key() == tcell.KeyCtrlO || (evk.Key() == tcell.KeyLeft && evk.Modifiers()&tcell.ModAlt != 0) {
+		jumpBack(app)
+	} else if evk.Key() == tcell.KeyRight && evk.Modifiers()&tcell.ModAlt != 0 {
+		jumpForward(app)
+	} else if evk.Key() == tcell.KeyCtrlW && keyState.PartialCtrlWCmd {
 		cycleView(app, true, tabViewsForward)
 	} else if evk.Key() == tcell.KeyRune && evk.Rune() == '=' && keyState.PartialCtrlWCmd {
 		clearOffsets(app)
@@ -1996,6 +2179,62 @@ func vimKeysMainView(evk *tcell.EventKey, app gowid.IApp) bool {
 	return handled
 }
 
+// The views that can have their own key mappings
+var keyMappingViewNames = []string{"list", "struct", "hex", "stream", "convs", "minibuffer"}
+
+type keyMappingViews struct{}
+
+var _ mapkeys.IView = keyMappingViews{}
+
+// CurrentView returns the name of the view with focus, or "" if none of those
+// in keyMappingViewNames has focus - for example, if the display filter has
+// focus or a dialog is open.
+func (v keyMappingViews) CurrentView(app gowid.IApp) string {
+	if MiniBuffer != nil && MiniBuffer.IsOpen() {
+		return "minibuffer"
+	}
+	if appView.SubWidget() != appViewNoDialogs {
+		return ""
+	}
+	switch appViewNoKeys.SubWidget() {
+	case streamView:
+		return "stream"
+	case convsViewWithKeys:
+		return "convs"
+	case mainView:
+	default:
+		return ""
+	}
+	return currentPacketPane()
+}
+
+// currentPacketPane returns "list", "struct" or "hex" for the packet pane with
+// focus, or "" if none has - for example, if the display filter has focus.
+func currentPacketPane() string {
+	switch mainViewNoKeys.SubWidget() {
+	case viewOnlyPacketList:
+		return "list"
+	case viewOnlyPacketStructure:
+		return "struct"
+	case viewOnlyPacketHex:
+		return "hex"
+	}
+	for i, name := range []string{"list", "struct", "hex"} {
+		if !currentlyFocusedViewNotByIndex(i) {
+			return name
+		}
+	}
+	return ""
+}
+
+func applyKeyMapping(w *mapkeys.Widget, km termshark.KeyMapping, app gowid.IApp) {
+	if km.View == "" {
+		w.AddMapping(km.From, km.To, app)
+	} else {
+		w.AddViewMapping(km.View, km.From, km.To, app)
+	}
+}
+
 func currentlyFocusedViewNotHex() bool {
 	return currentlyFocusedViewNotByIndex(2)
 }
@@ -2211,8 +2450,18 @@ func appKeyPress(evk *tcell.EventKey, app gowid.IApp) bool {
 		reallyQuit(app)
 	} else if evk.Key() == tcell.KeyCtrlL {
 		app.Sync()
+	} else if evk.Key() == tcell.KeyCtrlS {
+		togglePacketListFrozen(app)
+	} else if evk.Key() == tcell.KeyCtrlP {
+		openCommandPalette(app)
+	} else if isrune && evk.Rune() == 'q' && keyMapper.IsRecording() {
+		stopMacroRecording(app)
+	} else if isrune && evk.Rune() == 'q' && profiles.ConfBool("main.record-macros", false) {
+		keyState.PartialqCmd = true
 	} else if isrune && (evk.Rune() == 'q' || evk.Rune() == 'Q') {
 		reallyQuit(app)
+	} else if isrune && evk.Rune() == '@' {
+		keyState.PartialAtCmd = true
 	} else if isrune && evk.Rune() == ':' {
 		lastLineMode(app)
 	} else if evk.Key() == tcell.KeyEscape {
@@ -2344,16 +2593,9 @@ func setLowerWidgets(app gowid.IApp) {
 			row2, _ := packetListView.Model().RowIdentifier(fxy.Row)
 			row := int(row2)
 
-			hex := getHexWidgetToDisplay(row)
-			if hex != nil {
-				sw1 = enableselected.New(
-					withscrollbar.New(
-						hex,
-						withscrollbar.Options{
-							HideIfContentFits: true,
-						},
-					),
-				)
+			hexView := getHexViewToDisplay(row)
+			if hexView != nil {
+				sw1 = enableselected.New(hexView)
 			}
 
 			str := getStructWidgetToDisplay(row, app)
@@ -2440,6 +2682,11 @@ func makePacketListModel(psml iPsmlInfo, app gowid.IApp) *psmlmodel.Model {
 		if !avgs[i].IsNone() {
 			avg = gwutil.Max(avgs[i].Val(), titleLen)
 		}
+		// Room for the gutter marking packets related to the selected packet
+		if i == 0 {
+			avg++
+			max++
+		}
 		// This makes the UI look nicer - an extra column of space when the columns are
 		// packed tightly and each column is usually full.
 		if avg == max {
@@ -2449,6 +2696,8 @@ func makePacketListModel(psml iPsmlInfo, app gowid.IApp) *psmlmodel.Model {
 		}
 	}
 
+	shownPacketCount = len(psml.PsmlData())
+
 	packetPsmlTableModel := table.NewSimpleModel(
 		headers,
 		psml.PsmlData(),
@@ -2471,6 +2720,7 @@ func makePacketListModel(psml iPsmlInfo, app gowid.IApp) *psmlmodel.Model {
 		packetPsmlTableModel,
 		gowid.MakePaletteRef("packet-list-row-focus"),
 	)
+	expandingModel.Marker = packetListMarker{}
 
 	// No need to refetch the information from the TOML file each time this is
 	// called. Use a globally cached version
@@ -2492,7 +2742,13 @@ func makePacketListModel(psml iPsmlInfo, app gowid.IApp) *psmlmodel.Model {
 }
 
 func updatePacketListWithData(psml iPsmlInfo, app gowid.IApp) {
+	// Leave the list as it is, but say how many packets are waiting
+	if PacketListFrozen {
+		updateFrozenIndicator(psml, app)
+		return
+	}
 	packetListView.colors = psml.PsmlColors() // otherwise this isn't updated
+	updateColorRuleMatches(false, app)
 	model := makePacketListModel(psml, app)
 	newPacketsArrived = true
 	packetListTable.SetModel(model, app)
@@ -2612,6 +2868,8 @@ func setPacketListWidgets(psml iPsmlInfo, app gowid.IApp) {
 		// be populated, display a loading message
 
 		setLowerWidgets(app)
+
+		notifyRemoteSelection()
 	}))
 
 	withScrollbar := withscrollbar.New(packetListView, withscrollbar.Options{
@@ -2629,7 +2887,9 @@ func setPacketListWidgets(psml iPsmlInfo, app gowid.IApp) {
 	packetListViewHolder.SetSubWidget(keys, app)
 }
 
-func expandStructWidgetAtPosition(row int, pos int, app gowid.IApp) {
+// expandStructWidgetAtPosition expands the struct widget to show the innermost field at the position
+// provided in one of the packet's data sources - 0 is the frame.
+func expandStructWidgetAtPosition(row int, pos int, sources [][]byte, source int, app gowid.IApp) {
 	if curPacketStructWidget != nil {
 		walker := curPacketStructWidget.Walker().(*noroot.Walker)
 		curTree := walker.Tree().(*pdmltree.Model)
@@ -2646,7 +2906,7 @@ func expandStructWidgetAtPosition(row int, pos int, app gowid.IApp) {
 			for i, ch := range curTree.Children_[hack:] {
 				// Save the current best one - but keep going. The pdml does not necessarily present them sorted
 				// by position. So we might need to skip one to find the best fit.
-				if ch.Pos <= pos && pos < ch.Pos+ch.Size {
+				if ch.Pos <= pos && pos < ch.Pos+ch.Size && ch.DataSource(sources) == source {
 					chosenTree = ch
 					chosenIdx = i
 				}
@@ -2685,77 +2945,26 @@ func updateCurrentPdmlPositionFrom(tr tree.IModel, pos tree.IPos) {
 	curPdmlPosition = treeAtCurPos.(*pdmltree.Model).PathToRoot()
 }
 
-func getLayersFromStructWidget(row int, pos int) []hexdumper2.LayerStyler {
-	layers := make([]hexdumper2.LayerStyler, 0)
-
-	model := getCurrentStructModel(row)
-	if model != nil {
-		layers = model.HexLayers(pos, false)
+// getLayersFromStructModel returns the layers of the decoded packet to show in the hex view of the data source
+// provided. The model, if not nil, must have its parent links made.
+func getLayersFromStructModel(model *pdmltree.Model, pos int, sources [][]byte, source int) []hexdumper2.LayerStyler {
+	if model == nil {
+		return make([]hexdumper2.LayerStyler, 0)
 	}
-
-	return layers
+	return model.SourceHexLayers(pos, false, sources, source)
 }
 
 func getHexWidgetKey(row int) []byte {
 	return []byte(fmt.Sprintf("p%d", row))
 }
 
-// Can return nil
+// getHexWidgetToDisplay returns the hex widget for the bytes of the frame at the row provided, or nil
+// if they aren't loaded.
 func getHexWidgetToDisplay(row int) *hexdumper2.Widget {
-	var res2 *hexdumper2.Widget
-
-	if val, ok := packetHexWidgets.Get(row); ok {
-		res2 = val.(*hexdumper2.Widget)
-	} else {
-		pktsPerLoad := Loader.PacketsPerLoad()
-
-		row2 := (row / pktsPerLoad) * pktsPerLoad
-		if ws, ok := Loader.PacketCache.Get(row2); ok {
-			srca := ws.(pcap.CacheEntry).Pcap
-			if len(srca) > row%pktsPerLoad {
-				src := srca[row%pktsPerLoad]
-				b := make([]byte, len(src))
-				copy(b, src)
-
-				layers := getLayersFromStructWidget(row, 0)
-				res2 = hexdumper2.New(b, hexdumper2.Options{
-					StyledLayers:      layers,
-					CursorUnselected:  "hex-byte-unselected",
-					CursorSelected:    "hex-byte-selected",
-					LineNumUnselected: "hex-interval-unselected",
-					LineNumSelected:   "hex-interval-selected",
-					PaletteIfCopying:  "copy-mode",
-				})
-
-				// If the user moves the cursor in the hexdump, this callback will adjust the corresponding
-				// pdml tree/struct widget's currently selected layer. That in turn will result in a callback
-				// to the hex widget to set the active layers.
-				res2.OnPositionChanged(gowid.MakeWidgetCallback("cb", func(app gowid.IApp, target gowid.IWidget) {
-					// If we're not focused on hex, then don't expand the struct widget. That's because if
-					// we're focused on struct, then changing the struct position causes a callback to the
-					// hex to update layers - which can update the hex position - which invokes a callback
-					// to change the struct again. So ultimately, moving the struct moves the hex position
-					// which moves the struct and causes the struct to jump around. I need to check
-					// the alt view too because the user can click with the mouse and in one view have
-					// struct selected but in the other view have hex selected.
-
-					// Propagate the adjustments to pane positions if:
-					// - this was initiated from a non-struct pane e.g. the hex pane. Then we update struct
-					// - this was via an override e.g. search for packet bytes. Then hex is updated on match
-					//   which should then update the struct view
-					if currentlyFocusedViewNotStruct() || allowHexToStructRepositioning {
-						expandStructWidgetAtPosition(row, res2.Position(), app)
-					}
-
-					// Ensure the behavior is reset after this callback runs. Just do it once.
-					allowHexToStructRepositioning = false
-				}))
-
-				packetHexWidgets.Add(row, res2)
-			}
-		}
+	if hexView := getHexViewToDisplay(row); hexView != nil {
+		return hexView.Hex(0)
 	}
-	return res2
+	return nil
 }
 
 //======================================================================
@@ -2800,6 +3009,7 @@ func getStructWidgetToDisplay(row int, app gowid.IApp) gowid.IWidget {
 	var res gowid.IWidget
 
 	model := getCurrentStructModel(row)
+	setRelatedPackets(model)
 	if model != nil {
 
 		// Apply expanded paths from previous packet
@@ -2821,8 +3031,8 @@ func getStructWidgetToDisplay(row int, app gowid.IApp) gowid.IWidget {
 		// which then calls back to the hex
 		updateHex := func(app gowid.IApp, doCursor bool, twalker tree.ITreeWalker) {
 
-			newhex := getHexWidgetToDisplay(row)
-			if newhex != nil {
+			hexView := getHexViewToDisplay(row)
+			if hexView != nil {
 
 				newtree := twalker.Tree().(*pdmltree.Model)
 				newpos := twalker.Focus().(tree.IPos)
@@ -2831,6 +3041,12 @@ func getStructWidgetToDisplay(row int, app gowid.IApp) gowid.IWidget {
 
 				leaf := newpos.GetSubStructure(expTree).(*pdmltree.ExpandedModel)
 
+				// The field might be in reassembled or decrypted data, for example, rather than the
+				// frame - so show that data source's bytes
+				source := (*pdmltree.Model)(leaf).DataSource(hexView.Sources())
+				hexView.SetSource(source, app)
+				newhex := hexView.Hex(source)
+
 				coverWholePacket := false
 
 				// This skips the "frame" node in the pdml that covers the entire range of bytes. If newpos
@@ -2843,7 +3059,7 @@ func getStructWidgetToDisplay(row int, app gowid.IApp) gowid.IWidget {
 					coverWholePacket = true
 				}
 
-				newLayers := newtree.HexLayers(leaf.Pos, coverWholePacket)
+				newLayers := newtree.SourceHexLayers(leaf.Pos, coverWholePacket, hexView.Sources(), source)
 				if len(newLayers) > 0 {
 					newhex.SetLayers(newLayers, app)
 
@@ -2967,11 +3183,16 @@ func RequestLoadInterfaces(psrcs []pcap.IPacketSource, captureFilter string, dis
 			MakePacketViewUpdater(),
 			MakeUpdateCurrentCaptureInTitle(),
 			ManageStreamCache{},
+			ManageJumps{},
 			ManageCapinfoCache{},
+			ManageFieldValuesCache{},
+			ManageCaptureStats{},
+			ManageWatchRules{},
 			SetStructWidgets{Loader}, // for OnClear
 			ClearWormholeState{},
 			ClearMarksHandler{},
 			ManageSearchData{},
+			NotifyRemoteClients{},
 			CancelledMessage{},
 		},
 		app,
@@ -3001,11 +3222,17 @@ func RequestLoadPcap(pcapf string, displayFilter string, jump termshark.GlobalJu
 		MakeUpdateCurrentCaptureInTitle(),
 		ManageStreamCache{},
 		ManageCapinfoCache{},
+		ManageFieldValuesCache{},
+		ManageCaptureStats{},
 		SetStructWidgets{Loader}, // for OnClear
 		MakeCheckGlobalJumpAfterPsml(jump),
+		RunPendingScript{},
+		RestorePendingSession{},
+		ManageJumps{},
 		ClearWormholeState{},
 		ClearMarksHandler{},
 		ManageSearchData{},
+		NotifyRemoteClients{},
 		CancelledMessage{},
 	}
 
@@ -3029,6 +3256,9 @@ func RequestNewFilter(displayFilter string, app gowid.IApp) {
 		SetStructWidgets{Loader}, // for OnClear
 		ClearMarksHandler{},
 		ManageSearchData{},
+		NotifyRemoteClients{},
+		RestorePendingSession{},
+		ManageJumps{},
 		// Don't use this one - we keep the cancelled flag set so that we
 		// don't restart live captures on clear if ctrl-c has been issued
 		// so we don't want this handler on a new filter because we don't
@@ -3040,6 +3270,7 @@ func RequestNewFilter(displayFilter string, app gowid.IApp) {
 	if Loader.DisplayFilter() == displayFilter {
 		log.Infof("No operation - same filter applied ('%s').", displayFilter)
 	} else {
+		recordJump()
 		Loader.Reload(displayFilter, handlers, app)
 	}
 }
@@ -3052,6 +3283,7 @@ func RequestReload(app gowid.IApp) {
 		SetStructWidgets{Loader}, // for OnClear
 		ClearMarksHandler{},
 		ManageSearchData{},
+		NotifyRemoteClients{},
 		// Don't use this one - we keep the cancelled flag set so that we
 		// don't restart live captures on clear if ctrl-c has been issued
 		// so we don't want this handler on a new filter because we don't
@@ -3168,6 +3400,68 @@ func (s savedCompleter) Completions(prefix string, cb fields.IPrefixCompleterCal
 	s.def.Completions(prefix, ncomp)
 }
 
+// valueCompleter offers the values of a field found in the loaded packets,
+// most frequent first, e.g. after "ip.addr == ".
+type valueCompleter struct{}
+
+var _ fields.IValueCompleter = valueCompleter{}
+
+func (v valueCompleter) ValueCompletions(field string, prefix string, cb fields.IPrefixCompleterCallback) {
+	pcapf := Loader.PcapPdml
+	if Loader.Empty() || pcapf == "" {
+		cb.Call([]string{})
+		return
+	}
+	displayFilter := Loader.DisplayFilter()
+
+	quote := false
+	if ok, f := FieldCompleter.LookupField(field); ok {
+		switch f.Type {
+		case fields.FT_STRING, fields.FT_STRINGZ, fields.FT_UINT_STRING, fields.FT_STRINGZPAD:
+			quote = true
+		}
+	}
+
+	args := pcap.ProfileArgs()
+	if prof := profiles.ConfString("main.wireshark-profile", ""); prof != "" {
+		args = append(args, "-C", prof)
+	}
+
+	termshark.TrackedGo(func() {
+		res := make([]string, 0)
+		vals, err := FieldValues.Values(pcapf, displayFilter, field, args)
+		if err == nil {
+			search := strings.TrimPrefix(prefix, "\"")
+			for _, val := range vals {
+				if !strings.HasPrefix(val.Value, search) {
+					continue
+				}
+				if quote {
+					res = append(res, strconv.Quote(val.Value))
+				} else {
+					res = append(res, val.Value)
+				}
+			}
+		}
+		cb.Call(res)
+	}, Goroutinewg)
+}
+
+// ManageFieldValuesCache drops the field values found for completion when a new
+// source is loaded, or the packets are cleared.
+type ManageFieldValuesCache struct{}
+
+var _ pcap.INewSource = ManageFieldValuesCache{}
+var _ pcap.IClear = ManageFieldValuesCache{}
+
+func (t ManageFieldValuesCache) OnNewSource(pcap.HandlerCode, gowid.IApp) {
+	FieldValues.Clear()
+}
+
+func (t ManageFieldValuesCache) OnClear(pcap.HandlerCode, gowid.IApp) {
+	FieldValues.Clear()
+}
+
 //======================================================================
 
 func StopEmptyStructViewTimer() {
@@ -3206,6 +3500,15 @@ func (w *prefixKeyWidget) UserInput(ev interface{}, size gowid.IRenderSize, focu
 	// at the end.
 	startingKeyState := keyState
 
+	// The key after q or @ names a macro register, so it goes nowhere else
+	if evk, ok := ev.(*tcell.EventKey); ok && (keyState.PartialqCmd || keyState.PartialAtCmd) {
+		keyState.PartialqCmd = false
+		keyState.PartialAtCmd = false
+		keyState.NumberPrefix = -1
+		macroKeyPress(evk, startingKeyState, app)
+		return true
+	}
+
 	handled := w.IWidget.UserInput(ev, size, focus, app)
 	switch ev := ev.(type) {
 	case *tcell.EventKey:
@@ -3227,7 +3530,7 @@ func (w *prefixKeyWidget) UserInput(ev interface{}, size gowid.IRenderSize, focu
 		}
 
 		if ev.Key() != tcell.KeyRune || ev.Rune() < '0' || ev.Rune() > '9' {
-			if !keyState.PartialZCmd && !keyState.PartialgCmd && !keyState.PartialCtrlWCmd {
+			if !keyState.PartialZCmd && !keyState.PartialgCmd && !keyState.PartialCtrlWCmd && !keyState.PartialAtCmd {
 				keyState.NumberPrefix = -1
 			}
 		}
@@ -3272,10 +3575,18 @@ func ApplyCurrentProfile(app gowid.IApp, vp *viper.Viper, vc *viper.Viper) error
 		reload = true
 	}
 
+	// e.g. a different TLS keylog file
+	if !reflect.DeepEqual(pcap.ProfileArgsFrom(vp), pcap.ProfileArgsFrom(vc)) {
+		reload = true
+	}
+
 	if reload {
 		RequestReload(app)
 	}
 
+	// The new profile might have its own coloring rules
+	updateColorRuleMatches(true, app)
+
 	ApplyCurrentTheme(app)
 	SetupColors()
 
@@ -3374,6 +3685,30 @@ func Build(tty string) (*gowid.App, error) {
 		gowid.MakePaletteRef("current-capture"),
 	)
 
+	frozenIndicator = text.New("")
+	frozenIndicatorStyled := styled.New(
+		frozenIndicator,
+		gowid.MakePaletteRef("current-capture"),
+	)
+
+	watchIndicator = text.New("")
+	watchIndicatorStyled := styled.New(
+		watchIndicator,
+		gowid.MakePaletteRef("current-capture"),
+	)
+
+	dropsIndicator = text.New("")
+	dropsIndicatorStyled := styled.New(
+		dropsIndicator,
+		gowid.MakePaletteRef("current-capture"),
+	)
+
+	macroIndicator = text.New("")
+	macroIndicatorStyled := styled.New(
+		macroIndicator,
+		gowid.MakePaletteRef("current-capture"),
+	)
+
 	sp := text.New("  ")
 
 	currentCaptureWidget = columns.NewFixed(
@@ -3384,6 +3719,9 @@ func Build(tty string) (*gowid.App, error) {
 		},
 		sp,
 		currentCaptureStyled,
+		frozenIndicatorStyled,
+		watchIndicatorStyled,
+		dropsIndicatorStyled,
 	)
 	currentCaptureWidgetHolder = holder.New(nullw)
 
@@ -3418,7 +3756,7 @@ func Build(tty string) (*gowid.App, error) {
 
 	//======================================================================
 
-	generalMenuItems := make([]menuutil.SimpleMenuItem, 0)
+	generalMenuItems = make([]menuutil.SimpleMenuItem, 0)
 
 	generalMenuItems = append(generalMenuItems, []menuutil.SimpleMenuItem{
 		menuutil.SimpleMenuItem{
@@ -3439,6 +3777,14 @@ func Build(tty string) (*gowid.App, error) {
 			},
 		},
 		menuutil.MakeMenuDivider(),
+		menuutil.SimpleMenuItem{
+			Txt: "Command Palette",
+			Key: gowid.MakeKeyExt2(0, tcell.KeyCtrlP, ' '),
+			CB: func(app gowid.IApp, w gowid.IWidget) {
+				multiMenu1Opener.CloseMenu(generalMenu, app)
+				openCommandPalette(app)
+			},
+		},
 		menuutil.SimpleMenuItem{
 			Txt: "Search Packets",
 			Key: gowid.MakeKeyExt2(0, tcell.KeyCtrlF, ' '),
@@ -3458,6 +3804,46 @@ func Build(tty string) (*gowid.App, error) {
 				reallyClear(app)
 			},
 		},
+		menuutil.SimpleMenuItem{
+			Txt: "Capture Options",
+			Key: gowid.MakeKey('o'),
+			CB: func(app gowid.IApp, w gowid.IWidget) {
+				multiMenu1Opener.CloseMenu(generalMenu, app)
+				openCaptureOptionsUi("", app)
+			},
+		},
+		menuutil.SimpleMenuItem{
+			Txt: "Capture Statistics",
+			Key: gowid.MakeKey('t'),
+			CB: func(app gowid.IApp, w gowid.IWidget) {
+				multiMenu1Opener.CloseMenu(generalMenu, app)
+				openCaptureStatsUi(app)
+			},
+		},
+		menuutil.SimpleMenuItem{
+			Txt: "Capture Filter",
+			Key: gowid.MakeKey('i'),
+			CB: func(app gowid.IApp, w gowid.IWidget) {
+				multiMenu1Opener.CloseMenu(generalMenu, app)
+				openCaptureFilterUi(app)
+			},
+		},
+		menuutil.SimpleMenuItem{
+			Txt: "Watch Rules",
+			Key: gowid.MakeKey('w'),
+			CB: func(app gowid.IApp, w gowid.IWidget) {
+				multiMenu1Opener.CloseMenu(generalMenu, app)
+				openWatchRulesUi(app)
+			},
+		},
+		menuutil.SimpleMenuItem{
+			Txt: "Extcap Interfaces",
+			Key: gowid.MakeKey('x'),
+			CB: func(app gowid.IApp, w gowid.IWidget) {
+				multiMenu1Opener.CloseMenu(generalMenu, app)
+				openExtcapUi("", app)
+			},
+		},
 		menuutil.SimpleMenuItem{
 			Txt: "Send Pcap",
 			Key: gowid.MakeKey('s'),
@@ -3473,6 +3859,14 @@ func Build(tty string) (*gowid.App, error) {
 				multiMenu1Opener.CloseMenu(generalMenu, app)
 				openEditColumns(app)
 			},
+		},
+		menuutil.SimpleMenuItem{
+			Txt: "Edit Preferences",
+			Key: gowid.MakeKey('p'),
+			CB: func(app gowid.IApp, w gowid.IWidget) {
+				multiMenu1Opener.CloseMenu(generalMenu, app)
+				openPrefsUi(app)
+			},
 		}}...)
 
 	if runtime.GOOS != "windows" {
@@ -3559,25 +3953,24 @@ func Build(tty string) (*gowid.App, error) {
 		},
 	}...)
 
-	if PacketColorsSupported {
-		generalMenuItems = append(
-			generalMenuItems[0:2],
-			append(
-				[]menuutil.SimpleMenuItem{
-					menuutil.SimpleMenuItem{
-						Txt: "Toggle Packet Colors",
-						Key: gowid.MakeKey('c'),
-						CB: func(app gowid.IApp, w gowid.IWidget) {
-							multiMenu1Opener.CloseMenu(generalMenu, app)
-							PacketColors = !PacketColors
-							profiles.SetConf("main.packet-colors", PacketColors)
-						},
+	generalMenuItems = append(
+		generalMenuItems[0:2],
+		append(
+			[]menuutil.SimpleMenuItem{
+				menuutil.SimpleMenuItem{
+					Txt: "Toggle Packet Colors",
+					Key: gowid.MakeKey('c'),
+					CB: func(app gowid.IApp, w gowid.IWidget) {
+						multiMenu1Opener.CloseMenu(generalMenu, app)
+						PacketColors = !PacketColors
+						profiles.SetConf("main.packet-colors", PacketColors)
+						updateColorRuleMatches(true, app)
 					},
 				},
-				generalMenuItems[2:]...,
-			)...,
-		)
-	}
+			},
+			generalMenuItems[2:]...,
+		)...,
+	)
 
 	generalMenuListBox, generalMenuWidth := menuutil.MakeMenuWithHotKeys(generalMenuItems, nil)
 
@@ -3620,7 +4013,7 @@ func Build(tty string) (*gowid.App, error) {
 		multiMenu1Opener.OpenMenu(analysisMenu, openAnalysisSite, app)
 	}))
 
-	analysisMenuItems := []menuutil.SimpleMenuItem{
+	analysisMenuItems = []menuutil.SimpleMenuItem{
 		menuutil.SimpleMenuItem{
 			Txt: "Capture file properties",
 			Key: gowid.MakeKey('p'),
@@ -3645,6 +4038,58 @@ func Build(tty string) (*gowid.App, error) {
 				openConvsUi(app)
 			},
 		},
+		menuutil.SimpleMenuItem{
+			Txt: "Build Display Filter",
+			Key: gowid.MakeKey('b'),
+			CB: func(app gowid.IApp, w gowid.IWidget) {
+				multiMenu1Opener.CloseMenu(analysisMenu, app)
+				openFilterBuilder(displayFilterTarget, app)
+			},
+		},
+		menuutil.MakeMenuDivider(),
+		menuutil.SimpleMenuItem{
+			Txt: "Decode As",
+			Key: gowid.MakeKey('d'),
+			CB: func(app gowid.IApp, w gowid.IWidget) {
+				multiMenu1Opener.CloseMenu(analysisMenu, app)
+				openDecodeAs("", "", app)
+			},
+		},
+		menuutil.SimpleMenuItem{
+			Txt: "TLS decryption",
+			Key: gowid.MakeKey('t'),
+			CB: func(app gowid.IApp, w gowid.IWidget) {
+				multiMenu1Opener.CloseMenu(analysisMenu, app)
+				openTLSKeylog(app)
+			},
+		},
+		menuutil.MakeMenuDivider(),
+		menuutil.SimpleMenuItem{
+			Txt: "Coloring Rules",
+			Key: gowid.MakeKey('r'),
+			CB: func(app gowid.IApp, w gowid.IWidget) {
+				multiMenu1Opener.CloseMenu(analysisMenu, app)
+				openColorRulesUi(app)
+			},
+		},
+		menuutil.SimpleMenuItem{
+			Txt: "Colorize Conversation",
+			Key: gowid.MakeKey('o'),
+			CB: func(app gowid.IApp, w gowid.IWidget) {
+				multiMenu1Opener.CloseMenu(analysisMenu, app)
+				if err := colorizeConversation(0, app); err != nil {
+					OpenError(err.Error(), app)
+				}
+			},
+		},
+		menuutil.SimpleMenuItem{
+			Txt: "Reset Colorization",
+			Key: gowid.MakeKey('x'),
+			CB: func(app gowid.IApp, w gowid.IWidget) {
+				multiMenu1Opener.CloseMenu(analysisMenu, app)
+				clearTempColorRules(app)
+			},
+		},
 	}
 
 	analysisMenuListBox, analysisMenuWidth := menuutil.MakeMenuWithHotKeys(analysisMenuItems, nil)
@@ -3696,6 +4141,19 @@ func Build(tty string) (*gowid.App, error) {
 		},
 	})
 
+	filterButtonsHolder = holder.New(nullw)
+
+	filterButtonsMenu = menu.New("filterbuttons", filterButtonsHolder, fixed, menu.Options{
+		Modal:             true,
+		CloseKeysProvided: true,
+		OpenCloser:        &multiMenu1Opener,
+		CloseKeys: []gowid.IKey{
+			gowid.MakeKeyExt(tcell.KeyLeft),
+			gowid.MakeKeyExt(tcell.KeyEscape),
+			gowid.MakeKeyExt(tcell.KeyCtrlC),
+		},
+	})
+
 	//======================================================================
 
 	currentProfile = text.New("default")
@@ -3731,7 +4189,8 @@ func Build(tty string) (*gowid.App, error) {
 				D:       weight(1),
 			},
 			&gowid.ContainerWidget{
-				IWidget: currentProfileWidgetHolder,
+				// The macro indicator shares a column so the menu indices below don't change
+				IWidget: columns.NewFixed(macroIndicatorStyled, currentProfileWidgetHolder),
 				D:       fixed, // give it priority when the window isn't wide enough
 			},
 			openAnalysisSite,
@@ -3787,10 +4246,13 @@ func Build(tty string) (*gowid.App, error) {
 	// For completing filter expressions
 	FieldCompleter = fields.New()
 	FieldCompleter.Init()
+	FieldValues = fields.NewFieldValues()
 
 	FilterWidget = filter.New("filter", filter.Options{
-		Completer:  savedCompleter{def: FieldCompleter},
-		MenuOpener: &multiMenu1Opener,
+		Completer:      savedCompleter{def: FieldCompleter},
+		MenuOpener:     &multiMenu1Opener,
+		Fields:         FieldCompleter,
+		ValueCompleter: valueCompleter{},
 	})
 
 	validFilterCb := gowid.MakeWidgetCallback("cb", func(app gowid.IApp, w gowid.IWidget) {
@@ -3812,6 +4274,12 @@ func Build(tty string) (*gowid.App, error) {
 	FilterWidget.OnInvalid(gowid.MakeWidgetCallback("cb", func(app gowid.IApp, w gowid.IWidget) {
 		applyWidget.Disable()
 	}))
+	// Point out where the problem is, if it's known
+	FilterWidget.OnInvalidSubmit(gowid.MakeWidgetCallback("cb", func(app gowid.IApp, w gowid.IWidget) {
+		if perr, ok := FilterWidget.ValidationError().(*dfilter.ParseError); ok {
+			OpenError(fmt.Sprintf("Invalid filter: %s\n\n%s\n%s^", perr.Msg, FilterWidget.Value(), strings.Repeat(" ", perr.Pos)), app)
+		}
+	}))
 	filterLabel := text.New("Filter: ")
 
 	savedw := button.New(text.New("Recent"))
@@ -3830,13 +4298,26 @@ func Build(tty string) (*gowid.App, error) {
 		// }
 	}))
 
-	progWidgetIdx = 7 // adjust this if nullw moves position in filterCols
+	buttonsw := button.New(text.New("Buttons"))
+	buttonsWidget := clicktracker.New(
+		styled.NewExt(
+			buttonsw,
+			gowid.MakePaletteRef("button"),
+			gowid.MakePaletteRef("button-focus"),
+		),
+	)
+	filterButtonsSite = menu.NewSite(menu.SiteOptions{YOffset: 1})
+	buttonsw.OnClick(gowid.MakeWidgetCallback("cb", func(app gowid.IApp, w gowid.IWidget) {
+		openFilterButtonsMenu(app)
+	}))
+
+	progWidgetIdx = 10 // adjust this if nullw moves position in filterCols
 	filterCols = columns.NewFixed(filterLabel,
 		&gowid.ContainerWidget{
 			IWidget: FilterWidget,
 			D:       weight(100),
 		},
-		applyWidget, colSpace, savedBtnSite, savedWidget, colSpace, nullw)
+		applyWidget, colSpace, savedBtnSite, savedWidget, colSpace, filterButtonsSite, buttonsWidget, colSpace, nullw)
 
 	//======================================================================
 
@@ -3925,42 +4406,60 @@ func Build(tty string) (*gowid.App, error) {
 	// you navigate to the top of the packet structure, hit up one more time
 	// and you're in the packet list view accidentally, hit down instinctively
 	// to go back and you change the selected packet.
-	packetListViewWithKeys := appkeys.NewMouse(
-		appkeys.New(
+	//
+	// ctrl-p is one of those movement keys, so the command palette's key is
+	// handled before the views see it.
+	packetListViewWithKeys := appkeys.New(
+		appkeys.NewMouse(
 			appkeys.New(
 				appkeys.New(
-					packetListViewHolder,
-					ApplyAutoScroll,
-					appkeys.Options{
-						ApplyBefore: true,
-					},
+					appkeys.New(
+						appkeys.New(
+							packetListViewHolder,
+							ApplyAutoScroll,
+							appkeys.Options{
+								ApplyBefore: true,
+							},
+						),
+						appKeysResize1,
+					),
+					colorizeKeyPress,
 				),
-				appKeysResize1,
+				widgets.SwallowMovementKeys,
 			),
-			widgets.SwallowMovementKeys,
+			widgets.SwallowMouseScroll,
 		),
-		widgets.SwallowMouseScroll,
+		paletteKeyPress,
+		appkeys.Options{
+			ApplyBefore: true,
+		},
 	)
 
 	packetStructureViewWithKeys :=
 		appkeys.New(
 			appkeys.New(
-				appkeys.NewMouse(
-					appkeys.New(
+				appkeys.New(
+					appkeys.NewMouse(
 						appkeys.New(
-							packetStructureViewHolder,
-							appKeysResize2,
+							appkeys.New(
+								packetStructureViewHolder,
+								appKeysResize2,
+							),
+							widgets.SwallowMovementKeys,
 						),
-						widgets.SwallowMovementKeys,
+						widgets.SwallowMouseScroll,
 					),
-					widgets.SwallowMouseScroll,
+					copyModeEnterKeys,
+					appkeys.Options{
+						ApplyBefore: true,
+					},
 				),
-				copyModeEnterKeys,
+				copyModeExitKeys,
 				appkeys.Options{
 					ApplyBefore: true,
 				},
 			),
-			copyModeExitKeys,
+			paletteKeyPress,
 			appkeys.Options{
 				ApplyBefore: true,
 			},
@@ -3969,19 +4468,25 @@ func Build(tty string) (*gowid.App, error) {
 	packetHexViewHolderWithKeys :=
 		appkeys.New(
 			appkeys.New(
-				appkeys.NewMouse(
-					appkeys.New(
-						packetHexViewHolder,
-						widgets.SwallowMovementKeys,
+				appkeys.New(
+					appkeys.NewMouse(
+						appkeys.New(
+							packetHexViewHolder,
+							widgets.SwallowMovementKeys,
+						),
+						widgets.SwallowMouseScroll,
 					),
-					widgets.SwallowMouseScroll,
+					copyModeEnterKeys,
+					appkeys.Options{
+						ApplyBefore: true,
+					},
 				),
-				copyModeEnterKeys,
+				copyModeExitKeys,
 				appkeys.Options{
 					ApplyBefore: true,
 				},
 			),
-			copyModeExitKeys,
+			paletteKeyPress,
 			appkeys.Options{
 				ApplyBefore: true,
 			},
@@ -4330,6 +4835,7 @@ func Build(tty string) (*gowid.App, error) {
 	} else {
 		appView = holder.New(mbView)
 	}
+	appViewNoDialogs = appView.SubWidget()
 
 	// A restriction on the multiMenu is that it only holds one open menu, so using
 	// this trick, only one menu can be open at a time per multiMenu variable. So
@@ -4357,10 +4863,11 @@ func Build(tty string) (*gowid.App, error) {
 	}
 
 	keyMapper = mapkeys.New(lastMenu)
+	keyMapper.SetView(keyMappingViews{})
 	keyMappings := termshark.LoadKeyMappings()
 	for _, km := range keyMappings {
-		log.Infof("Applying keymapping %v --> %v", km.From, km.To)
-		keyMapper.AddMapping(km.From, km.To, app)
+		log.Infof("Applying keymapping %v", km)
+		applyKeyMapping(keyMapper, km, app)
 	}
 
 	if err = termshark.LoadGlobalMarks(globalMarksMap); err != nil {
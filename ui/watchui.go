@@ -0,0 +1,642 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+package ui
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gcla/gowid"
+	"github.com/gcla/gowid/widgets/button"
+	"github.com/gcla/gowid/widgets/checkbox"
+	"github.com/gcla/gowid/widgets/columns"
+	"github.com/gcla/gowid/widgets/dialog"
+	"github.com/gcla/gowid/widgets/divider"
+	"github.com/gcla/gowid/widgets/edit"
+	"github.com/gcla/gowid/widgets/framed"
+	"github.com/gcla/gowid/widgets/list"
+	"github.com/gcla/gowid/widgets/menu"
+	"github.com/gcla/gowid/widgets/pile"
+	"github.com/gcla/gowid/widgets/styled"
+	"github.com/gcla/gowid/widgets/text"
+	"github.com/gcla/termshark/v2"
+	"github.com/gcla/termshark/v2/configs/profiles"
+	"github.com/gcla/termshark/v2/pkg/pcap"
+	"github.com/gcla/termshark/v2/pkg/shark"
+	"github.com/gcla/termshark/v2/ui/menuutil"
+	"github.com/gcla/termshark/v2/widgets/filter"
+	"github.com/gdamore/tcell/v2"
+	log "github.com/sirupsen/logrus"
+)
+
+//======================================================================
+
+// A rule's bell, flash and command actions fire at most this often, so that a
+// burst of matching packets doesn't start a process for each one.
+const minWatchInterval = time.Second
+
+// A rule's command is killed if it runs for longer than this
+const watchCommandTimeout = 30 * time.Second
+
+// How many times the title bar flashes for a flash action
+const watchFlashes = 3
+
+// These are only accessed from the app goroutine
+var watchCancel context.CancelFunc // stops the watch processes used for tshark without Lua
+var watchLastFired map[int]time.Time
+var watchIndicator *text.Widget
+var watchFlashGen int
+
+// The PSML of a live capture is read again from the start when a new display filter
+// is applied. Packets up to watchAfter, and up to a filter's entry in watchSeen, have
+// been checked already, so only their marks are applied again.
+var watchAfter int
+var watchSeen map[string]int
+
+// The packets matched by mark rules, keyed by packet number. They are marked in
+// the packet list's gutter.
+var watchMarkedPackets map[int]struct{}
+
+var watchLuaOnce sync.Once
+var watchLua bool
+
+// tsharkHasLua returns true if tshark can run the watch script, so the loader's
+// PSML process can check the watch rules.
+func tsharkHasLua() bool {
+	watchLuaOnce.Do(func() {
+		watchLua = termshark.TSharkSupportsLua(termshark.TSharkBin())
+	})
+	return watchLua
+}
+
+//======================================================================
+
+// ManageWatchRules resets the watch state for each live capture. If tshark can't
+// run Lua scripts, it runs a process for each rule alongside the capture.
+type ManageWatchRules struct{}
+
+var _ pcap.IBeforeBegin = ManageWatchRules{}
+var _ pcap.IAfterEnd = ManageWatchRules{}
+
+func (t ManageWatchRules) BeforeBegin(code pcap.HandlerCode, app gowid.IApp) {
+	if code&pcap.IfaceCode == 0 {
+		return
+	}
+	setWatchIndicator("", app)
+	watchAfter = 0
+	watchSeen = make(map[string]int)
+	watchLastFired = make(map[int]time.Time)
+	if !tsharkHasLua() {
+		startWatchProcesses(app)
+	}
+}
+
+func (t ManageWatchRules) AfterEnd(code pcap.HandlerCode, app gowid.IApp) {
+	if code&pcap.IfaceCode == 0 {
+		return
+	}
+	stopWatchProcesses()
+}
+
+//======================================================================
+
+// watchRulesMatcher has the loader's PSML process check each packet of a live
+// capture against the enabled watch rules.
+type watchRulesMatcher struct {
+	app gowid.IApp
+}
+
+var _ pcap.IWatcher = watchRulesMatcher{}
+
+func MakeWatchRulesMatcher(app gowid.IApp) watchRulesMatcher {
+	return watchRulesMatcher{app: app}
+}
+
+func (w watchRulesMatcher) WatchFilters() []string {
+	if !tsharkHasLua() {
+		return nil
+	}
+	return enabledWatchFilters(shark.GetWatchRules())
+}
+
+func (w watchRulesMatcher) WatchMatched(filter string, frame int, row []string) {
+	w.app.Run(gowid.RunFunction(func(app gowid.IApp) {
+		watchMatched(filter, frame, row, app)
+	}))
+}
+
+// enabledWatchFilters returns the filters of the enabled rules, each once.
+func enabledWatchFilters(rules []shark.WatchRule) []string {
+	res := make([]string, 0, len(rules))
+	for _, rule := range rules {
+		if rule.Enabled && !termshark.StringInSlice(rule.Filter, res) {
+			res = append(res, rule.Filter)
+		}
+	}
+	return res
+}
+
+// watchMatched fires the enabled rules with the filter that the packet matched.
+// row is the packet's PSML, or nil if it's hidden by the display filter.
+//
+// Runs in app goroutine
+func watchMatched(filter string, frame int, row []string, app gowid.IApp) {
+	summary := ""
+	if row != nil {
+		summary = psmlSummary(row).String()
+	}
+	seen := frame <= watchAfter || frame <= watchSeen[filter]
+	if !seen {
+		watchSeen[filter] = frame
+	}
+	for i, rule := range shark.GetWatchRules() {
+		if rule.Enabled && rule.Filter == filter && (!seen || rule.Action == shark.WatchMark) {
+			fireWatchRule(i, rule, frame, summary, app)
+		}
+	}
+}
+
+// startWatchProcesses starts checking the enabled rules against the live
+// capture with a process for each rule, for tshark without Lua.
+//
+// Runs in app goroutine
+func startWatchProcesses(app gowid.IApp) {
+	stopWatchProcesses()
+
+	if Loader.InterfaceFile() == "" || len(Loader.Interfaces()) == 0 {
+		return
+	}
+
+	filters := enabledWatchFilters(shark.GetWatchRules())
+	if len(filters) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(Loader.Context())
+	watchCancel = cancel
+
+	cmds := Loader.Commands()
+	tmpfile := Loader.InterfaceFile()
+
+	for _, filter := range filters {
+		filter := filter
+		termshark.TrackedGo(func() {
+			err := pcap.WatchPsml(ctx, cmds, tmpfile, filter, func(row []string) {
+				if len(row) < 2 {
+					return
+				}
+				num, err := strconv.Atoi(row[0])
+				if err != nil {
+					return
+				}
+				app.Run(gowid.RunFunction(func(app gowid.IApp) {
+					// Ignore stragglers from a previous capture
+					if ctx.Err() == nil {
+						watchMatched(filter, num, row[1:], app)
+					}
+				}))
+			})
+			if err != nil {
+				log.Warnf("Could not watch for %s: %v", filter, err)
+				app.Run(gowid.RunFunction(func(app gowid.IApp) {
+					OpenError(fmt.Sprintf("Could not watch for %s: %v", filter, err), app)
+				}))
+			}
+		}, Goroutinewg)
+	}
+}
+
+func stopWatchProcesses() {
+	if watchCancel != nil {
+		watchCancel()
+		watchCancel = nil
+	}
+}
+
+// applyWatchRules has new rules checked against the rest of the live capture.
+// The loader's PSML process only picks up the rules when it starts, so it's
+// restarted.
+//
+// Runs in app goroutine
+func applyWatchRules(app gowid.IApp) {
+	if !Loader.InterfaceLoader.IsLoading() {
+		return
+	}
+	watchAfter = lastLoadedPacket()
+	watchLastFired = make(map[int]time.Time)
+	if tsharkHasLua() {
+		RequestReload(app)
+	} else {
+		startWatchProcesses(app)
+	}
+}
+
+// lastLoadedPacket returns the number of the last packet in the packet list.
+func lastLoadedPacket() int {
+	psml := Loader.PsmlData()
+	if len(psml) == 0 || len(psml[len(psml)-1]) == 0 {
+		return 0
+	}
+	num, _ := strconv.Atoi(psml[len(psml)-1][0])
+	return num
+}
+
+// fireWatchRule carries out the rule's action for the packet that matched.
+//
+// Runs in app goroutine
+func fireWatchRule(idx int, rule shark.WatchRule, num int, summary string, app gowid.IApp) {
+	log.Infof("Watch rule %s matched packet %d", rule.Filter, num)
+
+	switch rule.Action {
+	case shark.WatchBell, shark.WatchFlash, shark.WatchCommand:
+		now := time.Now()
+		if now.Sub(watchLastFired[idx]) < minWatchInterval {
+			return
+		}
+		watchLastFired[idx] = now
+	}
+
+	msg := fmt.Sprintf(" [watch: %s matched packet %d]", rule.Filter, num)
+
+	switch rule.Action {
+	case shark.WatchBell:
+		setWatchIndicator(msg, app)
+		if err := app.GetScreen().Beep(); err != nil {
+			log.Warnf("Could not ring the terminal bell: %v", err)
+		}
+	case shark.WatchFlash:
+		flashWatchIndicator(msg, app)
+	case shark.WatchMark:
+		setWatchIndicator(msg, app)
+		if watchMarkedPackets == nil {
+			watchMarkedPackets = make(map[int]struct{})
+		}
+		watchMarkedPackets[num] = struct{}{}
+		// The letter mark jumps to the latest match
+		marksMap[rune(rule.MarkName()[0])] = termshark.JumpPos{
+			Pos:     num,
+			Summary: summary,
+		}
+	case shark.WatchCommand:
+		setWatchIndicator(msg, app)
+		runWatchCommand(rule, num, summary)
+	case shark.WatchStop:
+		setWatchIndicator(msg, app)
+		if Loader.InterfaceLoader.IsLoading() {
+			Loader.StopLoadPsmlAndIface(NoHandlers{})
+			OpenMessage(fmt.Sprintf("Capture stopped - packet %d matched %s.", num, rule.Filter), appView, app)
+		}
+	}
+}
+
+// runWatchCommand runs the rule's command with sh -c - or cmd /C on Windows -
+// describing the packet in its environment. The command is killed if it takes
+// too long, or termshark quits.
+func runWatchCommand(rule shark.WatchRule, num int, summary string) {
+	ctx, cancel := context.WithTimeout(Loader.Context(), watchCommandTimeout)
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", rule.Param)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", rule.Param)
+	}
+	cmd.Env = append(os.Environ(), shark.WatchCommandEnv(rule, num, summary)...)
+	termshark.TrackedGo(func() {
+		defer cancel()
+		if out, err := cmd.CombinedOutput(); err != nil {
+			log.Warnf("Watch command %s failed: %v: %s", rule.Param, err, string(out))
+		}
+	}, Goroutinewg)
+}
+
+// Runs in app goroutine
+func setWatchIndicator(msg string, app gowid.IApp) {
+	watchFlashGen++
+	if watchIndicator != nil {
+		watchIndicator.SetText(msg, app)
+	}
+}
+
+// flashWatchIndicator blinks the message in the title bar a few times, then
+// leaves it there.
+//
+// Runs in app goroutine
+func flashWatchIndicator(msg string, app gowid.IApp) {
+	setWatchIndicator(msg, app)
+	gen := watchFlashGen
+
+	termshark.TrackedGo(func() {
+		for i := 0; i < watchFlashes*2; i++ {
+			time.Sleep(250 * time.Millisecond)
+			show := i%2 == 1
+			app.Run(gowid.RunFunction(func(app gowid.IApp) {
+				// Superseded by a later match
+				if gen != watchFlashGen || watchIndicator == nil {
+					return
+				}
+				if show {
+					watchIndicator.SetText(msg, app)
+				} else {
+					watchIndicator.SetText("", app)
+				}
+			}))
+		}
+	}, Goroutinewg)
+}
+
+//======================================================================
+
+// openWatchRulesUi opens the watch rules editor.
+func openWatchRulesUi(app gowid.IApp) {
+	openWatchRulesWith(shark.GetWatchRules(), 0, app)
+}
+
+// openWatchRulesWith opens the editor with a working set of rules, focused on the
+// given row. The rules are only written to the profile when the user hits Ok.
+func openWatchRulesWith(rules []shark.WatchRule, focus int, app gowid.IApp) {
+	var rulesDialog *dialog.Widget
+
+	styledBtn := func(w gowid.IWidget) gowid.IWidget {
+		return styled.NewExt(
+			w,
+			gowid.MakePaletteRef("button"),
+			gowid.MakePaletteRef("button-focus"),
+		)
+	}
+
+	ruleWidgets := make([]gowid.IWidget, 0, len(rules))
+	for i, rule := range rules {
+		i, rule := i, rule
+
+		enabledCheck := checkbox.New(rule.Enabled)
+		enabledCheck.OnClick(gowid.WidgetCallback{"cb", func(app gowid.IApp, w gowid.IWidget) {
+			rules[i].Enabled = enabledCheck.IsChecked()
+		}})
+
+		editBtn := button.New(text.New("Edit"))
+		editBtn.OnClick(gowid.MakeWidgetCallback("cb", func(app gowid.IApp, w gowid.IWidget) {
+			rulesDialog.Close(app)
+			openWatchRuleEditor(rules, i, app)
+		}))
+
+		delBtn := button.New(text.New("Delete"))
+		delBtn.OnClick(gowid.MakeWidgetCallback("cb", func(app gowid.IApp, w gowid.IWidget) {
+			rulesDialog.Close(app)
+			newRules := make([]shark.WatchRule, 0, len(rules))
+			newRules = append(newRules, rules[0:i]...)
+			newRules = append(newRules, rules[i+1:]...)
+			openWatchRulesWith(newRules, i, app)
+		}))
+
+		ruleWidgets = append(ruleWidgets, columns.NewWithDim(
+			fixed,
+			enabledCheck,
+			&gowid.ContainerWidget{
+				IWidget: text.New(" "),
+				D:       fixed,
+			},
+			&gowid.ContainerWidget{
+				IWidget: text.New(rule.Filter, text.Options{
+					Wrap:          text.WrapClip,
+					ClipIndicator: "...",
+				}),
+				D: weight(2),
+			},
+			&gowid.ContainerWidget{
+				IWidget: text.New(" "+rule.Describe(), text.Options{
+					Wrap:          text.WrapClip,
+					ClipIndicator: "...",
+				}),
+				D: weight(1),
+			},
+			styledBtn(editBtn),
+			styledBtn(delBtn),
+		))
+	}
+
+	if len(ruleWidgets) == 0 {
+		ruleWidgets = append(ruleWidgets, text.New("No watch rules are set."))
+	}
+
+	rulesWalker := list.NewSimpleListWalker(ruleWidgets)
+	if focus > 0 && focus < len(ruleWidgets) {
+		rulesWalker.SetFocus(list.ListPos(focus), app)
+	}
+
+	addBtn := button.New(text.New("Add"))
+	addBtn.OnClick(gowid.MakeWidgetCallback("cb", func(app gowid.IApp, w gowid.IWidget) {
+		rulesDialog.Close(app)
+		openWatchRuleEditor(rules, -1, app)
+	}))
+
+	okBtn := dialog.Button{
+		Msg: "Ok",
+		Action: gowid.MakeWidgetCallback("exec", gowid.WidgetChangedFunction(func(app gowid.IApp, _ gowid.IWidget) {
+			rulesDialog.Close(app)
+			shark.SetWatchRules(rules)
+			applyWatchRules(app)
+		})),
+	}
+
+	view := pile.NewFlow(
+		text.New(fmt.Sprintf("Watch rules for profile %s. Each packet captured live is checked against the enabled rules.", profiles.CurrentName())),
+		divider.NewBlank(),
+		// Do this so the list box scrolls inside the dialog
+		&gowid.ContainerWidget{
+			IWidget: list.New(rulesWalker),
+			D:       weight(1),
+		},
+		divider.NewUnicode(),
+		columns.NewFixed(styledBtn(addBtn)),
+	)
+
+	rulesDialog = dialog.New(
+		framed.NewSpace(view),
+		dialog.Options{
+			Buttons:         []dialog.Button{okBtn, dialog.Cancel},
+			NoShadow:        true,
+			BackgroundStyle: gowid.MakePaletteRef("dialog"),
+			BorderStyle:     gowid.MakePaletteRef("dialog"),
+			ButtonStyle:     gowid.MakePaletteRef("dialog-button"),
+			Modal:           true,
+			FocusOnWidget:   true,
+		},
+	)
+
+	dialog.OpenExt(rulesDialog, appView, ratio(0.8), ratio(0.8), app)
+}
+
+// openWatchRuleEditor edits the rule at index idx of the working set, or adds a
+// new rule if idx is -1. Either way, the rules editor is reopened afterwards.
+func openWatchRuleEditor(rules []shark.WatchRule, idx int, app gowid.IApp) {
+	var editDialog *dialog.Widget
+
+	rule := shark.WatchRule{
+		Enabled: true,
+		Filter:  FilterWidget.Value(),
+	}
+	if idx >= 0 && idx < len(rules) {
+		rule = rules[idx]
+	}
+
+	filterWidget := edit.New(edit.Options{
+		Text: rule.Filter,
+	})
+	paramWidget := edit.New(edit.Options{
+		Text: rule.Param,
+	})
+
+	action := rule.Action
+	actionSite, actionBtn := makeWatchActionChoice(&action)
+
+	okBtn := dialog.Button{
+		Msg: "Ok",
+		Action: gowid.MakeWidgetCallback("exec", gowid.WidgetChangedFunction(func(app gowid.IApp, _ gowid.IWidget) {
+			newRule := shark.WatchRule{
+				Enabled: rule.Enabled,
+				Filter:  filterWidget.Text(),
+				Action:  action,
+			}
+			switch action {
+			case shark.WatchMark, shark.WatchCommand:
+				newRule.Param = paramWidget.Text()
+			}
+			if err := newRule.Validate(); err != nil {
+				OpenError(err.Error(), app)
+				return
+			}
+			filter.CheckDisplayFilterThen(newRule.Filter, FieldCompleter, app, func(err error, app gowid.IApp) {
+				if err != nil {
+					OpenError(fmt.Sprintf("Invalid filter: %v", err), app)
+					return
+				}
+
+				editDialog.Close(app)
+
+				newRules := make([]shark.WatchRule, len(rules))
+				copy(newRules, rules)
+				focus := idx
+				if idx >= 0 && idx < len(newRules) {
+					newRules[idx] = newRule
+				} else {
+					newRules = append(newRules, newRule)
+					focus = len(newRules) - 1
+				}
+				openWatchRulesWith(newRules, focus, app)
+			})
+		})),
+	}
+
+	cancelBtn := dialog.Button{
+		Msg: "Cancel",
+		Action: gowid.MakeWidgetCallback("exec", gowid.WidgetChangedFunction(func(app gowid.IApp, _ gowid.IWidget) {
+			editDialog.Close(app)
+			openWatchRulesWith(rules, idx, app)
+		})),
+	}
+
+	labelled := func(lbl string, w gowid.IWidget) gowid.IWidget {
+		return columns.NewWithDim(
+			gowid.RenderWithWeight{1},
+			&gowid.ContainerWidget{
+				IWidget: text.New(lbl),
+				D:       fixed,
+			},
+			framed.NewUnicode(w),
+		)
+	}
+
+	title := "Add a watch rule"
+	if idx >= 0 {
+		title = fmt.Sprintf("Edit watch rule %s", rule.Filter)
+	}
+
+	editDialog = dialog.New(
+		framed.NewSpace(
+			pile.NewFlow(
+				text.New(fmt.Sprintf("%s:", title)),
+				divider.NewBlank(),
+				labelled("Display filter: ", filterWidget),
+				divider.NewBlank(),
+				columns.NewFixed(text.New("Action:         "), actionSite, actionBtn),
+				divider.NewBlank(),
+				labelled("Mark/command:   ", paramWidget),
+				divider.NewBlank(),
+				text.New("The mark action marks each matching packet in the packet list, and sets a mark from a to z (w by "+
+					"default) on the latest - jump to it with ' as usual. "+
+					"The command runs with TERMSHARK_PACKET_NUMBER and TERMSHARK_PACKET_SUMMARY in its environment."),
+			),
+		),
+		dialog.Options{
+			Buttons:         []dialog.Button{okBtn, cancelBtn},
+			NoShadow:        true,
+			BackgroundStyle: gowid.MakePaletteRef("dialog"),
+			BorderStyle:     gowid.MakePaletteRef("dialog"),
+			ButtonStyle:     gowid.MakePaletteRef("dialog-button"),
+			Modal:           true,
+			FocusOnWidget:   true,
+		},
+	)
+
+	editDialog.Open(appView, ratio(0.7), app)
+}
+
+// makeWatchActionChoice returns a button which opens a drop down of the watch
+// actions, and the site at which the drop down opens. The current choice is held
+// in *action.
+func makeWatchActionChoice(action *shark.WatchAction) (*menu.SiteWidget, gowid.IWidget) {
+	actionBtn := button.New(text.New(action.String()))
+	actionSite := menu.NewSite(menu.SiteOptions{YOffset: 1})
+
+	var actionMenu *menu.Widget
+	items := make([]menuutil.SimpleMenuItem, 0, len(shark.WatchActions))
+	for i, name := range shark.WatchActions {
+		i, name := i, name
+		items = append(items, menuutil.SimpleMenuItem{
+			Txt: name,
+			CB: func(app gowid.IApp, w gowid.IWidget) {
+				multiMenu1Opener.CloseMenu(actionMenu, app)
+				*action = shark.WatchAction(i)
+				actionBtn.SetSubWidget(text.New(name), app)
+			},
+		})
+	}
+
+	actionListBox, actionWidth := menuutil.MakeMenu(items, nil)
+
+	actionMenu = menu.New("watchaction", actionListBox, units(actionWidth), menu.Options{
+		Modal:             true,
+		OpenCloser:        &multiMenu1Opener,
+		CloseKeysProvided: true,
+		CloseKeys: []gowid.IKey{
+			gowid.MakeKey('q'),
+			gowid.MakeKeyExt(tcell.KeyLeft),
+			gowid.MakeKeyExt(tcell.KeyEscape),
+			gowid.MakeKeyExt(tcell.KeyCtrlC),
+		},
+	})
+
+	actionBtn.OnClick(gowid.MakeWidgetCallback("cb", func(app gowid.IApp, w gowid.IWidget) {
+		multiMenu1Opener.OpenMenu(actionMenu, actionSite, app)
+	}))
+
+	return actionSite, styled.NewExt(
+		actionBtn,
+		gowid.MakePaletteRef("button"),
+		gowid.MakePaletteRef("button-focus"),
+	)
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 110
+// End:
@@ -167,6 +167,21 @@ func TSharkVersion(tshark string) (semver.Version, error) {
 	return TSharkVersionFromOutput(string(output))
 }
 
+// TSharkSupportsLuaFromOutput reports whether the output of tshark --version
+// says that tshark was built with Lua, needed to run Lua scripts with -X.
+func TSharkSupportsLuaFromOutput(output string) bool {
+	return regexp.MustCompile(`\bwith Lua\b`).MatchString(output)
+}
+
+func TSharkSupportsLua(tshark string) bool {
+	cmd := exec.Command(tshark, "--version")
+	cmdOutput := &bytes.Buffer{}
+	cmd.Stdout = cmdOutput
+	cmd.Run() // as for TSharkVersion
+
+	return TSharkSupportsLuaFromOutput(cmdOutput.String())
+}
+
 // Depends on empty.pcap being present
 func TSharkSupportsColor(tshark string) (bool, error) {
 	exitCode, err := RunForExitCode(
@@ -356,16 +371,52 @@ func KeyPressIsPrintable(key gowid.IKey) bool {
 	return unicode.IsPrint(key.Rune()) && key.Modifiers() & ^tcell.ModShift == 0
 }
 
+// KeyMapping maps a keypress to a sequence of keypresses. If View is not empty,
+// the mapping only applies when that view has focus.
 type KeyMapping struct {
+	View string
 	From vim.KeyPress
 	To   vim.KeySequence
 }
 
+// String returns the form saved in the config - "<from> <to>", preceded by the
+// view for a view mapping.
+func (k KeyMapping) String() string {
+	if k.View == "" {
+		return fmt.Sprintf("%v %v", k.From, k.To)
+	}
+	return fmt.Sprintf("%s %v %v", k.View, k.From, k.To)
+}
+
+func parseKeyMapping(mapping string) (KeyMapping, error) {
+	var res KeyMapping
+	words := strings.Split(mapping, " ")
+	switch len(words) {
+	case 2:
+	case 3:
+		res.View = words[0]
+		words = words[1:]
+	default:
+		return res, fmt.Errorf("Could not parse vim key mapping (missing separator?): %s", mapping)
+	}
+	from := vim.VimStringToKeys(words[0])
+	if len(from) != 1 {
+		return res, fmt.Errorf("Could not parse 'source' vim keypress: %s", words[0])
+	}
+	to := vim.VimStringToKeys(words[1])
+	if len(to) < 1 {
+		return res, fmt.Errorf("Could not parse 'target' vim keypresses: %s", words[1])
+	}
+	res.From = from[0]
+	res.To = to
+	return res, nil
+}
+
 func AddKeyMapping(km KeyMapping) {
 	mappings := LoadKeyMappings()
 	newMappings := make([]KeyMapping, 0)
 	for _, mapping := range mappings {
-		if mapping.From != km.From {
+		if mapping.From != km.From || mapping.View != km.View {
 			newMappings = append(newMappings, mapping)
 		}
 	}
@@ -373,11 +424,13 @@ func AddKeyMapping(km KeyMapping) {
 	SaveKeyMappings(newMappings)
 }
 
-func RemoveKeyMapping(kp vim.KeyPress) {
+// RemoveKeyMapping removes the mapping of kp for view, or the mapping for all
+// views if view is empty.
+func RemoveKeyMapping(view string, kp vim.KeyPress) {
 	mappings := LoadKeyMappings()
 	newMappings := make([]KeyMapping, 0)
 	for _, mapping := range mappings {
-		if mapping.From != kp {
+		if mapping.From != kp || mapping.View != view {
 			newMappings = append(newMappings, mapping)
 		}
 	}
@@ -388,22 +441,12 @@ func LoadKeyMappings() []KeyMapping {
 	mappings := profiles.ConfStringSlice("main.key-mappings", []string{})
 	res := make([]KeyMapping, 0)
 	for _, mapping := range mappings {
-		pair := strings.Split(mapping, " ")
-		if len(pair) != 2 {
-			log.Warnf("Could not parse vim key mapping (missing separator?): %s", mapping)
-			continue
-		}
-		from := vim.VimStringToKeys(pair[0])
-		if len(from) != 1 {
-			log.Warnf("Could not parse 'source' vim keypress: %s", pair[0])
-			continue
-		}
-		to := vim.VimStringToKeys(pair[1])
-		if len(to) < 1 {
-			log.Warnf("Could not parse 'target' vim keypresses: %s", pair[1])
+		km, err := parseKeyMapping(mapping)
+		if err != nil {
+			log.Warn(err)
 			continue
 		}
-		res = append(res, KeyMapping{From: from[0], To: to})
+		res = append(res, km)
 	}
 	return res
 }
@@ -411,11 +454,41 @@ func LoadKeyMappings() []KeyMapping {
 func SaveKeyMappings(mappings []KeyMapping) {
 	ser := make([]string, 0, len(mappings))
 	for _, mapping := range mappings {
-		ser = append(ser, fmt.Sprintf("%v %v", mapping.From, vim.KeySequence(mapping.To)))
+		ser = append(ser, mapping.String())
 	}
 	profiles.SetConf("main.key-mappings", ser)
 }
 
+// LoadMacros returns the key sequences recorded with q, by register.
+func LoadMacros() map[rune]vim.KeySequence {
+	res := make(map[rune]vim.KeySequence)
+	for _, macro := range profiles.ConfStringSlice("main.macros", []string{}) {
+		pair := strings.SplitN(macro, " ", 2)
+		reg := []rune(pair[0])
+		if len(pair) != 2 || len(reg) != 1 {
+			log.Warnf("Could not parse macro: %s", macro)
+			continue
+		}
+		res[reg[0]] = vim.VimStringToKeys(pair[1])
+	}
+	return res
+}
+
+func SaveMacros(macros map[rune]vim.KeySequence) {
+	regs := make([]rune, 0, len(macros))
+	for reg := range macros {
+		regs = append(regs, reg)
+	}
+	sort.Slice(regs, func(i, j int) bool {
+		return regs[i] < regs[j]
+	})
+	ser := make([]string, 0, len(macros))
+	for _, reg := range regs {
+		ser = append(ser, fmt.Sprintf("%c %v", reg, macros[reg]))
+	}
+	profiles.SetConf("main.macros", ser)
+}
+
 func RemoveFromStringSlice(pcap string, comps []string) []string {
 	var newcomps []string
 	for _, v := range comps {
@@ -626,6 +699,12 @@ func AddToRecentFilters(val string) {
 	addToRecent("main.recent-filters", val)
 }
 
+// AddToCmdlineHistory records a command run from termshark's command-line,
+// most recent first.
+func AddToCmdlineHistory(val string) {
+	addToRecent("main.cmdline-history", val)
+}
+
 func addToRecent(field string, val string) {
 	comps := profiles.ConfStrings(field)
 	if (len(comps) == 0 || comps[0] != val) && strings.TrimSpace(val) != "" {
@@ -1081,6 +1160,63 @@ func interfacesFrom(reader io.Reader) (map[int][]string, error) {
 
 //======================================================================
 
+// InterfaceCapability is a setting dumpcap reports an interface supports, such
+// as a link-layer type or a timestamp type.
+type InterfaceCapability struct {
+	Name        string // e.g. EN10MB
+	Description string // e.g. Ethernet
+}
+
+var interfaceCapabilityRE = regexp.MustCompile(`^\s+(\S+)(\s+\((.*)\))?\s*$`)
+
+// InterfaceLinkTypes returns the link-layer types the interface supports, as
+// reported by dumpcap -L. The types can differ in monitor mode.
+func InterfaceLinkTypes(iface string, monitor bool) ([]InterfaceCapability, error) {
+	args := []string{"-L"}
+	if monitor {
+		args = append(args, "-I")
+	}
+	args = append(args, "-i", iface)
+	out, err := exec.Command(DumpcapBin(), args...).Output()
+	if err != nil {
+		return nil, err
+	}
+	return interfaceCapabilitiesFrom(bytes.NewReader(out))
+}
+
+// InterfaceTimestampTypes returns the timestamp types the interface supports,
+// as reported by dumpcap --list-time-stamp-types.
+func InterfaceTimestampTypes(iface string) ([]InterfaceCapability, error) {
+	out, err := exec.Command(DumpcapBin(), "--list-time-stamp-types", "-i", iface).Output()
+	if err != nil {
+		return nil, err
+	}
+	return interfaceCapabilitiesFrom(bytes.NewReader(out))
+}
+
+// $ dumpcap -L -i eth0
+// Data link types of interface eth0 (use option -y to set):
+//   EN10MB (Ethernet)
+//   DOCSIS (DOCSIS)
+func interfaceCapabilitiesFrom(reader io.Reader) ([]InterfaceCapability, error) {
+	res := make([]InterfaceCapability, 0)
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		if match := interfaceCapabilityRE.FindStringSubmatch(scanner.Text()); match != nil {
+			res = append(res, InterfaceCapability{
+				Name:        match[1],
+				Description: match[3],
+			})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+//======================================================================
+
 var foldersRE = regexp.MustCompile(`:\s*`)
 
 // $ env TMPDIR=/foo tshark -G folders Temp
@@ -1147,6 +1283,30 @@ func WiresharkProfileNames() []string {
 	return res
 }
 
+// WiresharkProfilePrefsFile returns the path to the preferences file of the
+// user's Wireshark profile with the given name. The file may not exist yet.
+func WiresharkProfilePrefsFile(name string) (string, error) {
+	return WiresharkProfileFile(name, "preferences")
+}
+
+// WiresharkProfileFile returns the path to the named file e.g. dfilter_buttons
+// in the user's Wireshark profile. If profile is empty, the file is from
+// Wireshark's Default profile. The file may not exist.
+func WiresharkProfileFile(profile string, file string) (string, error) {
+	folders, err := TsharkSettings("Personal configuration")
+	if err != nil {
+		return "", err
+	}
+	folder, ok := folders["Personal configuration"]
+	if !ok {
+		return "", fmt.Errorf("Could not find the Wireshark personal configuration folder")
+	}
+	if profile == "" {
+		return filepath.Join(folder, file), nil
+	}
+	return filepath.Join(folder, "profiles", profile, file), nil
+}
+
 //======================================================================
 
 func IsTerminal(fd uintptr) bool {
@@ -1268,6 +1428,8 @@ type KeyState struct {
 	PartialCtrlWCmd bool
 	PartialmCmd     bool
 	PartialQuoteCmd bool
+	PartialqCmd     bool
+	PartialAtCmd    bool
 }
 
 //======================================================================
@@ -88,6 +88,13 @@ Running on Linux 3.2.0-126-generic, with libpcap version 1.1.1, with libz
 	assert.Equal(t, res, v1)
 }
 
+func TestLua1(t *testing.T) {
+	assert.True(t, TSharkSupportsLuaFromOutput(`Compiled (64-bit) using GCC 11.2.0, with GLib 2.72.1, with libpcap, with POSIX
+capabilities (Linux), with libnl 3, with zlib 1.2.11, with PCRE2, with Lua 5.2.4, with GnuTLS 3.7.3`))
+	assert.False(t, TSharkSupportsLuaFromOutput(`Compiled (64-bit) using GCC 11.2.0, with GLib 2.72.1, with libpcap, with POSIX
+capabilities (Linux), with libnl 3, with zlib 1.2.11, with PCRE2, without Lua, with GnuTLS 3.7.3`))
+}
+
 func TestInterfaces1(t *testing.T) {
 	out1 := `
 1. \Device\NPF_{BAC1CFBD-DE27-4023-B478-0C490B99DC5E} (Local Area Connection 2)
@@ -135,6 +142,32 @@ func TestInterfaces2(t *testing.T) {
 	assert.Equal(t, `ciscodump`, v[1])
 }
 
+func TestInterfaceCapabilities1(t *testing.T) {
+	out1 := `
+Data link types of interface wlan0 when not in monitor mode (use option -y to set):
+  EN10MB (Ethernet)
+  DOCSIS (DOCSIS)
+  RAW
+`[1:]
+	caps, err := interfaceCapabilitiesFrom(bytes.NewReader([]byte(out1)))
+	assert.NoError(t, err)
+	assert.Equal(t, []InterfaceCapability{
+		{Name: "EN10MB", Description: "Ethernet"},
+		{Name: "DOCSIS", Description: "DOCSIS"},
+		{Name: "RAW"},
+	}, caps)
+
+	out2 := `
+Timestamp types of the interface (use option --time-stamp-type to set):
+  host (Host)
+  adapter_unsynced (Adapter, not synced with system time)
+`[1:]
+	caps, err = interfaceCapabilitiesFrom(bytes.NewReader([]byte(out2)))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(caps))
+	assert.Equal(t, InterfaceCapability{Name: "adapter_unsynced", Description: "Adapter, not synced with system time"}, caps[1])
+}
+
 func TestConv1(t *testing.T) {
 	var tests = []struct {
 		arg string
@@ -174,6 +207,25 @@ func TestMACComp1(t *testing.T) {
 	assert.False(t, mac.Less("11:22:33:44:55:66", "11:22:33:44:54:66"))
 }
 
+func TestKeyMapping1(t *testing.T) {
+	km, err := parseKeyMapping("<f1> ZZ")
+	assert.NoError(t, err)
+	assert.Equal(t, "", km.View)
+	assert.Equal(t, 2, len(km.To))
+	assert.Equal(t, "<f1> ZZ", km.String())
+
+	km, err = parseKeyMapping("hex <f5> <tab><tab><down><tab>")
+	assert.NoError(t, err)
+	assert.Equal(t, "hex", km.View)
+	assert.Equal(t, 4, len(km.To))
+	assert.Equal(t, "hex <f5> <tab><tab><down><tab>", km.String())
+
+	_, err = parseKeyMapping("<f1>")
+	assert.Error(t, err)
+	_, err = parseKeyMapping("hex ab ZZ")
+	assert.Error(t, err)
+}
+
 func TestFolders(t *testing.T) {
 	tmp := os.Getenv("TMPDIR")
 	os.Setenv("TMPDIR", "/foo")
@@ -8,10 +8,13 @@
 package filter
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io"
 	"os/exec"
+	"regexp"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
@@ -33,6 +36,7 @@ import (
 	"github.com/gcla/gowid/widgets/styled"
 	"github.com/gcla/gowid/widgets/text"
 	"github.com/gcla/termshark/v2"
+	"github.com/gcla/termshark/v2/pkg/dfilter"
 	"github.com/gcla/termshark/v2/pkg/fields"
 	"github.com/gcla/termshark/v2/widgets/appkeys"
 	"github.com/gdamore/tcell/v2"
@@ -54,6 +58,7 @@ type filtStruct struct {
 type Widget struct {
 	wrapped              gowid.IWidget
 	opts                 Options
+	validator            IValidator
 	ed                   *edit.Widget     // what the user types into - wrapped by validity styling
 	dropDown             *menu.Widget     // the menu of possible completions
 	dropDownSite         *menu.SiteWidget // where in this widget structure the drop down is rendered
@@ -75,6 +80,7 @@ type Widget struct {
 	readytorunchan       chan struct{}
 	temporarilyDisabled  *bool // set to true right after submitting a new filter, so the menu disappears
 	enterPending         bool  // set to true if the user has hit enter; process if the filter goes to valid before another change. For slow validity processing.
+	confirming           bool  // set to true while a filter shown as invalid is being confirmed by tshark
 	*gowid.Callbacks
 	gowid.IsSelectable
 }
@@ -87,6 +93,7 @@ type ValidCB struct{}
 type InvalidCB struct{}
 type EmptyCB struct{}
 type SubmitCB struct{}
+type InvalidSubmitCB struct{}
 
 type Pos int
 
@@ -97,9 +104,11 @@ const (
 
 type Options struct {
 	Completer      fields.IPrefixCompleter
+	ValueCompleter fields.IValueCompleter // if set, complete the value after e.g. "ip.addr == "
 	MenuOpener     menu.IOpener
 	Position       Pos
 	Validator      IValidator
+	Fields         dfilter.IFields // if set, and no validator is provided, check filters in Go before using tshark
 	MaxCompletions int
 }
 
@@ -121,7 +130,7 @@ func New(name string, opt Options) *Widget {
 
 	validator := opt.Validator
 	if validator == nil {
-		validator = &DisplayFilterValidator{}
+		validator = &DisplayFilterValidator{Fields: opt.Fields}
 	}
 
 	filterList := list.New(list.NewSimpleListWalker([]gowid.IWidget{}))
@@ -172,7 +181,7 @@ func New(name string, opt Options) *Widget {
 
 	cb := gowid.NewCallbacks()
 
-	onelineEd := appkeys.New(ed, handleEnter(cb, res), appkeys.Options{
+	onelineEd := appkeys.New(ed, handleEnter(cb, res, res), appkeys.Options{
 		ApplyBefore: true,
 	})
 
@@ -214,6 +223,7 @@ func New(name string, opt Options) *Widget {
 	*res = Widget{
 		wrapped:              wrapped,
 		opts:                 opt,
+		validator:            validator,
 		ed:                   ed,
 		dropDown:             drop,
 		dropDownSite:         site,
@@ -239,6 +249,7 @@ func New(name string, opt Options) *Widget {
 			app.Run(gowid.RunFunction(func(app gowid.IApp) {
 				res.validitySite.SetSubWidget(res.valid, app)
 				gowid.RunWidgetCallbacks(res.Callbacks, ValidCB{}, app, res)
+				res.confirming = false
 
 				if res.enterPending {
 					var dummy gowid.IWidget
@@ -257,6 +268,18 @@ func New(name string, opt Options) *Widget {
 				res.validitySite.SetSubWidget(res.invalid, app)
 				gowid.RunWidgetCallbacks(res.Callbacks, InvalidCB{}, app, res)
 				res.enterPending = false
+				res.confirming = false
+			}))
+		},
+	}
+
+	// Shown as invalid, but an enter is remembered in case tshark decides otherwise
+	unconfirmedcb := &ValidateCB{
+		Fn: func(app gowid.IApp) {
+			app.Run(gowid.RunFunction(func(app gowid.IApp) {
+				res.validitySite.SetSubWidget(res.invalid, app)
+				gowid.RunWidgetCallbacks(res.Callbacks, InvalidCB{}, app, res)
+				res.confirming = true
 			}))
 		},
 	}
@@ -267,6 +290,7 @@ func New(name string, opt Options) *Widget {
 				res.validitySite.SetSubWidget(res.intermediate, app)
 				gowid.RunWidgetCallbacks(res.Callbacks, IntermediateCB{}, app, res)
 				res.enterPending = false
+				res.confirming = false
 			}))
 		},
 	}
@@ -277,6 +301,7 @@ func New(name string, opt Options) *Widget {
 				res.validitySite.SetSubWidget(res.empty, app)
 				gowid.RunWidgetCallbacks(res.Callbacks, EmptyCB{}, app, res)
 				res.enterPending = false
+				res.confirming = false
 			}))
 		},
 	}
@@ -285,6 +310,9 @@ func New(name string, opt Options) *Widget {
 	validator.SetInvalid(invalidcb)
 	validator.SetKilled(killedcb)
 	validator.SetEmpty(emptycb)
+	if v, ok := validator.(IValidatorWithUnconfirmed); ok {
+		v.SetUnconfirmed(unconfirmedcb)
+	}
 
 	// Save up filter changes, send latest over when process is ready, discard ones in between
 	termshark.TrackedGo(func() {
@@ -335,6 +363,7 @@ func New(name string, opt Options) *Widget {
 				invalidcb.App = fs.app
 				killedcb.App = fs.app
 				emptycb.App = fs.app
+				unconfirmedcb.App = fs.app
 				validator.Validate(fs.txt)
 			}
 		}
@@ -353,11 +382,14 @@ type iFilterEnter interface {
 	setDisabled()
 	setEnterPending()
 	isValid() bool
+	isInvalid() bool
 }
 
 // if the filter is valid when enter is pressed, submit the SubmitCB callback. Those
-// registered will be able to respond e.g. start handling the valid filter value.
-func handleEnter(cb *gowid.Callbacks, fe iFilterEnter) appkeys.KeyInputFn {
+// registered will be able to respond e.g. start handling the valid filter value. If
+// the filter is known to be invalid, submit the InvalidSubmitCB callback instead, so
+// the problem can be explained.
+func handleEnter(cb *gowid.Callbacks, w gowid.IWidget, fe iFilterEnter) appkeys.KeyInputFn {
 	return func(evk *tcell.EventKey, app gowid.IApp) bool {
 		handled := false
 		switch evk.Key() {
@@ -366,6 +398,8 @@ func handleEnter(cb *gowid.Callbacks, fe iFilterEnter) appkeys.KeyInputFn {
 				var dummy gowid.IWidget
 				gowid.RunWidgetCallbacks(cb, SubmitCB{}, app, dummy)
 				fe.setDisabled()
+			} else if fe.isInvalid() {
+				gowid.RunWidgetCallbacks(cb, InvalidSubmitCB{}, app, w)
 			} else {
 				fe.setEnterPending() // remember in case the filter goes valid shortly
 			}
@@ -375,6 +409,46 @@ func handleEnter(cb *gowid.Callbacks, fe iFilterEnter) appkeys.KeyInputFn {
 	}
 }
 
+// The value compared with a field - the term being completed - starts after the
+// operator, and may be a partially typed string
+var valueContextRE = regexp.MustCompile(`([A-Za-z][A-Za-z0-9_.\-]*)\s*(?:===|!==|==|!=|~=|>=|<=|>|<|\s(?:eq|ne|gt|lt|ge|le|any_eq|all_eq|any_ne|all_ne|contains))\s*("[^"]*|[^\s"()]*)$`)
+
+// completionContext returns the start of the term at pos that a completion
+// would replace. If values is true and the term is the value compared with a
+// field, the field's name is returned too.
+func completionContext(txt string, pos int, values bool) (int, string) {
+	if values {
+		if m := valueContextRE.FindStringSubmatchIndex(txt[0:pos]); m != nil {
+			return m[4], txt[m[2]:m[3]]
+		}
+	}
+	start := pos
+	for start > 0 {
+		if !isValidFilterRune(rune(txt[start-1])) {
+			break
+		}
+		start--
+	}
+	return start, ""
+}
+
+// completionEnd returns the end of the term at pos that a completion would
+// replace.
+func completionEnd(txt string, pos int, value bool) int {
+	end := pos
+	for end < len(txt) {
+		if value {
+			if unicode.IsSpace(rune(txt[end])) || txt[end] == '(' || txt[end] == ')' {
+				break
+			}
+		} else if !isValidFilterRune(rune(txt[end])) {
+			break
+		}
+		end++
+	}
+	return end
+}
+
 func isValidFilterRune(r rune) bool {
 	res := true
 	switch {
@@ -389,7 +463,7 @@ func isValidFilterRune(r rune) bool {
 	return res
 }
 
-func newMenuWidgets(ed *edit.Widget, completions []string) []gowid.IWidget {
+func newMenuWidgets(ed *edit.Widget, completions []string, values bool) []gowid.IWidget {
 	menu2Widgets := make([]gowid.IWidget, 0)
 
 	for _, s := range completions {
@@ -410,29 +484,8 @@ func newMenuWidgets(ed *edit.Widget, completions []string) []gowid.IWidget {
 		clickmeStyled := styled.NewInvertedFocus(clickme, gowid.MakePaletteRef("filter-menu"))
 		clickme.OnClick(gowid.MakeWidgetCallback(gowid.ClickCB{}, func(app gowid.IApp, target gowid.IWidget) {
 			txt := ed.Text()
-			end := ed.CursorPos()
-			start := end
-		Loop1:
-			for {
-				if start == 0 {
-					break
-				}
-				start--
-				if !isValidFilterRune(rune(txt[start])) {
-					start++
-					break Loop1
-				}
-			}
-		Loop2:
-			for {
-				if end == len(txt) {
-					break
-				}
-				if !isValidFilterRune(rune(txt[end])) {
-					break Loop2
-				}
-				end++
-			}
+			start, field := completionContext(txt, ed.CursorPos(), values)
+			end := completionEnd(txt, ed.CursorPos(), field != "")
 			ed.SetText(fmt.Sprintf("%s%s%s", txt[0:start], scopy, txt[end:len(txt)]), app)
 			ed.SetCursorPos(len(txt[0:start])+len(scopy), app)
 
@@ -471,6 +524,17 @@ func makeCompletions(comp fields.IPrefixCompleter, txt string, max int, app gowi
 	}
 }
 
+func makeValueCompletions(comp fields.IValueCompleter, field string, txt string, max int, app gowid.IApp, fn func([]string, gowid.IApp)) {
+	cb := fnCallback{
+		app: app,
+		fn: func(completions []string, app gowid.IApp) {
+			completions = completions[0:gwutil.Min(max, len(completions))]
+			fn(completions, app)
+		},
+	}
+	comp.ValueCompletions(field, txt, cb)
+}
+
 func (w *Widget) setDisabled() {
 	*w.temporarilyDisabled = true
 }
@@ -484,6 +548,19 @@ func (w *Widget) isValid() bool {
 	return w.validitySite.SubWidget() == w.valid
 }
 
+func (w *Widget) isInvalid() bool {
+	return w.validitySite.SubWidget() == w.invalid && !w.confirming
+}
+
+// ValidationError returns the problem found with the filter when it was last
+// checked, if the validator can explain it, or nil.
+func (w *Widget) ValidationError() error {
+	if v, ok := w.validator.(IValidatorWithError); ok {
+		return v.LastError()
+	}
+	return nil
+}
+
 // Start an asynchronous routine to update the drop-down menu with completion
 // options. Runs on a small delay so it can be cancelled and restarted if the
 // user is typing quickly.
@@ -522,24 +599,22 @@ func (w *Widget) UpdateCompletions(app gowid.IApp) {
 
 			txt := w.ed.Text()
 			end := w.ed.CursorPos()
-			start := end
-		Loop:
-			for {
-				if start == 0 {
-					break
-				}
-				start--
-				if !isValidFilterRune(rune(txt[start])) {
-					start++
-					break Loop
-				}
-			}
+			start, field := completionContext(txt, end, w.opts.ValueCompleter != nil)
 
-			makeCompletions(w.fields, txt[start:end], y, app, func(completions []string, app gowid.IApp) {
+			cb := func(completions []string, app gowid.IApp) {
 				app.Run(gowid.RunFunction(func(app gowid.IApp) {
-					w.processCompletions(completions, app)
+					// Value completions arrive later - drop them if the filter has changed since
+					if ctx.Err() == nil {
+						w.processCompletions(completions, app)
+					}
 				}))
-			})
+			}
+
+			if field != "" {
+				makeValueCompletions(w.opts.ValueCompleter, field, txt[start:end], y, app, cb)
+			} else {
+				makeCompletions(w.fields, txt[start:end], y, app, cb)
+			}
 		}))
 	}(w.edCtx)
 }
@@ -550,7 +625,7 @@ func (w *Widget) processCompletions(completions []string, app gowid.IApp) {
 		max = gwutil.Max(max, len(c))
 	}
 
-	menu2Widgets := newMenuWidgets(w.ed, completions)
+	menu2Widgets := newMenuWidgets(w.ed, completions, w.opts.ValueCompleter != nil)
 	w.completions = completions
 	app.Run(gowid.RunFunction(func(app gowid.IApp) {
 		w.completionsList.SetWalker(list.NewSimpleListWalker(menu2Widgets), app)
@@ -584,6 +659,12 @@ func (w *Widget) OnSubmit(f gowid.IWidgetChangedCallback) {
 	gowid.AddWidgetCallback(w, SubmitCB{}, f)
 }
 
+// OnInvalidSubmit registers a callback run when enter is pressed and the filter is
+// invalid.
+func (w *Widget) OnInvalidSubmit(f gowid.IWidgetChangedCallback) {
+	gowid.AddWidgetCallback(w, InvalidSubmitCB{}, f)
+}
+
 func (w *Widget) OnIntermediate(f gowid.IWidgetChangedCallback) {
 	gowid.AddWidgetCallback(w, IntermediateCB{}, f)
 }
@@ -613,6 +694,21 @@ func (w *Widget) SetValue(v string, app gowid.IApp) {
 	w.ed.SetCursorPos(len(v), app)
 }
 
+// InsertValue inserts v into the filter at the cursor, separated by a space from
+// the text either side of it.
+func (w *Widget) InsertValue(v string, app gowid.IApp) {
+	txt := w.ed.Text()
+	pos := w.ed.CursorPos()
+	if pos > 0 && txt[pos-1] != ' ' {
+		v = " " + v
+	}
+	if pos < len(txt) && txt[pos] != ' ' {
+		v = v + " "
+	}
+	w.ed.SetText(txt[0:pos]+v+txt[pos:], app)
+	w.ed.SetCursorPos(pos+len(v), app)
+}
+
 func (w *Widget) Menus() []gowid.IMenuCompatible {
 	return []gowid.IMenuCompatible{w.dropDown}
 }
@@ -707,6 +803,18 @@ type IValidator interface {
 	Validate(filter string)
 }
 
+// IValidatorWithUnconfirmed is implemented by validators that can report a filter
+// as invalid before they are sure, then confirm it.
+type IValidatorWithUnconfirmed interface {
+	SetUnconfirmed(cb IValidateCB)
+}
+
+// IValidatorWithError is implemented by validators that can say why a filter is
+// invalid.
+type IValidatorWithError interface {
+	LastError() error
+}
+
 //======================================================================
 
 type IValidateCB interface {
@@ -727,14 +835,32 @@ func (v *ValidateCB) Call(filter string) {
 }
 
 type DisplayFilterValidator struct {
-	Valid    IValidateCB
-	Invalid  IValidateCB
-	KilledCB IValidateCB
-	EmptyCB  IValidateCB
-	Cmd      *exec.Cmd
+	Valid       IValidateCB
+	Invalid     IValidateCB
+	KilledCB    IValidateCB
+	EmptyCB     IValidateCB
+	Unconfirmed IValidateCB // if set, called when the Go check finds a problem, before tshark confirms it
+	Cmd         *exec.Cmd
+	Fields      dfilter.IFields // if set, used to check the filter before running tshark
+	errLock     sync.Mutex
+	err         error // the last problem found by the Go check
 }
 
 var _ IValidator = (*DisplayFilterValidator)(nil)
+var _ IValidatorWithError = (*DisplayFilterValidator)(nil)
+var _ IValidatorWithUnconfirmed = (*DisplayFilterValidator)(nil)
+
+func (f *DisplayFilterValidator) LastError() error {
+	f.errLock.Lock()
+	defer f.errLock.Unlock()
+	return f.err
+}
+
+func (f *DisplayFilterValidator) setLastError(err error) {
+	f.errLock.Lock()
+	defer f.errLock.Unlock()
+	f.err = err
+}
 
 func (f *DisplayFilterValidator) SetValid(cb IValidateCB) {
 	f.Valid = cb
@@ -744,6 +870,10 @@ func (f *DisplayFilterValidator) SetInvalid(cb IValidateCB) {
 	f.Invalid = cb
 }
 
+func (f *DisplayFilterValidator) SetUnconfirmed(cb IValidateCB) {
+	f.Unconfirmed = cb
+}
+
 func (f *DisplayFilterValidator) SetKilled(cb IValidateCB) {
 	f.KilledCB = cb
 }
@@ -775,10 +905,31 @@ func (f *DisplayFilterValidator) Validate(filter string) {
 		return
 	}
 
+	// Running tshark for each change to the filter is slow on older machines, so check
+	// the filter in Go first. tshark is only needed if the Go check can't be sure - and
+	// a filter found valid here is confirmed by tshark when it's applied. The Go check
+	// doesn't know every construct tshark accepts, so a problem it finds is shown straight
+	// away, then confirmed by tshark; its error is kept to show where in the filter the
+	// problem is.
+	if f.Fields != nil {
+		verified, err := dfilter.Check(filter, f.Fields)
+		f.setLastError(err)
+		if err == nil && verified {
+			if f.Valid != nil {
+				f.Valid.Call(filter)
+			}
+			return
+		}
+		if err != nil && f.Unconfirmed != nil {
+			f.Unconfirmed.Call(filter)
+		}
+	}
+
 	f.Cmd = exec.Command(termshark.TSharkBin(), []string{"-Y", filter, "-r", termshark.CacheFile("empty.pcap")}...)
 	err = f.Cmd.Run()
 
 	if err == nil {
+		f.setLastError(nil)
 		if f.Valid != nil {
 			f.Valid.Call(filter)
 		}
@@ -803,6 +954,159 @@ func (f *DisplayFilterValidator) Validate(filter string) {
 	}
 }
 
+// CheckDisplayFilter checks a display filter about to be applied without the filter
+// widget e.g. from a script or dialog. Like DisplayFilterValidator, it checks in Go first,
+// and a problem found there is only reported if tshark agrees the filter is invalid. It
+// may run tshark, so don't call it from the app goroutine - use CheckDisplayFilterThen.
+func CheckDisplayFilter(filter string, flds dfilter.IFields) error {
+	_, err := dfilter.Check(filter, flds)
+	if err == nil {
+		return nil
+	}
+	return confirmWithTShark(filter, err)
+}
+
+// CheckDisplayFilterThen is CheckDisplayFilter for the app goroutine. If the Go check finds
+// no problem, cb is called straight away; otherwise tshark is run in the background and cb
+// is called in the app goroutine with its verdict.
+func CheckDisplayFilterThen(filter string, flds dfilter.IFields, app gowid.IApp, cb func(error, gowid.IApp)) {
+	_, err := dfilter.Check(filter, flds)
+	if err == nil {
+		cb(nil, app)
+		return
+	}
+	termshark.TrackedGo(func() {
+		err := confirmWithTShark(filter, err)
+		app.Run(gowid.RunFunction(func(app gowid.IApp) {
+			cb(err, app)
+		}))
+	}, Goroutinewg)
+}
+
+// confirmWithTShark returns err, the problem the Go check found with filter, only if
+// tshark also rejects the filter.
+func confirmWithTShark(filter string, err error) error {
+	cmd := exec.Command(termshark.TSharkBin(), []string{"-Y", filter, "-r", termshark.CacheFile("empty.pcap")}...)
+	if terr := cmd.Run(); terr != nil {
+		if exiterr, ok := terr.(*exec.ExitError); ok {
+			if status, ok := exiterr.Sys().(syscall.WaitStatus); ok && status.ExitStatus() == 2 {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+//======================================================================
+
+// CaptureFilterValidator checks a capture filter by compiling it with dumpcap -d.
+// Compiling needs an interface, because the BPF program depends on the link-layer
+// type.
+type CaptureFilterValidator struct {
+	Valid    IValidateCB
+	Invalid  IValidateCB
+	KilledCB IValidateCB
+	EmptyCB  IValidateCB
+	Args     []string // dumpcap flags preceding -f e.g. -d -i eth0 -y EN10MB
+	Cmd      *exec.Cmd
+	errLock  sync.Mutex
+	err      error // dumpcap's explanation of the last invalid filter
+}
+
+var _ IValidator = (*CaptureFilterValidator)(nil)
+var _ IValidatorWithError = (*CaptureFilterValidator)(nil)
+
+func (f *CaptureFilterValidator) LastError() error {
+	f.errLock.Lock()
+	defer f.errLock.Unlock()
+	return f.err
+}
+
+func (f *CaptureFilterValidator) setLastError(err error) {
+	f.errLock.Lock()
+	defer f.errLock.Unlock()
+	f.err = err
+}
+
+func (f *CaptureFilterValidator) SetValid(cb IValidateCB) {
+	f.Valid = cb
+}
+
+func (f *CaptureFilterValidator) SetInvalid(cb IValidateCB) {
+	f.Invalid = cb
+}
+
+func (f *CaptureFilterValidator) SetKilled(cb IValidateCB) {
+	f.KilledCB = cb
+}
+
+func (f *CaptureFilterValidator) SetEmpty(cb IValidateCB) {
+	f.EmptyCB = cb
+}
+
+func (f *CaptureFilterValidator) Kill() (bool, error) {
+	var err error
+	var res bool
+	if f.Cmd != nil {
+		proc := f.Cmd.Process
+		if proc != nil {
+			res = true
+			err = proc.Kill()
+		}
+	}
+	return res, err
+}
+
+func (f *CaptureFilterValidator) Validate(filter string) {
+	if filter == "" {
+		f.setLastError(nil)
+		if f.EmptyCB != nil {
+			f.EmptyCB.Call(filter)
+		}
+		return
+	}
+
+	var stderr bytes.Buffer
+	f.Cmd = exec.Command(termshark.DumpcapBin(), append(append([]string{}, f.Args...), "-f", filter)...)
+	f.Cmd.Stderr = &stderr
+	err := f.Cmd.Run()
+
+	if err == nil {
+		f.setLastError(nil)
+		if f.Valid != nil {
+			f.Valid.Call(filter)
+		}
+		return
+	}
+
+	// dumpcap exits with an error if the filter doesn't compile; only a signal means
+	// the check was cut short. If dumpcap couldn't be run at all, the filter can't be
+	// used to capture either, so say why.
+	exiterr, ok := err.(*exec.ExitError)
+	if !ok {
+		f.setLastError(fmt.Errorf("Could not run %s: %v", termshark.DumpcapBin(), err))
+		if f.Invalid != nil {
+			f.Invalid.Call(filter)
+		}
+		return
+	}
+
+	killed := true
+	if status, ok := exiterr.Sys().(syscall.WaitStatus); ok && !status.Signaled() {
+		killed = false
+	}
+	if killed {
+		if f.KilledCB != nil {
+			f.KilledCB.Call(filter)
+		}
+	} else {
+		f.setLastError(fmt.Errorf("%s", strings.TrimSpace(stderr.String())))
+		if f.Invalid != nil {
+			f.Invalid.Call(filter)
+		}
+	}
+}
+
 //======================================================================
 // Local Variables:
 // mode: Go
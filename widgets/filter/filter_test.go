@@ -0,0 +1,44 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package filter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+//======================================================================
+
+func TestCompletionContext1(t *testing.T) {
+	for _, tc := range []struct {
+		txt   string
+		start int
+		field string
+	}{
+		{"tcp.por", 0, ""},
+		{"tcp and ud", 8, ""},
+		{"ip.addr == ", 11, "ip.addr"},
+		{"ip.addr==10.0", 9, "ip.addr"},
+		{"tcp.port eq 8", 12, "tcp.port"},
+		{"http.host contains \"ab", 19, "http.host"},
+		{"eth.src == 00:11:2", 11, "eth.src"},
+		{"ip.src == 1.2.3.4 and ip.dst != ", 32, "ip.dst"},
+		{"http.host == \"ab\" ", 18, ""},
+	} {
+		start, field := completionContext(tc.txt, len(tc.txt), true)
+		assert.Equal(t, tc.start, start, tc.txt)
+		assert.Equal(t, tc.field, field, tc.txt)
+	}
+
+	start, field := completionContext("ip.addr == 10.0", 15, false)
+	assert.Equal(t, 11, start)
+	assert.Equal(t, "", field)
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 110
+// End:
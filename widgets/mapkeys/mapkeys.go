@@ -6,7 +6,8 @@
 // keypresses. If the user pnovides as input a key that is mapped, the sequence of
 // resulting keypresses is played to the subwidget before control returns. If the key is
 // not mapped, it is passed through as normal. I'm going to use this to provide a vim-like
-// macro feature in termshark.
+// macro feature in termshark. The widget can also record the keys typed, and play them
+// back later, for vim-like q and @ macros.
 package mapkeys
 
 import (
@@ -17,9 +18,25 @@ import (
 
 //======================================================================
 
+// IView reports which view of the application has focus, so that mappings made for
+// that view alone can take precedence. It returns "" if no such view has focus.
+type IView interface {
+	CurrentView(app gowid.IApp) string
+}
+
+// The most keys played, for macros, in response to one keypress - so a macro that plays
+// itself can't hang the UI.
+const maxPlayed = 10000
+
 type Widget struct {
 	gowid.IWidget
-	kmap map[vim.KeyPress]vim.KeySequence
+	kmap      map[vim.KeyPress]vim.KeySequence
+	vmaps     map[string]map[vim.KeyPress]vim.KeySequence
+	view      IView
+	recording bool
+	recorded  vim.KeySequence
+	pending   vim.KeySequence // queued by Play
+	playing   bool
 }
 
 var _ gowid.IWidget = (*Widget)(nil)
@@ -28,30 +45,105 @@ func New(w gowid.IWidget) *Widget {
 	res := &Widget{
 		IWidget: w,
 		kmap:    make(map[vim.KeyPress]vim.KeySequence),
+		vmaps:   make(map[string]map[vim.KeyPress]vim.KeySequence),
 	}
 	return res
 }
 
+// SetView provides the means to find the current view, needed for mappings added with
+// AddViewMapping.
+func (w *Widget) SetView(v IView) {
+	w.view = v
+}
+
+func (w *Widget) lookup(kp vim.KeyPress, app gowid.IApp) (vim.KeySequence, bool) {
+	if w.view != nil {
+		if vmap, ok := w.vmaps[w.view.CurrentView(app)]; ok {
+			if seq, ok := vmap[kp]; ok {
+				return seq, true
+			}
+		}
+	}
+	seq, ok := w.kmap[kp]
+	return seq, ok
+}
+
 func (w *Widget) UserInput(ev interface{}, size gowid.IRenderSize, focus gowid.Selector, app gowid.IApp) bool {
 	switch ev := ev.(type) {
 	case *tcell.EventKey:
 		kp := vim.KeyPressFromTcell(ev)
-		if seq, ok := w.kmap[kp]; ok {
-			var res bool
-			for _, vk := range seq {
-				k := gowid.Key(vk)
-				// What should the handled value be??
-				res = w.IWidget.UserInput(tcell.NewEventKey(k.Key(), k.Rune(), k.Modifiers()), size, focus, app)
-			}
-			return res
-		} else {
-			return w.IWidget.UserInput(ev, size, focus, app)
+		if w.recording && !w.playing {
+			w.recorded = append(w.recorded, kp)
+		}
+		res := w.handleKey(kp, ev, size, focus, app)
+		if !w.playing && len(w.pending) > 0 {
+			w.playPending(size, focus, app)
 		}
+		return res
 	default:
 		return w.IWidget.UserInput(ev, size, focus, app)
 	}
 }
 
+func (w *Widget) handleKey(kp vim.KeyPress, ev *tcell.EventKey, size gowid.IRenderSize, focus gowid.Selector, app gowid.IApp) bool {
+	if seq, ok := w.lookup(kp, app); ok {
+		var res bool
+		for _, vk := range seq {
+			k := gowid.Key(vk)
+			// What should the handled value be??
+			res = w.IWidget.UserInput(tcell.NewEventKey(k.Key(), k.Rune(), k.Modifiers()), size, focus, app)
+		}
+		return res
+	} else {
+		return w.IWidget.UserInput(ev, size, focus, app)
+	}
+}
+
+// playPending plays the keys queued by Play as if the user had typed them, so mappings
+// apply. Keys queued while playing - by a macro that plays another - are played too.
+func (w *Widget) playPending(size gowid.IRenderSize, focus gowid.Selector, app gowid.IApp) {
+	w.playing = true
+	defer func() {
+		w.playing = false
+		w.pending = nil
+	}()
+	for played := 0; len(w.pending) > 0 && played < maxPlayed; played++ {
+		kp := w.pending[0]
+		w.pending = w.pending[1:]
+		k := gowid.Key(kp)
+		w.handleKey(kp, tcell.NewEventKey(k.Key(), k.Rune(), k.Modifiers()), size, focus, app)
+	}
+}
+
+// StartRecording begins saving the keys the user types, until StopRecording is called.
+// The keys are saved before any mapping is applied.
+func (w *Widget) StartRecording(app gowid.IApp) {
+	w.recording = true
+	w.recorded = make(vim.KeySequence, 0)
+}
+
+// StopRecording returns the keys typed since StartRecording, not including the key being
+// processed - the one that stopped the recording - unless it is being played.
+func (w *Widget) StopRecording(app gowid.IApp) vim.KeySequence {
+	res := w.recorded
+	if len(res) > 0 && !w.playing {
+		res = res[:len(res)-1]
+	}
+	w.recording = false
+	w.recorded = nil
+	return res
+}
+
+func (w *Widget) IsRecording() bool {
+	return w.recording
+}
+
+// Play queues keys to be processed as if the user had typed them. They are processed
+// once the current keypress has been handled.
+func (w *Widget) Play(keys vim.KeySequence, app gowid.IApp) {
+	w.pending = append(w.pending, keys...)
+}
+
 func (w *Widget) AddMapping(from vim.KeyPress, to vim.KeySequence, app gowid.IApp) {
 	w.kmap[from] = to
 }
@@ -60,6 +152,21 @@ func (w *Widget) RemoveMapping(from vim.KeyPress, app gowid.IApp) {
 	delete(w.kmap, from)
 }
 
+// AddViewMapping maps from to to only when view has focus. It takes precedence over a
+// mapping of the same key made with AddMapping.
+func (w *Widget) AddViewMapping(view string, from vim.KeyPress, to vim.KeySequence, app gowid.IApp) {
+	if _, ok := w.vmaps[view]; !ok {
+		w.vmaps[view] = make(map[vim.KeyPress]vim.KeySequence)
+	}
+	w.vmaps[view][from] = to
+}
+
+func (w *Widget) RemoveViewMapping(view string, from vim.KeyPress, app gowid.IApp) {
+	if vmap, ok := w.vmaps[view]; ok {
+		delete(vmap, from)
+	}
+}
+
 // ClearMappings will remove all mappings. I deliberately preserve the same dictionary,
 // though in case I decide in the future it's useful to let clients have direct access to
 // the map (and so maybe store it somewhere).
@@ -67,6 +174,9 @@ func (w *Widget) ClearMappings(app gowid.IApp) {
 	for k := range w.kmap {
 		delete(w.kmap, k)
 	}
+	for k := range w.vmaps {
+		delete(w.vmaps, k)
+	}
 }
 
 //======================================================================
@@ -0,0 +1,173 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+package minibuffer
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gcla/gowid"
+	"github.com/gdamore/tcell/v2"
+)
+
+//======================================================================
+
+// IHistory stores the command lines run in the minibuffer, most recent
+// first.
+type IHistory interface {
+	Entries() []string
+	Add(line string)
+}
+
+// SetHistory lets the user recall earlier commands with up/down and search
+// them with ctrl-r. Commands run are added to it.
+func (w *Widget) SetHistory(h IHistory) {
+	w.history = h
+}
+
+// olderHistory returns the index of the first entry after from that starts
+// with prefix, or -1.
+func olderHistory(entries []string, from int, prefix string) int {
+	for i := from + 1; i < len(entries); i++ {
+		if strings.HasPrefix(entries[i], prefix) {
+			return i
+		}
+	}
+	return -1
+}
+
+// newerHistory returns the index of the last entry before from that starts
+// with prefix, or -1.
+func newerHistory(entries []string, from int, prefix string) int {
+	if from > len(entries) {
+		from = len(entries)
+	}
+	for i := from - 1; i >= 0; i-- {
+		if strings.HasPrefix(entries[i], prefix) {
+			return i
+		}
+	}
+	return -1
+}
+
+// searchHistory returns the index of the first entry, starting at from, that
+// contains query, or -1.
+func searchHistory(entries []string, from int, query string) int {
+	if from < 0 {
+		from = 0
+	}
+	for i := from; i < len(entries); i++ {
+		if strings.Contains(entries[i], query) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (w *Widget) setTextAndCursor(txt string, pos int, app gowid.IApp) {
+	w.ed.SetText(txt, app)
+	w.ed.SetCursorPos(pos, app)
+}
+
+// historyOlder replaces the command line with the previous command run that
+// starts with what the user typed before navigating the history.
+func (w *Widget) historyOlder(app gowid.IApp) {
+	entries := w.history.Entries()
+	if w.histIdx == -1 {
+		w.histTyped = w.ed.Text()
+	}
+	if i := olderHistory(entries, w.histIdx, w.histTyped); i != -1 {
+		w.histIdx = i
+		w.setTextAndCursor(entries[i], len(entries[i]), app)
+	}
+}
+
+// historyNewer moves back towards the most recent command, and then to what
+// the user had typed.
+func (w *Widget) historyNewer(app gowid.IApp) {
+	entries := w.history.Entries()
+	if i := newerHistory(entries, w.histIdx, w.histTyped); i != -1 {
+		w.histIdx = i
+		w.setTextAndCursor(entries[i], len(entries[i]), app)
+	} else {
+		w.histIdx = -1
+		w.setTextAndCursor(w.histTyped, len(w.histTyped), app)
+	}
+}
+
+//======================================================================
+
+// Reverse incremental search, like ctrl-r in bash
+
+func (w *Widget) startSearch(app gowid.IApp) {
+	w.searching = true
+	w.searchQuery = ""
+	w.searchIdx = 0
+	w.searchSaved = w.ed.Text()
+	w.histIdx = -1
+	w.ed.SetCaption(searchCaption("", true), app)
+}
+
+func (w *Widget) endSearch(app gowid.IApp) {
+	w.searching = false
+	w.ed.SetCaption(":", app)
+}
+
+func searchCaption(query string, found bool) string {
+	if found {
+		return fmt.Sprintf("(reverse-i-search)`%s': ", query)
+	}
+	return fmt.Sprintf("(failed reverse-i-search)`%s': ", query)
+}
+
+func (w *Widget) findInHistory(from int, app gowid.IApp) {
+	entries := w.history.Entries()
+	i := searchHistory(entries, from, w.searchQuery)
+	if i != -1 {
+		w.searchIdx = i
+		w.setTextAndCursor(entries[i], strings.Index(entries[i], w.searchQuery), app)
+	}
+	w.ed.SetCaption(searchCaption(w.searchQuery, i != -1), app)
+}
+
+// handleSearchKey processes a key while searching. If it returns false, the
+// search has ended with the match accepted, and the key should be processed
+// as usual - so enter runs the command found.
+func (w *Widget) handleSearchKey(ev *tcell.EventKey, app gowid.IApp) bool {
+	switch ev.Key() {
+	case tcell.KeyCtrlR:
+		if w.searchQuery != "" {
+			w.findInHistory(w.searchIdx+1, app)
+		}
+	case tcell.KeyRune:
+		w.searchQuery += string(ev.Rune())
+		w.findInHistory(w.searchIdx, app)
+	case tcell.KeyBackspace, tcell.KeyBackspace2:
+		if w.searchQuery != "" {
+			q := []rune(w.searchQuery)
+			w.searchQuery = string(q[:len(q)-1])
+			if w.searchQuery == "" {
+				w.searchIdx = 0
+				w.setTextAndCursor(w.searchSaved, len(w.searchSaved), app)
+				w.ed.SetCaption(searchCaption("", true), app)
+			} else {
+				w.findInHistory(0, app)
+			}
+		}
+	case tcell.KeyCtrlG, tcell.KeyEscape:
+		w.endSearch(app)
+		w.setTextAndCursor(w.searchSaved, len(w.searchSaved), app)
+	default:
+		w.endSearch(app)
+		return false
+	}
+	return true
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 78
+// End:
@@ -0,0 +1,47 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+package minibuffer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+//======================================================================
+
+var testHistory = []string{
+	"filter tcp",
+	"set dark-mode on",
+	`filter "udp and ip.addr == 10.0.0.1"`,
+	"map <f5> <tab><tab><down><tab>",
+}
+
+func TestHistoryNavigation1(t *testing.T) {
+	assert.Equal(t, 0, olderHistory(testHistory, -1, ""))
+	assert.Equal(t, 1, olderHistory(testHistory, 0, ""))
+	assert.Equal(t, -1, olderHistory(testHistory, 3, ""))
+
+	// Only lines starting with what was typed
+	assert.Equal(t, 2, olderHistory(testHistory, 0, "filter"))
+	assert.Equal(t, -1, olderHistory(testHistory, 2, "filter"))
+	assert.Equal(t, 0, newerHistory(testHistory, 2, "filter"))
+	assert.Equal(t, -1, newerHistory(testHistory, 0, "filter"))
+	assert.Equal(t, 3, newerHistory(testHistory, 10, "map"))
+}
+
+func TestHistorySearch1(t *testing.T) {
+	assert.Equal(t, 2, searchHistory(testHistory, 0, "udp"))
+	assert.Equal(t, 0, searchHistory(testHistory, -1, "filter"))
+	assert.Equal(t, 2, searchHistory(testHistory, 1, "filter"))
+	assert.Equal(t, -1, searchHistory(testHistory, 3, "filter"))
+	assert.Equal(t, -1, searchHistory(testHistory, 0, "sctp"))
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 78
+// End:
@@ -6,6 +6,7 @@
 package minibuffer
 
 import (
+	"fmt"
 	"regexp"
 	"sort"
 	"strings"
@@ -43,7 +44,14 @@ type Widget struct {
 	// want to display all completions if the buffer is empty because it fills the screen
 	// and looks ugly. So this is a hack to allow the completions to be displayed
 	// via the tab key
-	actions map[string]IAction
+	actions     map[string]IAction
+	history     IHistory
+	histIdx     int    // index of the history entry shown, or -1 if not navigating the history
+	histTyped   string // what the user typed before navigating the history
+	searching   bool   // true during a ctrl-r search of the history
+	searchQuery string
+	searchIdx   int
+	searchSaved string // the command line before the search began
 }
 
 var _ gowid.IWidget = (*Widget)(nil)
@@ -102,15 +110,41 @@ func (w *keysWidget) UserInput(ev interface{}, size gowid.IRenderSize, focus gow
 	res := false
 	switch ev := ev.(type) {
 	case *tcell.EventKey:
+		if w.outer.searching && w.outer.handleSearchKey(ev, app) {
+			w.Widget.SetFocus(app, 1)
+			return true
+		}
 		switch ev.Key() {
 		case tcell.KeyRune:
+			w.outer.histIdx = -1
 			res = w.bottom.UserInput(ev, size, focus, app)
-		case tcell.KeyDown, tcell.KeyCtrlN, tcell.KeyUp, tcell.KeyCtrlP:
+		case tcell.KeyUp:
+			// Up recalls earlier commands unless the user is choosing a completion
+			if w.outer.history != nil && (w.outer.histIdx != -1 || w.outer.selections == nil) {
+				w.outer.historyOlder(app)
+				res = true
+			} else {
+				res = w.top.UserInput(ev, size, focus, app)
+			}
+		case tcell.KeyDown:
+			if w.outer.history != nil && w.outer.histIdx != -1 {
+				w.outer.historyNewer(app)
+				res = true
+			} else {
+				res = w.top.UserInput(ev, size, focus, app)
+			}
+		case tcell.KeyCtrlN, tcell.KeyCtrlP:
 			res = w.top.UserInput(ev, size, focus, app)
+		case tcell.KeyCtrlR:
+			if w.outer.history != nil {
+				w.outer.startSearch(app)
+				res = true
+			}
 		case tcell.KeyTAB, tcell.KeyEnter:
 			w.outer.handleSelection(ev.Key() == tcell.KeyEnter, app)
 			res = true
 		case tcell.KeyBackspace, tcell.KeyBackspace2:
+			w.outer.histIdx = -1
 			if w.outer.ed.Text() == "" {
 				if w.outer.IsOpen() {
 					w.outer.Close(app)
@@ -183,6 +217,7 @@ func New() *Widget {
 		ed:      editW,
 		pl:      bufferW,
 		actions: make(map[string]IAction),
+		histIdx: -1,
 	}
 	return res
 }
@@ -196,13 +231,7 @@ func (w *Widget) handleSelection(keyIsEnter bool, app gowid.IApp) {
 		selectedIdx = int(w.selections.Walker().Focus().(list.ListPos))
 	}
 
-	wordMatchesS := wordExp.FindAllStringSubmatch(w.ed.Text(), -1)
-	words := make([]string, 0, len(wordMatchesS))
-	for _, m := range wordMatchesS {
-		if m[2] != "" {
-			words = append(words, strings.TrimPrefix(strings.TrimSuffix(m[2], "\""), "\"")) // make a list of the words in the minibuffer
-		}
-	}
+	words := SplitWords(w.ed.Text()) // make a list of the words in the minibuffer
 
 	switch {
 	// how many words are in the edit box
@@ -213,26 +242,14 @@ func (w *Widget) handleSelection(keyIsEnter bool, app gowid.IApp) {
 		case 0:
 			// "load /tmp/foo" and []  - just run what the user typed if the key was enter
 			if act, ok := w.actions[words[0]]; ok && keyIsEnter {
-				err := act.Run(app, words...)
-				if err == nil {
-					// Run the command, let it handle errors
-					if w.IsOpen() {
-						w.Close(app)
-					}
-				}
+				w.run(act, app, words...)
 			}
 		default:
 			// if the last word exactly equals the one selected in the partials, just run on enter
 			if words[len(words)-1] == partials[selectedIdx].word && keyIsEnter {
 				// "load /tmp/foo.pcap" and ["/tmp/foo.pcap"]
 				if act, ok := w.actions[words[0]]; ok {
-					err := act.Run(app, words...)
-					if err == nil {
-						// Run the command, let it handle errors
-						if w.IsOpen() {
-							w.Close(app)
-						}
-					}
+					w.run(act, app, words...)
 				}
 			} else {
 				// Otherwise, tab complete
@@ -252,24 +269,13 @@ func (w *Widget) handleSelection(keyIsEnter bool, app gowid.IApp) {
 		switch len(partials) {
 		case 0:
 			if act, ok := w.actions[words[0]]; ok && keyIsEnter {
-				err := act.Run(app, words...)
-				if err == nil {
-					// Run the command, let it handle errors
-					if w.IsOpen() {
-						w.Close(app)
-					}
-				}
+				w.run(act, app, words...)
 			}
 		default:
 			if words[len(words)-1] == partials[selectedIdx].word && keyIsEnter {
 				act := w.actions[partials[selectedIdx].word]
 				if len(act.Arguments([]string{}, app)) == 0 {
-					err := w.actions[partials[selectedIdx].word].Run(app, partials[selectedIdx].word)
-					if err == nil {
-						if w.IsOpen() {
-							w.Close(app)
-						}
-					}
+					w.run(act, app, partials[selectedIdx].word)
 				}
 			} else {
 				if keyIsEnter {
@@ -321,11 +327,66 @@ func (w *Widget) handleSelection(keyIsEnter bool, app gowid.IApp) {
 	}
 }
 
+// run runs a command the user has entered, and remembers it in the history.
+// The minibuffer is closed if the command succeeds; the command reports its
+// own errors.
+func (w *Widget) run(act IAction, app gowid.IApp, words ...string) {
+	if w.history != nil {
+		w.history.Add(strings.TrimSpace(w.ed.Text()))
+	}
+	err := act.Run(app, words...)
+	if err == nil {
+		if w.IsOpen() {
+			w.Close(app)
+		}
+	}
+}
+
 // Not thread-safe, manage via App perhaps
 func (w *Widget) Register(name string, action IAction) {
 	w.actions[name] = action
 }
 
+// Invoke runs a registered command as if the user had typed it in full and
+// hit enter. The first word is the command name e.g. "set", "dark-mode", "on".
+// Call from the app goroutine.
+func (w *Widget) Invoke(app gowid.IApp, words ...string) error {
+	if len(words) == 0 {
+		return fmt.Errorf("No command provided")
+	}
+	act, ok := w.actions[words[0]]
+	if !ok {
+		return fmt.Errorf("Unknown command %s", words[0])
+	}
+	return act.Run(app, words...)
+}
+
+// Commands returns the name of every registered command, sorted.
+func (w *Widget) Commands() []string {
+	res := make([]string, 0, len(w.actions))
+	for name := range w.actions {
+		res = append(res, name)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// TakesArguments returns true if the named command offers arguments to
+// complete.
+func (w *Widget) TakesArguments(name string, app gowid.IApp) bool {
+	act, ok := w.actions[name]
+	if !ok {
+		return false
+	}
+	return len(act.Arguments([]string{""}, app)) > 0
+}
+
+// SetCommandLine replaces what the user has typed with txt, leaving the
+// cursor at the end.
+func (w *Widget) SetCommandLine(txt string, app gowid.IApp) {
+	w.setTextAndCursor(txt, len(txt), app)
+}
+
 func (w *Widget) getPartialsCompletions(checkOffer bool, app gowid.IApp) []partial {
 	txt := w.ed.Text()
 	partials := make([]partial, 0)
@@ -0,0 +1,63 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+package minibuffer
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+//======================================================================
+
+// ScriptLine is a command read from a script of minibuffer commands.
+type ScriptLine struct {
+	Num   int // line number in the script, from 1
+	Words []string
+}
+
+// SplitWords breaks a minibuffer command line into words. Double quotes
+// group words containing spaces e.g. filter "tcp and udp".
+func SplitWords(line string) []string {
+	wordMatchesS := wordExp.FindAllStringSubmatch(line, -1)
+	words := make([]string, 0, len(wordMatchesS))
+	for _, m := range wordMatchesS {
+		if m[2] != "" {
+			words = append(words, strings.TrimPrefix(strings.TrimSuffix(m[2], "\""), "\""))
+		}
+	}
+	return words
+}
+
+// ReadScript reads a script of minibuffer commands, one per line. Blank
+// lines and lines starting with # are skipped. A leading : is allowed, as
+// if the command had been typed in the minibuffer.
+func ReadScript(r io.Reader) ([]ScriptLine, error) {
+	res := make([]ScriptLine, 0)
+	scanner := bufio.NewScanner(r)
+	num := 0
+	for scanner.Scan() {
+		num++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		words := SplitWords(strings.TrimPrefix(line, ":"))
+		if len(words) == 0 {
+			continue
+		}
+		res = append(res, ScriptLine{Num: num, Words: words})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 78
+// End:
@@ -0,0 +1,42 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+package minibuffer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+//======================================================================
+
+func TestSplitWords1(t *testing.T) {
+	assert.Equal(t, []string{"set", "dark-mode", "on"}, SplitWords("set dark-mode  on"))
+	assert.Equal(t, []string{"filter", "tcp and udp"}, SplitWords(`filter "tcp and udp"`))
+	assert.Equal(t, []string{}, SplitWords("   "))
+}
+
+func TestReadScript1(t *testing.T) {
+	script := `# set things up
+set dark-mode on
+
+:theme dracula
+  filter "ip.addr == 10.0.0.1"
+`
+	lines, err := ReadScript(strings.NewReader(script))
+	assert.NoError(t, err)
+	assert.Equal(t, []ScriptLine{
+		{Num: 2, Words: []string{"set", "dark-mode", "on"}},
+		{Num: 4, Words: []string{"theme", "dracula"}},
+		{Num: 5, Words: []string{"filter", "ip.addr == 10.0.0.1"}},
+	}, lines)
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 78
+// End:
@@ -250,8 +250,10 @@ type Widget struct {
 	completer       fields.IPrefixCompleter
 	cols            *columns.Widget
 	findBtn         *disable.Widget
+	searchTypeBtn   *button.Widget
 	searchTargetBtn *button.Widget
 	dataBtn         *button.Widget
+	caseCheck       *checkbox.Widget
 	validator       filter.IValidator
 	errHandler      IErrorHandler
 	alg             IAlgorithm
@@ -379,6 +381,8 @@ func New(alg IAlgorithm,
 		),
 	)
 
+	res.searchTypeBtn = searchTypeB
+
 	mymenu := buildSearchTypeMenu(searchTypeB, men, res)
 
 	searchTypeBtnSite := menu.NewSite(menu.SiteOptions{YOffset: 1})
@@ -446,6 +450,7 @@ func New(alg IAlgorithm,
 	caseCheck.OnClick(gowid.WidgetCallback{"cb", func(app gowid.IApp, _ gowid.IWidget) {
 		res.SetCaseSensitive(caseCheck.IsChecked())
 	}})
+	res.caseCheck = caseCheck
 
 	caseLabel := text.New(" Case Sens ")
 	caseW := hpadding.New(
@@ -583,6 +588,10 @@ func (w *Widget) Value() string {
 	return w.filt.Value()
 }
 
+func (w *Widget) InsertValue(val string, app gowid.IApp) {
+	w.filt.InsertValue(val, app)
+}
+
 func (w *Widget) CaseSensitive() bool {
 	return profiles.ConfBool("main.search-case-sensitive", false)
 }
@@ -591,6 +600,38 @@ func (w *Widget) SetCaseSensitive(val bool) {
 	profiles.SetConf("main.search-case-sensitive", val)
 }
 
+// SearchType returns the kind of search - filter, hex, string or regex.
+func (w *Widget) SearchType() string {
+	return getSearchType()
+}
+
+// SearchTarget returns what is searched - list, details or bytes.
+func (w *Widget) SearchTarget() string {
+	return getSearchTarget()
+}
+
+// SetSearch changes the kind of search, what is searched and its case
+// sensitivity, as if each had been chosen using the widget's buttons.
+func (w *Widget) SetSearch(stype string, target string, caseSensitive bool, app gowid.IApp) {
+	if _, ok := searchTypeMap[stype]; ok {
+		profiles.SetConf("main.search-type", stype)
+		w.searchTypeBtn.SetSubWidget(text.New(searchTypeMap[stype]), app)
+	}
+	if _, ok := searchTargetMap[target]; ok {
+		profiles.SetConf("main.search-target", target)
+		w.searchTargetBtn.SetSubWidget(text.New(searchTargetMap[target]), app)
+	}
+	w.SetCaseSensitive(caseSensitive)
+	w.caseCheck.SetChecked(app, caseSensitive)
+
+	w.validator = getValidator()
+	fval := w.Value()
+	w.Close(app)
+	w.setFilter(w.validator, w.getCompleter(), app)
+	w.SetValue(fval, app)
+	w.updateSearchTargetFromConf(app)
+}
+
 func (w *Widget) Open(app gowid.IApp) {
 	filt := filter.New("searchfilter", filter.Options{
 		MenuOpener: w.menuOpener,